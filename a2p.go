@@ -0,0 +1,558 @@
+package smspit
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// A2P 10DLC modes: what happens to messages from unregistered US long codes
+// to US numbers. In SMSPIT_A2P_NUMBERS, registered marks a number as
+// registered without a campaign.
+const (
+	a2pOff        = "off"
+	a2pThrottle   = "throttle"
+	a2pReject     = "reject"
+	a2pRegistered = "registered"
+)
+
+// Brand and campaign registration statuses. Only numbers in a verified
+// campaign of an approved brand count as registered.
+const (
+	brandApproved    = "approved"
+	brandPending     = "pending"
+	brandFailed      = "failed"
+	campaignVerified = "verified"
+	campaignPending  = "pending"
+	campaignFailed   = "failed"
+)
+
+// campaignUseCases are the standard 10DLC campaign use cases
+var campaignUseCases = []string{
+	"2FA", "ACCOUNT_NOTIFICATION", "CUSTOMER_CARE", "DELIVERY_NOTIFICATION", "FRAUD_ALERT",
+	"HIGHER_EDUCATION", "LOW_VOLUME", "MARKETING", "MIXED", "POLLING_VOTING",
+	"PUBLIC_SERVICE_ANNOUNCEMENT", "SECURITY_ALERT",
+}
+
+// Brand is a stub A2P 10DLC brand registration
+type Brand struct {
+	SID       string    `json:"sid"`
+	Name      string    `json:"name"`
+	Status    string    `json:"status"` // approved, pending or failed
+	Project   string    `json:"project"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// BrandRequest is the body for registering or updating a brand. Brands are
+// approved unless a status is given.
+type BrandRequest struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
+
+// Campaign is a stub A2P 10DLC campaign, registering the numbers that send
+// under one of a brand's use cases
+type Campaign struct {
+	SID         string    `json:"sid"`
+	BrandSID    string    `json:"brand_sid"`
+	UseCase     string    `json:"use_case"`
+	Description string    `json:"description,omitempty"`
+	Numbers     []string  `json:"numbers"`
+	Status      string    `json:"status"` // verified, pending or failed
+	Project     string    `json:"project"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// CampaignRequest is the body for registering or updating a campaign.
+// Campaigns are verified unless a status is given.
+type CampaignRequest struct {
+	BrandSID    string   `json:"brand_sid"`
+	UseCase     string   `json:"use_case"`
+	Description string   `json:"description"`
+	Numbers     []string `json:"numbers"`
+	Status      string   `json:"status"`
+}
+
+// a2pStore holds the registered brands and campaigns, in the order added
+type a2pStore struct {
+	mu        sync.Mutex
+	brands    []*Brand
+	campaigns []*Campaign
+}
+
+// UnregisteredSenderError is returned in reject mode when capturing a
+// message from an unregistered US long code to a US number
+type UnregisteredSenderError struct {
+	From string
+}
+
+func (e *UnregisteredSenderError) Error() string {
+	return fmt.Sprintf(twilioErrorCatalog[30034].Message, e.From)
+}
+
+// parseA2PNumbers parses "number=mode,..." into per-number A2P modes
+func parseA2PNumbers(val string) map[string]string {
+	modes := make(map[string]string)
+	for _, entry := range strings.Split(val, ",") {
+		number, mode, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			continue
+		}
+		mode = strings.ToLower(strings.TrimSpace(mode))
+		if mode != a2pThrottle && mode != a2pReject && mode != a2pRegistered {
+			log.Printf("⚠️ Ignoring invalid SMSPIT_A2P_NUMBERS entry %q (use registered, throttle or reject)", entry)
+			continue
+		}
+		modes[strings.TrimSpace(number)] = mode
+	}
+	return modes
+}
+
+// usLongCode reports whether number is a US or Canadian 10-digit number
+// other than a toll-free one
+func usLongCode(number string) bool {
+	code, national, ok := splitCallingCode(number)
+	if !ok || code != "1" || !e164Number.MatchString(number) || len(national) != 10 {
+		return false
+	}
+	for _, prefix := range tollFreePrefixes {
+		if strings.HasPrefix(national, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// a2pMode returns what happens to a message from sender to recipient in
+// project: throttle or reject for an unregistered US long code sending to
+// a US number, and off otherwise. Numbers in SMSPIT_A2P_NUMBERS use their
+// own mode.
+func (s *Server) a2pMode(project, sender, recipient string) string {
+	if !usLongCode(sender) {
+		return a2pOff
+	}
+	if code, _, ok := splitCallingCode(recipient); !ok || code != "1" {
+		return a2pOff
+	}
+	mode, ok := s.config.A2PNumbers[sender]
+	if !ok {
+		if s.config.A2PMode == a2pOff {
+			return a2pOff
+		}
+		if _, registered := s.a2pCampaign(project, sender); registered {
+			return a2pOff
+		}
+		mode = s.config.A2PMode
+	}
+	if mode == a2pRegistered {
+		return a2pOff
+	}
+	return mode
+}
+
+// a2pThrottling reports whether any sender can be throttled, so the rate
+// limiter has to look at requests
+func (s *Server) a2pThrottling() bool {
+	if s.config.A2PMode == a2pThrottle {
+		return true
+	}
+	for _, mode := range s.config.A2PNumbers {
+		if mode == a2pThrottle {
+			return true
+		}
+	}
+	return false
+}
+
+// a2pCampaign returns the SID of the campaign number is registered with in
+// project, and whether that registration is complete: the campaign is
+// verified and its brand approved
+func (s *Server) a2pCampaign(project, number string) (string, bool) {
+	s.a2p.mu.Lock()
+	defer s.a2p.mu.Unlock()
+
+	for _, campaign := range s.a2p.campaigns {
+		if campaign.Project != project {
+			continue
+		}
+		for _, n := range campaign.Numbers {
+			if n != number {
+				continue
+			}
+			brand := s.a2p.findBrand(project, campaign.BrandSID)
+			return campaign.SID, campaign.Status == campaignVerified && brand != nil && brand.Status == brandApproved
+		}
+	}
+	return "", false
+}
+
+// checkA2P refuses an outbound message from an unregistered US long code to
+// a US number in reject mode. Throttling is done by the rate limiter.
+func (s *Server) checkA2P(msg Message) error {
+	if msg.Direction != "outbound" || s.a2pMode(msg.Project, msg.From, msg.To) != a2pReject {
+		return nil
+	}
+	log.Printf("🪪 Message from unregistered number %s to %s refused", msg.From, msg.To)
+	return &UnregisteredSenderError{From: msg.From}
+}
+
+// writeUnregisteredSenderError answers a capture request from an
+// unregistered number in the provider's error format (Twilio code 30034)
+func writeUnregisteredSenderError(w http.ResponseWriter, r *http.Request, err *UnregisteredSenderError) {
+	writeProviderError(w, r, http.StatusBadRequest, 30034, err.Error(), 0)
+}
+
+// findBrand returns the project's brand with the given SID. Callers must
+// hold mu.
+func (st *a2pStore) findBrand(project, sid string) *Brand {
+	for _, brand := range st.brands {
+		if brand.Project == project && brand.SID == sid {
+			return brand
+		}
+	}
+	return nil
+}
+
+// findCampaign returns the project's campaign with the given SID. Callers
+// must hold mu.
+func (st *a2pStore) findCampaign(project, sid string) *Campaign {
+	for _, campaign := range st.campaigns {
+		if campaign.Project == project && campaign.SID == sid {
+			return campaign
+		}
+	}
+	return nil
+}
+
+// newBrand validates req
+func newBrand(req BrandRequest, project string) (*Brand, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, fmt.Errorf("Missing 'name' field")
+	}
+	status := strings.ToLower(req.Status)
+	if status == "" {
+		status = brandApproved
+	}
+	if status != brandApproved && status != brandPending && status != brandFailed {
+		return nil, fmt.Errorf("Invalid 'status' field (approved, pending or failed)")
+	}
+	return &Brand{
+		SID:       "BN" + strings.ReplaceAll(uuid.New().String(), "-", ""),
+		Name:      name,
+		Status:    status,
+		Project:   project,
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+// newCampaign validates req. Callers must hold the store's mu, as the brand
+// has to exist and the numbers can't be in another of the project's
+// campaigns (other than the one with the SID skip).
+func (st *a2pStore) newCampaign(req CampaignRequest, project, skip string) (*Campaign, int, error) {
+	if st.findBrand(project, req.BrandSID) == nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("Unknown 'brand_sid' %q", req.BrandSID)
+	}
+	useCase := strings.ToUpper(req.UseCase)
+	known := false
+	for _, u := range campaignUseCases {
+		known = known || u == useCase
+	}
+	if !known {
+		return nil, http.StatusBadRequest, fmt.Errorf("Invalid 'use_case' field (%s)", strings.Join(campaignUseCases, ", "))
+	}
+	status := strings.ToLower(req.Status)
+	if status == "" {
+		status = campaignVerified
+	}
+	if status != campaignVerified && status != campaignPending && status != campaignFailed {
+		return nil, http.StatusBadRequest, fmt.Errorf("Invalid 'status' field (verified, pending or failed)")
+	}
+
+	numbers := []string{}
+	seen := make(map[string]bool)
+	for _, number := range req.Numbers {
+		if !usLongCode(number) {
+			return nil, http.StatusBadRequest, fmt.Errorf("Invalid number %q (10DLC campaigns register US long codes, e.g. +15551234567)", number)
+		}
+		if seen[number] {
+			continue
+		}
+		seen[number] = true
+		for _, other := range st.campaigns {
+			if other.Project != project || other.SID == skip {
+				continue
+			}
+			for _, n := range other.Numbers {
+				if n == number {
+					return nil, http.StatusConflict, fmt.Errorf("Number %s is already registered with campaign %s", number, other.SID)
+				}
+			}
+		}
+		numbers = append(numbers, number)
+	}
+
+	return &Campaign{
+		SID:         "QE" + strings.ReplaceAll(uuid.New().String(), "-", ""),
+		BrandSID:    req.BrandSID,
+		UseCase:     useCase,
+		Description: req.Description,
+		Numbers:     numbers,
+		Status:      status,
+		Project:     project,
+		CreatedAt:   time.Now(),
+	}, http.StatusCreated, nil
+}
+
+// handleListBrands lists the project's brands
+func (s *Server) handleListBrands(w http.ResponseWriter, r *http.Request) {
+	project := projectFromRequest(r)
+
+	s.a2p.mu.Lock()
+	defer s.a2p.mu.Unlock()
+
+	brands := []*Brand{}
+	for _, brand := range s.a2p.brands {
+		if brand.Project == project {
+			brands = append(brands, brand)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"brands": brands,
+		"total":  len(brands),
+	})
+}
+
+// handleCreateBrand registers a brand
+func (s *Server) handleCreateBrand(w http.ResponseWriter, r *http.Request) {
+	var req BrandRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	brand, err := newBrand(req, projectFromRequest(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	defer s.syncRecords(kindBrands, kindCampaigns)
+	s.a2p.mu.Lock()
+	defer s.a2p.mu.Unlock()
+	s.a2p.brands = append(s.a2p.brands, brand)
+	log.Printf("🪪 Brand registered: %s (%s)", brand.Name, brand.Status)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(brand)
+}
+
+// handleGetBrand returns one of the project's brands
+func (s *Server) handleGetBrand(w http.ResponseWriter, r *http.Request) {
+	s.a2p.mu.Lock()
+	defer s.a2p.mu.Unlock()
+
+	brand := s.a2p.findBrand(projectFromRequest(r), mux.Vars(r)["sid"])
+	if brand == nil {
+		http.Error(w, "Brand not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(brand)
+}
+
+// handleUpdateBrand replaces a brand's name and status, e.g. to fail its
+// vetting
+func (s *Server) handleUpdateBrand(w http.ResponseWriter, r *http.Request) {
+	var req BrandRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	defer s.syncRecords(kindBrands, kindCampaigns)
+	s.a2p.mu.Lock()
+	defer s.a2p.mu.Unlock()
+
+	brand := s.a2p.findBrand(projectFromRequest(r), mux.Vars(r)["sid"])
+	if brand == nil {
+		http.Error(w, "Brand not found", http.StatusNotFound)
+		return
+	}
+	updated, err := newBrand(req, brand.Project)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	updated.SID, updated.CreatedAt = brand.SID, brand.CreatedAt
+	*brand = *updated
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(brand)
+}
+
+// handleDeleteBrand removes a brand without campaigns
+func (s *Server) handleDeleteBrand(w http.ResponseWriter, r *http.Request) {
+	project, sid := projectFromRequest(r), mux.Vars(r)["sid"]
+
+	defer s.syncRecords(kindBrands, kindCampaigns)
+	s.a2p.mu.Lock()
+	defer s.a2p.mu.Unlock()
+
+	for _, campaign := range s.a2p.campaigns {
+		if campaign.Project == project && campaign.BrandSID == sid {
+			http.Error(w, "Brand has campaigns; delete them first", http.StatusConflict)
+			return
+		}
+	}
+	for i, brand := range s.a2p.brands {
+		if brand.Project == project && brand.SID == sid {
+			s.a2p.brands = append(s.a2p.brands[:i], s.a2p.brands[i+1:]...)
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
+			return
+		}
+	}
+
+	http.Error(w, "Brand not found", http.StatusNotFound)
+}
+
+// handleListCampaigns lists the project's campaigns, optionally only a
+// brand's (?brand_sid=)
+func (s *Server) handleListCampaigns(w http.ResponseWriter, r *http.Request) {
+	project, brandSID := projectFromRequest(r), r.URL.Query().Get("brand_sid")
+
+	s.a2p.mu.Lock()
+	defer s.a2p.mu.Unlock()
+
+	campaigns := []*Campaign{}
+	for _, campaign := range s.a2p.campaigns {
+		if campaign.Project == project && (brandSID == "" || campaign.BrandSID == brandSID) {
+			campaigns = append(campaigns, campaign)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"campaigns": campaigns,
+		"total":     len(campaigns),
+	})
+}
+
+// handleCreateCampaign registers a campaign and its numbers
+func (s *Server) handleCreateCampaign(w http.ResponseWriter, r *http.Request) {
+	var req CampaignRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	defer s.syncRecords(kindBrands, kindCampaigns)
+	s.a2p.mu.Lock()
+	defer s.a2p.mu.Unlock()
+
+	campaign, status, err := s.a2p.newCampaign(req, projectFromRequest(r), "")
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	s.a2p.campaigns = append(s.a2p.campaigns, campaign)
+	log.Printf("🪪 Campaign registered: %s %s with %d number(s) (%s)", campaign.SID, campaign.UseCase, len(campaign.Numbers), campaign.Status)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(campaign)
+}
+
+// handleGetCampaign returns one of the project's campaigns
+func (s *Server) handleGetCampaign(w http.ResponseWriter, r *http.Request) {
+	s.a2p.mu.Lock()
+	defer s.a2p.mu.Unlock()
+
+	campaign := s.a2p.findCampaign(projectFromRequest(r), mux.Vars(r)["sid"])
+	if campaign == nil {
+		http.Error(w, "Campaign not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(campaign)
+}
+
+// handleUpdateCampaign replaces a campaign's details, e.g. to add numbers or
+// move it to failed
+func (s *Server) handleUpdateCampaign(w http.ResponseWriter, r *http.Request) {
+	var req CampaignRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	defer s.syncRecords(kindBrands, kindCampaigns)
+	s.a2p.mu.Lock()
+	defer s.a2p.mu.Unlock()
+
+	campaign := s.a2p.findCampaign(projectFromRequest(r), mux.Vars(r)["sid"])
+	if campaign == nil {
+		http.Error(w, "Campaign not found", http.StatusNotFound)
+		return
+	}
+	updated, status, err := s.a2p.newCampaign(req, campaign.Project, campaign.SID)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	updated.SID, updated.CreatedAt = campaign.SID, campaign.CreatedAt
+	*campaign = *updated
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(campaign)
+}
+
+// handleDeleteCampaign removes a campaign, unregistering its numbers
+func (s *Server) handleDeleteCampaign(w http.ResponseWriter, r *http.Request) {
+	project, sid := projectFromRequest(r), mux.Vars(r)["sid"]
+
+	defer s.syncRecords(kindBrands, kindCampaigns)
+	s.a2p.mu.Lock()
+	defer s.a2p.mu.Unlock()
+
+	for i, campaign := range s.a2p.campaigns {
+		if campaign.Project == project && campaign.SID == sid {
+			s.a2p.campaigns = append(s.a2p.campaigns[:i], s.a2p.campaigns[i+1:]...)
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
+			return
+		}
+	}
+
+	http.Error(w, "Campaign not found", http.StatusNotFound)
+}
+
+// handleA2PNumber reports a sender's registration and what happens to its
+// messages to US numbers
+func (s *Server) handleA2PNumber(w http.ResponseWriter, r *http.Request) {
+	project, number := projectFromRequest(r), mux.Vars(r)["number"]
+
+	resp := map[string]interface{}{
+		"number":     number,
+		"registered": false,
+		"mode":       s.a2pMode(project, number, "+12025550100"), // Any US recipient
+	}
+	if campaignSID, registered := s.a2pCampaign(project, number); campaignSID != "" {
+		resp["campaign_sid"] = campaignSID
+		resp["registered"] = registered
+	}
+	if mode := s.config.A2PNumbers[number]; mode != "" {
+		resp["configured"] = mode
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,158 @@
+package smspit
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// registerA2P registers a brand and a campaign for numbers with the given
+// statuses, returning the brand and campaign SIDs
+func (ts *testServer) registerA2P(t *testing.T, brandStatus, campaignStatus string, numbers ...string) (string, string) {
+	t.Helper()
+	w := do(t, ts.web, "POST", "/api/v1/a2p/brands", `{"name":"Acme","status":"`+brandStatus+`"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create brand: %d %s", w.Code, w.Body)
+	}
+	var brand Brand
+	decode(t, w, &brand)
+	w = do(t, ts.web, "POST", "/api/v1/a2p/campaigns",
+		`{"brand_sid":"`+brand.SID+`","use_case":"2fa","numbers":["`+strings.Join(numbers, `","`)+`"],"status":"`+campaignStatus+`"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create campaign: %d %s", w.Code, w.Body)
+	}
+	var campaign Campaign
+	decode(t, w, &campaign)
+	return brand.SID, campaign.SID
+}
+
+func TestA2PEnforcement(t *testing.T) {
+	const sender = "+15550001111"
+
+	tests := []struct {
+		name     string
+		mode     string
+		numbers  map[string]string
+		brand    string // Brand and campaign status registering sender, if set
+		campaign string
+		from, to string
+		want     int
+	}{
+		{name: "off", mode: a2pOff, from: sender, to: "+15551230001", want: http.StatusOK},
+		{name: "unregistered", mode: a2pReject, from: sender, to: "+15551230001", want: http.StatusBadRequest},
+		{name: "toll-free sender", mode: a2pReject, from: "+18005550100", to: "+15551230001", want: http.StatusOK},
+		{name: "short code sender", mode: a2pReject, from: "12345", to: "+15551230001", want: http.StatusOK},
+		{name: "non-US recipient", mode: a2pReject, from: sender, to: "+447700900123", want: http.StatusOK},
+		{name: "registered", mode: a2pReject, brand: brandApproved, campaign: campaignVerified, from: sender, to: "+15551230001", want: http.StatusOK},
+		{name: "campaign pending", mode: a2pReject, brand: brandApproved, campaign: campaignPending, from: sender, to: "+15551230001", want: http.StatusBadRequest},
+		{name: "brand failed", mode: a2pReject, brand: brandFailed, campaign: campaignVerified, from: sender, to: "+15551230001", want: http.StatusBadRequest},
+		{name: "configured registered", mode: a2pReject, numbers: map[string]string{sender: a2pRegistered}, from: sender, to: "+15551230001", want: http.StatusOK},
+		{name: "configured reject", mode: a2pOff, numbers: map[string]string{sender: a2pReject}, from: sender, to: "+15551230001", want: http.StatusBadRequest},
+		{name: "configured reject beats registration", mode: a2pOff, numbers: map[string]string{sender: a2pReject}, brand: brandApproved, campaign: campaignVerified, from: sender, to: "+15551230001", want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t, Config{A2PMode: tt.mode, A2PNumbers: tt.numbers})
+			if tt.brand != "" {
+				ts.registerA2P(t, tt.brand, tt.campaign, sender)
+			}
+
+			w := do(t, ts.api, "POST", "/send", `{"to":"`+tt.to+`","from":"`+tt.from+`","body":"Hi"}`)
+			if w.Code != tt.want {
+				t.Fatalf("send: %d %s, want %d", w.Code, w.Body, tt.want)
+			}
+			if tt.want == http.StatusBadRequest && !strings.Contains(w.Body.String(), tt.from) {
+				t.Errorf("error %q doesn't name the sender", w.Body)
+			}
+		})
+	}
+}
+
+func TestA2PProviderErrors(t *testing.T) {
+	ts := newTestServer(t, Config{A2PMode: a2pReject, TwilioCompat: true})
+
+	w := do(t, ts.api, "POST", "/2010-04-01/Accounts/AC1/Messages.json", "To=%2B15551230001&From=%2B15550001111&Body=Hi",
+		"Content-Type", "application/x-www-form-urlencoded")
+	var twilioErr TwilioError
+	decode(t, w, &twilioErr)
+	if w.Code != http.StatusBadRequest || twilioErr.Code != 30034 {
+		t.Errorf("Twilio send: %d %s, want 400 with code 30034", w.Code, w.Body)
+	}
+}
+
+func TestA2PThrottle(t *testing.T) {
+	ts := newTestServer(t, Config{A2PMode: a2pThrottle, A2PThrottleRate: 0.1})
+	send := func(from string) int {
+		return do(t, ts.api, "POST", "/send", `{"to":"+15551230001","from":"`+from+`","body":"Hi"}`).Code
+	}
+
+	if got := send("+15550001111"); got != http.StatusOK {
+		t.Errorf("first send: %d, want 200", got)
+	}
+	if got := send("+15550001111"); got != http.StatusTooManyRequests {
+		t.Errorf("second send from the unregistered number: %d, want 429", got)
+	}
+
+	ts.registerA2P(t, brandApproved, campaignVerified, "+15550002222")
+	for i := 0; i < 3; i++ {
+		if got := send("+15550002222"); got != http.StatusOK {
+			t.Errorf("send %d from the registered number: %d, want 200", i, got)
+		}
+	}
+}
+
+func TestA2PRegistrationAPI(t *testing.T) {
+	ts := newTestServer(t, Config{A2PMode: a2pReject})
+	brandSID, campaignSID := ts.registerA2P(t, brandApproved, campaignVerified, "+15550001111")
+
+	tests := []struct {
+		name, method, path, body string
+		header                   []string
+		want                     int
+		wantBody                 string
+	}{
+		{"brand without a name", "POST", "/api/v1/a2p/brands", `{"name":" "}`, nil, http.StatusBadRequest, "name"},
+		{"brand with an unknown status", "POST", "/api/v1/a2p/brands", `{"name":"Acme","status":"vetted"}`, nil, http.StatusBadRequest, "status"},
+		{"campaign for an unknown brand", "POST", "/api/v1/a2p/campaigns", `{"brand_sid":"BN0","use_case":"2FA"}`, nil, http.StatusBadRequest, "brand_sid"},
+		{"campaign with an unknown use case", "POST", "/api/v1/a2p/campaigns", `{"brand_sid":"` + brandSID + `","use_case":"SPAM"}`, nil, http.StatusBadRequest, "use_case"},
+		{"campaign with a toll-free number", "POST", "/api/v1/a2p/campaigns", `{"brand_sid":"` + brandSID + `","use_case":"2FA","numbers":["+18005550100"]}`, nil, http.StatusBadRequest, "+18005550100"},
+		{"number in another campaign", "POST", "/api/v1/a2p/campaigns", `{"brand_sid":"` + brandSID + `","use_case":"MARKETING","numbers":["+15550001111"]}`, nil, http.StatusConflict, campaignSID},
+		{"brand with campaigns", "DELETE", "/api/v1/a2p/brands/" + brandSID, "", nil, http.StatusConflict, "campaigns"},
+		{"another project's brand", "GET", "/api/v1/a2p/brands/" + brandSID, "", []string{projectHeader, "other"}, http.StatusNotFound, ""},
+		{"another project's campaign", "DELETE", "/api/v1/a2p/campaigns/" + campaignSID, "", []string{projectHeader, "other"}, http.StatusNotFound, ""},
+		{"registered number", "GET", "/api/v1/a2p/numbers/+15550001111", "", nil, http.StatusOK, `"registered":true`},
+		{"unregistered number", "GET", "/api/v1/a2p/numbers/+15550002222", "", nil, http.StatusOK, `"mode":"reject"`},
+		{"number registered in another project", "GET", "/api/v1/a2p/numbers/+15550001111", "", []string{projectHeader, "other"}, http.StatusOK, `"registered":false`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := do(t, ts.web, tt.method, tt.path, tt.body, tt.header...)
+			if w.Code != tt.want || !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("%s %s: %d %s, want %d mentioning %q", tt.method, tt.path, w.Code, w.Body, tt.want, tt.wantBody)
+			}
+		})
+	}
+
+	// Failing the campaign unregisters its numbers
+	w := do(t, ts.web, "PUT", "/api/v1/a2p/campaigns/"+campaignSID, `{"brand_sid":"`+brandSID+`","use_case":"2FA","numbers":["+15550001111"],"status":"failed"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("update campaign: %d %s", w.Code, w.Body)
+	}
+	if w := do(t, ts.api, "POST", "/send", `{"to":"+15551230001","from":"+15550001111","body":"Hi"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("send from the failed campaign's number: %d, want 400", w.Code)
+	}
+
+	if w := do(t, ts.web, "DELETE", "/api/v1/a2p/campaigns/"+campaignSID, ""); w.Code != http.StatusOK {
+		t.Errorf("delete campaign: %d", w.Code)
+	}
+	if w := do(t, ts.web, "DELETE", "/api/v1/a2p/brands/"+brandSID, ""); w.Code != http.StatusOK {
+		t.Errorf("delete brand without campaigns: %d", w.Code)
+	}
+	var list struct {
+		Total int `json:"total"`
+	}
+	decode(t, do(t, ts.web, "GET", "/api/v1/a2p/brands", ""), &list)
+	if list.Total != 0 {
+		t.Errorf("%d brands left, want 0", list.Total)
+	}
+}
@@ -0,0 +1,218 @@
+package smspit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AdapterConfig declares a capture endpoint for a provider SMSpit doesn't
+// know natively. To, From and Body name where each value is found: a dotted
+// JSON path (message.recipients.0) for JSON bodies, otherwise a form or
+// query parameter name.
+type AdapterConfig struct {
+	Name   string `json:"name"`
+	Path   string `json:"path"`
+	Method string `json:"method,omitempty"` // Default POST
+	To     string `json:"to"`
+	From   string `json:"from,omitempty"`
+	Body   string `json:"body"`
+	// Status and Response are the reply. Response is a Go template over
+	// adapterResult; the default is {"id": ..., "count": ...}.
+	Status      int    `json:"status,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Response    string `json:"response,omitempty"`
+}
+
+// adapter is a compiled AdapterConfig
+type adapter struct {
+	AdapterConfig
+	response *template.Template
+}
+
+// adapterResult is the data available to an adapter's response template
+type adapterResult struct {
+	ID        string // First captured message ID
+	IDs       []string
+	To        string // First recipient
+	From      string
+	Body      string
+	Count     int
+	Messages  []Message
+	Timestamp time.Time
+}
+
+// adapterFuncs are the functions available to response templates
+var adapterFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// newAdapter validates an adapter config and compiles its response template
+func newAdapter(config AdapterConfig) (*adapter, error) {
+	if config.Name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	if !strings.HasPrefix(config.Path, "/") {
+		return nil, fmt.Errorf("%s: path must start with /", config.Name)
+	}
+	if config.To == "" || config.Body == "" {
+		return nil, fmt.Errorf("%s: to and body mappings are required", config.Name)
+	}
+	if config.Method == "" {
+		config.Method = "POST"
+	}
+	config.Method = strings.ToUpper(config.Method)
+	if config.Status == 0 {
+		config.Status = http.StatusOK
+	}
+	if config.ContentType == "" {
+		config.ContentType = "application/json"
+	}
+
+	a := &adapter{AdapterConfig: config}
+	if config.Response != "" {
+		tmpl, err := template.New(config.Name).Funcs(adapterFuncs).Parse(config.Response)
+		if err != nil {
+			return nil, fmt.Errorf("%s: response: %w", config.Name, err)
+		}
+		a.response = tmpl
+	}
+	return a, nil
+}
+
+// jsonPath looks up a dotted path in a decoded JSON value; numeric segments
+// index arrays
+func jsonPath(v interface{}, path string) interface{} {
+	for _, key := range strings.Split(path, ".") {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			v = node[key]
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil
+			}
+			v = node[i]
+		default:
+			return nil
+		}
+	}
+	return v
+}
+
+// jsonStrings flattens a JSON value into strings, splitting comma-separated
+// lists
+func jsonStrings(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return splitRecipients(v)
+	case float64:
+		return []string{strconv.FormatFloat(v, 'f', -1, 64)}
+	case []interface{}:
+		var out []string
+		for _, item := range v {
+			out = append(out, jsonStrings(item)...)
+		}
+		return out
+	}
+	return nil
+}
+
+// fields extracts the recipients, sender and body from a request
+func (a *adapter) fields(r *http.Request) (to []string, from, body string, err error) {
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		var payload interface{}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			return nil, "", "", fmt.Errorf("Invalid JSON: %w", err)
+		}
+		to = jsonStrings(jsonPath(payload, a.To))
+		if a.From != "" {
+			from = strings.Join(jsonStrings(jsonPath(payload, a.From)), ",")
+		}
+		if v := jsonPath(payload, a.Body); v != nil {
+			body = fmt.Sprint(v)
+		}
+		return to, from, body, nil
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return nil, "", "", fmt.Errorf("Invalid form data")
+	}
+	to = splitRecipients(r.FormValue(a.To))
+	if a.From != "" {
+		from = r.FormValue(a.From)
+	}
+	return to, from, r.FormValue(a.Body), nil
+}
+
+// adapterHandler captures a message per recipient and renders the adapter's
+// response
+func (s *Server) adapterHandler(a *adapter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		to, from, body, err := a.fields(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(to) == 0 {
+			http.Error(w, fmt.Sprintf("Missing recipient (%s)", a.To), http.StatusBadRequest)
+			return
+		}
+		if body == "" {
+			http.Error(w, fmt.Sprintf("Missing message body (%s)", a.Body), http.StatusBadRequest)
+			return
+		}
+
+		result := adapterResult{To: to[0], From: from, Body: body, Count: len(to), Timestamp: time.Now()}
+		msgs := make([]Message, 0, len(to))
+		for _, recipient := range to {
+			msgs = append(msgs, Message{
+				ID:        "msg_" + uuid.New().String()[:8],
+				To:        recipient,
+				From:      from,
+				Body:      body,
+				Status:    "captured",
+				CreatedAt: result.Timestamp,
+				Project:   projectFromRequest(r),
+				Metadata:  metadataFromRequest(r),
+
+				Correlation: correlationFromRequest(r),
+			})
+		}
+		if err := s.captureMessages(msgs); err != nil {
+			writeCaptureError(w, r, err)
+			return
+		}
+		for _, msg := range msgs {
+			result.IDs = append(result.IDs, msg.ID)
+			result.Messages = append(result.Messages, msg)
+
+			log.Printf("📱 SMS captured (%s): To=%s Body=%s", a.Name, msg.To, truncate(msg.Body, 50))
+		}
+		result.ID = result.IDs[0]
+
+		var out bytes.Buffer
+		if a.response == nil {
+			json.NewEncoder(&out).Encode(map[string]interface{}{"id": result.ID, "count": result.Count})
+		} else if err := a.response.Execute(&out, result); err != nil {
+			log.Printf("⚠️ Adapter %s response template failed: %v", a.Name, err)
+			http.Error(w, "Response template failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", a.ContentType)
+		w.WriteHeader(a.Status)
+		w.Write(out.Bytes())
+	}
+}
@@ -0,0 +1,361 @@
+package smspit
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+// Token scopes. Admin implies every other scope.
+const (
+	scopeSend  = "send"
+	scopeRead  = "read"
+	scopeAdmin = "admin"
+)
+
+var validScopes = map[string]bool{scopeSend: true, scopeRead: true, scopeAdmin: true}
+
+// Token roles, shorthands for common scope sets
+const (
+	roleReadOnly = "read-only" // List, search, get and stream
+	roleFull     = "full"      // Everything, including deletes
+)
+
+var tokenRoles = map[string][]string{
+	roleReadOnly: {scopeRead},
+	roleFull:     {scopeAdmin},
+}
+
+// APIToken is an API key issued through the admin API. A token bound to a
+// project can only reach that project's messages.
+type APIToken struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name,omitempty"`
+	Token     string    `json:"token,omitempty"` // Only returned when created
+	Scopes    []string  `json:"scopes"`
+	Project   string    `json:"project,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// hasScope reports whether the token grants scope
+func (t *APIToken) hasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope || s == scopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// role names the token's role, or "" for other scope sets
+func (t *APIToken) role() string {
+	switch {
+	case t.hasScope(scopeAdmin):
+		return roleFull
+	case len(t.Scopes) == 1 && t.Scopes[0] == scopeRead:
+		return roleReadOnly
+	}
+	return ""
+}
+
+// tokenStore holds issued API tokens keyed by their secret
+type tokenStore struct {
+	mu     sync.RWMutex
+	tokens map[string]*APIToken
+}
+
+func (ts *tokenStore) lookup(secret string) (*APIToken, bool) {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	t, ok := ts.tokens[secret]
+	return t, ok
+}
+
+// rootToken represents SMSPIT_AUTH_TOKEN: admin over every project
+var rootToken = &APIToken{ID: "root", Scopes: []string{scopeAdmin}}
+
+// twilioToken represents the credentials of an SMSPIT_TWILIO_ACCOUNTS
+// account, which Twilio SDKs send instead of an SMSpit token: send, on the
+// Twilio endpoints only
+var twilioToken = &APIToken{ID: "twilio", Scopes: []string{scopeSend}}
+
+// requestToken extracts the presented credential from a Bearer/raw
+// Authorization header, or the password of Basic auth (as Twilio SDKs send).
+// WebSocket and SSE clients, which can't set headers, may pass ?token=.
+func requestToken(r *http.Request) string {
+	if _, password, ok := r.BasicAuth(); ok {
+		return password
+	}
+	if token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "); token != "" {
+		return token
+	}
+	if websocket.IsWebSocketUpgrade(r) || r.URL.Path == "/api/v1/events" {
+		return r.URL.Query().Get("token")
+	}
+	return ""
+}
+
+// authEnabled reports whether API credentials are checked at all
+func (s *Server) authEnabled() bool {
+	return s.config.AuthToken != "" || s.oidc != nil
+}
+
+// authRequired reports whether a request needs credentials: everything
+// except health checks and the API description with SMSPIT_AUTH_TOKEN, and
+// the web UI's API, the WebSocket and the debug endpoints with SSO alone
+func (s *Server) authRequired(r *http.Request) bool {
+	if r.Method == "OPTIONS" || isPublicPath(r.URL.Path) {
+		return false
+	}
+	if s.config.AuthToken != "" {
+		return true
+	}
+	return s.oidc != nil && (strings.HasPrefix(r.URL.Path, "/api/") || r.URL.Path == "/ws" || isDebugPath(r.URL.Path))
+}
+
+// authenticate resolves the token presented with a request, or its SSO
+// session
+func (s *Server) authenticate(r *http.Request) (*APIToken, bool) {
+	secret := requestToken(r)
+	if secret == "" {
+		return s.sessionToken(r)
+	}
+	if s.isRootToken(secret) {
+		return rootToken, true
+	}
+	return s.tokens.lookup(secret)
+}
+
+// isRootToken reports whether secret is SMSPIT_AUTH_TOKEN, in constant time
+func (s *Server) isRootToken(secret string) bool {
+	return s.config.AuthToken != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(s.config.AuthToken)) == 1
+}
+
+// requiredScope maps a request to the scope it needs: capture endpoints need
+// send, the admin API and debug endpoints need admin, and the rest of
+// /api/v1 needs read for GETs (and the side-effect free analyzer, GraphQL
+// and the WebSocket) and admin for changes
+func requiredScope(r *http.Request) string {
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/api/v1/admin/"), isDebugPath(r.URL.Path):
+		return scopeAdmin
+	case strings.HasPrefix(r.URL.Path, "/api/v1/simulate/"):
+		return scopeSend
+	case r.URL.Path == "/api/v1/analyze", r.URL.Path == "/api/graphql", r.URL.Path == "/ws":
+		return scopeRead
+	case strings.HasPrefix(r.URL.Path, "/api/v1/"):
+		if r.Method == "GET" || r.Method == "HEAD" {
+			return scopeRead
+		}
+		return scopeAdmin
+	default:
+		return scopeSend
+	}
+}
+
+// isPublicPath reports whether a path is reachable without a token
+// (health checks and the API description)
+func isPublicPath(path string) bool {
+	switch path {
+	case "/health", "/api/v1/health", "/livez", "/readyz", "/api/v1/openapi.json":
+		return true
+	}
+	return false
+}
+
+// writeAuthError refuses a request without a usable token, with a Twilio
+// error (20003 or 20403) on the Twilio-compatible APIs
+func writeAuthError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	if !isTwilioPath(r.URL.Path) {
+		http.Error(w, message, status)
+		return
+	}
+	if status == http.StatusUnauthorized {
+		writeTwilioError(w, twilioErrorCatalog[20003])
+		return
+	}
+	writeTwilioError(w, twilioErrorCatalog[20403], message)
+}
+
+// authMiddleware enforces API tokens when SMSPIT_AUTH_TOKEN or SSO is set.
+// Requests with a project-bound token are scoped to that project. On the
+// Twilio endpoints the credentials of an SMSPIT_TWILIO_ACCOUNTS account
+// will do too, as twilioAuth checks them anyway.
+func (s *Server) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.authRequired(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, ok := s.authenticate(r)
+		if !ok && isTwilioPath(r.URL.Path) && s.twilioAccountAuth(r) {
+			token, ok = twilioToken, true
+		}
+		if !ok {
+			if s.oidc != nil {
+				w.Header().Set("X-SMSpit-Login", "auth/login") // Tells the web UI to sign in
+			}
+			writeAuthError(w, r, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+		if !token.hasScope(requiredScope(r)) {
+			writeAuthError(w, r, http.StatusForbidden, "Forbidden: token lacks '"+requiredScope(r)+"' scope")
+			return
+		}
+
+		if token.Project != "" {
+			if strings.HasPrefix(r.URL.Path, "/api/v1/admin/") {
+				http.Error(w, "Forbidden: the admin API needs a token not bound to a project", http.StatusForbidden)
+				return
+			}
+			if isDebugPath(r.URL.Path) {
+				http.Error(w, "Forbidden: the debug endpoints need a token not bound to a project", http.StatusForbidden)
+				return
+			}
+			project := projectFromRequest(r)
+			if project != defaultProject && project != token.Project {
+				writeAuthError(w, r, http.StatusForbidden, "Forbidden: token is limited to project '"+token.Project+"'")
+				return
+			}
+			r = r.WithContext(context.WithValue(r.Context(), projectContextKey{}, token.Project))
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleCreateToken issues a new API token
+func (s *Server) handleCreateToken(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name    string   `json:"name"`
+		Scopes  []string `json:"scopes"`
+		Role    string   `json:"role"`
+		Project string   `json:"project"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.Role != "" {
+		scopes, ok := tokenRoles[req.Role]
+		if !ok {
+			http.Error(w, "Invalid role '"+req.Role+"' (use read-only or full)", http.StatusBadRequest)
+			return
+		}
+		if len(req.Scopes) > 0 {
+			http.Error(w, "Use either 'role' or 'scopes'", http.StatusBadRequest)
+			return
+		}
+		req.Scopes = scopes
+	}
+	if len(req.Scopes) == 0 {
+		http.Error(w, "Missing 'scopes' or 'role' field", http.StatusBadRequest)
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !validScopes[scope] {
+			http.Error(w, "Invalid scope '"+scope+"' (use send, read or admin)", http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Project != "" && !validProjectName.MatchString(req.Project) {
+		http.Error(w, "Invalid project name", http.StatusBadRequest)
+		return
+	}
+
+	token := &APIToken{
+		ID:        "tok_" + uuid.New().String()[:8],
+		Name:      req.Name,
+		Token:     "smspit_" + strings.ReplaceAll(uuid.New().String(), "-", ""),
+		Scopes:    req.Scopes,
+		Project:   req.Project,
+		CreatedAt: time.Now(),
+	}
+
+	s.tokens.mu.Lock()
+	s.tokens.tokens[token.Token] = token
+	s.tokens.mu.Unlock()
+	s.syncRecords(kindTokens)
+
+	log.Printf("🔑 API token created: ID=%s Scopes=%s Project=%s", token.ID, strings.Join(token.Scopes, ","), token.Project)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(token)
+}
+
+// handleListTokens lists issued tokens without their secrets
+func (s *Server) handleListTokens(w http.ResponseWriter, r *http.Request) {
+	s.tokens.mu.RLock()
+	tokens := make([]APIToken, 0, len(s.tokens.tokens))
+	for _, t := range s.tokens.tokens {
+		redacted := *t
+		redacted.Token = ""
+		tokens = append(tokens, redacted)
+	}
+	s.tokens.mu.RUnlock()
+
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].CreatedAt.Before(tokens[j].CreatedAt)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"tokens": tokens,
+		"total":  len(tokens),
+	})
+}
+
+// handleWhoAmI describes the request's token so clients like the web UI
+// can hide what it doesn't allow. Without SMSPIT_AUTH_TOKEN or SSO every
+// request has full access.
+func (s *Server) handleWhoAmI(w http.ResponseWriter, r *http.Request) {
+	token := rootToken
+	if s.authEnabled() {
+		token, _ = s.authenticate(r) // Checked by authMiddleware
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"auth":    s.authEnabled(),
+		"sso":     strings.HasPrefix(token.ID, "sso_"),
+		"id":      token.ID,
+		"name":    token.Name,
+		"role":    token.role(),
+		"scopes":  token.Scopes,
+		"project": token.Project,
+	})
+}
+
+// handleRevokeToken deletes a token by ID
+func (s *Server) handleRevokeToken(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	defer s.syncRecords(kindTokens)
+	s.tokens.mu.Lock()
+	defer s.tokens.mu.Unlock()
+
+	for secret, t := range s.tokens.tokens {
+		if t.ID == id {
+			delete(s.tokens.tokens, secret)
+			log.Printf("🔑 API token revoked: ID=%s", id)
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"status": "revoked"})
+			return
+		}
+	}
+
+	http.Error(w, "Token not found", http.StatusNotFound)
+}
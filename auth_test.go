@@ -0,0 +1,122 @@
+package smspit
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestPublicPaths(t *testing.T) {
+	ts := newTestServer(t, Config{AuthToken: "secret"})
+
+	for _, path := range []string{"/health", "/api/v1/health", "/livez", "/readyz", "/api/v1/openapi.json"} {
+		if w := do(t, ts.web, "GET", path, ""); w.Code == http.StatusUnauthorized {
+			t.Errorf("GET %s without a token: %d, want it served", path, w.Code)
+		}
+	}
+}
+
+func TestAuthRequired(t *testing.T) {
+	ts := newTestServer(t, Config{AuthToken: "secret"})
+
+	tests := []struct {
+		method, path string
+	}{
+		{"GET", "/api/v1/messages"},
+		// Routes whose paths end like a public one aren't public
+		{"GET", "/api/v1/messages/health"},
+		{"GET", "/api/v1/messages/livez"},
+		{"GET", "/api/v1/messages/readyz"},
+		{"POST", "/api/v1/snapshots/health"},
+	}
+	for _, tt := range tests {
+		if w := do(t, ts.web, tt.method, tt.path, ""); w.Code != http.StatusUnauthorized {
+			t.Errorf("%s %s without a token: %d, want 401", tt.method, tt.path, w.Code)
+		}
+		for _, token := range []string{"wrong", "secre", "secret2"} {
+			if w := do(t, ts.web, tt.method, tt.path, "", "Authorization", "Bearer "+token); w.Code != http.StatusUnauthorized {
+				t.Errorf("%s %s with token %q: %d, want 401", tt.method, tt.path, token, w.Code)
+			}
+		}
+	}
+
+	if w := do(t, ts.web, "GET", "/api/v1/messages", "", "Authorization", "Bearer secret"); w.Code != http.StatusOK {
+		t.Errorf("GET /api/v1/messages with the root token: %d, want 200", w.Code)
+	}
+}
+
+func TestTwilioCredentials(t *testing.T) {
+	ts := newTestServer(t, Config{
+		AuthToken:      "secret",
+		TwilioCompat:   true,
+		TwilioAccounts: map[string]string{"AC1": "token1", "AC2": "token2"},
+	})
+	basic := func(sid, token string) string {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(sid+":"+token))
+	}
+
+	tests := []struct {
+		name, path, auth string
+		want, code       int
+	}{
+		{"account credentials", "/2010-04-01/Accounts/AC1/Messages.json", basic("AC1", "token1"), http.StatusCreated, 0},
+		{"wrong auth token", "/2010-04-01/Accounts/AC1/Messages.json", basic("AC1", "token2"), http.StatusUnauthorized, 20003},
+		{"another account's path", "/2010-04-01/Accounts/AC2/Messages.json", basic("AC1", "token1"), http.StatusUnauthorized, 20003},
+		{"unknown account", "/2010-04-01/Accounts/AC9/Messages.json", basic("AC9", "token1"), http.StatusUnauthorized, 20003},
+		{"no credentials", "/2010-04-01/Accounts/AC1/Messages.json", "", http.StatusUnauthorized, 20003},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := []string{"Content-Type", "application/x-www-form-urlencoded"}
+			if tt.auth != "" {
+				header = append(header, "Authorization", tt.auth)
+			}
+			w := do(t, ts.api, "POST", tt.path, "To=%2B15551230001&From=%2B15550009999&Body=Hi", header...)
+			if w.Code != tt.want {
+				t.Fatalf("%d %s, want %d", w.Code, w.Body, tt.want)
+			}
+			if tt.code != 0 {
+				var resp struct {
+					Code int `json:"code"`
+				}
+				decode(t, w, &resp)
+				if resp.Code != tt.code {
+					t.Errorf("error code %d, want %d", resp.Code, tt.code)
+				}
+			}
+		})
+	}
+
+	// Twilio credentials don't open the rest of the API
+	if w := do(t, ts.web, "GET", "/api/v1/messages", "", "Authorization", basic("AC1", "token1")); w.Code != http.StatusUnauthorized {
+		t.Errorf("REST API with Twilio credentials: %d, want 401", w.Code)
+	}
+}
+
+func TestWebSocketToken(t *testing.T) {
+	ts := newTestServer(t, Config{AuthToken: "secret"})
+	srv := httptest.NewServer(ts.web)
+	defer srv.Close()
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
+
+	if _, resp, err := websocket.DefaultDialer.Dial(wsURL, nil); err == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("WebSocket without a token: %v, want 401", err)
+	}
+	if _, resp, err := websocket.DefaultDialer.Dial(wsURL+"?token=wrong", nil); err == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("WebSocket with a wrong token: %v, want 401", err)
+	}
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL+"?token=secret", nil)
+	if err != nil {
+		t.Fatalf("WebSocket with the token in the query: %v", err)
+	}
+	conn.Close()
+
+	// Only the WebSocket and event stream take a query token
+	if w := do(t, ts.web, "GET", "/api/v1/messages?token=secret", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("REST API with a query token: %d, want 401", w.Code)
+	}
+}
@@ -0,0 +1,259 @@
+package smspit
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// maxAutoReplyChain stops rules from answering each other's replies forever,
+// e.g. when an application's TwiML reply matches a rule again
+const maxAutoReplyChain = 10
+
+// AutoReplyRule answers matching outbound messages with a simulated inbound
+// reply from the recipient. Rules apply in the order they were added; the
+// first one that matches replies.
+type AutoReplyRule struct {
+	ID string `json:"id"`
+	// To, From and Body are regexes the message must match; empty matches anything
+	To   string `json:"to,omitempty"`
+	From string `json:"from,omitempty"`
+	Body string `json:"body,omitempty"`
+	// Reply is the reply's text; $1 or ${name} insert groups of the Body match
+	Reply string `json:"reply"`
+	// Delay before replying, e.g. "2s"
+	Delay string `json:"delay,omitempty"`
+	// WebhookURL receives the reply as Twilio's incoming SMS webhook
+	// (default SMSPIT_INBOUND_WEBHOOK_URL; none just records it)
+	WebhookURL string `json:"webhook_url,omitempty"`
+	// Project limits the rule to one project; empty means every project
+	Project   string    `json:"project,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	Hits      int       `json:"hits"`
+
+	to, from, body *regexp.Regexp
+	delay          time.Duration
+}
+
+// AutoReplyRequest is the body for creating an auto-reply rule
+type AutoReplyRequest struct {
+	To         string `json:"to"`
+	From       string `json:"from"`
+	Body       string `json:"body"`
+	Reply      string `json:"reply"`
+	Delay      string `json:"delay"`
+	WebhookURL string `json:"webhook_url"`
+	Project    string `json:"project"`
+}
+
+// autoReplyStore holds the auto-reply rules
+type autoReplyStore struct {
+	mu    sync.Mutex
+	rules []*AutoReplyRule
+}
+
+// parseAutoReplyRules parses "reply=regex;reply=regex" into rules matching
+// the body. They are validated when the server is created.
+func parseAutoReplyRules(val string) []AutoReplyRequest {
+	var reqs []AutoReplyRequest
+	for _, entry := range strings.Split(val, ";") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		reply, pattern, _ := strings.Cut(entry, "=")
+		reqs = append(reqs, AutoReplyRequest{Reply: reply, Body: pattern})
+	}
+	return reqs
+}
+
+// newAutoReplyRule validates req and builds a rule from it
+func newAutoReplyRule(req AutoReplyRequest) (*AutoReplyRule, error) {
+	rule := &AutoReplyRule{
+		ID:         "reply_" + uuid.New().String()[:8],
+		To:         req.To,
+		From:       req.From,
+		Body:       req.Body,
+		Reply:      req.Reply,
+		Delay:      req.Delay,
+		WebhookURL: req.WebhookURL,
+		Project:    req.Project,
+		CreatedAt:  time.Now(),
+	}
+
+	if strings.TrimSpace(rule.Reply) == "" {
+		return nil, fmt.Errorf("missing 'reply'")
+	}
+	for _, field := range []struct {
+		name    string
+		pattern string
+		re      **regexp.Regexp
+	}{{"to", rule.To, &rule.to}, {"from", rule.From, &rule.from}, {"body", rule.Body, &rule.body}} {
+		if field.pattern == "" {
+			continue
+		}
+		re, err := regexp.Compile(field.pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid '%s' pattern: %v", field.name, err)
+		}
+		*field.re = re
+	}
+	if rule.Delay != "" {
+		d, err := time.ParseDuration(rule.Delay)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid 'delay' duration")
+		}
+		rule.delay = d
+	}
+	if rule.Project != "" && !validProjectName.MatchString(rule.Project) {
+		return nil, fmt.Errorf("invalid project name")
+	}
+	return rule, nil
+}
+
+// reply returns the rule's reply to msg, if the rule matches it
+func (rule *AutoReplyRule) reply(msg Message) (string, bool) {
+	if rule.Project != "" && rule.Project != msg.Project {
+		return "", false
+	}
+	if (rule.to != nil && !rule.to.MatchString(msg.To)) || (rule.from != nil && !rule.from.MatchString(msg.From)) {
+		return "", false
+	}
+	if rule.body == nil {
+		return rule.Reply, true
+	}
+	match := rule.body.FindStringSubmatchIndex(msg.text())
+	if match == nil {
+		return "", false
+	}
+	return string(rule.body.ExpandString(nil, rule.Reply, msg.text(), match)), true
+}
+
+// maybeAutoReply schedules the reply of the first rule matching an outbound
+// message
+func (s *Server) maybeAutoReply(msg Message) {
+	if msg.Direction != "outbound" || msg.autoReplies >= maxAutoReplyChain {
+		return
+	}
+
+	s.autoReply.mu.Lock()
+	var rule *AutoReplyRule
+	var text string
+	for _, r := range s.autoReply.rules {
+		if reply, ok := r.reply(msg); ok {
+			rule, text = r, reply
+			r.Hits++
+			break
+		}
+	}
+	s.autoReply.mu.Unlock()
+	if rule == nil {
+		return
+	}
+
+	webhookURL := rule.WebhookURL
+	if webhookURL == "" {
+		webhookURL = s.config.InboundWebhookURL
+	}
+	time.AfterFunc(rule.delay, func() { s.sendAutoReply(msg, text, webhookURL) })
+}
+
+// sendAutoReply records the reply to msg as an inbound message and delivers
+// it to the webhook, if any
+func (s *Server) sendAutoReply(msg Message, text, webhookURL string) {
+	accountSID := msg.AccountSID
+	if accountSID == "" {
+		accountSID = defaultAccountSID
+	}
+	reply := Message{
+		ID:         "SM" + strings.ReplaceAll(uuid.New().String(), "-", ""),
+		To:         msg.From,
+		From:       msg.To,
+		Body:       text,
+		Status:     "received",
+		Direction:  "inbound",
+		CreatedAt:  time.Now(),
+		AccountSID: accountSID,
+		Project:    msg.Project,
+
+		autoReplies: msg.autoReplies + 1,
+	}
+	if !msg.carrierMessaging() {
+		reply.Channel = msg.Channel // Reply on the same app channel
+	}
+	if err := s.captureMessage(&reply); err != nil {
+		return
+	}
+
+	log.Printf("↩️ Auto-reply simulated: From=%s To=%s Body=%s", reply.From, reply.To, truncate(reply.Body, 50))
+
+	if webhookURL != "" {
+		s.postInbound(reply, webhookURL)
+	}
+}
+
+// handleListAutoReplies lists the auto-reply rules
+func (s *Server) handleListAutoReplies(w http.ResponseWriter, r *http.Request) {
+	s.autoReply.mu.Lock()
+	defer s.autoReply.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"rules": s.autoReply.rules,
+		"total": len(s.autoReply.rules),
+	})
+}
+
+// handleCreateAutoReply adds an auto-reply rule
+func (s *Server) handleCreateAutoReply(w http.ResponseWriter, r *http.Request) {
+	var req AutoReplyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rule, err := newAutoReplyRule(req)
+	if err != nil {
+		http.Error(w, "Invalid rule: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.autoReply.mu.Lock()
+	s.autoReply.rules = append(s.autoReply.rules, rule)
+	s.autoReply.mu.Unlock()
+	s.syncRecords(kindAutoReplies)
+
+	log.Printf("↩️ Auto-reply rule added: ID=%s Reply=%s", rule.ID, truncate(rule.Reply, 50))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(rule)
+}
+
+// handleDeleteAutoReply removes an auto-reply rule
+func (s *Server) handleDeleteAutoReply(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	defer s.syncRecords(kindAutoReplies)
+	s.autoReply.mu.Lock()
+	defer s.autoReply.mu.Unlock()
+
+	for i, rule := range s.autoReply.rules {
+		if rule.ID == id {
+			s.autoReply.rules = append(s.autoReply.rules[:i], s.autoReply.rules[i+1:]...)
+			log.Printf("↩️ Auto-reply rule removed: ID=%s", id)
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
+			return
+		}
+	}
+
+	http.Error(w, "Auto-reply rule not found", http.StatusNotFound)
+}
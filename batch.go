@@ -0,0 +1,96 @@
+package smspit
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// maxBatchSize is the most messages one POST /send/batch may capture
+const maxBatchSize = 1000
+
+// BatchResult is the outcome of one message of a batch send
+type BatchResult struct {
+	Index  int    `json:"index"`
+	ID     string `json:"id,omitempty"`
+	Status string `json:"status"` // captured/queued, invalid, rejected by a hook, or skipped when another item failed
+	Error  string `json:"error,omitempty"`
+}
+
+// handleSendBatch captures a JSON array of send requests. The batch is all
+// or nothing: if any item is invalid or rejected by a hook none are
+// captured, and the response says which items were at fault.
+func (s *Server) handleSendBatch(w http.ResponseWriter, r *http.Request) {
+	var reqs []SendRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqs); err != nil {
+		http.Error(w, "Invalid JSON (expected an array of messages): "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(reqs) == 0 {
+		http.Error(w, "Empty batch", http.StatusBadRequest)
+		return
+	}
+	if len(reqs) > maxBatchSize {
+		http.Error(w, fmt.Sprintf("Too many messages (at most %d per batch)", maxBatchSize), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.startCapture(); err != nil {
+		writeCaptureError(w, r, err)
+		return
+	}
+	defer s.endCapture()
+
+	project, headerMeta, correlation := projectFromRequest(r), metadataFromRequest(r), correlationFromRequest(r)
+	msgs := make([]Message, len(reqs))
+	results := make([]BatchResult, len(reqs))
+	valid := true
+	for i, req := range reqs {
+		err := s.renderTemplate(&req, project)
+		if err == nil {
+			req.Metadata, err = mergeMetadata(headerMeta, req.Metadata)
+		}
+		var msg Message
+		if err == nil {
+			msg, err = newSendMessage(req, project, false)
+			msg.Correlation = correlation
+		}
+		if err == nil && s.optOuts.optedOut(project, msg.From, msg.To) {
+			err = fmt.Errorf(twilioErrorCatalog[21610].Message, msg.To)
+		}
+		if err != nil {
+			results[i] = BatchResult{Index: i, Status: "invalid", Error: err.Error()}
+			valid = false
+			continue
+		}
+		if err := s.processMessage(&msg); err != nil {
+			results[i] = BatchResult{Index: i, Status: "rejected", Error: err.Error()}
+			valid = false
+			continue
+		}
+		msgs[i] = msg
+		results[i] = BatchResult{Index: i, Status: "skipped"}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !valid {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"captured": 0,
+			"results":  results,
+		})
+		return
+	}
+
+	for i := range msgs {
+		s.storeMessage(&msgs[i])
+		results[i] = BatchResult{Index: i, ID: msgs[i].ID, Status: msgs[i].Status}
+	}
+	log.Printf("📱 SMS batch captured: %d messages", len(msgs))
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"captured": len(msgs),
+		"results":  results,
+	})
+}
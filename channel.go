@@ -0,0 +1,74 @@
+package smspit
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Message channels
+const (
+	channelSMS      = "sms"
+	channelMMS      = "mms"
+	channelWhatsApp = "whatsapp"
+	channelRCS      = "rcs"
+	channelViber    = "viber"
+)
+
+// channels lists the message channels, in the order stats report them
+var channels = []string{channelSMS, channelMMS, channelWhatsApp, channelRCS, channelViber}
+
+// validChannel reports whether c is a message channel
+func validChannel(c string) bool {
+	for _, channel := range channels {
+		if c == channel {
+			return true
+		}
+	}
+	return false
+}
+
+// channel returns msg's channel. Messages captured without one (and those
+// imported or restored from before channels were recorded) are WhatsApp
+// when either party has a "whatsapp:" address, as Twilio writes them, MMS
+// when they carry media and SMS otherwise.
+func (m Message) channel() string {
+	switch {
+	case m.Channel != "":
+		return m.Channel
+	case strings.HasPrefix(m.To, "whatsapp:") || strings.HasPrefix(m.From, "whatsapp:"):
+		return channelWhatsApp
+	case len(m.Media) > 0:
+		return channelMMS
+	}
+	return channelSMS
+}
+
+// carrierMessaging reports whether msg goes over the carrier network (SMS or
+// MMS), where carrier rules such as segment limits, sender IDs, 10DLC and
+// content screening apply
+func (m Message) carrierMessaging() bool {
+	c := m.channel()
+	return c == channelSMS || c == channelMMS
+}
+
+// vonageChannel maps a Vonage Messages API channel to SMSpit's; ok is false
+// for channels SMSpit doesn't capture, such as messenger
+func vonageChannel(c string) (channel string, ok bool) {
+	switch c {
+	case "":
+		return channelSMS, true
+	case "viber_service":
+		return channelViber, true
+	}
+	return c, validChannel(c)
+}
+
+// channelParam reads the ?channel= filter of a stats request
+func channelParam(q url.Values) (string, error) {
+	c := strings.ToLower(q.Get("channel"))
+	if c != "" && !validChannel(c) {
+		return "", fmt.Errorf("Invalid 'channel' (use %s)", strings.Join(channels, ", "))
+	}
+	return c, nil
+}
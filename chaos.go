@@ -0,0 +1,446 @@
+package smspit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// ChaosRule makes matching capture requests slow or fail. Rules apply in the
+// order they were added; the first one that matches a request wins.
+type ChaosRule struct {
+	ID string `json:"id"`
+	// Status is the HTTP error to return (0 only adds latency)
+	Status int `json:"status,omitempty"`
+	// Code is the provider error code in the body, e.g. Twilio's 20429
+	Code int `json:"code,omitempty"`
+	// Message overrides the error message
+	Message string `json:"message,omitempty"`
+	// RetryAfter is sent as the Retry-After header, in seconds
+	RetryAfter int `json:"retry_after,omitempty"`
+	// Latency delays the response; Jitter adds up to that much more at random
+	Latency string `json:"latency,omitempty"`
+	Jitter  string `json:"jitter,omitempty"`
+	// Numbers limits the rule to requests to or from these numbers
+	Numbers []string `json:"numbers,omitempty"`
+	// Percentage of matching requests affected (default 100)
+	Percentage float64 `json:"percentage"`
+	// Project limits the rule to one project; empty means every project
+	Project   string     `json:"project,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Hits      int        `json:"hits"`
+
+	latency time.Duration
+	jitter  time.Duration
+}
+
+// ChaosRequest is the body for creating a chaos rule. Duration (e.g. "5m")
+// removes the rule after that long.
+type ChaosRequest struct {
+	Status     int      `json:"status"`
+	Code       int      `json:"code"`
+	Message    string   `json:"message"`
+	RetryAfter int      `json:"retry_after"`
+	Latency    string   `json:"latency"`
+	Jitter     string   `json:"jitter"`
+	Numbers    []string `json:"numbers"`
+	Percentage float64  `json:"percentage"`
+	Project    string   `json:"project"`
+	Duration   string   `json:"duration"`
+}
+
+// chaosStore holds the active chaos rules
+type chaosStore struct {
+	mu    sync.Mutex
+	rules []*ChaosRule
+}
+
+// newChaosRule validates req and builds a rule from it
+func newChaosRule(req ChaosRequest) (*ChaosRule, error) {
+	rule := &ChaosRule{
+		ID:         "chaos_" + uuid.New().String()[:8],
+		Status:     req.Status,
+		Code:       req.Code,
+		Message:    req.Message,
+		RetryAfter: req.RetryAfter,
+		Latency:    req.Latency,
+		Jitter:     req.Jitter,
+		Numbers:    req.Numbers,
+		Percentage: req.Percentage,
+		Project:    req.Project,
+		CreatedAt:  time.Now(),
+	}
+
+	if rule.Status != 0 && (rule.Status < 400 || rule.Status > 599) {
+		return nil, fmt.Errorf("'status' must be a 4xx or 5xx code")
+	}
+	var err error
+	if rule.Latency != "" {
+		if rule.latency, err = time.ParseDuration(rule.Latency); err != nil || rule.latency < 0 {
+			return nil, fmt.Errorf("invalid 'latency' duration")
+		}
+	}
+	if rule.Jitter != "" {
+		if rule.jitter, err = time.ParseDuration(rule.Jitter); err != nil || rule.jitter < 0 {
+			return nil, fmt.Errorf("invalid 'jitter' duration")
+		}
+	}
+	if rule.Status == 0 && rule.latency == 0 && rule.jitter == 0 {
+		return nil, fmt.Errorf("set 'status', 'latency' or 'jitter'")
+	}
+	if rule.Percentage == 0 {
+		rule.Percentage = 100
+	}
+	if rule.Percentage < 0 || rule.Percentage > 100 {
+		return nil, fmt.Errorf("'percentage' must be between 0 and 100")
+	}
+	if rule.Project != "" && !validProjectName.MatchString(rule.Project) {
+		return nil, fmt.Errorf("invalid project name")
+	}
+	if req.Duration != "" {
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid 'duration'")
+		}
+		expires := rule.CreatedAt.Add(d)
+		rule.ExpiresAt = &expires
+	}
+	return rule, nil
+}
+
+// matches reports whether the rule covers a request for project involving
+// numbers. It does not roll the percentage.
+func (rule *ChaosRule) matches(project string, numbers []string, now time.Time) bool {
+	if rule.ExpiresAt != nil && now.After(*rule.ExpiresAt) {
+		return false
+	}
+	if rule.Project != "" && rule.Project != project {
+		return false
+	}
+	if len(rule.Numbers) == 0 {
+		return true
+	}
+	for _, want := range rule.Numbers {
+		for _, n := range numbers {
+			if n == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// pickChaosRule returns the first live rule matching the request, pruning
+// expired rules as it goes
+func (s *Server) pickChaosRule(project string, numbers []string) (ChaosRule, bool) {
+	s.chaos.mu.Lock()
+	defer s.chaos.mu.Unlock()
+
+	now := time.Now()
+	live := s.chaos.rules[:0]
+	for _, rule := range s.chaos.rules {
+		if rule.ExpiresAt == nil || now.Before(*rule.ExpiresAt) {
+			live = append(live, rule)
+		}
+	}
+	s.chaos.rules = live
+
+	for _, rule := range s.chaos.rules {
+		if rule.matches(project, numbers, now) {
+			if rand.Float64()*100 >= rule.Percentage {
+				return ChaosRule{}, false
+			}
+			rule.Hits++
+			return *rule, true
+		}
+	}
+	return ChaosRule{}, false
+}
+
+// chaosMiddleware applies chaos rules to the capture endpoints
+func (s *Server) chaosMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "OPTIONS" || isPublicPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		s.chaos.mu.Lock()
+		active := len(s.chaos.rules) > 0
+		s.chaos.mu.Unlock()
+		if !active {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		to, from := requestParties(r)
+		rule, ok := s.pickChaosRule(projectFromRequest(r), append(to, from...))
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		delay := rule.latency
+		if rule.jitter > 0 {
+			delay += time.Duration(rand.Int63n(int64(rule.jitter) + 1))
+		}
+		if delay > 0 {
+			select {
+			case <-time.After(delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		if rule.Status == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		log.Printf("💥 Chaos rule %s failed %s %s with %d", rule.ID, r.Method, r.URL.Path, rule.Status)
+		writeChaosError(w, r, rule)
+	})
+}
+
+// requestParties returns the recipient and sender numbers of a capture
+// request in any of the supported provider formats, leaving the body
+// readable for the handler
+func requestParties(r *http.Request) (to, from []string) {
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		r.Body = io.NopCloser(errReader{err})
+		return nil, nil
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") || bytes.HasPrefix(bytes.TrimSpace(body), []byte("{")) {
+		var fields map[string]interface{}
+		json.Unmarshal(body, &fields)
+		to = append(jsonNumbers(fields["to"]), jsonNumbers(fields["recipients"])...)
+		from = append(jsonNumbers(fields["from"]), jsonNumbers(fields["originator"])...)
+		return to, from
+	}
+
+	clone := r.Clone(r.Context())
+	clone.Body = io.NopCloser(bytes.NewReader(body))
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		clone.ParseMultipartForm(maxMediaItems * maxMediaSize)
+	} else {
+		clone.ParseForm()
+	}
+	values := func(keys ...string) []string {
+		var numbers []string
+		for _, key := range keys {
+			for _, v := range clone.Form[key] {
+				numbers = append(numbers, strings.Split(v, ",")...)
+			}
+		}
+		return numbers
+	}
+	return values("To", "to", "PhoneNumber", "recipients"), values("From", "from", "originator")
+}
+
+// jsonNumbers flattens a decoded JSON value (string, number, list or a
+// Vonage {"number": ...} object) into phone numbers
+func jsonNumbers(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return strings.Split(v, ",")
+	case float64:
+		return []string{strconv.FormatFloat(v, 'f', -1, 64), "+" + strconv.FormatFloat(v, 'f', -1, 64)}
+	case []interface{}:
+		var numbers []string
+		for _, item := range v {
+			numbers = append(numbers, jsonNumbers(item)...)
+		}
+		return numbers
+	case map[string]interface{}:
+		return jsonNumbers(v["number"])
+	}
+	return nil
+}
+
+// writeChaosError writes rule's error in the shape of the provider API the
+// request was made to
+func writeChaosError(w http.ResponseWriter, r *http.Request, rule ChaosRule) {
+	retryAfter := rule.RetryAfter
+	if retryAfter == 0 && rule.Status == http.StatusTooManyRequests {
+		retryAfter = 1
+	}
+	writeProviderError(w, r, rule.Status, rule.Code, rule.Message, retryAfter)
+}
+
+// writeProviderError writes an error in the shape of the provider API the
+// request was made to. code and message fall back to provider defaults.
+func writeProviderError(w http.ResponseWriter, r *http.Request, status, code int, message string, retryAfter int) {
+	throttled := status == http.StatusTooManyRequests
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	}
+
+	if message == "" {
+		message = http.StatusText(status)
+		if message == "" {
+			message = "Simulated error"
+		}
+	}
+
+	path := r.URL.Path
+	switch {
+	case isTwilioPath(path):
+		if code == 0 {
+			code = 20500
+			if throttled {
+				code = 20429
+			}
+		}
+		writeTwilioError(w, TwilioError{Code: code, Status: status, Message: message})
+	case strings.HasPrefix(path, "/nexmo/") || path == "/v1/messages":
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{
+			"type":     "https://developer.vonage.com/api-errors#" + strconv.Itoa(status),
+			"title":    http.StatusText(status),
+			"detail":   message,
+			"instance": uuid.New().String(),
+		})
+	case path == "/messages":
+		if code == 0 {
+			code = 99
+		}
+		writeMessageBirdError(w, status, code, message, "")
+	case path == "/pa/send_message" && status < 500:
+		viberStatus := viberBadData
+		if throttled {
+			viberStatus = viberTooManyRequests
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		writeViberStatus(w, viberStatus, message)
+	case whatsAppPath.MatchString(path):
+		if code == 0 {
+			code = 131000
+			if throttled {
+				code = 130429
+			} else if status < 500 {
+				code = 100
+			}
+		}
+		writeWhatsAppError(w, status, code, message, message)
+	case strings.HasPrefix(path, "/xms/"):
+		sinchCode := "internal_error"
+		if throttled {
+			sinchCode = "too_many_requests"
+		} else if status < 500 {
+			sinchCode = "syntax_constraint_violation"
+		}
+		writeSinchError(w, status, sinchCode, message)
+	case path == "/":
+		snsCode := "InternalFailure"
+		if throttled {
+			snsCode = "Throttling"
+		} else if status < 500 {
+			snsCode = "InvalidParameter"
+		}
+		writeSNSError(w, status, snsCode, message)
+	default:
+		http.Error(w, message, status)
+	}
+}
+
+// handleListChaos lists the active chaos rules
+func (s *Server) handleListChaos(w http.ResponseWriter, r *http.Request) {
+	s.chaos.mu.Lock()
+	defer s.chaos.mu.Unlock()
+
+	now := time.Now()
+	rules := []*ChaosRule{}
+	for _, rule := range s.chaos.rules {
+		if rule.ExpiresAt == nil || now.Before(*rule.ExpiresAt) {
+			rules = append(rules, rule)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"rules": rules,
+		"total": len(rules),
+	})
+}
+
+// handleCreateChaos adds a chaos rule
+func (s *Server) handleCreateChaos(w http.ResponseWriter, r *http.Request) {
+	var req ChaosRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rule, err := newChaosRule(req)
+	if err != nil {
+		http.Error(w, "Invalid chaos rule: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.chaos.mu.Lock()
+	s.chaos.rules = append(s.chaos.rules, rule)
+	s.chaos.mu.Unlock()
+	s.syncRecords(kindChaosRules)
+
+	log.Printf("💥 Chaos rule added: ID=%s Status=%d Latency=%s Percentage=%g", rule.ID, rule.Status, rule.Latency, rule.Percentage)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(rule)
+}
+
+// handleDeleteChaos removes one chaos rule
+func (s *Server) handleDeleteChaos(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	defer s.syncRecords(kindChaosRules)
+	s.chaos.mu.Lock()
+	defer s.chaos.mu.Unlock()
+
+	for i, rule := range s.chaos.rules {
+		if rule.ID == id {
+			s.chaos.rules = append(s.chaos.rules[:i], s.chaos.rules[i+1:]...)
+			log.Printf("💥 Chaos rule removed: ID=%s", id)
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
+			return
+		}
+	}
+
+	http.Error(w, "Chaos rule not found", http.StatusNotFound)
+}
+
+// handleClearChaos removes every chaos rule
+func (s *Server) handleClearChaos(w http.ResponseWriter, r *http.Request) {
+	s.chaos.mu.Lock()
+	count := len(s.chaos.rules)
+	s.chaos.rules = nil
+	s.chaos.mu.Unlock()
+	s.syncRecords(kindChaosRules)
+
+	log.Printf("💥 Chaos rules cleared: %d", count)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "cleared",
+		"deleted": count,
+	})
+}
@@ -0,0 +1,217 @@
+package smspit
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChaosRules(t *testing.T) {
+	const (
+		sendBody   = `{"to":"+15551230001","from":"+15550009999","body":"Hi"}`
+		twilioPath = "/2010-04-01/Accounts/AC1/Messages.json"
+		twilioBody = "To=%2B15551230001&From=%2B15550009999&Body=Hi"
+	)
+	form := []string{"Content-Type", "application/x-www-form-urlencoded"}
+
+	tests := []struct {
+		name           string
+		rules          []ChaosRequest
+		path, body     string
+		header         []string
+		want           int
+		wantBody       string // Part of the response
+		wantRetryAfter string
+		wantLatency    time.Duration
+	}{
+		{
+			name:     "failure",
+			rules:    []ChaosRequest{{Status: 503, Message: "Simulated outage"}},
+			path:     "/send",
+			body:     sendBody,
+			want:     http.StatusServiceUnavailable,
+			wantBody: "Simulated outage",
+		},
+		{
+			name:           "throttling defaults Retry-After",
+			rules:          []ChaosRequest{{Status: 429}},
+			path:           "/send",
+			body:           sendBody,
+			want:           http.StatusTooManyRequests,
+			wantRetryAfter: "1",
+		},
+		{
+			name:           "Twilio error shape",
+			rules:          []ChaosRequest{{Status: 429, RetryAfter: 30}},
+			path:           twilioPath,
+			body:           twilioBody,
+			header:         form,
+			want:           http.StatusTooManyRequests,
+			wantBody:       `"code":20429`,
+			wantRetryAfter: "30",
+		},
+		{
+			name:     "provider error code",
+			rules:    []ChaosRequest{{Status: 400, Code: 21211, Message: "Invalid 'To' Phone Number"}},
+			path:     twilioPath,
+			body:     twilioBody,
+			header:   form,
+			want:     http.StatusBadRequest,
+			wantBody: `"code":21211`,
+		},
+		{
+			name:  "matching number",
+			rules: []ChaosRequest{{Status: 500, Numbers: []string{"+15551230001"}}},
+			path:  "/send",
+			body:  sendBody,
+			want:  http.StatusInternalServerError,
+		},
+		{
+			name:   "matching sender",
+			rules:  []ChaosRequest{{Status: 500, Numbers: []string{"+15550009999"}}},
+			path:   twilioPath,
+			body:   twilioBody,
+			header: form,
+			want:   http.StatusInternalServerError,
+		},
+		{
+			name:  "other number",
+			rules: []ChaosRequest{{Status: 500, Numbers: []string{"+15559999999"}}},
+			path:  "/send",
+			body:  sendBody,
+			want:  http.StatusOK,
+		},
+		{
+			name:  "other project",
+			rules: []ChaosRequest{{Status: 500, Project: "other"}},
+			path:  "/send",
+			body:  sendBody,
+			want:  http.StatusOK,
+		},
+		{
+			name:   "rule's project",
+			rules:  []ChaosRequest{{Status: 500, Project: "other"}},
+			path:   "/send",
+			body:   sendBody,
+			header: []string{projectHeader, "other"},
+			want:   http.StatusInternalServerError,
+		},
+		{
+			name:  "first matching rule wins",
+			rules: []ChaosRequest{{Status: 502, Numbers: []string{"+15551230001"}}, {Status: 500}},
+			path:  "/send",
+			body:  sendBody,
+			want:  http.StatusBadGateway,
+		},
+		{
+			name:        "latency only",
+			rules:       []ChaosRequest{{Latency: "50ms"}},
+			path:        "/send",
+			body:        sendBody,
+			want:        http.StatusOK,
+			wantLatency: 50 * time.Millisecond,
+		},
+		{
+			name:  "public paths are spared",
+			rules: []ChaosRequest{{Status: 500}},
+			path:  "/readyz",
+			want:  http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t, Config{TwilioCompat: true, ChaosRules: tt.rules})
+
+			method := "POST"
+			if tt.body == "" {
+				method = "GET"
+			}
+			start := time.Now()
+			w := do(t, ts.api, method, tt.path, tt.body, tt.header...)
+			if w.Code != tt.want && !(tt.want == http.StatusOK && w.Code == http.StatusCreated) {
+				t.Fatalf("%s %s: %d %s, want %d", method, tt.path, w.Code, w.Body, tt.want)
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("body %q, want it to contain %q", w.Body, tt.wantBody)
+			}
+			if got := w.Header().Get("Retry-After"); got != tt.wantRetryAfter {
+				t.Errorf("Retry-After %q, want %q", got, tt.wantRetryAfter)
+			}
+			if elapsed := time.Since(start); elapsed < tt.wantLatency {
+				t.Errorf("answered after %v, want at least %v", elapsed, tt.wantLatency)
+			}
+			if failed, captured := tt.want >= 400, len(ts.messagesFor(defaultProject))+len(ts.messagesFor("other")) > 0; failed == captured && tt.body != "" {
+				t.Errorf("captured = %v with status %d", captured, w.Code)
+			}
+		})
+	}
+}
+
+func TestChaosPercentage(t *testing.T) {
+	for _, percentage := range []float64{1e-9, 100} {
+		ts := newTestServer(t, Config{ChaosRules: []ChaosRequest{{Status: 500, Percentage: percentage}}})
+		failed := 0
+		for i := 0; i < 20; i++ {
+			if w := do(t, ts.api, "POST", "/send", `{"to":"+15551230001","body":"Hi"}`); w.Code == http.StatusInternalServerError {
+				failed++
+			}
+		}
+		if want := int(percentage / 5); failed != want {
+			t.Errorf("percentage %g failed %d of 20 requests, want %d", percentage, failed, want)
+		}
+	}
+}
+
+func TestChaosAPI(t *testing.T) {
+	ts := newTestServer(t, Config{})
+
+	for _, body := range []string{
+		`{}`,
+		`{"status": 200}`,
+		`{"latency": "soon"}`,
+		`{"status": 500, "percentage": 150}`,
+		`{"status": 500, "project": "Not A Project"}`,
+		`{"status": 500, "duration": "-1m"}`,
+	} {
+		if w := do(t, ts.web, "POST", "/api/v1/chaos", body); w.Code != http.StatusBadRequest {
+			t.Errorf("create %s: %d, want 400", body, w.Code)
+		}
+	}
+
+	w := do(t, ts.web, "POST", "/api/v1/chaos", `{"status": 503}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", w.Code, w.Body)
+	}
+	var rule ChaosRule
+	decode(t, w, &rule)
+	if rule.Percentage != 100 {
+		t.Errorf("percentage %g, want the default 100", rule.Percentage)
+	}
+	do(t, ts.web, "POST", "/api/v1/chaos", `{"status": 500, "duration": "1ms"}`)
+	time.Sleep(5 * time.Millisecond)
+	do(t, ts.api, "POST", "/send", `{"to":"+15551230001","body":"Hi"}`)
+
+	// The expired rule is gone and the hit was counted
+	var list struct {
+		Rules []ChaosRule `json:"rules"`
+	}
+	decode(t, do(t, ts.web, "GET", "/api/v1/chaos", ""), &list)
+	if len(list.Rules) != 1 || list.Rules[0].ID != rule.ID || list.Rules[0].Hits != 1 {
+		t.Errorf("rules %+v, want %s with one hit", list.Rules, rule.ID)
+	}
+
+	if w := do(t, ts.web, "DELETE", "/api/v1/chaos/"+rule.ID, ""); w.Code != http.StatusOK {
+		t.Errorf("delete: %d", w.Code)
+	}
+	if w := do(t, ts.web, "DELETE", "/api/v1/chaos/"+rule.ID, ""); w.Code != http.StatusNotFound {
+		t.Errorf("delete again: %d, want 404", w.Code)
+	}
+	do(t, ts.web, "POST", "/api/v1/chaos", `{"status": 503}`)
+	if w := do(t, ts.web, "DELETE", "/api/v1/chaos", ""); !strings.Contains(w.Body.String(), `"deleted":1`) {
+		t.Errorf("clear: %s", w.Body)
+	}
+	if w := do(t, ts.api, "POST", "/send", `{"to":"+15551230001","body":"Hi"}`); w.Code != http.StatusOK {
+		t.Errorf("send after clearing: %d, want 200", w.Code)
+	}
+}
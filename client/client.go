@@ -0,0 +1,456 @@
+// Package client is a Go client for a running SMSpit server.
+//
+// It wraps the capture endpoint and the /api/v1 REST API with typed methods
+// and includes helpers for integration tests:
+//
+//	c := client.New("http://localhost:8080", "http://localhost:9080")
+//	msg := c.WaitForMessageTo(t, "+15551234567", 10*time.Second)
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client talks to an SMSpit instance
+type Client struct {
+	// BaseURL is the web/API server, e.g. http://localhost:8080
+	BaseURL string
+	// SendURL is the capture server, e.g. http://localhost:9080
+	SendURL string
+	// Token is sent as a Bearer token when SMSPIT_AUTH_TOKEN is configured
+	Token string
+	// Project scopes every request to a project namespace (X-SMSpit-Project)
+	Project string
+	// HTTPClient is used for all requests (defaults to a 30s timeout client)
+	HTTPClient *http.Client
+	// PollInterval controls how often WaitForMessage polls (defaults to 250ms)
+	PollInterval time.Duration
+}
+
+// New creates a client for the given web and capture base URLs
+func New(baseURL, sendURL string) *Client {
+	return &Client{
+		BaseURL:      strings.TrimRight(baseURL, "/"),
+		SendURL:      strings.TrimRight(sendURL, "/"),
+		HTTPClient:   &http.Client{Timeout: 30 * time.Second},
+		PollInterval: 250 * time.Millisecond,
+	}
+}
+
+// Message is a captured SMS message
+type Message struct {
+	ID         string      `json:"id"`
+	To         string      `json:"to"`
+	From       string      `json:"from,omitempty"`
+	ToName     string      `json:"to_name,omitempty"`
+	FromName   string      `json:"from_name,omitempty"`
+	Body       string      `json:"body"`
+	Tags       []string    `json:"tags,omitempty"`
+	Media      []MediaItem `json:"media,omitempty"`
+	Channel    string      `json:"channel,omitempty"` // sms, mms, whatsapp, rcs or viber
+	Status     string      `json:"status"`
+	Direction  string      `json:"direction"`
+	Project    string      `json:"project,omitempty"`
+	Unread     bool        `json:"unread"`
+	CreatedAt  time.Time   `json:"created_at"`
+	Encoding   string      `json:"encoding,omitempty"`
+	Characters int         `json:"characters,omitempty"`
+	Segments   int         `json:"segments,omitempty"`
+	Links      []Link      `json:"links,omitempty"`
+	Priority   string      `json:"priority,omitempty"`
+	// ValidityPeriod in seconds, after which an undelivered message expires
+	ValidityPeriod int        `json:"validity_period,omitempty"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+	AccountSID     string     `json:"account_sid,omitempty"`
+	ServiceSID     string     `json:"messaging_service_sid,omitempty"`
+	// DeleteAt is when a message sent with a TTL is deleted
+	DeleteAt *time.Time `json:"delete_at,omitempty"`
+	// DuplicateOf is the ID of the earlier identical message this one repeats
+	DuplicateOf string `json:"duplicate_of,omitempty"`
+	// RCS is the structured content of an RCS message, as sent
+	RCS json.RawMessage `json:"rcs,omitempty"`
+	// Viber is the content of a Viber message, as sent
+	Viber json.RawMessage `json:"viber,omitempty"`
+	// TemplateID is the template the body was rendered from, with the
+	// variables it was given
+	TemplateID        string            `json:"template_id,omitempty"`
+	TemplateVariables map[string]string `json:"template_variables,omitempty"`
+	// Metadata was set by the sender in the request body or
+	// X-SMSpit-Meta-* headers
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// RequestID, TraceID and SpanID come from the X-Request-ID and
+	// traceparent headers of the request that sent the message
+	RequestID string `json:"request_id,omitempty"`
+	TraceID   string `json:"trace_id,omitempty"`
+	SpanID    string `json:"span_id,omitempty"`
+	// FilteredBy lists the content screening rules the message broke; it
+	// then has the filtered status
+	FilteredBy []ContentMatch `json:"filtered_by,omitempty"`
+	// Highlight holds the fields a search matched (body, to, from, to_name,
+	// from_name) with the matches marked; set on Search results
+	Highlight map[string]string `json:"highlight,omitempty"`
+}
+
+// ContentMatch is a content screening rule a message broke
+type ContentMatch struct {
+	Rule     string `json:"rule"` // banned_word, url_shortener or shaft
+	Category string `json:"category,omitempty"`
+	Match    string `json:"match"`
+}
+
+// Link is a URL found in a message body
+type Link struct {
+	URL      string            `json:"url"`
+	Scheme   string            `json:"scheme,omitempty"`
+	Host     string            `json:"host"`
+	Path     string            `json:"path,omitempty"`
+	Query    map[string]string `json:"query,omitempty"`
+	Fragment string            `json:"fragment,omitempty"`
+	// TrackingURL and Clicks are set when the server tracks link clicks
+	TrackingURL string      `json:"tracking_url,omitempty"`
+	Clicks      []LinkClick `json:"clicks,omitempty"`
+}
+
+// LinkClick is one visit to a link's tracking URL
+type LinkClick struct {
+	At        time.Time `json:"at"`
+	UserAgent string    `json:"user_agent"`
+}
+
+// MediaItem is an MMS attachment
+type MediaItem struct {
+	ContentType string `json:"content_type"`
+	Size        int    `json:"size"`
+	Filename    string `json:"filename,omitempty"`
+	SourceURL   string `json:"source_url,omitempty"`
+	URL         string `json:"url"`
+}
+
+// SendRequest is the payload for Send
+type SendRequest struct {
+	To       string   `json:"to"`
+	From     string   `json:"from,omitempty"`
+	Body     string   `json:"body"`
+	Tags     []string `json:"tags,omitempty"`
+	Priority string   `json:"priority,omitempty"` // low, normal or high
+	// ValidityPeriod in seconds, up to 36000
+	ValidityPeriod int `json:"validity_period,omitempty"`
+	// TTL deletes the message that long after capture, e.g. "30s", so a
+	// test can clean up after itself
+	TTL string `json:"ttl,omitempty"`
+	// TemplateID renders the body from a server-side template, by ID or
+	// name, with Variables; leave Body empty
+	TemplateID string            `json:"template_id,omitempty"`
+	Variables  map[string]string `json:"variables,omitempty"`
+	// Metadata is stored with the message, e.g. a test run ID to find it by
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// SendResponse is returned by Send
+type SendResponse struct {
+	ID        string    `json:"id"`
+	Status    string    `json:"status"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// BatchResult is the outcome of one message of SendBatch
+type BatchResult struct {
+	Index  int    `json:"index"`
+	ID     string `json:"id,omitempty"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// BatchResponse is returned by SendBatch
+type BatchResponse struct {
+	Captured int           `json:"captured"`
+	Results  []BatchResult `json:"results"`
+}
+
+// MessageList is a page of messages
+type MessageList struct {
+	Messages []Message `json:"messages"`
+	Total    int       `json:"total"`
+	Count    int       `json:"count"`
+	Limit    int       `json:"limit"`
+	Offset   int       `json:"offset"`
+	Next     *string   `json:"next"`
+}
+
+// ListOptions controls paging for List and Search
+type ListOptions struct {
+	Limit  int
+	Offset int
+}
+
+// SearchOptions filters messages for Search
+type SearchOptions struct {
+	ListOptions
+	// Query uses the search query language, e.g. `to:+1555 body:"reset code"`
+	Query string
+	// Regex treats Query as a regular expression matched against the body
+	Regex bool
+	// From matches the sender
+	From string
+	// Status matches the exact message status
+	Status string
+	// AccountSID matches the Twilio account the message was sent through
+	AccountSID string
+	// After and Before limit results to messages captured in that range
+	After  time.Time
+	Before time.Time
+	// To matches the recipient number
+	To string
+	// Tags only returns messages carrying every one of these tags
+	Tags []string
+	// Metadata only returns messages with every one of these metadata
+	// values
+	Metadata map[string]string
+	// RequestID and TraceID match the X-Request-ID and traceparent trace ID
+	// of the request that sent the message
+	RequestID string
+	TraceID   string
+	// HighlightPre and HighlightPost replace the <mark> and </mark> markers
+	// around matches in Message.Highlight
+	HighlightPre  string
+	HighlightPost string
+}
+
+// MessageFilter selects the message WaitForMessage waits for
+type MessageFilter struct {
+	// To matches the recipient (substring)
+	To string
+	// Contains matches the body (substring)
+	Contains string
+	// Since ignores messages captured before this time
+	Since time.Time
+	// Metadata matches messages with every one of these metadata values,
+	// e.g. this test run's ID
+	Metadata map[string]string
+}
+
+// APIError is returned when SMSpit responds with a non-2xx status
+type APIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("smspit: HTTP %d: %s", e.StatusCode, strings.TrimSpace(e.Body))
+}
+
+// Send captures an SMS via the /send endpoint
+func (c *Client) Send(ctx context.Context, req SendRequest) (*SendResponse, error) {
+	var resp SendResponse
+	if err := c.do(ctx, "POST", c.SendURL+"/send", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// SendBatch captures up to 1000 messages in one request via /send/batch.
+// If any is invalid none are captured and an *APIError is returned.
+func (c *Client) SendBatch(ctx context.Context, reqs []SendRequest) (*BatchResponse, error) {
+	var resp BatchResponse
+	if err := c.do(ctx, "POST", c.SendURL+"/send/batch", reqs, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// List returns a page of messages, newest first
+func (c *Client) List(ctx context.Context, opts ListOptions) (*MessageList, error) {
+	q := url.Values{}
+	opts.apply(q)
+
+	var list MessageList
+	if err := c.do(ctx, "GET", c.BaseURL+"/api/v1/messages?"+q.Encode(), nil, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// Search returns messages matching opts, newest first
+func (c *Client) Search(ctx context.Context, opts SearchOptions) (*MessageList, error) {
+	q := url.Values{}
+	opts.apply(q)
+	if opts.Query != "" {
+		q.Set("q", opts.Query)
+	}
+	if opts.Regex {
+		q.Set("q_regex", "true")
+	}
+	if opts.To != "" {
+		q.Set("to", opts.To)
+	}
+	for _, tag := range opts.Tags {
+		q.Add("tag", tag)
+	}
+	for key, value := range opts.Metadata {
+		q.Add("meta", key+"="+value)
+	}
+	if opts.RequestID != "" {
+		q.Set("request_id", opts.RequestID)
+	}
+	if opts.TraceID != "" {
+		q.Set("trace_id", opts.TraceID)
+	}
+	if opts.From != "" {
+		q.Set("from", opts.From)
+	}
+	if opts.Status != "" {
+		q.Set("status", opts.Status)
+	}
+	if opts.AccountSID != "" {
+		q.Set("account", opts.AccountSID)
+	}
+	if !opts.After.IsZero() {
+		q.Set("after", opts.After.Format(time.RFC3339Nano))
+	}
+	if !opts.Before.IsZero() {
+		q.Set("before", opts.Before.Format(time.RFC3339Nano))
+	}
+	if opts.HighlightPre != "" {
+		q.Set("highlight_pre", opts.HighlightPre)
+	}
+	if opts.HighlightPost != "" {
+		q.Set("highlight_post", opts.HighlightPost)
+	}
+
+	var list MessageList
+	if err := c.do(ctx, "GET", c.BaseURL+"/api/v1/messages/search?"+q.Encode(), nil, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// Get returns a single message by ID
+func (c *Client) Get(ctx context.Context, id string) (*Message, error) {
+	var msg Message
+	if err := c.do(ctx, "GET", c.BaseURL+"/api/v1/messages/"+url.PathEscape(id), nil, &msg); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// Delete removes a single message
+func (c *Client) Delete(ctx context.Context, id string) error {
+	return c.do(ctx, "DELETE", c.BaseURL+"/api/v1/messages/"+url.PathEscape(id), nil, nil)
+}
+
+// MarkRead marks a single message as read
+func (c *Client) MarkRead(ctx context.Context, id string) error {
+	return c.do(ctx, "POST", c.BaseURL+"/api/v1/messages/"+url.PathEscape(id)+"/read", nil, nil)
+}
+
+// Clear removes all messages
+func (c *Client) Clear(ctx context.Context) error {
+	return c.do(ctx, "DELETE", c.BaseURL+"/api/v1/messages", nil, nil)
+}
+
+// WaitForMessage polls until a message matching filter is captured or ctx is done
+func (c *Client) WaitForMessage(ctx context.Context, filter MessageFilter) (*Message, error) {
+	interval := c.PollInterval
+	if interval <= 0 {
+		interval = 250 * time.Millisecond
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		list, err := c.Search(ctx, SearchOptions{To: filter.To, Metadata: filter.Metadata, ListOptions: ListOptions{Limit: 100}})
+		if err != nil {
+			return nil, err
+		}
+		for i := range list.Messages {
+			if filter.matches(list.Messages[i]) {
+				return &list.Messages[i], nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (f MessageFilter) matches(msg Message) bool {
+	if f.To != "" && !strings.Contains(msg.To, f.To) {
+		return false
+	}
+	if f.Contains != "" && !strings.Contains(msg.Body, f.Contains) {
+		return false
+	}
+	if !f.Since.IsZero() && msg.CreatedAt.Before(f.Since) {
+		return false
+	}
+	return true
+}
+
+func (o ListOptions) apply(q url.Values) {
+	if o.Limit > 0 {
+		q.Set("limit", strconv.Itoa(o.Limit))
+	}
+	if o.Offset > 0 {
+		q.Set("offset", strconv.Itoa(o.Offset))
+	}
+}
+
+// do performs a JSON request and decodes the response into out (if non-nil)
+func (c *Client) do(ctx context.Context, method, target string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	if c.Project != "" {
+		req.Header.Set("X-SMSpit-Project", c.Project)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return &APIError{StatusCode: resp.StatusCode, Body: string(data)}
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
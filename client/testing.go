@@ -0,0 +1,103 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// WaitForMessageTo waits for a message to the given number and fails the
+// test if none arrives within timeout
+func (c *Client) WaitForMessageTo(t testing.TB, to string, timeout time.Duration) Message {
+	t.Helper()
+	return c.WaitForMessageMatching(t, MessageFilter{To: to}, timeout)
+}
+
+// WaitForMessageContaining waits for a message to the given number whose body
+// contains substr and fails the test if none arrives within timeout
+func (c *Client) WaitForMessageContaining(t testing.TB, to, substr string, timeout time.Duration) Message {
+	t.Helper()
+	return c.WaitForMessageMatching(t, MessageFilter{To: to, Contains: substr}, timeout)
+}
+
+// WaitForMessageMatching waits for a message matching filter and fails the
+// test if none arrives within timeout. The failure message lists the most
+// recent captured messages to help diagnose near misses.
+func (c *Client) WaitForMessageMatching(t testing.TB, filter MessageFilter, timeout time.Duration) Message {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	msg, err := c.WaitForMessage(ctx, filter)
+	if err == nil {
+		return *msg
+	}
+
+	t.Fatalf("smspit: no message matching %s within %s: %v\n%s", filter, timeout, err, c.recentMessages())
+	return Message{}
+}
+
+// RequireNoMessageTo fails the test if a message to the given number is
+// captured within wait
+func (c *Client) RequireNoMessageTo(t testing.TB, to string, wait time.Duration) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), wait)
+	defer cancel()
+
+	msg, err := c.WaitForMessage(ctx, MessageFilter{To: to, Since: time.Now()})
+	if err == nil {
+		t.Fatalf("smspit: expected no message to %s, got %s: %q", to, msg.ID, msg.Body)
+	}
+}
+
+// ClearMessages removes all messages and fails the test on error
+func (c *Client) ClearMessages(t testing.TB) {
+	t.Helper()
+
+	if err := c.Clear(context.Background()); err != nil {
+		t.Fatalf("smspit: clear messages: %v", err)
+	}
+}
+
+func (f MessageFilter) String() string {
+	var parts []string
+	if f.To != "" {
+		parts = append(parts, fmt.Sprintf("to=%q", f.To))
+	}
+	if f.Contains != "" {
+		parts = append(parts, fmt.Sprintf("contains=%q", f.Contains))
+	}
+	if !f.Since.IsZero() {
+		parts = append(parts, "since="+f.Since.Format(time.RFC3339))
+	}
+	if len(parts) == 0 {
+		return "{any}"
+	}
+	return "{" + strings.Join(parts, " ") + "}"
+}
+
+// recentMessages describes the latest captured messages for failure output
+func (c *Client) recentMessages() string {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	list, err := c.List(ctx, ListOptions{Limit: 10})
+	if err != nil {
+		return fmt.Sprintf("(could not list recent messages: %v)", err)
+	}
+	if len(list.Messages) == 0 {
+		return "(no messages captured)"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "most recent of %d captured messages:\n", list.Total)
+	for _, m := range list.Messages {
+		fmt.Fprintf(&b, "  %s  to=%s from=%s status=%s body=%q\n",
+			m.CreatedAt.Format(time.RFC3339), m.To, m.From, m.Status, m.Body)
+	}
+	return b.String()
+}
@@ -0,0 +1,665 @@
+package smspit
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// clusterBacklog is how many notices a replica buffers while it applies
+// earlier ones. If it falls further behind it reloads the shared store.
+const clusterBacklog = 4096
+
+// A replica records in the shared store that it's alive every
+// clusterHeartbeat. One not seen for clusterStaleAfter has stopped, and
+// another replica takes over its deliveries and scheduled sends.
+const (
+	clusterHeartbeat  = 5 * time.Second
+	clusterStaleAfter = 15 * time.Second
+)
+
+// messageKey identifies a message in the shared store
+type messageKey struct {
+	Project string `json:"project"`
+	ID      string `json:"id"`
+}
+
+// key returns the message's key in the shared store
+func (m Message) key() messageKey {
+	return messageKey{Project: m.Project, ID: m.ID}
+}
+
+// storedMessage is a message as the shared store holds it: with its media
+// data, concatenated parts, unredacted body and owning replica, which the
+// API doesn't serialize
+type storedMessage struct {
+	Message
+	Original  string        `json:"original,omitempty"`
+	Parts     []MessagePart `json:"parts,omitempty"`
+	MediaData [][]byte      `json:"media_data,omitempty"`
+	Replica   string        `json:"replica,omitempty"`
+}
+
+func newStoredMessage(msg Message) storedMessage {
+	stored := storedMessage{Message: msg, Original: msg.original, Parts: msg.parts, Replica: msg.replica}
+	for _, item := range msg.Media {
+		stored.MediaData = append(stored.MediaData, item.Data)
+	}
+	return stored
+}
+
+// message restores the message, with the sequence number the store gave it
+func (m storedMessage) message(seq uint64) Message {
+	msg := m.Message
+	msg.original, msg.parts, msg.replica, msg.seq = m.Original, m.Parts, m.Replica, seq
+	msg.Media = append([]MediaItem(nil), msg.Media...)
+	for i := range msg.Media {
+		if i < len(m.MediaData) {
+			msg.Media[i].Data = m.MediaData[i]
+		}
+	}
+	return msg
+}
+
+// clusterNotice is what replicas publish to each other: the messages and
+// records one of them saved to or removed from the shared store, a number it
+// purged, that it is leaving, or an event for their WebSocket and stream
+// clients
+type clusterNotice struct {
+	Replica string          `json:"replica"`
+	Saved   []messageKey    `json:"saved,omitempty"`
+	Removed []messageKey    `json:"removed,omitempty"`
+	Records []recordKey     `json:"records,omitempty"`
+	Purge   *purgeNotice    `json:"purge,omitempty"`
+	Left    bool            `json:"left,omitempty"`
+	Event   json.RawMessage `json:"event,omitempty"`
+}
+
+// purgeNotice asks the other replicas to purge a number from what they keep
+// to themselves (see purgeReplica)
+type purgeNotice struct {
+	Digits  string `json:"digits"`
+	Project string `json:"project,omitempty"`
+	Scoped  bool   `json:"scoped,omitempty"`
+}
+
+// clusterState connects a replica to the shared store and to the other
+// replicas
+type clusterState struct {
+	replica string // Tells the replica's own notices apart from its peers'
+	store   *clusterStore
+	bus     clusterBus
+	resync  chan struct{} // Asks for the shared store to be reloaded
+	done    chan struct{}
+
+	// mu orders the replica's writes, so the store keeps the latest copy,
+	// and guards the fields below
+	mu     sync.Mutex
+	closed bool // Left the cluster: changes are no longer shared
+	// synced holds each kind's records by ID, encoded, as last written to
+	// or read from the store
+	synced map[string]map[string]string
+	// local holds the IDs of records configured at startup, e.g. read
+	// tokens. Every replica has its own until one is changed through the API.
+	local map[string]map[string]bool
+}
+
+// joinCluster opens the shared store (SQLite at SMSPIT_DB_PATH, or Postgres
+// at SMSPIT_CLUSTER_STORE), loads its messages and records and follows the
+// other replicas' changes over NATS or Redis at SMSPIT_CLUSTER_URL. Without
+// a URL the replica keeps everything to itself.
+func (s *Server) joinCluster() error {
+	if s.config.ClusterURL == "" {
+		return nil
+	}
+	store, err := openClusterStore(s.config.DBPath, s.config.ClusterStore)
+	if err != nil {
+		return err
+	}
+
+	c := &clusterState{
+		replica: uuid.New().String(),
+		store:   store,
+		resync:  make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		synced:  make(map[string]map[string]string, len(sharedKinds)),
+		local:   make(map[string]map[string]bool, len(sharedKinds)),
+	}
+	for kind, shared := range sharedKinds {
+		c.synced[kind] = shared.records(s)
+		c.local[kind] = make(map[string]bool, len(c.synced[kind]))
+		for id := range c.synced[kind] {
+			c.local[kind][id] = true
+		}
+	}
+
+	// Subscribe before loading, so nothing saved in between is missed.
+	// Notices for changes the load already has are applied again harmlessly.
+	notices := make(chan []byte, clusterBacklog)
+	c.bus, err = connectClusterBus(s.config.ClusterURL, s.config.ClusterSubject, notices, c.requestResync)
+	if err != nil {
+		store.db.Close()
+		return err
+	}
+	s.cluster = c
+	n, records, err := s.loadShared()
+	if err == nil {
+		err = store.seen(c.replica, time.Now().Unix())
+	}
+	if err != nil {
+		s.cluster = nil
+		c.bus.close()
+		store.db.Close()
+		return fmt.Errorf("loading the shared store: %w", err)
+	}
+	go s.followCluster(notices)
+	// Replicas that stopped while none was running left their deliveries
+	s.adoptStaleReplicas()
+
+	clusterURL := s.config.ClusterURL
+	if u, err := url.Parse(clusterURL); err == nil {
+		clusterURL = u.Redacted()
+	}
+	log.Printf("🛰️ Joined the cluster at %s as replica %s (%d messages and %d records in the shared store %s)", clusterURL, c.replica[:8], n, records, store.name)
+	if s.config.RateLimitPerNumber > 0 || s.config.RateLimitPerAccount > 0 {
+		log.Printf("⚠️ Rate limits are counted by each replica: the cluster lets through that rate per replica")
+	}
+	return nil
+}
+
+// leaveCluster stops following the other replicas, hands this replica's
+// deliveries and scheduled sends to them and closes the store
+func (s *Server) leaveCluster() {
+	c := s.cluster
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return // Already left
+	}
+	c.closed = true
+	close(c.done)
+	if err := c.store.seen(c.replica, 0); err == nil {
+		c.publish(clusterNotice{Left: true})
+	}
+	c.mu.Unlock()
+	c.bus.close()
+	c.store.db.Close()
+}
+
+// requestResync asks followCluster to reload the shared store
+func (c *clusterState) requestResync() {
+	select {
+	case c.resync <- struct{}{}:
+	default: // Already asked
+	}
+}
+
+// followCluster applies the other replicas' notices in the order they were
+// published, reloads the store when asked and keeps the replica's heartbeat
+func (s *Server) followCluster(notices <-chan []byte) {
+	c := s.cluster
+	heartbeat := time.NewTicker(clusterHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-c.resync:
+			if _, _, err := s.loadShared(); err != nil {
+				log.Printf("⚠️ Reloading the shared store: %v", err)
+			}
+		case data := <-notices:
+			s.applyClusterNotice(data)
+		case <-heartbeat.C:
+			if err := c.store.seen(c.replica, time.Now().Unix()); err != nil {
+				log.Printf("⚠️ Recording the replica's heartbeat: %v", err)
+				continue
+			}
+			s.adoptStaleReplicas()
+		}
+	}
+}
+
+// loadShared replaces the replica's messages and shared records with the
+// store's and returns how many of each there are
+func (s *Server) loadShared() (int, int, error) {
+	c := s.cluster
+	msgs, err := c.store.allMessages()
+	if err != nil {
+		return 0, 0, err
+	}
+	s.mu.Lock()
+	s.messages = msgs
+	if len(msgs) > 0 && msgs[0].seq > s.seq {
+		s.seq = msgs[0].seq
+	}
+	s.mu.Unlock()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	records, order, err := c.store.allRecords()
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, key := range order {
+		s.applyRecord(key, records[key])
+	}
+	// Records removed while the replica wasn't listening. Its configured
+	// ones were never in the store.
+	for kind, ids := range c.synced {
+		for id := range ids {
+			key := recordKey{Kind: kind, ID: id}
+			if _, ok := records[key]; !ok && !c.local[kind][id] {
+				s.applyRecord(key, nil)
+			}
+		}
+	}
+	return len(msgs), len(order), nil
+}
+
+// publish sends a notice to the other replicas
+func (c *clusterState) publish(notice clusterNotice) {
+	notice.Replica = c.replica
+	data, err := json.Marshal(notice)
+	if err == nil {
+		err = c.bus.publish(data)
+	}
+	if err != nil {
+		log.Printf("⚠️ Notifying the other replicas: %v", err)
+	}
+}
+
+// syncSaved writes the current copies of messages to the shared store and
+// tells the other replicas. A message stored for the first time gets its
+// sequence number from the store, replacing the one storeMessage gave it,
+// and this replica as its owner: the one running its delivery and
+// scheduled send.
+func (s *Server) syncSaved(keys ...messageKey) {
+	c := s.cluster
+	if c == nil || len(keys) == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+
+	wanted := make(map[messageKey]bool, len(keys))
+	for _, key := range keys {
+		wanted[key] = true
+	}
+	var msgs []Message
+	s.mu.Lock()
+	for i, msg := range s.messages {
+		if wanted[msg.key()] {
+			if msg.replica == "" {
+				s.messages[i].replica = c.replica
+				msg.replica = c.replica
+			}
+			msgs = append(msgs, msg)
+		}
+	}
+	s.mu.Unlock()
+	if len(msgs) == 0 {
+		return // Removed meanwhile
+	}
+
+	seqs, err := c.store.saveMessages(msgs)
+	if err != nil {
+		log.Printf("⚠️ Saving %d message(s) to the shared store: %v", len(msgs), err)
+		return
+	}
+	saved := make(map[messageKey]uint64, len(msgs))
+	for i, msg := range msgs {
+		saved[msg.key()] = seqs[i]
+	}
+	s.mu.Lock()
+	for i := range s.messages {
+		if seq, ok := saved[s.messages[i].key()]; ok {
+			s.messages[i].seq = seq
+			if seq > s.seq {
+				s.seq = seq
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	notice := clusterNotice{Saved: make([]messageKey, 0, len(msgs))}
+	for _, msg := range msgs {
+		notice.Saved = append(notice.Saved, msg.key())
+	}
+	c.publish(notice)
+}
+
+// syncRemoved deletes messages from the shared store and tells the other
+// replicas
+func (s *Server) syncRemoved(msgs ...Message) {
+	c := s.cluster
+	if c == nil || len(msgs) == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+
+	keys := make([]messageKey, len(msgs))
+	for i, msg := range msgs {
+		keys[i] = msg.key()
+	}
+	if err := c.store.removeMessages(keys); err != nil {
+		log.Printf("⚠️ Removing %d message(s) from the shared store: %v", len(keys), err)
+		return
+	}
+	c.publish(clusterNotice{Removed: keys})
+}
+
+// syncRecords writes the records of kinds changed since they were last
+// synced to the shared store, and tells the other replicas. Call it after
+// changing a shared store, without holding its lock.
+func (s *Server) syncRecords(kinds ...string) {
+	c := s.cluster
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+
+	changed := make(map[recordKey][]byte)
+	current := make(map[string]map[string]string, len(kinds))
+	for _, kind := range kinds {
+		records := sharedKinds[kind].records(s)
+		current[kind] = records
+		for id, data := range records {
+			if old, ok := c.synced[kind][id]; !ok || old != data {
+				changed[recordKey{Kind: kind, ID: id}] = []byte(data)
+			}
+		}
+		for id := range c.synced[kind] {
+			if _, ok := records[id]; !ok {
+				changed[recordKey{Kind: kind, ID: id}] = nil
+			}
+		}
+	}
+	if len(changed) == 0 {
+		return
+	}
+
+	if err := c.store.saveRecords(changed); err != nil {
+		log.Printf("⚠️ Saving %d record(s) to the shared store: %v", len(changed), err)
+		return
+	}
+	for kind, records := range current {
+		c.synced[kind] = records
+	}
+	notice := clusterNotice{Records: make([]recordKey, 0, len(changed))}
+	for key := range changed {
+		delete(c.local[key.Kind], key.ID)
+		notice.Records = append(notice.Records, key)
+	}
+	c.publish(notice)
+}
+
+// applyRecord stores another replica's copy of a record, or removes the
+// record when data is nil. The caller must hold the cluster's mu.
+func (s *Server) applyRecord(key recordKey, data []byte) {
+	c := s.cluster
+	kind, ok := sharedKinds[key.Kind]
+	if !ok {
+		return // Shared by a newer version
+	}
+	old, had := c.synced[key.Kind][key.ID]
+	if (data == nil && !had) || (data != nil && had && old == string(data)) {
+		return
+	}
+	if err := kind.apply(s, key.ID, data); err != nil {
+		log.Printf("⚠️ Applying shared %s %s: %v", key.Kind, key.ID, err)
+		return
+	}
+	if data == nil {
+		delete(c.synced[key.Kind], key.ID)
+	} else {
+		c.synced[key.Kind][key.ID] = string(data)
+	}
+	delete(c.local[key.Kind], key.ID)
+}
+
+// publishEvent relays a broadcast event to the other replicas' clients
+func (s *Server) publishEvent(event map[string]interface{}) {
+	c := s.cluster
+	if c == nil {
+		return
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		c.publish(clusterNotice{Event: data})
+	}
+}
+
+// publishPurge has the other replicas purge a number too
+func (s *Server) publishPurge(digits, project string, scoped bool) {
+	c := s.cluster
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		c.publish(clusterNotice{Purge: &purgeNotice{Digits: digits, Project: project, Scoped: scoped}})
+	}
+}
+
+// applyClusterNotice applies another replica's changes to this replica's
+// messages and records, repeats its purge, takes over its deliveries if it
+// left and passes its event on to this replica's clients
+func (s *Server) applyClusterNotice(data []byte) {
+	c := s.cluster
+	var notice clusterNotice
+	if err := json.Unmarshal(data, &notice); err != nil || notice.Replica == c.replica {
+		return
+	}
+
+	if len(notice.Saved) > 0 {
+		msgs, err := c.store.loadMessages(notice.Saved)
+		if err != nil {
+			log.Printf("⚠️ Reading the shared store: %v", err)
+			c.requestResync()
+		} else {
+			s.applySaved(msgs)
+		}
+	}
+	if len(notice.Removed) > 0 {
+		s.applyRemoved(notice.Removed)
+	}
+	if len(notice.Records) > 0 {
+		c.mu.Lock()
+		records, err := c.store.loadRecords(notice.Records)
+		if err != nil {
+			log.Printf("⚠️ Reading the shared store: %v", err)
+			c.requestResync()
+		}
+		for key, data := range records {
+			s.applyRecord(key, data)
+		}
+		c.mu.Unlock()
+	}
+	if p := notice.Purge; p != nil && p.Digits != "" {
+		s.purgeReplica(p.Digits, p.Project, p.Scoped)
+	}
+	if notice.Left {
+		s.adoptStaleReplicas()
+	}
+	if len(notice.Event) > 0 {
+		if event, err := decodeClusterEvent(notice.Event); err == nil {
+			s.deliverEvent(event)
+		}
+	}
+}
+
+// applySaved replaces the replica's copies of messages, adding those it
+// hasn't seen in front, newest first
+func (s *Server) applySaved(msgs []Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index := make(map[messageKey]int, len(s.messages))
+	for i, msg := range s.messages {
+		index[msg.key()] = i
+	}
+	var added []Message
+	for _, msg := range msgs {
+		if msg.seq > s.seq {
+			s.seq = msg.seq
+		}
+		if i, ok := index[msg.key()]; ok {
+			s.messages[i] = msg
+			continue
+		}
+		added = append([]Message{msg}, added...)
+	}
+	if len(added) > 0 {
+		s.messages = append(added, s.messages...)
+	}
+}
+
+// applyRemoved drops the replica's copies of messages
+func (s *Server) applyRemoved(keys []messageKey) {
+	removed := make(map[messageKey]bool, len(keys))
+	for _, key := range keys {
+		removed[key] = true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kept := make([]Message, 0, len(s.messages))
+	for _, msg := range s.messages {
+		if !removed[msg.key()] {
+			kept = append(kept, msg)
+		}
+	}
+	s.messages = kept
+}
+
+// adoptStaleReplicas takes over the messages of replicas that left or
+// stopped sending heartbeats, if no other replica claims them first
+func (s *Server) adoptStaleReplicas() {
+	c := s.cluster
+	before := time.Now().Add(-clusterStaleAfter).Unix()
+	stale, err := c.store.staleReplicas(before)
+	if err != nil {
+		log.Printf("⚠️ Checking for stopped replicas: %v", err)
+		return
+	}
+	for _, replica := range stale {
+		if replica == c.replica {
+			continue
+		}
+		if won, err := c.store.claim(replica, before); err != nil || !won {
+			continue
+		}
+		s.adoptMessages(replica)
+	}
+}
+
+// adoptMessages makes this replica the owner of a stopped replica's
+// messages still waiting for a scheduled send or delivery, and carries
+// those on
+func (s *Server) adoptMessages(replica string) {
+	c := s.cluster
+	var keys []messageKey
+	s.mu.RLock()
+	for _, msg := range s.messages {
+		if msg.replica == replica && (msg.Status == "scheduled" || msg.Status == "queued" || msg.Status == "sent") {
+			keys = append(keys, msg.key())
+		}
+	}
+	s.mu.RUnlock()
+	// The notices for their latest changes may not have arrived yet
+	if msgs, err := c.store.loadMessages(keys); err == nil {
+		s.applySaved(msgs)
+	}
+
+	var adopted []Message
+	s.mu.Lock()
+	for i, msg := range s.messages {
+		if msg.replica == replica && (msg.Status == "scheduled" || msg.Status == "queued" || msg.Status == "sent") {
+			s.messages[i].replica = c.replica
+			adopted = append(adopted, s.messages[i])
+		}
+	}
+	s.mu.Unlock()
+	keys = keys[:0]
+	for _, msg := range adopted {
+		keys = append(keys, msg.key())
+	}
+	s.syncSaved(keys...)
+
+	for _, msg := range adopted {
+		if msg.Status == "scheduled" && msg.SendAt != nil {
+			id := msg.ID
+			time.AfterFunc(time.Until(*msg.SendAt), func() { s.sendScheduled(id) })
+		} else if msg.Status != "scheduled" {
+			go s.resumeDelivery(msg)
+		}
+	}
+	log.Printf("🛰️ Took over %d message(s) from stopped replica %.8s", len(adopted), replica)
+}
+
+// decodeClusterEvent decodes a relayed event, with its message as a Message
+// as local subscribers (waits, GraphQL and gRPC streams) expect
+func decodeClusterEvent(data json.RawMessage) (map[string]interface{}, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	event := make(map[string]interface{}, len(fields))
+	for name, raw := range fields {
+		if name == "message" {
+			var msg Message
+			if err := json.Unmarshal(raw, &msg); err == nil {
+				event[name] = msg
+				continue
+			}
+		}
+		var value interface{}
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, err
+		}
+		event[name] = value
+	}
+	return event, nil
+}
+
+// checkCluster checks the connection to the other replicas and the shared
+// store
+func (s *Server) checkCluster() ReadinessCheck {
+	c := s.cluster
+	if c == nil {
+		return ReadinessCheck{Status: "skipped"}
+	}
+	if err := c.bus.check(); err != nil {
+		return ReadinessCheck{Status: "failed", Error: err.Error()}
+	}
+	if err := c.store.db.Ping(); err != nil {
+		return ReadinessCheck{Status: "failed", Path: c.store.name, Error: err.Error()}
+	}
+	return ReadinessCheck{Status: "ok", Path: c.store.name}
+}
@@ -0,0 +1,188 @@
+package smspit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/redis/go-redis/v9"
+)
+
+// clusterBus carries notices between the replicas: NATS or Redis pub/sub
+type clusterBus interface {
+	publish(data []byte) error
+	// check returns why the replica can't reach the other replicas, if it can't
+	check() error
+	close()
+}
+
+// connectClusterBus subscribes to subject at rawURL, passing notices to
+// notices. Notices that may have been missed, after a reconnect or when
+// notices is full, call resync instead.
+func connectClusterBus(rawURL, subject string, notices chan<- []byte, resync func()) (clusterBus, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid SMSPIT_CLUSTER_URL (must be a NATS or Redis URL such as nats://nats:4222 or redis://redis:6379)")
+	}
+	var bus clusterBus
+	switch u.Scheme {
+	case "redis", "rediss":
+		bus, err = connectRedisBus(rawURL, subject, notices, resync)
+	default:
+		bus, err = connectNATSBus(rawURL, subject, notices, resync)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("connecting to %s: %w", u.Redacted(), err)
+	}
+	return bus, nil
+}
+
+// forward passes a notice on, or asks for a resync if the replica has
+// fallen too far behind to take it
+func forward(notices chan<- []byte, data []byte, resync func()) {
+	select {
+	case notices <- data:
+	default:
+		log.Printf("⚠️ Fell behind the other replicas, reloading the shared store")
+		resync()
+	}
+}
+
+type natsBus struct {
+	conn    *nats.Conn
+	subject string
+}
+
+func connectNATSBus(rawURL, subject string, notices chan<- []byte, resync func()) (*natsBus, error) {
+	conn, err := nats.Connect(rawURL,
+		nats.Name("smspit"),
+		nats.MaxReconnects(-1),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				log.Printf("⚠️ Lost the cluster connection: %v", err)
+			}
+		}),
+		// Notices published while disconnected are gone, so catch up from
+		// the store
+		nats.ReconnectHandler(func(*nats.Conn) {
+			log.Printf("🛰️ Reconnected to the cluster")
+			resync()
+		}),
+		nats.ErrorHandler(func(_ *nats.Conn, _ *nats.Subscription, err error) {
+			if errors.Is(err, nats.ErrSlowConsumer) {
+				log.Printf("⚠️ Fell behind the other replicas, reloading the shared store")
+				resync()
+			}
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	_, err = conn.Subscribe(subject, func(m *nats.Msg) { forward(notices, m.Data, resync) })
+	if err == nil {
+		// Wait for the server to have the subscription, so nothing published
+		// after joining is missed
+		err = conn.Flush()
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("subscribing to %s: %w", subject, err)
+	}
+	return &natsBus{conn: conn, subject: subject}, nil
+}
+
+func (b *natsBus) publish(data []byte) error {
+	return b.conn.Publish(b.subject, data)
+}
+
+func (b *natsBus) check() error {
+	if !b.conn.IsConnected() {
+		return fmt.Errorf("not connected to NATS (%s)", b.conn.Status())
+	}
+	return nil
+}
+
+func (b *natsBus) close() {
+	b.conn.Close()
+}
+
+type redisBus struct {
+	client  *redis.Client
+	pubsub  *redis.PubSub
+	subject string
+	cancel  context.CancelFunc
+}
+
+func connectRedisBus(rawURL, subject string, notices chan<- []byte, resync func()) (*redisBus, error) {
+	opts, err := redis.ParseURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	client := redis.NewClient(opts)
+	ctx, cancel := context.WithCancel(context.Background())
+	pubsub := client.Subscribe(ctx, subject)
+	// Wait for the confirmation, so nothing published after joining is missed
+	if _, err := pubsub.Receive(ctx); err != nil {
+		cancel()
+		pubsub.Close()
+		client.Close()
+		return nil, fmt.Errorf("subscribing to %s: %w", subject, err)
+	}
+	b := &redisBus{client: client, pubsub: pubsub, subject: subject, cancel: cancel}
+	go b.receive(ctx, notices, resync)
+	return b, nil
+}
+
+// receive passes notices on until the bus closes. go-redis reconnects and
+// subscribes again on the next receive after an error.
+func (b *redisBus) receive(ctx context.Context, notices chan<- []byte, resync func()) {
+	for {
+		msg, err := b.pubsub.Receive(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Printf("⚠️ Lost the cluster connection: %v", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+		switch msg := msg.(type) {
+		case *redis.Subscription:
+			// Subscribed again after a reconnect: notices published meanwhile
+			// are gone, so catch up from the store
+			log.Printf("🛰️ Reconnected to the cluster")
+			resync()
+		case *redis.Message:
+			forward(notices, []byte(msg.Payload), resync)
+		}
+	}
+}
+
+func (b *redisBus) publish(data []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return b.client.Publish(ctx, b.subject, data).Err()
+}
+
+func (b *redisBus) check() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := b.client.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("not connected to Redis: %v", err)
+	}
+	return nil
+}
+
+func (b *redisBus) close() {
+	b.cancel()
+	b.pubsub.Close()
+	b.client.Close()
+}
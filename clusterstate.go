@@ -0,0 +1,726 @@
+package smspit
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+	"time"
+)
+
+// Kinds of records the replicas share besides messages. Each names a store
+// in sharedKinds.
+const (
+	kindTokens        = "tokens"
+	kindWebhooks      = "webhooks"
+	kindHooks         = "hooks"
+	kindTemplates     = "templates"
+	kindTagRules      = "tag-rules"
+	kindAutoReplies   = "auto-replies"
+	kindChaosRules    = "chaos-rules"
+	kindSearches      = "searches"
+	kindContacts      = "contacts"
+	kindSnapshots     = "snapshots"
+	kindOptOuts       = "opt-outs"
+	kindVerifications = "verifications"
+	kindNumbers       = "numbers"
+	kindSinchBatches  = "sinch-batches"
+	kindBrands        = "brands"
+	kindCampaigns     = "campaigns"
+	kindLookups       = "lookups"
+	kindSSOLogins     = "sso-logins"
+	kindSSOSessions   = "sso-sessions"
+)
+
+// recordKey identifies a shared record
+type recordKey struct {
+	Kind string `json:"kind"`
+	ID   string `json:"id"`
+}
+
+// sharedKind is a store the replicas keep the same, record by record.
+// Counters each replica keeps for itself (a webhook's deliveries, a rule's
+// hits) are left out of the records.
+type sharedKind struct {
+	// records returns the store's records by ID, encoded while it holds
+	// the store's lock
+	records func(s *Server) map[string]string
+	// apply stores another replica's copy of a record, or removes the
+	// record when data is nil
+	apply func(s *Server, id string, data []byte) error
+}
+
+// sharedKinds are the stores shared through the cluster, by kind
+var sharedKinds = map[string]sharedKind{
+	kindTokens: {
+		records: func(s *Server) map[string]string {
+			s.tokens.mu.RLock()
+			defer s.tokens.mu.RUnlock()
+			records := make(map[string]interface{}, len(s.tokens.tokens))
+			for _, t := range s.tokens.tokens {
+				records[t.ID] = t
+			}
+			return encodeRecords(records)
+		},
+		apply: func(s *Server, id string, data []byte) error {
+			var token APIToken
+			if data != nil {
+				if err := json.Unmarshal(data, &token); err != nil {
+					return err
+				}
+			}
+			s.tokens.mu.Lock()
+			defer s.tokens.mu.Unlock()
+			for secret, t := range s.tokens.tokens {
+				if t.ID == id {
+					delete(s.tokens.tokens, secret)
+				}
+			}
+			if data != nil {
+				s.tokens.tokens[token.Token] = &token
+			}
+			return nil
+		},
+	},
+	kindWebhooks: {
+		records: func(s *Server) map[string]string {
+			s.webhooks.mu.RLock()
+			defer s.webhooks.mu.RUnlock()
+			records := make(map[string]interface{}, len(s.webhooks.hooks))
+			for _, hook := range s.webhooks.hooks {
+				records[hook.ID] = webhookRecord{
+					ID: hook.ID, URL: hook.URL, Format: hook.Format, Secret: hook.Secret,
+					Project: hook.Project, Tags: hook.Tags, Numbers: hook.Numbers, CreatedAt: hook.CreatedAt,
+				}
+			}
+			return encodeRecords(records)
+		},
+		apply: func(s *Server, id string, data []byte) error {
+			var rec webhookRecord
+			if data != nil {
+				if err := json.Unmarshal(data, &rec); err != nil {
+					return err
+				}
+			}
+			s.webhooks.mu.Lock()
+			defer s.webhooks.mu.Unlock()
+			i := indexOf(s.webhooks.hooks, func(hook *Webhook) bool { return hook.ID == id })
+			switch {
+			case data == nil:
+				s.webhooks.hooks = removeAt(s.webhooks.hooks, i)
+			case i < 0:
+				s.webhooks.hooks = append(s.webhooks.hooks, &Webhook{ID: rec.ID, CreatedAt: rec.CreatedAt})
+				i = len(s.webhooks.hooks) - 1
+				fallthrough
+			default:
+				hook := s.webhooks.hooks[i]
+				hook.URL, hook.Format, hook.Secret, hook.Signed = rec.URL, rec.Format, rec.Secret, rec.Secret != ""
+				hook.Project, hook.Tags, hook.Numbers = rec.Project, rec.Tags, rec.Numbers
+			}
+			return nil
+		},
+	},
+	kindHooks: {
+		records: func(s *Server) map[string]string {
+			s.hooks.mu.Lock()
+			defer s.hooks.mu.Unlock()
+			records := make(map[string]interface{}, len(s.hooks.hooks))
+			for _, hook := range s.hooks.hooks {
+				records[hook.ID] = hookRecord{ID: hook.ID, Name: hook.Name, Expression: hook.Expression, Project: hook.Project, CreatedAt: hook.CreatedAt}
+			}
+			return encodeRecords(records)
+		},
+		apply: func(s *Server, id string, data []byte) error {
+			var hook *Hook
+			if data != nil {
+				var rec hookRecord
+				if err := json.Unmarshal(data, &rec); err != nil {
+					return err
+				}
+				var err error
+				if hook, err = newHook(HookRequest{Name: rec.Name, Expression: rec.Expression, Project: rec.Project}); err != nil {
+					return err
+				}
+				hook.ID, hook.CreatedAt = rec.ID, rec.CreatedAt
+			}
+			s.hooks.mu.Lock()
+			defer s.hooks.mu.Unlock()
+			i := indexOf(s.hooks.hooks, func(h *Hook) bool { return h.ID == id })
+			if hook != nil && i >= 0 {
+				hook.Runs, hook.Errors, hook.LastError = s.hooks.hooks[i].Runs, s.hooks.hooks[i].Errors, s.hooks.hooks[i].LastError
+			}
+			s.hooks.hooks = upsert(s.hooks.hooks, i, hook)
+			return nil
+		},
+	},
+	kindTemplates: {
+		records: func(s *Server) map[string]string {
+			s.templates.mu.RLock()
+			defer s.templates.mu.RUnlock()
+			records := make(map[string]interface{}, len(s.templates.templates))
+			for _, t := range s.templates.templates {
+				records[t.ID] = t
+			}
+			return encodeRecords(records)
+		},
+		apply: func(s *Server, id string, data []byte) error {
+			var t *Template
+			if err := decodeRecord(data, &t); err != nil {
+				return err
+			}
+			s.templates.mu.Lock()
+			defer s.templates.mu.Unlock()
+			i := indexOf(s.templates.templates, func(t Template) bool { return t.ID == id })
+			s.templates.templates = upsertValue(s.templates.templates, i, t)
+			return nil
+		},
+	},
+	kindTagRules: {
+		records: func(s *Server) map[string]string {
+			s.tagRules.mu.RLock()
+			defer s.tagRules.mu.RUnlock()
+			records := make(map[string]interface{}, len(s.tagRules.rules))
+			for _, rule := range s.tagRules.rules {
+				records[rule.ID] = rule
+			}
+			return encodeRecords(records)
+		},
+		apply: func(s *Server, id string, data []byte) error {
+			var rule *TagRule
+			if data != nil {
+				var rec TagRule
+				if err := json.Unmarshal(data, &rec); err != nil {
+					return err
+				}
+				var err error
+				if rule, err = newTagRule(rec.Tag, rec.Pattern, rec.Project); err != nil {
+					return err
+				}
+				rule.ID, rule.CreatedAt = rec.ID, rec.CreatedAt
+			}
+			s.tagRules.mu.Lock()
+			defer s.tagRules.mu.Unlock()
+			i := indexOf(s.tagRules.rules, func(r *TagRule) bool { return r.ID == id })
+			s.tagRules.rules = upsert(s.tagRules.rules, i, rule)
+			return nil
+		},
+	},
+	kindAutoReplies: {
+		records: func(s *Server) map[string]string {
+			s.autoReply.mu.Lock()
+			defer s.autoReply.mu.Unlock()
+			records := make(map[string]interface{}, len(s.autoReply.rules))
+			for _, rule := range s.autoReply.rules {
+				rec := *rule
+				rec.Hits = 0
+				records[rule.ID] = rec
+			}
+			return encodeRecords(records)
+		},
+		apply: func(s *Server, id string, data []byte) error {
+			var rule *AutoReplyRule
+			if data != nil {
+				var rec AutoReplyRule
+				if err := json.Unmarshal(data, &rec); err != nil {
+					return err
+				}
+				var err error
+				rule, err = newAutoReplyRule(AutoReplyRequest{
+					To: rec.To, From: rec.From, Body: rec.Body, Reply: rec.Reply,
+					Delay: rec.Delay, WebhookURL: rec.WebhookURL, Project: rec.Project,
+				})
+				if err != nil {
+					return err
+				}
+				rule.ID, rule.CreatedAt = rec.ID, rec.CreatedAt
+			}
+			s.autoReply.mu.Lock()
+			defer s.autoReply.mu.Unlock()
+			i := indexOf(s.autoReply.rules, func(r *AutoReplyRule) bool { return r.ID == id })
+			if rule != nil && i >= 0 {
+				rule.Hits = s.autoReply.rules[i].Hits
+			}
+			s.autoReply.rules = upsert(s.autoReply.rules, i, rule)
+			return nil
+		},
+	},
+	kindChaosRules: {
+		records: func(s *Server) map[string]string {
+			s.chaos.mu.Lock()
+			defer s.chaos.mu.Unlock()
+			records := make(map[string]interface{}, len(s.chaos.rules))
+			for _, rule := range s.chaos.rules {
+				rec := *rule
+				rec.Hits = 0
+				records[rule.ID] = rec
+			}
+			return encodeRecords(records)
+		},
+		apply: func(s *Server, id string, data []byte) error {
+			var rule *ChaosRule
+			if data != nil {
+				var rec ChaosRule
+				if err := json.Unmarshal(data, &rec); err != nil {
+					return err
+				}
+				var err error
+				rule, err = newChaosRule(ChaosRequest{
+					Status: rec.Status, Code: rec.Code, Message: rec.Message, RetryAfter: rec.RetryAfter,
+					Latency: rec.Latency, Jitter: rec.Jitter, Numbers: rec.Numbers, Percentage: rec.Percentage, Project: rec.Project,
+				})
+				if err != nil {
+					return err
+				}
+				rule.ID, rule.CreatedAt, rule.ExpiresAt = rec.ID, rec.CreatedAt, rec.ExpiresAt
+			}
+			s.chaos.mu.Lock()
+			defer s.chaos.mu.Unlock()
+			i := indexOf(s.chaos.rules, func(r *ChaosRule) bool { return r.ID == id })
+			if rule != nil && i >= 0 {
+				rule.Hits = s.chaos.rules[i].Hits
+			}
+			s.chaos.rules = upsert(s.chaos.rules, i, rule)
+			return nil
+		},
+	},
+	kindSearches: {
+		records: func(s *Server) map[string]string {
+			s.searches.mu.RLock()
+			defer s.searches.mu.RUnlock()
+			records := make(map[string]interface{}, len(s.searches.searches))
+			for _, search := range s.searches.searches {
+				search.Count, search.Unread = 0, 0
+				records[search.ID] = search
+			}
+			return encodeRecords(records)
+		},
+		apply: func(s *Server, id string, data []byte) error {
+			var search *SavedSearch
+			if err := decodeRecord(data, &search); err != nil {
+				return err
+			}
+			s.searches.mu.Lock()
+			defer s.searches.mu.Unlock()
+			i := indexOf(s.searches.searches, func(search SavedSearch) bool { return search.ID == id })
+			s.searches.searches = upsertValue(s.searches.searches, i, search)
+			return nil
+		},
+	},
+	kindContacts: {
+		// Contacts are keyed by project and number digits
+		records: func(s *Server) map[string]string {
+			s.contacts.mu.RLock()
+			defer s.contacts.mu.RUnlock()
+			records := make(map[string]interface{})
+			for project, contacts := range s.contacts.projects {
+				for digits, contact := range contacts {
+					records[project+"|"+digits] = contact
+				}
+			}
+			return encodeRecords(records)
+		},
+		apply: func(s *Server, id string, data []byte) error {
+			var contact *Contact
+			if err := decodeRecord(data, &contact); err != nil {
+				return err
+			}
+			project, digits, _ := strings.Cut(id, "|")
+			s.contacts.mu.Lock()
+			defer s.contacts.mu.Unlock()
+			if contact == nil {
+				delete(s.contacts.projects[project], digits)
+				return nil
+			}
+			if s.contacts.projects == nil {
+				s.contacts.projects = make(map[string]map[string]Contact)
+			}
+			if s.contacts.projects[project] == nil {
+				s.contacts.projects[project] = make(map[string]Contact)
+			}
+			s.contacts.projects[project][digits] = *contact
+			return nil
+		},
+	},
+	kindSnapshots: {
+		// Snapshots are keyed by project and name
+		records: func(s *Server) map[string]string {
+			s.snapshots.mu.RLock()
+			defer s.snapshots.mu.RUnlock()
+			records := make(map[string]interface{})
+			for project, byName := range s.snapshots.snapshots {
+				for name, snap := range byName {
+					rec := snapshotRecord{Snapshot: *snap, Messages: make([]storedMessage, len(snap.messages))}
+					for i, msg := range snap.messages {
+						rec.Messages[i] = newStoredMessage(msg)
+					}
+					records[project+"/"+name] = rec
+				}
+			}
+			return encodeRecords(records)
+		},
+		apply: func(s *Server, id string, data []byte) error {
+			var rec *snapshotRecord
+			if err := decodeRecord(data, &rec); err != nil {
+				return err
+			}
+			project, name, _ := strings.Cut(id, "/")
+			s.snapshots.mu.Lock()
+			defer s.snapshots.mu.Unlock()
+			if rec == nil {
+				delete(s.snapshots.snapshots[project], name)
+				return nil
+			}
+			snap := rec.Snapshot
+			snap.messages = make([]Message, len(rec.Messages))
+			for i, stored := range rec.Messages {
+				snap.messages[i] = stored.message(0)
+			}
+			if s.snapshots.snapshots[project] == nil {
+				s.snapshots.snapshots[project] = make(map[string]*Snapshot)
+			}
+			s.snapshots.snapshots[project][name] = &snap
+			return nil
+		},
+	},
+	kindOptOuts: {
+		records: func(s *Server) map[string]string {
+			s.optOuts.mu.Lock()
+			defer s.optOuts.mu.Unlock()
+			records := make(map[string]interface{}, len(s.optOuts.optOuts))
+			for key, o := range s.optOuts.optOuts {
+				records[key] = o
+			}
+			return encodeRecords(records)
+		},
+		apply: func(s *Server, id string, data []byte) error {
+			var o *OptOut
+			if err := decodeRecord(data, &o); err != nil {
+				return err
+			}
+			s.optOuts.mu.Lock()
+			defer s.optOuts.mu.Unlock()
+			switch {
+			case o == nil:
+				delete(s.optOuts.optOuts, id)
+			case s.optOuts.optOuts == nil:
+				s.optOuts.optOuts = map[string]*OptOut{id: o}
+			default:
+				s.optOuts.optOuts[id] = o
+			}
+			return nil
+		},
+	},
+	kindVerifications: {
+		records: func(s *Server) map[string]string {
+			s.verify.mu.Lock()
+			defer s.verify.mu.Unlock()
+			records := make(map[string]interface{}, len(s.verify.verifications))
+			for key, ver := range s.verify.verifications {
+				records[key] = ver
+			}
+			return encodeRecords(records)
+		},
+		apply: func(s *Server, id string, data []byte) error {
+			var ver *verification
+			if err := decodeRecord(data, &ver); err != nil {
+				return err
+			}
+			s.verify.mu.Lock()
+			defer s.verify.mu.Unlock()
+			if ver == nil {
+				delete(s.verify.verifications, id)
+			} else {
+				s.verify.verifications[id] = ver
+			}
+			return nil
+		},
+	},
+	kindNumbers: {
+		records: func(s *Server) map[string]string {
+			s.numbers.mu.Lock()
+			defer s.numbers.mu.Unlock()
+			records := make(map[string]interface{}, len(s.numbers.numbers))
+			for _, n := range s.numbers.numbers {
+				records[n.SID] = n
+			}
+			return encodeRecords(records)
+		},
+		apply: func(s *Server, id string, data []byte) error {
+			var n *PhoneNumber
+			if err := decodeRecord(data, &n); err != nil {
+				return err
+			}
+			s.numbers.mu.Lock()
+			defer s.numbers.mu.Unlock()
+			i := indexOf(s.numbers.numbers, func(n *PhoneNumber) bool { return n.SID == id })
+			s.numbers.numbers = upsert(s.numbers.numbers, i, n)
+			return nil
+		},
+	},
+	kindSinchBatches: {
+		records: func(s *Server) map[string]string {
+			s.sinch.mu.Lock()
+			defer s.sinch.mu.Unlock()
+			records := make(map[string]interface{}, len(s.sinch.batches))
+			for _, b := range s.sinch.batches {
+				records[b.ID] = b
+			}
+			return encodeRecords(records)
+		},
+		apply: func(s *Server, id string, data []byte) error {
+			var batch *sinchBatch
+			if err := decodeRecord(data, &batch); err != nil {
+				return err
+			}
+			s.sinch.mu.Lock()
+			defer s.sinch.mu.Unlock()
+			// Batches are replaced rather than changed, as handlers read them
+			// outside the lock
+			i := indexOf(s.sinch.batches, func(b *sinchBatch) bool { return b.ID == id })
+			switch {
+			case batch == nil:
+				s.sinch.batches = removeAt(s.sinch.batches, i)
+			case i >= 0:
+				s.sinch.batches[i] = batch
+			default:
+				// Newest first
+				s.sinch.batches = append([]*sinchBatch{batch}, s.sinch.batches...)
+			}
+			return nil
+		},
+	},
+	kindBrands: {
+		records: func(s *Server) map[string]string {
+			s.a2p.mu.Lock()
+			defer s.a2p.mu.Unlock()
+			records := make(map[string]interface{}, len(s.a2p.brands))
+			for _, b := range s.a2p.brands {
+				records[b.SID] = b
+			}
+			return encodeRecords(records)
+		},
+		apply: func(s *Server, id string, data []byte) error {
+			var brand *Brand
+			if err := decodeRecord(data, &brand); err != nil {
+				return err
+			}
+			s.a2p.mu.Lock()
+			defer s.a2p.mu.Unlock()
+			i := indexOf(s.a2p.brands, func(b *Brand) bool { return b.SID == id })
+			s.a2p.brands = upsert(s.a2p.brands, i, brand)
+			return nil
+		},
+	},
+	kindCampaigns: {
+		records: func(s *Server) map[string]string {
+			s.a2p.mu.Lock()
+			defer s.a2p.mu.Unlock()
+			records := make(map[string]interface{}, len(s.a2p.campaigns))
+			for _, c := range s.a2p.campaigns {
+				records[c.SID] = c
+			}
+			return encodeRecords(records)
+		},
+		apply: func(s *Server, id string, data []byte) error {
+			var campaign *Campaign
+			if err := decodeRecord(data, &campaign); err != nil {
+				return err
+			}
+			s.a2p.mu.Lock()
+			defer s.a2p.mu.Unlock()
+			i := indexOf(s.a2p.campaigns, func(c *Campaign) bool { return c.SID == id })
+			s.a2p.campaigns = upsert(s.a2p.campaigns, i, campaign)
+			return nil
+		},
+	},
+	kindLookups: {
+		records: func(s *Server) map[string]string {
+			s.lookups.mu.RLock()
+			defer s.lookups.mu.RUnlock()
+			records := make(map[string]interface{}, len(s.lookups.fixtures))
+			for number, fixture := range s.lookups.fixtures {
+				records[number] = fixture
+			}
+			return encodeRecords(records)
+		},
+		apply: func(s *Server, id string, data []byte) error {
+			var fixture *LookupFixture
+			if err := decodeRecord(data, &fixture); err != nil {
+				return err
+			}
+			s.lookups.mu.Lock()
+			defer s.lookups.mu.Unlock()
+			if fixture == nil {
+				delete(s.lookups.fixtures, id)
+			} else {
+				s.lookups.fixtures[id] = *fixture
+			}
+			return nil
+		},
+	},
+	// SSO logins and sessions are shared so the provider's callback, and the
+	// signed-in user's requests, can reach any replica
+	kindSSOLogins: {
+		records: func(s *Server) map[string]string {
+			records := make(map[string]interface{})
+			if s.oidc == nil {
+				return encodeRecords(records)
+			}
+			s.oidc.mu.Lock()
+			defer s.oidc.mu.Unlock()
+			for state, l := range s.oidc.logins {
+				records[state] = ssoLoginRecord{Nonce: l.nonce, Verifier: l.verifier, RedirectURL: l.redirectURL, Next: l.next, Expires: l.expires}
+			}
+			return encodeRecords(records)
+		},
+		apply: func(s *Server, id string, data []byte) error {
+			var rec *ssoLoginRecord
+			if err := decodeRecord(data, &rec); err != nil || s.oidc == nil {
+				return err
+			}
+			s.oidc.mu.Lock()
+			defer s.oidc.mu.Unlock()
+			if rec == nil {
+				delete(s.oidc.logins, id)
+			} else {
+				s.oidc.logins[id] = oidcLogin{nonce: rec.Nonce, verifier: rec.Verifier, redirectURL: rec.RedirectURL, next: rec.Next, expires: rec.Expires}
+			}
+			return nil
+		},
+	},
+	kindSSOSessions: {
+		records: func(s *Server) map[string]string {
+			records := make(map[string]interface{})
+			if s.oidc == nil {
+				return encodeRecords(records)
+			}
+			s.oidc.mu.Lock()
+			defer s.oidc.mu.Unlock()
+			for id, sess := range s.oidc.sessions {
+				records[id] = ssoSessionRecord{Token: sess.token, Expires: sess.expires}
+			}
+			return encodeRecords(records)
+		},
+		apply: func(s *Server, id string, data []byte) error {
+			var rec *ssoSessionRecord
+			if err := decodeRecord(data, &rec); err != nil || s.oidc == nil {
+				return err
+			}
+			s.oidc.mu.Lock()
+			defer s.oidc.mu.Unlock()
+			if rec == nil {
+				delete(s.oidc.sessions, id)
+			} else {
+				s.oidc.sessions[id] = oidcSession{token: rec.Token, expires: rec.Expires}
+			}
+			return nil
+		},
+	},
+}
+
+// webhookRecord is a webhook as the shared store holds it: its settings,
+// including the secret the API doesn't serialize, without its delivery
+// counters
+type webhookRecord struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Format    string    `json:"format"`
+	Secret    string    `json:"secret,omitempty"`
+	Project   string    `json:"project,omitempty"`
+	Tags      []string  `json:"tags,omitempty"`
+	Numbers   []string  `json:"numbers,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// hookRecord is a processing hook without its counters; replicas compile
+// the expression themselves
+type hookRecord struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name,omitempty"`
+	Expression string    `json:"expression"`
+	Project    string    `json:"project,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// snapshotRecord is a snapshot with its messages
+type snapshotRecord struct {
+	Snapshot
+	Messages []storedMessage `json:"messages"`
+}
+
+type ssoLoginRecord struct {
+	Nonce       string    `json:"nonce"`
+	Verifier    string    `json:"verifier"`
+	RedirectURL string    `json:"redirect_url"`
+	Next        string    `json:"next"`
+	Expires     time.Time `json:"expires"`
+}
+
+type ssoSessionRecord struct {
+	Token   *APIToken `json:"token"`
+	Expires time.Time `json:"expires"`
+}
+
+// decodeRecord decodes data into *v, leaving it nil when data is
+func decodeRecord(data []byte, v interface{}) error {
+	if data == nil {
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
+
+// indexOf returns the index of the first item matching, or -1
+func indexOf[T any](items []T, match func(T) bool) int {
+	for i, item := range items {
+		if match(item) {
+			return i
+		}
+	}
+	return -1
+}
+
+// removeAt removes items[i], if i is an index
+func removeAt[T any](items []T, i int) []T {
+	if i < 0 {
+		return items
+	}
+	return append(items[:i:i], items[i+1:]...)
+}
+
+// upsert replaces items[i] with item, appends it when i is -1, or removes
+// items[i] when item is nil
+func upsert[T any](items []*T, i int, item *T) []*T {
+	switch {
+	case item == nil:
+		return removeAt(items, i)
+	case i < 0:
+		return append(items, item)
+	}
+	items[i] = item
+	return items
+}
+
+// upsertValue is upsert for a slice of values
+func upsertValue[T any](items []T, i int, item *T) []T {
+	switch {
+	case item == nil:
+		return removeAt(items, i)
+	case i < 0:
+		return append(items, *item)
+	}
+	items[i] = *item
+	return items
+}
+
+// encodeRecords encodes a kind's records for comparing and storing
+func encodeRecords(records map[string]interface{}) map[string]string {
+	encoded := make(map[string]string, len(records))
+	for id, record := range records {
+		data, err := json.Marshal(record)
+		if err != nil {
+			log.Printf("⚠️ Encoding shared record %s: %v", id, err)
+			continue
+		}
+		encoded[id] = string(data)
+	}
+	return encoded
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/substrate-app/smspit/client"
+)
+
+const cliUsage = `Usage: smspit <command> [flags]
+
+Commands:
+  serve     Run the SMSpit server (default; --config FILE, --print-config)
+  tail      Stream captured messages as they arrive
+  send      Capture a message
+  list      List or search captured messages
+  clear     Delete all captured messages
+
+Connection flags (all commands except serve):
+  --url       Web/API server (env SMSPIT_URL, default http://localhost:8080)
+  --api-url   Capture server (env SMSPIT_API_URL, default http://localhost:9080)
+  --token     API token (env SMSPIT_TOKEN)
+  --project   Project namespace (env SMSPIT_PROJECT)
+
+Run 'smspit <command> -h' for command flags.
+`
+
+// cliConn holds the connection flags shared by the client commands
+type cliConn struct {
+	url     string
+	apiURL  string
+	token   string
+	project string
+}
+
+func (c *cliConn) register(fs *flag.FlagSet) {
+	fs.StringVar(&c.url, "url", envOr("SMSPIT_URL", "http://localhost:8080"), "web/API server URL")
+	fs.StringVar(&c.apiURL, "api-url", envOr("SMSPIT_API_URL", "http://localhost:9080"), "capture server URL")
+	fs.StringVar(&c.token, "token", envOr("SMSPIT_TOKEN", ""), "API token")
+	fs.StringVar(&c.project, "project", envOr("SMSPIT_PROJECT", ""), "project namespace")
+}
+
+func (c *cliConn) client() *client.Client {
+	cl := client.New(c.url, c.apiURL)
+	cl.Token = c.token
+	cl.Project = c.project
+	return cl
+}
+
+// runCLI runs a client subcommand and returns the process exit code
+func runCLI(cmd string, args []string) int {
+	var err error
+	switch cmd {
+	case "tail":
+		err = cliTail(args)
+	case "send":
+		err = cliSend(args)
+	case "list", "ls":
+		err = cliList(args)
+	case "clear":
+		err = cliClear(args)
+	case "help", "-h", "--help":
+		fmt.Print(cliUsage)
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "smspit: unknown command %q\n\n%s", cmd, cliUsage)
+		return 2
+	}
+
+	if err == flag.ErrHelp {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "smspit %s: %v\n", cmd, err)
+		return 1
+	}
+	return 0
+}
+
+// printMessage writes one message as a line of text, or as JSON
+func printMessage(w io.Writer, msg client.Message, asJSON bool) {
+	if asJSON {
+		json.NewEncoder(w).Encode(msg)
+		return
+	}
+	from := msg.From
+	if from == "" {
+		from = "-"
+	}
+	arrow := "→"
+	if msg.Direction == "inbound" {
+		arrow = "←"
+	}
+	body := strings.ReplaceAll(msg.Body, "\n", " ")
+	fmt.Fprintf(w, "%s  %s %s %s  %s\n", msg.CreatedAt.Local().Format("2006-01-02 15:04:05"), from, arrow, msg.To, body)
+}
+
+// ANSI escapes the list command asks the server to mark matches with
+const (
+	ansiHighlight = "\x1b[1;33m"
+	ansiReset     = "\x1b[0m"
+)
+
+// highlighted shows why a search result matched: its body becomes the
+// highlighted snippet, in color on a terminal and plain otherwise
+func highlighted(msg client.Message, color bool) client.Message {
+	for field, value := range msg.Highlight {
+		if !color {
+			value = strings.NewReplacer(ansiHighlight, "", ansiReset, "").Replace(value)
+		}
+		switch field {
+		case "body":
+			msg.Body = value
+		case "to":
+			msg.To = value
+		case "from":
+			msg.From = value
+		}
+	}
+	return msg
+}
+
+// isTerminal reports whether f is a terminal rather than a file or pipe
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// cliTail prints recent messages, then streams new ones over the WebSocket
+func cliTail(args []string) error {
+	fs := flag.NewFlagSet("tail", flag.ContinueOnError)
+	var conn cliConn
+	conn.register(fs)
+	n := fs.Int("n", 10, "number of recent messages to print first")
+	to := fs.String("to", "", "only show messages to numbers containing this")
+	asJSON := fs.Bool("json", false, "print messages as NDJSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	out := bufio.NewWriter(os.Stdout)
+	matches := func(msg client.Message) bool {
+		return *to == "" || strings.Contains(msg.To, *to)
+	}
+
+	if *n > 0 {
+		list, err := conn.client().Search(ctx, client.SearchOptions{ListOptions: client.ListOptions{Limit: *n}, To: *to})
+		if err != nil {
+			return err
+		}
+		for i := len(list.Messages) - 1; i >= 0; i-- {
+			printMessage(out, list.Messages[i], *asJSON)
+		}
+		out.Flush()
+	}
+
+	wsURL, err := url.Parse(strings.TrimRight(conn.url, "/") + "/ws")
+	if err != nil {
+		return err
+	}
+	wsURL.Scheme = strings.Replace(wsURL.Scheme, "http", "ws", 1)
+	if conn.project != "" {
+		wsURL.RawQuery = url.Values{"project": {conn.project}}.Encode()
+	}
+	header := http.Header{}
+	if conn.token != "" {
+		header.Set("Authorization", "Bearer "+conn.token)
+	}
+
+	ws, _, err := websocket.DefaultDialer.DialContext(ctx, wsURL.String(), header)
+	if err != nil {
+		return fmt.Errorf("connecting to %s: %v", wsURL, err)
+	}
+	defer ws.Close()
+
+	go func() {
+		<-ctx.Done()
+		ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+		ws.Close()
+	}()
+
+	for {
+		var event struct {
+			Type    string         `json:"type"`
+			Message client.Message `json:"message"`
+		}
+		if err := ws.ReadJSON(&event); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if websocket.IsCloseError(err, websocket.CloseGoingAway) {
+				return fmt.Errorf("server at %s shut down", conn.url)
+			}
+			return err
+		}
+		if event.Type != "new_message" || !matches(event.Message) {
+			continue
+		}
+		printMessage(out, event.Message, *asJSON)
+		out.Flush()
+	}
+}
+
+// cliSend captures a message. A body of "-" is read from stdin.
+func cliSend(args []string) error {
+	fs := flag.NewFlagSet("send", flag.ContinueOnError)
+	var conn cliConn
+	conn.register(fs)
+	to := fs.String("to", "", "recipient number (required)")
+	from := fs.String("from", "", "sender number or ID")
+	body := fs.String("body", "", "message text, or - to read stdin")
+	tags := fs.String("tags", "", "comma-separated tags")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *to == "" {
+		return fmt.Errorf("--to is required")
+	}
+
+	text := *body
+	if text == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		text = strings.TrimRight(string(data), "\n")
+	}
+
+	req := client.SendRequest{To: *to, From: *from, Body: text}
+	if *tags != "" {
+		req.Tags = strings.Split(*tags, ",")
+	}
+
+	resp, err := conn.client().Send(context.Background(), req)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s %s\n", resp.ID, resp.Status)
+	return nil
+}
+
+// cliList prints captured messages, newest first
+func cliList(args []string) error {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	var conn cliConn
+	conn.register(fs)
+	limit := fs.Int("limit", 20, "maximum messages to print")
+	to := fs.String("to", "", "only messages to numbers containing this")
+	query := fs.String("q", "", "only messages whose body or recipient contains this")
+	asJSON := fs.Bool("json", false, "print messages as NDJSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	opts := client.SearchOptions{
+		ListOptions: client.ListOptions{Limit: *limit},
+		Query:       *query,
+		To:          *to,
+	}
+	if !*asJSON {
+		opts.HighlightPre, opts.HighlightPost = ansiHighlight, ansiReset
+	}
+	list, err := conn.client().Search(context.Background(), opts)
+	if err != nil {
+		return err
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	color := isTerminal(os.Stdout)
+	for _, msg := range list.Messages {
+		if !*asJSON {
+			msg = highlighted(msg, color)
+		}
+		printMessage(out, msg, *asJSON)
+	}
+	if !*asJSON && list.Total > list.Count {
+		fmt.Fprintf(out, "(%d of %d messages)\n", list.Count, list.Total)
+	}
+	return nil
+}
+
+// cliClear deletes every message in the project
+func cliClear(args []string) error {
+	fs := flag.NewFlagSet("clear", flag.ContinueOnError)
+	var conn cliConn
+	conn.register(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if err := conn.client().Clear(context.Background()); err != nil {
+		return err
+	}
+	fmt.Println("cleared")
+	return nil
+}
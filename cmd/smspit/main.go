@@ -0,0 +1,127 @@
+// Command smspit runs the SMSpit server and provides a small CLI for talking
+// to a running instance.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/substrate-app/smspit"
+)
+
+func main() {
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] == "serve" {
+		args = args[1:]
+	} else if len(args) > 0 && (!strings.HasPrefix(args[0], "-") || args[0] == "-h" || args[0] == "--help") {
+		os.Exit(runCLI(args[0], args[1:]))
+	}
+	serve(args)
+}
+
+// serve runs the SMSpit server until interrupted
+func serve(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	configPath := fs.String("config", os.Getenv("SMSPIT_CONFIG"), "YAML or TOML config file (env SMSPIT_CONFIG)")
+	printConfig := fs.Bool("print-config", false, "print the effective configuration as YAML and exit")
+	flags := registerSettingFlags(fs)
+	fs.Parse(args)
+
+	config, settings, err := smspit.LoadConfig(*configPath, flags.overrides())
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	if *printConfig {
+		if err := smspit.WriteConfig(os.Stdout, config, settings); err != nil {
+			log.Fatalf("Failed to print config: %v", err)
+		}
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	inst, err := smspit.New(config).Start(ctx)
+	if err != nil {
+		log.Fatalf("Failed to start: %v", err)
+	}
+
+	if inst.APIURL == inst.WebURL {
+		log.Printf("🚀 SMSpit listening on %s (single port)", inst.WebURL)
+		log.Printf("   POST %s/send - Capture SMS", inst.APIURL)
+	} else {
+		log.Printf("🚀 SMSpit API server listening on %s", inst.APIURL)
+		log.Printf("   POST %s/send - Capture SMS", inst.APIURL)
+		log.Printf("🌐 SMSpit Web UI listening on %s", inst.WebURL)
+	}
+	log.Printf("   Open %s in your browser", inst.WebURL)
+	log.Printf("📱 SMSpit is ready to capture SMS messages!")
+
+	<-ctx.Done()
+
+	log.Println("Shutting down...")
+	inst.Close()
+}
+
+// flagAliases are extra short names for common setting flags
+var flagAliases = map[string]string{
+	"db": "db-path",
+}
+
+// settingFlag is a command-line flag for one setting
+type settingFlag struct {
+	key    string
+	value  string
+	set    bool
+	isBool bool
+}
+
+func (f *settingFlag) String() string   { return f.value }
+func (f *settingFlag) IsBoolFlag() bool { return f.isBool }
+
+func (f *settingFlag) Set(value string) error {
+	f.value, f.set = value, true
+	return nil
+}
+
+// settingFlags are the flags mirroring every SMSPIT_* setting
+type settingFlags []*settingFlag
+
+// registerSettingFlags adds a flag per setting (web_port → --web-port) that
+// overrides the environment and the config file
+func registerSettingFlags(fs *flag.FlagSet) settingFlags {
+	var flags settingFlags
+	for _, s := range smspit.ConfigSettings() {
+		f := &settingFlag{key: s.Key, value: s.Default, isBool: s.Default == "true" || s.Default == "false"}
+		fs.Var(f, strings.ReplaceAll(s.Key, "_", "-"), "env "+s.Env)
+		flags = append(flags, f)
+	}
+	for alias, name := range flagAliases {
+		fs.Var(fs.Lookup(name).Value, alias, "alias for --"+name)
+	}
+	return flags
+}
+
+// overrides returns the values of the flags given on the command line
+func (flags settingFlags) overrides() map[string]string {
+	overrides := make(map[string]string)
+	for _, f := range flags {
+		if f.set {
+			overrides[f.key] = f.value
+		}
+	}
+	return overrides
+}
+
+// envOr returns the environment variable key, or def when it is unset
+func envOr(key, def string) string {
+	if val := os.Getenv(key); val != "" {
+		return val
+	}
+	return def
+}
@@ -0,0 +1,192 @@
+package smspit
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// concatTimeout is how long the parts of a concatenated message are held
+// for the rest to arrive. After that the message is captured with the parts
+// it has, tagged "incomplete".
+const concatTimeout = 2 * time.Minute
+
+// Concatenation information elements in a UDH (3GPP TS 23.040 9.2.3.24)
+const (
+	ieConcat8  = 0x00 // 8-bit reference number
+	ieConcat16 = 0x08 // 16-bit reference number
+)
+
+// ConcatInfo describes a message reassembled from concatenated parts
+type ConcatInfo struct {
+	Ref      int `json:"ref"`      // Reference number shared by the parts
+	Total    int `json:"total"`    // Parts the sender said there are
+	Received int `json:"received"` // Parts that arrived; fewer when incomplete
+}
+
+// MessagePart is one part of a concatenated message as it was received
+type MessagePart struct {
+	Seq        int       `json:"seq"`
+	UDH        string    `json:"udh"` // User data header, in hex
+	Body       string    `json:"body"`
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+// udhConcat is the concatenation header of one part
+type udhConcat struct {
+	ref, total, seq int
+}
+
+// parseConcatUDH finds the concatenation information element in a user data
+// header (length byte included)
+func parseConcatUDH(udh []byte) (udhConcat, bool) {
+	if len(udh) == 0 || int(udh[0]) != len(udh)-1 {
+		return udhConcat{}, false
+	}
+	for ies := udh[1:]; len(ies) >= 2; {
+		iei, n := ies[0], int(ies[1])
+		if len(ies) < 2+n {
+			break
+		}
+		data := ies[2 : 2+n]
+		ies = ies[2+n:]
+
+		var c udhConcat
+		switch {
+		case iei == ieConcat8 && n == 3:
+			c = udhConcat{ref: int(data[0]), total: int(data[1]), seq: int(data[2])}
+		case iei == ieConcat16 && n == 4:
+			c = udhConcat{ref: int(data[0])<<8 | int(data[1]), total: int(data[2]), seq: int(data[3])}
+		default:
+			continue
+		}
+		if c.total == 0 || c.seq == 0 || c.seq > c.total {
+			return udhConcat{}, false
+		}
+		return c, true
+	}
+	return udhConcat{}, false
+}
+
+// pendingConcat collects the parts of one concatenated message
+type pendingConcat struct {
+	msg   Message // The first part's message, without a body yet
+	ref   int
+	total int
+	parts map[int]MessagePart
+	timer *time.Timer
+}
+
+// concatStore holds concatenated messages until all their parts arrive
+type concatStore struct {
+	mu      sync.Mutex
+	pending map[string]*pendingConcat
+}
+
+// addConcatPart buffers one part of a concatenated message. When it is the
+// last one missing, the reassembled message is returned for capture and
+// complete is true. Otherwise the message so far is returned, without a
+// body: the reassembled message keeps the ID of the first part received.
+// A nil udh records a part whose concatenation came from elsewhere, such as
+// SMPP's sar_* parameters.
+func (s *Server) addConcatPart(part Message, udh []byte, c udhConcat) (msg Message, complete bool) {
+	key := strings.Join([]string{part.Project, part.From, part.To, fmt.Sprint(c.ref), fmt.Sprint(c.total)}, "|")
+
+	s.concat.mu.Lock()
+	defer s.concat.mu.Unlock()
+	if s.concat.pending == nil {
+		s.concat.pending = make(map[string]*pendingConcat)
+	}
+	pending := s.concat.pending[key]
+	if pending == nil {
+		first := part
+		first.Body = ""
+		pending = &pendingConcat{msg: first, ref: c.ref, total: c.total, parts: make(map[int]MessagePart)}
+		pending.timer = time.AfterFunc(concatTimeout, func() { s.flushConcat(key) })
+		s.concat.pending[key] = pending
+	}
+	pending.parts[c.seq] = MessagePart{
+		Seq:        c.seq,
+		UDH:        hex.EncodeToString(udh),
+		Body:       part.Body,
+		ReceivedAt: time.Now(),
+	}
+	if len(pending.parts) < pending.total {
+		return pending.msg, false
+	}
+
+	pending.timer.Stop()
+	delete(s.concat.pending, key)
+	return pending.assemble(), true
+}
+
+// flushConcat captures a concatenated message whose parts stopped arriving
+func (s *Server) flushConcat(key string) {
+	s.concat.mu.Lock()
+	pending := s.concat.pending[key]
+	delete(s.concat.pending, key)
+	s.concat.mu.Unlock()
+	if pending == nil {
+		return
+	}
+
+	msg := pending.assemble()
+	msg.Tags = editTags(msg.Tags, []string{"incomplete"}, nil)
+	if err := s.captureMessage(&msg); err != nil {
+		return
+	}
+	log.Printf("🧩 Incomplete concatenated SMS captured: To=%s Parts=%d/%d", msg.To, msg.Concat.Received, msg.Concat.Total)
+}
+
+// assemble joins the parts received so far, in order, into one message
+func (p *pendingConcat) assemble() Message {
+	msg := p.msg
+	msg.parts = make([]MessagePart, 0, len(p.parts))
+	for _, part := range p.parts {
+		msg.parts = append(msg.parts, part)
+	}
+	sort.Slice(msg.parts, func(i, j int) bool { return msg.parts[i].Seq < msg.parts[j].Seq })
+
+	var body strings.Builder
+	for _, part := range msg.parts {
+		body.WriteString(part.Body)
+	}
+	msg.Body = body.String()
+	msg.Concat = &ConcatInfo{Ref: p.ref, Total: p.total, Received: len(msg.parts)}
+	return msg
+}
+
+// handleGetMessageParts lists the parts a concatenated message was
+// reassembled from. Other messages have none.
+func (s *Server) handleGetMessageParts(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, msg := range s.messagesFor(projectFromRequest(r)) {
+		if msg.ID == id {
+			parts := msg.parts
+			if parts == nil {
+				parts = []MessagePart{}
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"parts":  parts,
+				"total":  len(parts),
+				"concat": msg.Concat,
+			})
+			return
+		}
+	}
+
+	http.Error(w, "Message not found", http.StatusNotFound)
+}
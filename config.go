@@ -0,0 +1,206 @@
+package smspit
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConfigFromEnv reads the configuration from SMSPIT_* environment variables
+func ConfigFromEnv() Config {
+	return (&configSource{}).config()
+}
+
+// Setting is the effective value of one configuration setting
+type Setting struct {
+	Key     string // Config file key, e.g. web_port
+	Env     string // Environment variable, e.g. SMSPIT_WEB_PORT
+	Value   string
+	Default string
+}
+
+// ConfigSettings lists every setting with its default value
+func ConfigSettings() []Setting {
+	source := &configSource{defaultsOnly: true}
+	source.config()
+	return source.settings
+}
+
+// configSource resolves each setting from command-line overrides, then its
+// SMSPIT_* environment variable, then the config file, then the default,
+// recording the values it used
+type configSource struct {
+	overrides    map[string]string // Command-line values by environment variable
+	file         map[string]string // Config file values by environment variable
+	defaultsOnly bool
+	settings     []Setting
+}
+
+// config reads every setting into a Config
+func (c *configSource) config() Config {
+	return Config{
+		DBPath:              c.get("SMSPIT_DB_PATH", "./smspit.db"),
+		ReadyMinFreeMB:      c.getInt("SMSPIT_READY_MIN_FREE_MB", 100),
+		Host:                c.get("SMSPIT_HOST", ""),
+		WebPort:             c.get("SMSPIT_WEB_PORT", "8080"),
+		APIPort:             c.get("SMSPIT_API_PORT", "9080"),
+		MaxMessages:         c.getInt("SMSPIT_MAX_MESSAGES", 10000),
+		MaxBodyBytes:        c.getInt("SMSPIT_MAX_BODY_BYTES", 10<<20),
+		MaxMessageLength:    c.getInt("SMSPIT_MAX_MESSAGE_LENGTH", 1600),
+		Retention:           c.getDuration("SMSPIT_RETENTION", 0),
+		TwilioCompat:        c.getBool("SMSPIT_TWILIO_COMPAT", false),
+		VonageCompat:        c.getBool("SMSPIT_VONAGE_COMPAT", false),
+		MessageBirdCompat:   c.getBool("SMSPIT_MESSAGEBIRD_COMPAT", false),
+		SNSCompat:           c.getBool("SMSPIT_SNS_COMPAT", false),
+		SinchCompat:         c.getBool("SMSPIT_SINCH_COMPAT", false),
+		KannelCompat:        c.getBool("SMSPIT_KANNEL_COMPAT", false),
+		WhatsAppCompat:      c.getBool("SMSPIT_WHATSAPP_COMPAT", false),
+		ViberCompat:         c.getBool("SMSPIT_VIBER_COMPAT", false),
+		ViberAuthToken:      c.get("SMSPIT_VIBER_AUTH_TOKEN", ""),
+		ViberUnreachable:    c.getList("SMSPIT_VIBER_UNREACHABLE"),
+		KannelPath:          c.get("SMSPIT_KANNEL_PATH", "/cgi-bin/sendsms"),
+		KannelParams:        parseKannelParams(c.get("SMSPIT_KANNEL_PARAMS", "")),
+		KannelUsername:      c.get("SMSPIT_KANNEL_USERNAME", ""),
+		KannelPassword:      c.get("SMSPIT_KANNEL_PASSWORD", ""),
+		KannelDLRFormat:     c.get("SMSPIT_KANNEL_DLR_FORMAT", defaultDLRFormat),
+		SMTPPort:            c.get("SMSPIT_SMTP_PORT", ""),
+		SMTPDomain:          c.get("SMSPIT_SMTP_DOMAIN", "sms.local"),
+		GRPCPort:            c.get("SMSPIT_GRPC_PORT", ""),
+		SMPPPort:            c.get("SMSPIT_SMPP_PORT", ""),
+		SMPPSystemID:        c.get("SMSPIT_SMPP_SYSTEM_ID", ""),
+		SMPPPassword:        c.get("SMSPIT_SMPP_PASSWORD", ""),
+		SMPPCharset:         strings.ToLower(c.get("SMSPIT_SMPP_CHARSET", smppCharsetGSM)),
+		SMPPDLRFormat:       c.get("SMSPIT_SMPP_DLR_FORMAT", defaultDLRFormat),
+		DeliverySim:         c.getBool("SMSPIT_DELIVERY_SIM", false),
+		DeliveryDelay:       c.getDuration("SMSPIT_DELIVERY_DELAY", 2*time.Second),
+		DeliveryFailureRate: c.getFloat("SMSPIT_DELIVERY_FAILURE_RATE", 0),
+		TwilioAuthToken:     c.get("SMSPIT_TWILIO_AUTH_TOKEN", ""),
+		TwilioNumberPool:    c.getList("SMSPIT_TWILIO_NUMBER_POOL"),
+		TwilioAccounts:      parseTwilioAccounts(c.get("SMSPIT_TWILIO_ACCOUNTS", "")),
+		VerifyCode:          c.get("SMSPIT_TWILIO_VERIFY_CODE", ""),
+		InboundWebhookURL:   c.get("SMSPIT_INBOUND_WEBHOOK_URL", ""),
+		WebhookURL:          c.get("SMSPIT_WEBHOOK_URL", ""),
+		WebhookSecret:       c.get("SMSPIT_WEBHOOK_SECRET", ""),
+		SlackWebhookURL:     c.get("SMSPIT_SLACK_WEBHOOK_URL", ""),
+		DiscordWebhookURL:   c.get("SMSPIT_DISCORD_WEBHOOK_URL", ""),
+		NtfyURL:             c.get("SMSPIT_NTFY_URL", ""),
+		PushoverToken:       c.get("SMSPIT_PUSHOVER_TOKEN", ""),
+		PushoverUser:        c.get("SMSPIT_PUSHOVER_USER", ""),
+		NotifyTags:          c.getList("SMSPIT_NOTIFY_TAGS"),
+		NotifyNumbers:       c.getList("SMSPIT_NOTIFY_NUMBERS"),
+		OTPPatterns:         compileOTPPatterns(c.get("SMSPIT_OTP_PATTERNS", "")),
+		MagicNumbers:        parseMagicNumbers(c.get("SMSPIT_MAGIC_NUMBERS", "")),
+		AuthToken:           c.get("SMSPIT_AUTH_TOKEN", ""),
+		ReadTokens:          c.getList("SMSPIT_READ_TOKENS"),
+		OIDCIssuer:          c.get("SMSPIT_OIDC_ISSUER", ""),
+		OIDCClientID:        c.get("SMSPIT_OIDC_CLIENT_ID", ""),
+		OIDCClientSecret:    c.get("SMSPIT_OIDC_CLIENT_SECRET", ""),
+		OIDCRedirectURL:     c.get("SMSPIT_OIDC_REDIRECT_URL", ""),
+		OIDCScopes:          strings.Split(c.get("SMSPIT_OIDC_SCOPES", "openid,profile,email"), ","),
+		OIDCGroupsClaim:     c.get("SMSPIT_OIDC_GROUPS_CLAIM", "groups"),
+		OIDCRoles:           parseOIDCRoles(c.get("SMSPIT_OIDC_ROLES", "")),
+		OIDCDefaultRole:     c.get("SMSPIT_OIDC_DEFAULT_ROLE", "none"),
+		TagRules:            parseTagRules(c.get("SMSPIT_TAG_RULES", "")),
+		AutoReplyRules:      parseAutoReplyRules(c.get("SMSPIT_AUTO_REPLIES", "")),
+		Hooks:               parseHooks(c.get("SMSPIT_HOOKS", "")),
+		OptOutKeywords:      c.getBool("SMSPIT_OPT_OUT_KEYWORDS", false),
+		StrictSenderID:      c.getBool("SMSPIT_STRICT_SENDER_ID", false),
+		RedactRules:         parseRedactRules(c.get("SMSPIT_REDACT_RULES", "")),
+		RedactMode:          c.get("SMSPIT_REDACT_MODE", redactAtCapture),
+		TrackLinks:          c.getBool("SMSPIT_TRACK_LINKS", false),
+		DuplicateWindow:     c.getDuration("SMSPIT_DUPLICATE_WINDOW", 0),
+		DuplicateMode:       c.get("SMSPIT_DUPLICATE_MODE", duplicateFlag),
+		ScreenBannedWords:   c.getList("SMSPIT_SCREEN_BANNED_WORDS"),
+		ScreenShorteners:    c.getBool("SMSPIT_SCREEN_SHORTENERS", false),
+		ScreenSHAFT:         c.getList("SMSPIT_SCREEN_SHAFT"),
+		A2PMode:             strings.ToLower(c.get("SMSPIT_A2P_MODE", a2pOff)),
+		A2PNumbers:          parseA2PNumbers(c.get("SMSPIT_A2P_NUMBERS", "")),
+		A2PThrottleRate:     c.getFloat("SMSPIT_A2P_THROTTLE_RATE", 0.1),
+		ScreenMode:          c.get("SMSPIT_SCREEN_MODE", screenFlag),
+		SearchMatching:      textMatching(strings.ToLower(c.get("SMSPIT_SEARCH_MATCHING", string(matchLoose)))),
+		RateLimitPerNumber:  c.getFloat("SMSPIT_RATE_LIMIT_PER_NUMBER", 0),
+		RateLimitPerAccount: c.getFloat("SMSPIT_RATE_LIMIT_PER_ACCOUNT", 0),
+		RateLimitMode:       c.get("SMSPIT_RATE_LIMIT_MODE", rateLimitReject),
+		RelayProvider:       c.get("SMSPIT_RELAY_PROVIDER", ""),
+		RelayAccount:        c.get("SMSPIT_RELAY_ACCOUNT", ""),
+		RelaySecret:         c.get("SMSPIT_RELAY_SECRET", ""),
+		RelayFrom:           c.get("SMSPIT_RELAY_FROM", ""),
+		RelayAllowlist:      c.getList("SMSPIT_RELAY_ALLOWLIST"),
+		RelayURL:            c.get("SMSPIT_RELAY_URL", ""),
+		AccessLog:           c.getBool("SMSPIT_ACCESS_LOG", false),
+		Debug:               c.getBool("SMSPIT_DEBUG", false),
+		OTLPEndpoint:        c.get("SMSPIT_OTLP_ENDPOINT", ""),
+		OTLPProtocol:        c.get("SMSPIT_OTLP_PROTOCOL", otlpHTTP),
+		ClusterURL:          c.get("SMSPIT_CLUSTER_URL", ""),
+		ClusterSubject:      c.get("SMSPIT_CLUSTER_SUBJECT", "smspit"),
+		ClusterStore:        c.get("SMSPIT_CLUSTER_STORE", ""),
+		SinglePort:          c.getBool("SMSPIT_SINGLE_PORT", false),
+		TLSCert:             c.get("SMSPIT_TLS_CERT", ""),
+		TLSKey:              c.get("SMSPIT_TLS_KEY", ""),
+		TLSAuto:             c.getBool("SMSPIT_TLS_AUTO", false),
+		WebRoot:             c.get("SMSPIT_WEBROOT", ""),
+		TrustedProxies:      parseTrustedProxies(c.get("SMSPIT_TRUSTED_PROXIES", "")),
+		CORSOrigins:         c.get("SMSPIT_CORS_ORIGINS", "*"),
+	}
+}
+
+// settingKey returns the config file key for an environment variable
+func settingKey(env string) string {
+	return strings.ToLower(strings.TrimPrefix(env, "SMSPIT_"))
+}
+
+// get returns the value of a setting, or defaultVal when it is unset
+func (c *configSource) get(key, defaultVal string) string {
+	val, ok := c.overrides[key]
+	if !ok && !c.defaultsOnly {
+		val = os.Getenv(key)
+		if val == "" {
+			val = c.file[key]
+		}
+	}
+	if val == "" && !ok {
+		val = defaultVal
+	}
+	c.settings = append(c.settings, Setting{Key: settingKey(key), Env: key, Value: val, Default: defaultVal})
+	return val
+}
+
+func (c *configSource) getInt(key string, defaultVal int) int {
+	var i int
+	if _, err := fmt.Sscanf(c.get(key, strconv.Itoa(defaultVal)), "%d", &i); err != nil {
+		return defaultVal
+	}
+	return i
+}
+
+func (c *configSource) getBool(key string, defaultVal bool) bool {
+	val := c.get(key, strconv.FormatBool(defaultVal))
+	return val == "true" || val == "1" || val == "yes"
+}
+
+func (c *configSource) getFloat(key string, defaultVal float64) float64 {
+	if f, err := strconv.ParseFloat(c.get(key, strconv.FormatFloat(defaultVal, 'g', -1, 64)), 64); err == nil {
+		return f
+	}
+	return defaultVal
+}
+
+// getList reads a comma-separated list, dropping blank entries
+func (c *configSource) getList(key string) []string {
+	var list []string
+	for _, item := range strings.Split(c.get(key, ""), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func (c *configSource) getDuration(key string, defaultVal time.Duration) time.Duration {
+	if d, err := time.ParseDuration(c.get(key, defaultVal.String())); err == nil {
+		return d
+	}
+	return defaultVal
+}
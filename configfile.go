@@ -0,0 +1,205 @@
+package smspit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// listSeparators joins list values from the config file for settings that
+// are not comma-separated
+var listSeparators = map[string]string{
+	"SMSPIT_OTP_PATTERNS": ";",
+	"SMSPIT_TAG_RULES":    ";",
+}
+
+// LoadConfig reads a YAML or TOML config file (chosen by extension; .json is
+// read as YAML) with SMSPIT_* environment variables overriding its values,
+// and overrides (e.g. command-line flags, keyed like the file) overriding
+// both. Keys are the variable names without the prefix, in lower case
+// (web_port), plus "webhooks", "chaos", "lookups", "searches" and "templates"
+// lists taking the same bodies as the API and an "adapters" list of
+// AdapterConfig. With an empty path only the environment is read. The returned settings
+// are the effective value of every setting, for --print-config.
+func LoadConfig(path string, overrides map[string]string) (Config, []Setting, error) {
+	source := &configSource{file: make(map[string]string), overrides: make(map[string]string)}
+	for key, value := range overrides {
+		source.overrides["SMSPIT_"+strings.ToUpper(key)] = value
+	}
+	var webhooks []WebhookRequest
+	var chaos []ChaosRequest
+	var lookups []LookupFixture
+	var searches []SavedSearchRequest
+	var templates []TemplateRequest
+	var adapters []AdapterConfig
+
+	if path != "" {
+		values, err := readConfigFile(path)
+		if err != nil {
+			return Config{}, nil, err
+		}
+
+		for key, value := range values {
+			key = strings.ReplaceAll(strings.ToLower(key), "-", "_")
+			switch key {
+			case "webhooks":
+				err = decodeConfigList(value, &webhooks)
+			case "chaos":
+				err = decodeConfigList(value, &chaos)
+			case "lookups":
+				err = decodeConfigList(value, &lookups)
+			case "searches":
+				err = decodeConfigList(value, &searches)
+			case "templates":
+				err = decodeConfigList(value, &templates)
+			case "adapters":
+				err = decodeConfigList(value, &adapters)
+			default:
+				env := "SMSPIT_" + strings.ToUpper(key)
+				source.file[env], err = configValue(value, listSeparators[env])
+			}
+			if err != nil {
+				return Config{}, nil, fmt.Errorf("%s: %s: %w", path, key, err)
+			}
+		}
+	}
+
+	config := source.config()
+	known := make(map[string]bool)
+	for _, s := range source.settings {
+		known[s.Env] = true
+	}
+	for env := range source.file {
+		if !known[env] {
+			return Config{}, nil, fmt.Errorf("%s: unknown setting %q", path, settingKey(env))
+		}
+	}
+	for env := range source.overrides {
+		if !known[env] {
+			return Config{}, nil, fmt.Errorf("unknown setting %q", settingKey(env))
+		}
+	}
+
+	config.Webhooks = webhooks
+	config.ChaosRules = chaos
+	config.LookupFixtures = lookups
+	config.SavedSearches = searches
+	config.Templates = templates
+	config.Adapters = adapters
+	return config, source.settings, nil
+}
+
+// readConfigFile parses a YAML or TOML file into a map
+func readConfigFile(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]interface{})
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		err = toml.Unmarshal(data, &values)
+	case ".yaml", ".yml", ".json":
+		err = yaml.Unmarshal(data, &values)
+	default:
+		return nil, fmt.Errorf("%s: unsupported config format (use .yaml, .yml, .toml or .json)", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return values, nil
+}
+
+// configValue converts a scalar or list from the config file to the string
+// form used by the environment variable
+func configValue(value interface{}, sep string) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string, bool, int, int64, uint64, float64:
+		return fmt.Sprint(v), nil
+	case []interface{}:
+		if sep == "" {
+			sep = ","
+		}
+		items := make([]string, len(v))
+		for i, item := range v {
+			s, err := configValue(item, sep)
+			if err != nil {
+				return "", err
+			}
+			items[i] = s
+		}
+		return strings.Join(items, sep), nil
+	default:
+		return "", fmt.Errorf("expected a value or a list, got %T", value)
+	}
+}
+
+// decodeConfigList decodes a list of API request bodies via JSON so the file
+// uses the same field names as the API
+func decodeConfigList(value, dst interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, dst)
+}
+
+// scalarNode returns a YAML node for a setting value, unquoted when it reads
+// back as the same bool or number
+func scalarNode(value string) *yaml.Node {
+	tag := "!!str"
+	if value == "true" || value == "false" {
+		tag = "!!bool"
+	} else if _, err := strconv.Atoi(value); err == nil {
+		tag = "!!int"
+	} else if _, err := strconv.ParseFloat(value, 64); err == nil && !strings.ContainsAny(value, "xX_") {
+		tag = "!!float"
+	}
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value}
+}
+
+// WriteConfig writes settings and the config's webhooks, chaos rules, Lookup
+// fixtures, saved searches, templates and adapters as a YAML config file
+func WriteConfig(w io.Writer, config Config, settings []Setting) error {
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	for _, s := range settings {
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: s.Key}, scalarNode(s.Value))
+	}
+
+	lists := []struct {
+		key   string
+		items interface{}
+	}{{"webhooks", config.Webhooks}, {"chaos", config.ChaosRules}, {"lookups", config.LookupFixtures}, {"searches", config.SavedSearches}, {"templates", config.Templates}, {"adapters", config.Adapters}}
+	for _, list := range lists {
+		// Round-trip through JSON so the keys match the API field names
+		var items []map[string]interface{}
+		if err := decodeConfigList(list.items, &items); err != nil {
+			return err
+		}
+		if len(items) == 0 {
+			continue
+		}
+		var node yaml.Node
+		if err := node.Encode(items); err != nil {
+			return err
+		}
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: list.key}, &node)
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(root); err != nil {
+		return err
+	}
+	return enc.Close()
+}
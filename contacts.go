@@ -0,0 +1,189 @@
+package smspit
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/gorilla/mux"
+)
+
+// Contact gives a phone number a friendly name, shown alongside the number
+// in API responses and the UI and searchable with to: and from:
+type Contact struct {
+	Number    string    `json:"number"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// contactStore holds each project's contacts by number digits, so any
+// formatting of a number finds its contact
+type contactStore struct {
+	mu       sync.RWMutex
+	projects map[string]map[string]Contact
+}
+
+// contactNames maps number digits to contact names
+type contactNames map[string]string
+
+// contactNames returns the project's contact names. The map is a copy.
+func (s *Server) contactNames(project string) contactNames {
+	s.contacts.mu.RLock()
+	defer s.contacts.mu.RUnlock()
+
+	names := make(contactNames, len(s.contacts.projects[project]))
+	for digits, contact := range s.contacts.projects[project] {
+		names[digits] = contact.Name
+	}
+	return names
+}
+
+// name returns the contact name for a phone number. Alphanumeric sender IDs
+// never have one.
+func (names contactNames) name(number string) string {
+	if strings.IndexFunc(number, unicode.IsLetter) >= 0 {
+		return ""
+	}
+	return names[numberDigits(number)]
+}
+
+// apply fills in the names of a message's recipient and sender
+func (names contactNames) apply(msg *Message) {
+	msg.ToName = names.name(msg.To)
+	msg.FromName = names.name(msg.From)
+}
+
+// setContact adds or replaces the project's contact for contact.Number,
+// returning it with its creation time
+func (s *Server) setContact(project string, contact Contact) Contact {
+	digits := numberDigits(contact.Number)
+
+	s.contacts.mu.Lock()
+	if s.contacts.projects == nil {
+		s.contacts.projects = make(map[string]map[string]Contact)
+	}
+	if s.contacts.projects[project] == nil {
+		s.contacts.projects[project] = make(map[string]Contact)
+	}
+	contact.CreatedAt = time.Now()
+	if existing, ok := s.contacts.projects[project][digits]; ok {
+		contact.CreatedAt = existing.CreatedAt
+	}
+	s.contacts.projects[project][digits] = contact
+	s.contacts.mu.Unlock()
+	s.syncRecords(kindContacts)
+
+	s.broadcastEvent(map[string]interface{}{"type": "contacts_updated", "project": project})
+	return contact
+}
+
+// decodeContact reads a contact from the request body, taking the number
+// from the path when there is one
+func decodeContact(r *http.Request) (Contact, string) {
+	var contact Contact
+	if err := json.NewDecoder(r.Body).Decode(&contact); err != nil {
+		return contact, "Invalid JSON: " + err.Error()
+	}
+	if number, ok := mux.Vars(r)["number"]; ok {
+		contact.Number = number
+	}
+	contact.Name = strings.TrimSpace(contact.Name)
+	if strings.HasPrefix(strings.TrimSpace(contact.Number), "+") {
+		contact.Number = "+" + numberDigits(contact.Number)
+	}
+	switch {
+	case numberDigits(contact.Number) == "" || strings.IndexFunc(contact.Number, unicode.IsLetter) >= 0:
+		return contact, "Missing or invalid 'number' field"
+	case contact.Name == "":
+		return contact, "Missing 'name' field"
+	}
+	return contact, ""
+}
+
+// handleListContacts returns the project's contacts, sorted by name
+func (s *Server) handleListContacts(w http.ResponseWriter, r *http.Request) {
+	s.contacts.mu.RLock()
+	contacts := make([]Contact, 0, len(s.contacts.projects[projectFromRequest(r)]))
+	for _, contact := range s.contacts.projects[projectFromRequest(r)] {
+		contacts = append(contacts, contact)
+	}
+	s.contacts.mu.RUnlock()
+	sort.Slice(contacts, func(i, j int) bool {
+		if !strings.EqualFold(contacts[i].Name, contacts[j].Name) {
+			return strings.ToLower(contacts[i].Name) < strings.ToLower(contacts[j].Name)
+		}
+		return contacts[i].Number < contacts[j].Number
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"contacts": contacts,
+		"total":    len(contacts),
+	})
+}
+
+// handleCreateContact adds a contact. A number that already has one is a
+// conflict; use PUT to rename it.
+func (s *Server) handleCreateContact(w http.ResponseWriter, r *http.Request) {
+	contact, errMsg := decodeContact(r)
+	if errMsg != "" {
+		http.Error(w, errMsg, http.StatusBadRequest)
+		return
+	}
+	project := projectFromRequest(r)
+
+	s.contacts.mu.RLock()
+	_, exists := s.contacts.projects[project][numberDigits(contact.Number)]
+	s.contacts.mu.RUnlock()
+	if exists {
+		http.Error(w, "Contact already exists for "+contact.Number, http.StatusConflict)
+		return
+	}
+
+	contact = s.setContact(project, contact)
+	log.Printf("📇 Contact added: %s = %s", contact.Number, contact.Name)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(contact)
+}
+
+// handleSetContact adds or renames the contact for a number
+func (s *Server) handleSetContact(w http.ResponseWriter, r *http.Request) {
+	contact, errMsg := decodeContact(r)
+	if errMsg != "" {
+		http.Error(w, errMsg, http.StatusBadRequest)
+		return
+	}
+
+	contact = s.setContact(projectFromRequest(r), contact)
+	log.Printf("📇 Contact set: %s = %s", contact.Number, contact.Name)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(contact)
+}
+
+// handleDeleteContact removes the contact for a number
+func (s *Server) handleDeleteContact(w http.ResponseWriter, r *http.Request) {
+	project, digits := projectFromRequest(r), numberDigits(mux.Vars(r)["number"])
+
+	s.contacts.mu.Lock()
+	_, ok := s.contacts.projects[project][digits]
+	delete(s.contacts.projects[project], digits)
+	s.contacts.mu.Unlock()
+	s.syncRecords(kindContacts)
+
+	if !ok {
+		http.Error(w, "Contact not found", http.StatusNotFound)
+		return
+	}
+	s.broadcastEvent(map[string]interface{}{"type": "contacts_updated", "project": project})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
+}
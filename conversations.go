@@ -0,0 +1,110 @@
+package smspit
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// noSender stands in for an empty sender in conversation paths
+const noSender = "-"
+
+// Conversation summarizes the thread between a recipient and a sender
+type Conversation struct {
+	To           string    `json:"to"`   // The end user's number
+	From         string    `json:"from"` // The sending number or sender ID ("-" when unset)
+	MessageCount int       `json:"message_count"`
+	Inbound      int       `json:"inbound"`
+	Outbound     int       `json:"outbound"`
+	Unread       int       `json:"unread"`
+	FirstAt      time.Time `json:"first_at"`
+	LastAt       time.Time `json:"last_at"`
+	LastMessage  Message   `json:"last_message"`
+}
+
+// conversationKey returns the (to, from) pair a message belongs to. Inbound
+// replies are flipped so both directions land in the same thread.
+func conversationKey(msg Message) (to, from string) {
+	to, from = msg.To, msg.From
+	if msg.Direction == "inbound" {
+		to, from = from, to
+	}
+	if from == "" {
+		from = noSender
+	}
+	return to, from
+}
+
+// conversations groups msgs (newest first) into threads, most recently
+// active first
+func conversations(msgs []Message) []Conversation {
+	index := make(map[[2]string]int)
+	var convs []Conversation
+	for _, msg := range msgs {
+		to, from := conversationKey(msg)
+		key := [2]string{to, from}
+		i, ok := index[key]
+		if !ok {
+			i = len(convs)
+			index[key] = i
+			convs = append(convs, Conversation{To: to, From: from, LastAt: msg.CreatedAt, LastMessage: msg})
+		}
+		c := &convs[i]
+		c.MessageCount++
+		c.FirstAt = msg.CreatedAt
+		if msg.Direction == "inbound" {
+			c.Inbound++
+		} else {
+			c.Outbound++
+		}
+		if msg.Unread {
+			c.Unread++
+		}
+	}
+	return convs
+}
+
+// handleListConversations lists threads grouped by (to, from)
+func (s *Server) handleListConversations(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	convs := conversations(s.messagesFor(projectFromRequest(r)))
+	s.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(paginateItems(r, "conversations", convs))
+}
+
+// handleGetConversation returns a thread's messages oldest first. Use "-"
+// for from when the messages had no sender.
+func (s *Server) handleGetConversation(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	to, from := vars["to"], vars["from"]
+
+	s.mu.RLock()
+	var thread []Message
+	for _, msg := range s.messagesFor(projectFromRequest(r)) {
+		if t, f := conversationKey(msg); t == to && f == from {
+			thread = append(thread, msg)
+		}
+	}
+	s.mu.RUnlock()
+
+	if len(thread) == 0 {
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+
+	conv := conversations(thread)[0]
+	sort.SliceStable(thread, func(i, j int) bool {
+		return thread[i].CreatedAt.Before(thread[j].CreatedAt)
+	})
+
+	resp := paginate(r, thread)
+	resp["conversation"] = conv
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
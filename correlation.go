@@ -0,0 +1,95 @@
+package smspit
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/metadata"
+)
+
+// maxRequestIDLength caps the X-Request-ID stored on a message
+const maxRequestIDLength = 200
+
+// traceparentPattern matches a W3C Trace Context traceparent header:
+// version, trace ID, parent (span) ID and flags
+var traceparentPattern = regexp.MustCompile(`^([0-9a-f]{2})-([0-9a-f]{32})-([0-9a-f]{16})-([0-9a-f]{2})$`)
+
+// requestIDHeaders are read in order for the ID of the request that sent a
+// message
+var requestIDHeaders = []string{"X-Request-ID", "X-Correlation-ID"}
+
+// Correlation ties a message to the request that sent it, so it can be
+// traced back to the calling service. It is embedded in Message.
+type Correlation struct {
+	RequestID string `json:"request_id,omitempty"` // X-Request-ID or X-Correlation-ID
+	TraceID   string `json:"trace_id,omitempty"`   // From traceparent
+	SpanID    string `json:"span_id,omitempty"`    // The caller's span, from traceparent
+
+	// span is SMSpit's own span for the capture when tracing is enabled,
+	// then for storing the message (see storeMessage)
+	span trace.SpanContext
+}
+
+// correlationFromRequest reads a capture request's correlation headers
+func correlationFromRequest(r *http.Request) Correlation {
+	c := newCorrelation(func(name string) string { return r.Header.Get(name) })
+	c.span = trace.SpanContextFromContext(r.Context())
+	return c
+}
+
+// grpcCorrelation reads the same correlation headers from an RPC's metadata
+func grpcCorrelation(ctx context.Context) Correlation {
+	md, _ := metadata.FromIncomingContext(ctx)
+	c := newCorrelation(func(name string) string {
+		if values := md.Get(name); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	})
+	c.span = trace.SpanContextFromContext(ctx)
+	return c
+}
+
+// newCorrelation builds a Correlation from header values. A traceparent
+// that isn't valid W3C Trace Context (including all-zero IDs) is ignored.
+func newCorrelation(header func(string) string) Correlation {
+	var c Correlation
+	for _, name := range requestIDHeaders {
+		if id := strings.TrimSpace(header(name)); id != "" {
+			if len(id) > maxRequestIDLength {
+				id = id[:maxRequestIDLength]
+			}
+			c.RequestID = id
+			break
+		}
+	}
+
+	m := traceparentPattern.FindStringSubmatch(strings.ToLower(strings.TrimSpace(header("traceparent"))))
+	if m != nil && m[1] != "ff" && strings.Trim(m[2], "0") != "" && strings.Trim(m[3], "0") != "" {
+		c.TraceID, c.SpanID = m[2], m[3]
+	}
+	return c
+}
+
+// logFields renders the IDs that are set for logs, e.g.
+// "request_id=abc trace_id=4bf9..."
+func (c Correlation) logFields() string {
+	var parts []string
+	for _, field := range []struct{ name, value string }{
+		{"request_id", c.RequestID}, {"trace_id", c.TraceID}, {"span_id", c.SpanID},
+	} {
+		if field.value != "" {
+			parts = append(parts, field.name+"="+field.value)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// traceContext carries the message's span, to parent the spans of work on
+// the message. It has no deadline, since that work outlives the request.
+func (c Correlation) traceContext() context.Context {
+	return trace.ContextWithSpanContext(context.Background(), c.span)
+}
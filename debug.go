@@ -0,0 +1,118 @@
+package smspit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// RuntimeStats is a snapshot of the process for diagnosing memory growth,
+// served by /api/v1/debug/runtime when SMSPIT_DEBUG is enabled
+type RuntimeStats struct {
+	GoVersion  string        `json:"go_version"`
+	Uptime     string        `json:"uptime"`
+	CPUs       int           `json:"cpus"`
+	GOMAXPROCS int           `json:"gomaxprocs"`
+	Goroutines int           `json:"goroutines"`
+	Memory     RuntimeMemory `json:"memory"`
+	GC         RuntimeGC     `json:"gc"`
+	// What SMSpit holds: every project's messages and the open WebSockets
+	Messages         int `json:"messages"`
+	WebSocketClients int `json:"websocket_clients"`
+}
+
+// RuntimeMemory is the heap and stack usage, in bytes
+type RuntimeMemory struct {
+	HeapAlloc   uint64 `json:"heap_alloc"`   // Live and not yet collected heap objects
+	HeapInuse   uint64 `json:"heap_inuse"`   // Heap spans in use
+	HeapIdle    uint64 `json:"heap_idle"`    // Heap spans waiting to be reused or returned
+	HeapObjects uint64 `json:"heap_objects"` // Allocated heap objects
+	StackInuse  uint64 `json:"stack_inuse"`
+	Sys         uint64 `json:"sys"`         // Obtained from the OS in total
+	TotalAlloc  uint64 `json:"total_alloc"` // Allocated over the process's life
+}
+
+// RuntimeGC is the garbage collector's statistics
+type RuntimeGC struct {
+	NumGC       uint32     `json:"num_gc"`
+	NextGC      uint64     `json:"next_gc"` // Heap size the next collection starts at
+	LastGC      *time.Time `json:"last_gc,omitempty"`
+	LastPause   string     `json:"last_pause"`
+	PauseTotal  string     `json:"pause_total"`
+	CPUFraction float64    `json:"cpu_fraction"` // Share of CPU time spent collecting since start
+	ForcedGC    uint32     `json:"forced_gc"`
+}
+
+// debugRoutes adds the pprof profiles and the runtime stats endpoint. Both
+// need an admin token when auth is enabled (see requiredScope).
+func (s *Server) debugRoutes(webRouter, api *mux.Router) {
+	debug := webRouter.PathPrefix("/debug/pprof").Subrouter()
+	debug.Use(s.authMiddleware)
+	debug.HandleFunc("/cmdline", pprof.Cmdline)
+	debug.HandleFunc("/profile", pprof.Profile)
+	debug.HandleFunc("/symbol", pprof.Symbol)
+	debug.HandleFunc("/trace", pprof.Trace)
+	// Index serves the named profiles too, e.g. /debug/pprof/heap
+	debug.PathPrefix("/").HandlerFunc(pprof.Index)
+
+	api.HandleFunc("/debug/runtime", s.handleDebugRuntime).Methods("GET")
+}
+
+// isDebugPath reports whether path is one of the debug endpoints
+func isDebugPath(path string) bool {
+	return strings.HasPrefix(path, "/debug/pprof/") || strings.HasPrefix(path, "/api/v1/debug/")
+}
+
+// handleDebugRuntime reports goroutine, heap and GC statistics. With
+// ?gc=true it runs a collection first, so heap_alloc shows what's live.
+func (s *Server) handleDebugRuntime(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("gc") == "true" {
+		runtime.GC()
+	}
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	stats := RuntimeStats{
+		GoVersion:  runtime.Version(),
+		Uptime:     time.Since(s.started).Round(time.Second).String(),
+		CPUs:       runtime.NumCPU(),
+		GOMAXPROCS: runtime.GOMAXPROCS(0),
+		Goroutines: runtime.NumGoroutine(),
+		Memory: RuntimeMemory{
+			HeapAlloc:   mem.HeapAlloc,
+			HeapInuse:   mem.HeapInuse,
+			HeapIdle:    mem.HeapIdle,
+			HeapObjects: mem.HeapObjects,
+			StackInuse:  mem.StackInuse,
+			Sys:         mem.Sys,
+			TotalAlloc:  mem.TotalAlloc,
+		},
+		GC: RuntimeGC{
+			NumGC:       mem.NumGC,
+			NextGC:      mem.NextGC,
+			LastPause:   time.Duration(mem.PauseNs[(mem.NumGC+255)%256]).String(),
+			PauseTotal:  time.Duration(mem.PauseTotalNs).String(),
+			CPUFraction: mem.GCCPUFraction,
+			ForcedGC:    mem.NumForcedGC,
+		},
+	}
+	if mem.LastGC > 0 {
+		last := time.Unix(0, int64(mem.LastGC))
+		stats.GC.LastGC = &last
+	}
+
+	s.mu.RLock()
+	stats.Messages = len(s.messages)
+	s.mu.RUnlock()
+	s.wsMu.Lock()
+	stats.WebSocketClients = len(s.wsClients)
+	s.wsMu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
@@ -0,0 +1,42 @@
+package smspit
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestDebugEndpoints(t *testing.T) {
+	sso := Config{Debug: true, OIDCIssuer: "https://sso.example.com", OIDCClientID: "smspit"}
+
+	tests := []struct {
+		name   string
+		config Config
+		header []string
+		want   int
+	}{
+		{name: "disabled", config: Config{}, want: http.StatusNotFound},
+		{name: "no auth", config: Config{Debug: true}, want: http.StatusOK},
+		{name: "token missing", config: Config{Debug: true, AuthToken: "secret"}, want: http.StatusUnauthorized},
+		{name: "root token", config: Config{Debug: true, AuthToken: "secret"}, header: []string{"Authorization", "Bearer secret"}, want: http.StatusOK},
+		{name: "read token", config: Config{Debug: true, AuthToken: "secret", ReadTokens: []string{"reader"}}, header: []string{"Authorization", "Bearer reader"}, want: http.StatusForbidden},
+		{name: "SSO without a session", config: sso, want: http.StatusUnauthorized},
+		{name: "SSO admin session", config: sso, header: []string{"Cookie", sessionCookie + "=admin"}, want: http.StatusOK},
+		{name: "SSO read-only session", config: sso, header: []string{"Cookie", sessionCookie + "=reader"}, want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t, tt.config)
+			if ts.oidc != nil {
+				expires := time.Now().Add(time.Hour)
+				ts.oidc.sessions["admin"] = oidcSession{token: rootToken, expires: expires}
+				ts.oidc.sessions["reader"] = oidcSession{token: &APIToken{ID: "sso", Scopes: []string{scopeRead}}, expires: expires}
+			}
+			for _, path := range []string{"/debug/pprof/", "/debug/pprof/cmdline", "/api/v1/debug/runtime"} {
+				if w := do(t, ts.web, "GET", path, "", tt.header...); w.Code != tt.want {
+					t.Errorf("GET %s: %d, want %d", path, w.Code, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package smspit
+
+import (
+	"log"
+	"math/rand"
+	"time"
+)
+
+// DeliveryOptions overrides the simulated delivery lifecycle of a single message
+type DeliveryOptions struct {
+	// Delay between status transitions, e.g. "500ms" (defaults to SMSPIT_DELIVERY_DELAY)
+	Delay string `json:"delay,omitempty"`
+	// Outcome forces the final status: delivered, undelivered or failed
+	Outcome string `json:"outcome,omitempty"`
+}
+
+// maxValidityPeriod is Twilio's longest ValidityPeriod, in seconds
+const maxValidityPeriod = 36000
+
+// validPriority reports whether p is a message priority
+func validPriority(p string) bool {
+	return p == "low" || p == "normal" || p == "high"
+}
+
+// deliveryTransitions lists the valid next states for each delivery status
+var deliveryTransitions = map[string][]string{
+	"scheduled": {"captured", "queued", "canceled", filteredStatus},
+	"queued":    {"sent", "failed", "expired"},
+	"sent":      {"delivered", "undelivered", "failed", "expired"},
+}
+
+// canTransition reports whether a message may move from one status to another
+func canTransition(from, to string) bool {
+	for _, next := range deliveryTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// deliveryPlan returns the sequence of statuses a message will move through
+// after being queued, along with the delay between each step
+func (s *Server) deliveryPlan(msg Message) ([]string, time.Duration) {
+	delay := s.config.DeliveryDelay
+	outcome := "delivered"
+	if rand.Float64() < s.config.DeliveryFailureRate {
+		outcome = "failed"
+	}
+
+	if opts := msg.Delivery; opts != nil {
+		if opts.Delay != "" {
+			if d, err := time.ParseDuration(opts.Delay); err == nil {
+				delay = d
+			}
+		}
+		if canTransition("sent", opts.Outcome) {
+			outcome = opts.Outcome
+		}
+	}
+
+	return []string{"sent", outcome}, delay
+}
+
+// simulateDelivery walks a queued message through the delivery lifecycle,
+// broadcasting a status_update event for every transition. queued is extra
+// time spent queued first, e.g. waiting for a rate-limited send slot. A
+// message with a validity period expires if it isn't delivered in time; an
+// undelivered one is retried until then, like a carrier would.
+func (s *Server) simulateDelivery(msg Message, queued time.Duration) {
+	steps, delay := s.deliveryPlan(msg)
+
+	s.sendStatusReports(msg)
+	if !s.waitForDelivery(msg, queued) {
+		return
+	}
+	s.deliverSteps(msg, steps, delay)
+}
+
+// resumeDelivery carries on simulating the delivery of a message another
+// replica was delivering when it stopped
+func (s *Server) resumeDelivery(msg Message) {
+	steps, delay := s.deliveryPlan(msg)
+	if msg.Status == "sent" {
+		steps = steps[1:]
+	}
+	s.deliverSteps(msg, steps, delay)
+}
+
+// deliverSteps moves msg through steps, delay apart
+func (s *Server) deliverSteps(msg Message, steps []string, delay time.Duration) {
+	for _, status := range steps {
+		wait := delay
+		if status == "undelivered" && msg.ExpiresAt != nil {
+			wait = time.Until(*msg.ExpiresAt)
+		}
+		if !s.waitForDelivery(msg, wait) {
+			return
+		}
+		updated, ok := s.updateMessageStatus(msg.ID, status)
+		if !ok {
+			return // Message was deleted or moved on
+		}
+		s.sendStatusReports(updated)
+	}
+
+	log.Printf("📬 Delivery simulated: ID=%s Status=%s", msg.ID, steps[len(steps)-1])
+}
+
+// waitForDelivery sleeps for d, unless msg's validity period runs out
+// first: then it expires msg and returns false
+func (s *Server) waitForDelivery(msg Message, d time.Duration) bool {
+	if msg.ExpiresAt == nil || d < time.Until(*msg.ExpiresAt) {
+		time.Sleep(d)
+		return true
+	}
+
+	time.Sleep(time.Until(*msg.ExpiresAt))
+	if updated, ok := s.updateMessageStatus(msg.ID, "expired"); ok {
+		s.sendStatusReports(updated)
+		log.Printf("⌛ Message expired undelivered: ID=%s ValidityPeriod=%ds", msg.ID, msg.ValidityPeriod)
+	}
+	return false
+}
+
+// updateMessageStatus moves a message to a new status if the transition is
+// valid and notifies WebSocket clients
+func (s *Server) updateMessageStatus(id, status string) (Message, bool) {
+	s.mu.Lock()
+	var updated Message
+	var previous string
+	found := false
+	for i := range s.messages {
+		if s.messages[i].ID == id {
+			if !canTransition(s.messages[i].Status, status) {
+				break
+			}
+			previous = s.messages[i].Status
+			s.messages[i].Status = status
+			updated = s.messages[i]
+			found = true
+			break
+		}
+	}
+	s.mu.Unlock()
+
+	if !found {
+		return Message{}, false
+	}
+	s.syncSaved(updated.key())
+
+	s.broadcastEvent(map[string]interface{}{
+		"type":            "status_update",
+		"project":         updated.Project,
+		"message_id":      id,
+		"status":          status,
+		"previous_status": previous,
+		"message":         updated,
+	})
+
+	return updated, true
+}
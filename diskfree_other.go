@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !freebsd
+
+package smspit
+
+// diskFree can't check free space on this platform
+func diskFree(dir string) (uint64, error) {
+	return 0, errDiskFreeUnsupported
+}
@@ -0,0 +1,142 @@
+package smspit
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kannel DLR types, the bits of a sendsms dlr-mask
+const (
+	dlrDelivered   = 1  // Delivered to phone
+	dlrUndelivered = 2  // Non-delivered to phone
+	dlrBuffered    = 4  // Queued on the SMSC
+	dlrSMSCAck     = 8  // Accepted by the SMSC
+	dlrSMSCNack    = 16 // Rejected by the SMSC
+)
+
+// defaultDLRFormat is the delivery receipt text SMSCs send in SMPP
+// deliver_sm PDUs (SMPP 3.4 appendix B), which Kannel passes on as %A
+const defaultDLRFormat = "id:{id} sub:001 dlvrd:{dlvrd} submit date:{submit_date} done date:{done_date} stat:{stat} err:{err} text:{text}"
+
+var dlrClient = &http.Client{Timeout: 10 * time.Second}
+
+// dlrType returns the Kannel DLR type and SMPP receipt stat for a status;
+// statuses with no DLR return type 0
+func dlrType(status string) (int, string) {
+	switch status {
+	case "queued":
+		return dlrBuffered, "ENROUTE"
+	case "sent":
+		return dlrSMSCAck, "ACCEPTD"
+	case "delivered":
+		return dlrDelivered, "DELIVRD"
+	case "undelivered", filteredStatus:
+		return dlrUndelivered, "UNDELIV"
+	case "expired":
+		return dlrUndelivered, "EXPIRED"
+	case "failed":
+		return dlrSMSCNack, "REJECTD"
+	case "canceled":
+		return dlrSMSCNack, "DELETED"
+	}
+	return 0, ""
+}
+
+// dlrText renders a delivery receipt format for msg at its current status
+func dlrText(format string, msg Message, stat string, done time.Time) string {
+	dlvrd, errCode := "000", "000"
+	if msg.Status == "delivered" {
+		dlvrd = "001"
+	}
+	if code, ok := twilioErrorCodes[msg.Status]; ok {
+		errCode = fmt.Sprintf("%03d", code%1000)
+	}
+	text := []rune(msg.Body)
+	if len(text) > 20 {
+		text = text[:20]
+	}
+	return strings.NewReplacer(
+		"{id}", msg.ID,
+		"{dlvrd}", dlvrd,
+		"{submit_date}", msg.CreatedAt.Format("0601021504"),
+		"{done_date}", done.Format("0601021504"),
+		"{stat}", stat,
+		"{err}", errCode,
+		"{text}", string(text),
+	).Replace(format)
+}
+
+// dlrURL fills in the Kannel escapes in msg's dlr-url. Values are
+// URL-encoded, as Kannel does.
+func (s *Server) dlrURL(msg Message, typ int, stat string) string {
+	now := time.Now()
+	values := map[byte]string{
+		'd': strconv.Itoa(typ),
+		'A': dlrText(s.config.KannelDLRFormat, msg, stat, now),
+		'I': msg.ID,
+		'F': msg.ID,
+		'p': msg.To,
+		'P': msg.From,
+		'a': msg.Body,
+		'i': "smspit",
+		't': now.UTC().Format("2006-01-02 15:04:05"),
+		'T': strconv.FormatInt(now.Unix(), 10),
+	}
+
+	var b strings.Builder
+	target := msg.DLRURL
+	for i := 0; i < len(target); i++ {
+		if target[i] != '%' || i+1 == len(target) {
+			b.WriteByte(target[i])
+			continue
+		}
+		if val, ok := values[target[i+1]]; ok {
+			b.WriteString(url.QueryEscape(val))
+			i++
+		} else if target[i+1] == '%' {
+			b.WriteByte('%')
+			i++
+		} else {
+			b.WriteByte('%') // Not an escape, e.g. an already encoded character
+		}
+	}
+	return b.String()
+}
+
+// sendDLR requests msg's dlr-url if the sender asked for a delivery report
+// of this status's type in its dlr-mask
+func (s *Server) sendDLR(msg Message) {
+	typ, stat := dlrType(msg.Status)
+	if msg.DLRURL == "" || msg.DLRMask&typ == 0 {
+		return
+	}
+
+	target := s.dlrURL(msg, typ, stat)
+	resp, err := dlrClient.Get(target)
+	if err != nil {
+		log.Printf("⚠️ DLR failed: ID=%s URL=%s Error=%v", msg.ID, target, err)
+		return
+	}
+	resp.Body.Close()
+
+	log.Printf("📨 DLR sent: ID=%s Type=%d Stat=%s Response=%d", msg.ID, typ, stat, resp.StatusCode)
+}
+
+// wantsStatusReports reports whether msg's sender asked for a status
+// callback or delivery reports, which need the delivery lifecycle
+func (msg Message) wantsStatusReports() bool {
+	return msg.StatusCallback != "" || msg.DLRURL != "" || msg.RegisteredDelivery != 0
+}
+
+// sendStatusReports sends the status callback and delivery reports msg's
+// sender asked for, if any
+func (s *Server) sendStatusReports(msg Message) {
+	s.sendStatusCallback(msg)
+	s.sendDLR(msg)
+	s.sendSMPPReceipt(msg)
+}
@@ -0,0 +1,76 @@
+package smspit
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Duplicate handling modes
+const (
+	duplicateFlag   = "flag"
+	duplicateReject = "reject"
+)
+
+// duplicateTag is added to messages flagged as duplicates
+const duplicateTag = "duplicate"
+
+// DuplicateError is returned in reject mode when capturing an outbound
+// message identical to one captured within SMSPIT_DUPLICATE_WINDOW
+type DuplicateError struct {
+	Original string // ID of the message it repeats
+	Age      time.Duration
+}
+
+func (e *DuplicateError) Error() string {
+	return fmt.Sprintf("Duplicate message: identical to %s sent %s ago", e.Original, e.Age.Round(time.Millisecond))
+}
+
+// checkDuplicate looks for an outbound message in the same project with the
+// same recipient and body captured within SMSPIT_DUPLICATE_WINDOW. Repeats
+// are tagged and point at the first message in duplicate_of, or refused in
+// reject mode. Bodies are compared after redaction, as stored.
+func (s *Server) checkDuplicate(msg *Message) error {
+	if s.config.DuplicateWindow <= 0 || msg.Direction != "outbound" {
+		return nil
+	}
+
+	body := s.redact(msg.Body)
+	since := time.Now().Add(-s.config.DuplicateWindow)
+	var original *Message
+	s.mu.RLock()
+	for i := range s.messages {
+		m := &s.messages[i]
+		if m.Project == msg.Project && m.Direction == "outbound" && m.To == msg.To && m.Body == body && !m.CreatedAt.Before(since) {
+			original = m
+			break
+		}
+	}
+	var originalID string
+	var age time.Duration
+	if original != nil {
+		originalID, age = original.ID, time.Since(original.CreatedAt)
+		if original.DuplicateOf != "" {
+			originalID = original.DuplicateOf
+		}
+	}
+	s.mu.RUnlock()
+
+	if originalID == "" {
+		return nil
+	}
+	if s.config.DuplicateMode == duplicateReject {
+		log.Printf("♊ Duplicate message to %s refused (repeats %s)", msg.To, originalID)
+		return &DuplicateError{Original: originalID, Age: age}
+	}
+	msg.DuplicateOf = originalID
+	msg.Tags = editTags(msg.Tags, []string{duplicateTag}, nil)
+	return nil
+}
+
+// writeDuplicateError answers a capture request refused as a duplicate with
+// 409 Conflict, in the provider's error format (Twilio code 20409)
+func writeDuplicateError(w http.ResponseWriter, r *http.Request, err *DuplicateError) {
+	writeProviderError(w, r, http.StatusConflict, 20409, err.Error(), 0)
+}
@@ -0,0 +1,121 @@
+package smspit
+
+import (
+	"encoding/json"
+	"net/http"
+	"unicode/utf16"
+)
+
+// Segment capacities. Multipart messages lose room to the 6-byte
+// concatenation UDH (7 septets for GSM-7, 3 UTF-16 units for UCS-2).
+const (
+	gsm7SingleLimit = 160
+	gsm7PartLimit   = 153
+	ucs2SingleLimit = 70
+	ucs2PartLimit   = 67
+)
+
+// gsm7Basic is the GSM 03.38 default alphabet
+const gsm7Basic = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞ\x1bÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+
+// gsm7Extension characters need an escape septet, so they count as two
+const gsm7Extension = "\f^{}\\[~]|€"
+
+var gsm7Septets = func() map[rune]int {
+	m := make(map[rune]int)
+	for _, r := range gsm7Basic {
+		m[r] = 1
+	}
+	for _, r := range gsm7Extension {
+		m[r] = 2
+	}
+	return m
+}()
+
+// SMSAnalysis describes how a message body is encoded and split into segments
+type SMSAnalysis struct {
+	Encoding   string   `json:"encoding"`   // GSM-7 or UCS-2
+	Characters int      `json:"characters"` // Unicode characters in the body
+	Units      int      `json:"units"`      // Septets (GSM-7) or UTF-16 code units (UCS-2)
+	Segments   int      `json:"segments"`
+	PerSegment int      `json:"per_segment"` // Capacity of each segment in units
+	Remaining  int      `json:"remaining"`   // Units left in the last segment
+	NonGSM     []string `json:"non_gsm_characters,omitempty"`
+}
+
+// analyzeSMS works out the encoding and segment count for body the way a
+// carrier would: GSM-7 if every character is in the GSM alphabet, otherwise
+// UCS-2. Escaped GSM characters and surrogate pairs are never split across
+// segments.
+func analyzeSMS(body string) SMSAnalysis {
+	a := SMSAnalysis{Encoding: "GSM-7"}
+
+	var widths []int
+	seen := make(map[rune]bool)
+	for _, r := range body {
+		a.Characters++
+		n, ok := gsm7Septets[r]
+		if !ok && !seen[r] {
+			seen[r] = true
+			a.NonGSM = append(a.NonGSM, string(r))
+		}
+		widths = append(widths, n)
+	}
+
+	single, part := gsm7SingleLimit, gsm7PartLimit
+	if len(a.NonGSM) > 0 {
+		a.Encoding = "UCS-2"
+		single, part = ucs2SingleLimit, ucs2PartLimit
+		widths = widths[:0]
+		for _, r := range body {
+			widths = append(widths, len(utf16.Encode([]rune{r})))
+		}
+	}
+
+	for _, n := range widths {
+		a.Units += n
+	}
+
+	if a.Units <= single {
+		a.Segments = 1
+		a.PerSegment = single
+		a.Remaining = single - a.Units
+		return a
+	}
+
+	// Pack characters into multipart segments without splitting any of them
+	a.Segments = 1
+	a.PerSegment = part
+	used := 0
+	for _, n := range widths {
+		if used+n > part {
+			a.Segments++
+			used = 0
+		}
+		used += n
+	}
+	a.Remaining = part - used
+	return a
+}
+
+// setEncoding records the body's encoding and segmentation on msg
+func setEncoding(msg *Message) {
+	a := analyzeSMS(msg.Body)
+	msg.Encoding = a.Encoding
+	msg.Characters = a.Characters
+	msg.Segments = a.Segments
+}
+
+// handleAnalyze reports encoding and segmentation for an arbitrary body
+func (s *Server) handleAnalyze(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Body string `json:"body"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(analyzeSMS(req.Body))
+}
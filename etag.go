@@ -0,0 +1,65 @@
+package smspit
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// writeConditionalJSON writes v as JSON with an ETag derived from the
+// encoded body, so polling clients can send If-None-Match and get a 304 Not
+// Modified while nothing they would see has changed. Last-Modified is when
+// the newest message in msgs was captured.
+func writeConditionalJSON(w http.ResponseWriter, r *http.Request, v interface{}, msgs []Message) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h := fnv.New64a()
+	h.Write(body)
+	etag := fmt.Sprintf(`"%016x"`, h.Sum64())
+
+	header := w.Header()
+	header.Set("ETag", etag)
+	// Revalidate every time rather than letting browsers guess a freshness
+	// lifetime from Last-Modified
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Vary", projectHeader)
+	if newest := newestCaptured(msgs); !newest.IsZero() {
+		header.Set("Last-Modified", newest.UTC().Format(http.TimeFormat))
+	}
+
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	header.Set("Content-Type", "application/json")
+	w.Write(append(body, '\n'))
+}
+
+// etagMatches reports whether an If-None-Match header lists etag, using the
+// weak comparison RFC 9110 asks for
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// newestCaptured returns the latest CreatedAt in msgs
+func newestCaptured(msgs []Message) time.Time {
+	var newest time.Time
+	for _, msg := range msgs {
+		if msg.CreatedAt.After(newest) {
+			newest = msg.CreatedAt
+		}
+	}
+	return newest
+}
@@ -0,0 +1,98 @@
+package smspit
+
+import (
+	"math"
+	"sync"
+)
+
+// eventHistorySize is how many recent events are kept for resuming streams
+const eventHistorySize = 1000
+
+// busEvent is a broadcast event tagged with a monotonically increasing ID
+type busEvent struct {
+	ID   uint64
+	Data map[string]interface{}
+}
+
+// eventBus fans out broadcast events to in-process subscribers
+// (long-poll waiters, streaming endpoints)
+type eventBus struct {
+	mu      sync.Mutex
+	seq     uint64
+	history []busEvent
+	subs    map[chan busEvent]struct{}
+}
+
+// subscribe registers for all events and returns the event channel plus a
+// function to unsubscribe. Slow subscribers miss events rather than
+// blocking capture.
+func (b *eventBus) subscribe() (<-chan busEvent, func()) {
+	_, ch, cancel := b.subscribeSince(math.MaxUint64)
+	return ch, cancel
+}
+
+// subscribeSince registers for events like subscribe and also returns the
+// buffered events published after lastID, so a reconnecting stream can
+// resume without gaps
+func (b *eventBus) subscribeSince(lastID uint64) ([]busEvent, <-chan busEvent, func()) {
+	ch := make(chan busEvent, 64)
+
+	b.mu.Lock()
+	if b.subs == nil {
+		b.subs = make(map[chan busEvent]struct{})
+	}
+	b.subs[ch] = struct{}{}
+
+	var replay []busEvent
+	for _, e := range b.history {
+		if e.ID > lastID {
+			replay = append(replay, e)
+		}
+	}
+	b.mu.Unlock()
+
+	return replay, ch, func() {
+		b.mu.Lock()
+		delete(b.subs, ch)
+		b.mu.Unlock()
+	}
+}
+
+// purge drops the recorded events matching drop, so resumed streams can't
+// replay them, and returns how many it dropped
+func (b *eventBus) purge(drop func(data map[string]interface{}) bool) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	kept := b.history[:0]
+	for _, e := range b.history {
+		if !drop(e.Data) {
+			kept = append(kept, e)
+		}
+	}
+	dropped := len(b.history) - len(kept)
+	b.history = kept
+	return dropped
+}
+
+// publish assigns the event an ID, records it and delivers it to every
+// subscriber without blocking
+func (b *eventBus) publish(data map[string]interface{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	event := busEvent{ID: b.seq, Data: data}
+
+	b.history = append(b.history, event)
+	if len(b.history) > eventHistorySize {
+		b.history = b.history[len(b.history)-eventHistorySize:]
+	}
+
+	for ch := range b.subs {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
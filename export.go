@@ -0,0 +1,110 @@
+package smspit
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportFlushEvery is how many rows are written between flushes so large
+// exports reach the client incrementally
+const exportFlushEvery = 100
+
+// csvHeader is the column order for CSV exports (and imports)
+var csvHeader = []string{
+	"id", "created_at", "project", "direction", "status", "from", "to", "body",
+	"tags", "encoding", "characters", "segments", "account_sid", "channel",
+}
+
+// csvRecord flattens a message into a CSV row matching csvHeader
+func csvRecord(msg Message) []string {
+	return []string{
+		msg.ID,
+		msg.CreatedAt.Format(time.RFC3339Nano),
+		msg.Project,
+		msg.Direction,
+		msg.Status,
+		msg.From,
+		msg.To,
+		msg.Body,
+		strings.Join(msg.Tags, ";"),
+		msg.Encoding,
+		strconv.Itoa(msg.Characters),
+		strconv.Itoa(msg.Segments),
+		msg.AccountSID,
+		msg.channel(),
+	}
+}
+
+// handleExportMessages streams the messages matching the search filters as
+// csv, json (a single array) or ndjson (one message per line)
+func (s *Server) handleExportMessages(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+
+	var contentType string
+	switch format {
+	case "csv":
+		contentType = "text/csv; charset=utf-8"
+	case "json":
+		contentType = "application/json"
+	case "ndjson":
+		contentType = "application/x-ndjson"
+	default:
+		http.Error(w, "Invalid format (use csv, json or ndjson)", http.StatusBadRequest)
+		return
+	}
+
+	msgs, err := s.searchMessages(r)
+	if err != nil {
+		http.Error(w, "Invalid query: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	flusher, _ := w.(http.Flusher)
+	flush := func(i int) {
+		if flusher != nil && i%exportFlushEvery == exportFlushEvery-1 {
+			flusher.Flush()
+		}
+	}
+
+	filename := fmt.Sprintf("smspit-messages-%s.%s", time.Now().Format("20060102-150405"), format)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	switch format {
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write(csvHeader)
+		for i, msg := range msgs {
+			cw.Write(csvRecord(msg))
+			if i%exportFlushEvery == exportFlushEvery-1 {
+				cw.Flush()
+			}
+			flush(i)
+		}
+		cw.Flush()
+	case "json":
+		enc := json.NewEncoder(w)
+		fmt.Fprint(w, "[")
+		for i, msg := range msgs {
+			if i > 0 {
+				fmt.Fprint(w, ",")
+			}
+			enc.Encode(msg)
+			flush(i)
+		}
+		fmt.Fprint(w, "]\n")
+	case "ndjson":
+		enc := json.NewEncoder(w)
+		for i, msg := range msgs {
+			enc.Encode(msg)
+			flush(i)
+		}
+	}
+}
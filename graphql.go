@@ -0,0 +1,669 @@
+package smspit
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	graphql "github.com/graph-gophers/graphql-go"
+)
+
+// graphqlSchema is the schema served at /api/graphql. Every field is scoped
+// to the request's project, as with the REST API.
+const graphqlSchema = `
+schema {
+	query: Query
+	subscription: Subscription
+}
+
+scalar Time
+
+type Query {
+	# Messages matching the filters, newest first. The filters take the
+	# same values as GET /api/v1/messages/search.
+	messages(query: String, to: String, from: String, status: String, tag: String, account: String, after: String, before: String, limit: Int = 50, offset: Int = 0): MessagePage!
+	message(id: ID!): Message
+	# Threads grouped by (to, from), most recently active first
+	conversations(limit: Int = 50, offset: Int = 0): ConversationPage!
+	conversation(to: String!, from: String!): Conversation
+	# Tags with message counts, most used first
+	tags: [Tag!]!
+}
+
+type Subscription {
+	# Messages as they are captured, optionally only those to a number or
+	# with a tag
+	messageAdded(to: String, tag: String): Message!
+}
+
+type Message {
+	id: ID!
+	to: String!
+	from: String!
+	# Contact names of the recipient and sender, when they have one
+	toName: String
+	fromName: String
+	body: String!
+	tags: [String!]!
+	status: String!
+	direction: String!
+	# sms, mms, whatsapp, rcs or viber
+	channel: String!
+	project: String!
+	unread: Boolean!
+	createdAt: Time!
+	encoding: String!
+	characters: Int!
+	segments: Int!
+	# low, normal or high, when the sender set one
+	priority: String
+	# Seconds the message may wait for delivery, and when that runs out
+	validityPeriod: Int
+	expiresAt: Time
+	# When a message sent with a ttl is deleted
+	deleteAt: Time
+	# The message this one repeats, within SMSPIT_DUPLICATE_WINDOW
+	duplicateOf: String
+	# The template the body was rendered from
+	templateId: String
+	# X-Request-ID and traceparent IDs of the request that sent the message
+	requestId: String
+	traceId: String
+	spanId: String
+	# Content screening rules an outbound message broke; it is filtered
+	filteredBy: [ContentMatch!]!
+	accountSid: String
+	conversation: Conversation!
+}
+
+type ContentMatch {
+	# banned_word, url_shortener or shaft
+	rule: String!
+	# SHAFT category, for shaft rules
+	category: String
+	# The word or host found
+	match: String!
+}
+
+type MessagePage {
+	nodes: [Message!]!
+	totalCount: Int!
+	limit: Int!
+	offset: Int!
+	hasNextPage: Boolean!
+}
+
+type Conversation {
+	to: String!
+	# The sending number, or "-" when the messages had none
+	from: String!
+	messageCount: Int!
+	inbound: Int!
+	outbound: Int!
+	unread: Int!
+	firstAt: Time!
+	lastAt: Time!
+	lastMessage: Message!
+	# The thread's messages, oldest first
+	messages(limit: Int = 50, offset: Int = 0): MessagePage!
+}
+
+type ConversationPage {
+	nodes: [Conversation!]!
+	totalCount: Int!
+	limit: Int!
+	offset: Int!
+	hasNextPage: Boolean!
+}
+
+type Tag {
+	name: String!
+	count: Int!
+	messages(limit: Int = 50, offset: Int = 0): MessagePage!
+}
+`
+
+// graphqlFederationSchema adds the _service field Apollo Federation gateways
+// read the subgraph schema from
+const graphqlFederationSchema = `
+type _Service {
+	sdl: String!
+}
+
+extend type Query {
+	_service: _Service!
+}
+`
+
+// graphqlWSProtocol is the WebSocket subprotocol for subscriptions
+// (graphql-ws's graphql-transport-ws)
+const graphqlWSProtocol = "graphql-transport-ws"
+
+// newGraphQLSchema parses the schema with s's resolvers
+func (s *Server) newGraphQLSchema() *graphql.Schema {
+	return graphql.MustParseSchema(graphqlSchema+graphqlFederationSchema, &graphqlResolver{s: s})
+}
+
+// graphqlRequest is a GraphQL operation, as POSTed or sent in a subscribe
+// message
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// graphqlProject returns the project a resolver is scoped to
+func graphqlProject(ctx context.Context) string {
+	if project, ok := ctx.Value(projectContextKey{}).(string); ok {
+		return project
+	}
+	return defaultProject
+}
+
+// handleGraphQL executes queries sent as a POSTed JSON body or GET query
+// params, and serves subscriptions over WebSocket
+func (s *Server) handleGraphQL(w http.ResponseWriter, r *http.Request) {
+	ctx := context.WithValue(r.Context(), projectContextKey{}, projectFromRequest(r))
+	if websocket.IsWebSocketUpgrade(r) {
+		s.serveGraphQLWS(w, r.WithContext(ctx))
+		return
+	}
+
+	var req graphqlRequest
+	if r.Method == "GET" {
+		q := r.URL.Query()
+		req.Query, req.OperationName = q.Get("query"), q.Get("operationName")
+		if v := q.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				http.Error(w, "Invalid variables: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+	} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Query == "" {
+		http.Error(w, "Missing 'query'", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.graphql.Exec(ctx, req.Query, req.OperationName, req.Variables))
+}
+
+// graphqlWSMessage is a graphql-transport-ws protocol message
+type graphqlWSMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// serveGraphQLWS speaks graphql-transport-ws: each subscribe message runs an
+// operation whose results are sent as next messages until it completes or
+// the client sends complete
+func (s *Server) serveGraphQLWS(w http.ResponseWriter, r *http.Request) {
+	upgrader := s.upgrader
+	upgrader.Subprotocols = []string{graphqlWSProtocol}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("GraphQL WebSocket upgrade error: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	var writeMu sync.Mutex
+	send := func(id, msgType string, payload interface{}) {
+		msg := graphqlWSMessage{ID: id, Type: msgType}
+		if payload != nil {
+			msg.Payload, _ = json.Marshal(payload)
+		}
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		conn.WriteJSON(msg)
+	}
+
+	var opsMu sync.Mutex
+	ops := make(map[string]context.CancelFunc)
+	for {
+		var msg graphqlWSMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			return
+		}
+		switch msg.Type {
+		case "connection_init":
+			send("", "connection_ack", nil)
+		case "ping":
+			send("", "pong", nil)
+		case "subscribe":
+			var req graphqlRequest
+			if err := json.Unmarshal(msg.Payload, &req); err != nil {
+				send(msg.ID, "error", []map[string]string{{"message": "Invalid payload: " + err.Error()}})
+				continue
+			}
+			opsMu.Lock()
+			if _, exists := ops[msg.ID]; exists {
+				opsMu.Unlock()
+				conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(4409, "Subscriber for "+msg.ID+" already exists"), time.Now().Add(time.Second))
+				return
+			}
+			opCtx, opCancel := context.WithCancel(ctx)
+			ops[msg.ID] = opCancel
+			opsMu.Unlock()
+
+			results, err := s.graphql.Subscribe(opCtx, req.Query, req.OperationName, req.Variables)
+			if err != nil {
+				opsMu.Lock()
+				delete(ops, msg.ID)
+				opsMu.Unlock()
+				opCancel()
+				send(msg.ID, "error", []map[string]string{{"message": err.Error()}})
+				continue
+			}
+			go func(id string) {
+				for result := range results {
+					send(id, "next", result)
+				}
+				opsMu.Lock()
+				_, active := ops[id]
+				delete(ops, id)
+				opsMu.Unlock()
+				if active {
+					send(id, "complete", nil)
+				}
+			}(msg.ID)
+		case "complete":
+			opsMu.Lock()
+			if opCancel, ok := ops[msg.ID]; ok {
+				opCancel()
+				delete(ops, msg.ID)
+			}
+			opsMu.Unlock()
+		}
+	}
+}
+
+// graphqlResolver resolves the Query and Subscription root fields
+type graphqlResolver struct {
+	s *Server
+}
+
+// graphqlPageArgs are the limit/offset arguments of list fields
+type graphqlPageArgs struct {
+	Limit  int32
+	Offset int32
+}
+
+// messagePage returns a page of msgs
+func (s *Server) messagePage(msgs []Message, args graphqlPageArgs) *messagePageResolver {
+	limit, offset, end := pageBounds(int(args.Limit), int(args.Offset), len(msgs))
+	page := &messagePageResolver{total: len(msgs), limit: limit, offset: offset, hasNext: end < len(msgs)}
+	for _, msg := range msgs[offset:end] {
+		page.nodes = append(page.nodes, &messageResolver{s: s, msg: msg})
+	}
+	return page
+}
+
+func (g *graphqlResolver) Messages(ctx context.Context, args struct {
+	Query, To, From, Status, Tag, Account, After, Before *string
+	graphqlPageArgs
+}) (*messagePageResolver, error) {
+	q := url.Values{}
+	for key, value := range map[string]*string{"q": args.Query, "to": args.To, "from": args.From, "status": args.Status, "tag": args.Tag, "account": args.Account, "after": args.After, "before": args.Before} {
+		if value != nil && *value != "" {
+			q.Set(key, *value)
+		}
+	}
+	filter, err := parseSearchValues(q)
+	if err != nil {
+		return nil, err
+	}
+	return g.s.messagePage(g.s.filterMessages(graphqlProject(ctx), filter), args.graphqlPageArgs), nil
+}
+
+func (g *graphqlResolver) Message(ctx context.Context, args struct{ ID graphql.ID }) *messageResolver {
+	g.s.mu.RLock()
+	defer g.s.mu.RUnlock()
+	for _, msg := range g.s.messagesFor(graphqlProject(ctx)) {
+		if msg.ID == string(args.ID) {
+			return &messageResolver{s: g.s, msg: msg}
+		}
+	}
+	return nil
+}
+
+func (g *graphqlResolver) Conversations(ctx context.Context, args graphqlPageArgs) *conversationPageResolver {
+	g.s.mu.RLock()
+	convs := conversations(g.s.messagesFor(graphqlProject(ctx)))
+	g.s.mu.RUnlock()
+
+	limit, offset, end := pageBounds(int(args.Limit), int(args.Offset), len(convs))
+	page := &conversationPageResolver{total: len(convs), limit: limit, offset: offset, hasNext: end < len(convs)}
+	for _, conv := range convs[offset:end] {
+		page.nodes = append(page.nodes, &conversationResolver{s: g.s, project: graphqlProject(ctx), conv: conv})
+	}
+	return page
+}
+
+func (g *graphqlResolver) Conversation(ctx context.Context, args struct{ To, From string }) *conversationResolver {
+	return g.s.conversationResolver(graphqlProject(ctx), args.To, args.From)
+}
+
+func (g *graphqlResolver) Tags(ctx context.Context) []*tagResolver {
+	g.s.mu.RLock()
+	counts := tagCounts(g.s.messagesFor(graphqlProject(ctx)))
+	g.s.mu.RUnlock()
+
+	tags := make([]*tagResolver, 0, len(counts))
+	for _, t := range counts {
+		tags = append(tags, &tagResolver{s: g.s, project: graphqlProject(ctx), tag: t})
+	}
+	return tags
+}
+
+func (g *graphqlResolver) Service() *graphqlServiceResolver {
+	return &graphqlServiceResolver{}
+}
+
+// MessageAdded streams newly captured messages until the subscription ends
+func (g *graphqlResolver) MessageAdded(ctx context.Context, args struct{ To, Tag *string }) <-chan *messageResolver {
+	project := graphqlProject(ctx)
+	events, unsubscribe := g.s.events.subscribe()
+	out := make(chan *messageResolver)
+	go func() {
+		defer unsubscribe()
+		defer close(out)
+		for {
+			select {
+			case event := <-events:
+				msg, ok := event.Data["message"].(Message)
+				if event.Data["type"] != "new_message" || !ok || msg.Project != project {
+					continue
+				}
+				if (args.To != nil && msg.To != *args.To) || (args.Tag != nil && !hasTags(msg, []string{*args.Tag})) {
+					continue
+				}
+				select {
+				case out <- &messageResolver{s: g.s, msg: msg}:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// messageResolver resolves a Message
+type messageResolver struct {
+	s   *Server
+	msg Message
+}
+
+func (m *messageResolver) ID() graphql.ID    { return graphql.ID(m.msg.ID) }
+func (m *messageResolver) To() string        { return m.msg.To }
+func (m *messageResolver) From() string      { return m.msg.From }
+func (m *messageResolver) Body() string      { return m.msg.Body }
+func (m *messageResolver) Status() string    { return m.msg.Status }
+func (m *messageResolver) Direction() string { return m.msg.Direction }
+func (m *messageResolver) Channel() string   { return m.msg.channel() }
+func (m *messageResolver) Project() string   { return m.msg.Project }
+func (m *messageResolver) Unread() bool      { return m.msg.Unread }
+func (m *messageResolver) Encoding() string  { return m.msg.Encoding }
+func (m *messageResolver) Characters() int32 { return int32(m.msg.Characters) }
+func (m *messageResolver) Segments() int32   { return int32(m.msg.Segments) }
+
+func (m *messageResolver) Tags() []string {
+	if m.msg.Tags == nil {
+		return []string{}
+	}
+	return m.msg.Tags
+}
+
+func (m *messageResolver) CreatedAt() graphql.Time {
+	return graphql.Time{Time: m.msg.CreatedAt}
+}
+
+func (m *messageResolver) ToName() *string {
+	name := m.s.contactNames(m.msg.Project).name(m.msg.To)
+	if name == "" {
+		return nil
+	}
+	return &name
+}
+
+func (m *messageResolver) FromName() *string {
+	name := m.s.contactNames(m.msg.Project).name(m.msg.From)
+	if name == "" {
+		return nil
+	}
+	return &name
+}
+
+func (m *messageResolver) Priority() *string {
+	if m.msg.Priority == "" {
+		return nil
+	}
+	return &m.msg.Priority
+}
+
+func (m *messageResolver) ValidityPeriod() *int32 {
+	if m.msg.ValidityPeriod == 0 {
+		return nil
+	}
+	n := int32(m.msg.ValidityPeriod)
+	return &n
+}
+
+func (m *messageResolver) ExpiresAt() *graphql.Time {
+	if m.msg.ExpiresAt == nil {
+		return nil
+	}
+	return &graphql.Time{Time: *m.msg.ExpiresAt}
+}
+
+func (m *messageResolver) DeleteAt() *graphql.Time {
+	if m.msg.DeleteAt == nil {
+		return nil
+	}
+	return &graphql.Time{Time: *m.msg.DeleteAt}
+}
+
+func (m *messageResolver) DuplicateOf() *string {
+	if m.msg.DuplicateOf == "" {
+		return nil
+	}
+	return &m.msg.DuplicateOf
+}
+
+func (m *messageResolver) RequestID() *string {
+	if m.msg.RequestID == "" {
+		return nil
+	}
+	return &m.msg.RequestID
+}
+
+func (m *messageResolver) TraceID() *string {
+	if m.msg.TraceID == "" {
+		return nil
+	}
+	return &m.msg.TraceID
+}
+
+func (m *messageResolver) SpanID() *string {
+	if m.msg.SpanID == "" {
+		return nil
+	}
+	return &m.msg.SpanID
+}
+
+func (m *messageResolver) TemplateID() *string {
+	if m.msg.TemplateID == "" {
+		return nil
+	}
+	return &m.msg.TemplateID
+}
+
+func (m *messageResolver) FilteredBy() []*contentMatchResolver {
+	matches := make([]*contentMatchResolver, len(m.msg.FilteredBy))
+	for i, match := range m.msg.FilteredBy {
+		matches[i] = &contentMatchResolver{match}
+	}
+	return matches
+}
+
+func (m *messageResolver) AccountSid() *string {
+	if m.msg.AccountSID == "" {
+		return nil
+	}
+	return &m.msg.AccountSID
+}
+
+func (m *messageResolver) Conversation() *conversationResolver {
+	to, from := conversationKey(m.msg)
+	if conv := m.s.conversationResolver(m.msg.Project, to, from); conv != nil {
+		return conv
+	}
+	// The message was deleted since it was resolved
+	return &conversationResolver{s: m.s, project: m.msg.Project, conv: conversations([]Message{m.msg})[0]}
+}
+
+// contentMatchResolver resolves a ContentMatch
+type contentMatchResolver struct {
+	m ContentMatch
+}
+
+func (c *contentMatchResolver) Rule() string  { return c.m.Rule }
+func (c *contentMatchResolver) Match() string { return c.m.Match }
+
+func (c *contentMatchResolver) Category() *string {
+	if c.m.Category == "" {
+		return nil
+	}
+	return &c.m.Category
+}
+
+// conversationResolver returns the (to, from) thread in project, or nil
+func (s *Server) conversationResolver(project, to, from string) *conversationResolver {
+	thread := s.thread(project, to, from)
+	if len(thread) == 0 {
+		return nil
+	}
+	return &conversationResolver{s: s, project: project, conv: conversations(thread)[0]}
+}
+
+// thread returns the (to, from) thread's messages in project, newest first
+func (s *Server) thread(project, to, from string) []Message {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var thread []Message
+	for _, msg := range s.messagesFor(project) {
+		if t, f := conversationKey(msg); t == to && f == from {
+			thread = append(thread, msg)
+		}
+	}
+	return thread
+}
+
+// conversationResolver resolves a Conversation
+type conversationResolver struct {
+	s       *Server
+	project string
+	conv    Conversation
+}
+
+func (c *conversationResolver) To() string          { return c.conv.To }
+func (c *conversationResolver) From() string        { return c.conv.From }
+func (c *conversationResolver) MessageCount() int32 { return int32(c.conv.MessageCount) }
+func (c *conversationResolver) Inbound() int32      { return int32(c.conv.Inbound) }
+func (c *conversationResolver) Outbound() int32     { return int32(c.conv.Outbound) }
+func (c *conversationResolver) Unread() int32       { return int32(c.conv.Unread) }
+
+func (c *conversationResolver) FirstAt() graphql.Time { return graphql.Time{Time: c.conv.FirstAt} }
+func (c *conversationResolver) LastAt() graphql.Time  { return graphql.Time{Time: c.conv.LastAt} }
+
+func (c *conversationResolver) LastMessage() *messageResolver {
+	return &messageResolver{s: c.s, msg: c.conv.LastMessage}
+}
+
+func (c *conversationResolver) Messages(args graphqlPageArgs) *messagePageResolver {
+	thread := c.s.thread(c.project, c.conv.To, c.conv.From)
+	sort.SliceStable(thread, func(i, j int) bool {
+		return thread[i].CreatedAt.Before(thread[j].CreatedAt)
+	})
+	return c.s.messagePage(thread, args)
+}
+
+// tagResolver resolves a Tag
+type tagResolver struct {
+	s       *Server
+	project string
+	tag     TagCount
+}
+
+func (t *tagResolver) Name() string { return t.tag.Tag }
+func (t *tagResolver) Count() int32 { return int32(t.tag.Count) }
+
+func (t *tagResolver) Messages(args graphqlPageArgs) *messagePageResolver {
+	var msgs []Message
+	t.s.mu.RLock()
+	for _, msg := range t.s.messagesFor(t.project) {
+		if hasTags(msg, []string{t.tag.Tag}) {
+			msgs = append(msgs, msg)
+		}
+	}
+	t.s.mu.RUnlock()
+	return t.s.messagePage(msgs, args)
+}
+
+// messagePageResolver resolves a MessagePage
+type messagePageResolver struct {
+	nodes                []*messageResolver
+	total, limit, offset int
+	hasNext              bool
+}
+
+func (p *messagePageResolver) Nodes() []*messageResolver {
+	if p.nodes == nil {
+		return []*messageResolver{}
+	}
+	return p.nodes
+}
+func (p *messagePageResolver) TotalCount() int32 { return int32(p.total) }
+func (p *messagePageResolver) Limit() int32      { return int32(p.limit) }
+func (p *messagePageResolver) Offset() int32     { return int32(p.offset) }
+func (p *messagePageResolver) HasNextPage() bool { return p.hasNext }
+
+// conversationPageResolver resolves a ConversationPage
+type conversationPageResolver struct {
+	nodes                []*conversationResolver
+	total, limit, offset int
+	hasNext              bool
+}
+
+func (p *conversationPageResolver) Nodes() []*conversationResolver {
+	if p.nodes == nil {
+		return []*conversationResolver{}
+	}
+	return p.nodes
+}
+func (p *conversationPageResolver) TotalCount() int32 { return int32(p.total) }
+func (p *conversationPageResolver) Limit() int32      { return int32(p.limit) }
+func (p *conversationPageResolver) Offset() int32     { return int32(p.offset) }
+func (p *conversationPageResolver) HasNextPage() bool { return p.hasNext }
+
+// graphqlServiceResolver resolves _service for Apollo Federation gateways
+type graphqlServiceResolver struct{}
+
+func (graphqlServiceResolver) Sdl() string { return graphqlSchema }
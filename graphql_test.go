@@ -0,0 +1,236 @@
+package smspit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// graphqlResponse is a GraphQL result
+type graphqlResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// query POSTs a GraphQL operation to /api/graphql
+func (ts *testServer) query(t *testing.T, query string, variables map[string]interface{}, header ...string) graphqlResponse {
+	t.Helper()
+	body, _ := json.Marshal(graphqlRequest{Query: query, Variables: variables})
+	w := do(t, ts.web, "POST", "/api/graphql", string(body), header...)
+	if w.Code != http.StatusOK {
+		t.Fatalf("graphql: %d %s", w.Code, w.Body)
+	}
+	var resp graphqlResponse
+	decode(t, w, &resp)
+	return resp
+}
+
+// jsonEqual reports whether two JSON documents hold the same values
+func jsonEqual(t *testing.T, a, b []byte) bool {
+	t.Helper()
+	var va, vb interface{}
+	if err := json.Unmarshal(a, &va); err != nil {
+		t.Fatalf("decoding %s: %v", a, err)
+	}
+	if err := json.Unmarshal(b, &vb); err != nil {
+		t.Fatalf("decoding %s: %v", b, err)
+	}
+	return reflect.DeepEqual(va, vb)
+}
+
+func TestGraphQLQueries(t *testing.T) {
+	ts := newTestServer(t, Config{})
+	w := do(t, ts.api, "POST", "/send", `{"to":"+15551230001","from":"+15550009999","body":"Your code is 123456","tags":["otp"]}`)
+	var sent struct {
+		ID string `json:"id"`
+	}
+	decode(t, w, &sent)
+	id := sent.ID
+	ts.send(t, "+15551230002", "Hello there")
+	ts.send(t, "+15551230001", "Hello again")
+	do(t, ts.api, "POST", "/send", `{"to":"+15551230009","body":"Elsewhere","tags":["team"]}`, projectHeader, "other")
+
+	tests := []struct {
+		name      string
+		query     string
+		variables map[string]interface{}
+		header    []string
+		want      string // Expected data, as JSON
+		wantError string
+	}{
+		{
+			name:  "messages",
+			query: `{ messages { totalCount hasNextPage nodes { to body } } }`,
+			want: `{"messages": {"totalCount": 3, "hasNextPage": false, "nodes": [
+				{"to": "+15551230001", "body": "Hello again"},
+				{"to": "+15551230002", "body": "Hello there"},
+				{"to": "+15551230001", "body": "Your code is 123456"}]}}`,
+		},
+		{
+			name:  "messages filtered and paged",
+			query: `{ messages(to: "+15551230001", limit: 1) { totalCount hasNextPage limit nodes { body } } }`,
+			want:  `{"messages": {"totalCount": 2, "hasNextPage": true, "limit": 1, "nodes": [{"body": "Hello again"}]}}`,
+		},
+		{
+			name:      "message by ID",
+			query:     `query($id: ID!) { message(id: $id) { id tags segments conversation { messageCount } } }`,
+			variables: map[string]interface{}{"id": id},
+			want:      `{"message": {"id": "` + id + `", "tags": ["otp"], "segments": 1, "conversation": {"messageCount": 2}}}`,
+		},
+		{
+			name:  "unknown message",
+			query: `{ message(id: "msg_missing") { id } }`,
+			want:  `{"message": null}`,
+		},
+		{
+			name:  "conversations",
+			query: `{ conversations { totalCount nodes { to messageCount lastMessage { body } } } }`,
+			want: `{"conversations": {"totalCount": 2, "nodes": [
+				{"to": "+15551230001", "messageCount": 2, "lastMessage": {"body": "Hello again"}},
+				{"to": "+15551230002", "messageCount": 1, "lastMessage": {"body": "Hello there"}}]}}`,
+		},
+		{
+			name:  "tags",
+			query: `{ tags { name count messages { totalCount } } }`,
+			want:  `{"tags": [{"name": "otp", "count": 1, "messages": {"totalCount": 1}}]}`,
+		},
+		{
+			name:   "project header",
+			query:  `{ messages { totalCount nodes { project } } tags { name } }`,
+			header: []string{projectHeader, "other"},
+			want:   `{"messages": {"totalCount": 1, "nodes": [{"project": "other"}]}, "tags": [{"name": "team"}]}`,
+		},
+		{
+			name:      "invalid filter",
+			query:     `{ messages(after: "someday") { totalCount } }`,
+			wantError: "after",
+		},
+		{
+			name:      "unknown field",
+			query:     `{ messages { nodes { secret } } }`,
+			wantError: `Cannot query field "secret"`,
+		},
+		{
+			name:  "federation SDL",
+			query: `{ _service { sdl } }`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := ts.query(t, tt.query, tt.variables, tt.header...)
+			if tt.wantError != "" {
+				if len(resp.Errors) == 0 || !strings.Contains(resp.Errors[0].Message, tt.wantError) {
+					t.Errorf("errors %+v, want one mentioning %q", resp.Errors, tt.wantError)
+				}
+				return
+			}
+			if len(resp.Errors) > 0 {
+				t.Fatalf("errors %+v", resp.Errors)
+			}
+			if tt.want != "" && !jsonEqual(t, resp.Data, []byte(tt.want)) {
+				t.Errorf("data %s, want %s", resp.Data, tt.want)
+			}
+		})
+	}
+}
+
+func TestGraphQLGet(t *testing.T) {
+	ts := newTestServer(t, Config{})
+	ts.send(t, "+15551230001", "Hello")
+
+	q := url.Values{
+		"query":     {`query($to: String) { messages(to: $to) { totalCount } }`},
+		"variables": {`{"to": "+15551230001"}`},
+	}
+	w := do(t, ts.web, "GET", "/api/graphql?"+q.Encode(), "")
+	var resp graphqlResponse
+	decode(t, w, &resp)
+	if !jsonEqual(t, resp.Data, []byte(`{"messages": {"totalCount": 1}}`)) {
+		t.Errorf("GET query: %s", w.Body)
+	}
+
+	for _, target := range []string{"/api/graphql", "/api/graphql?query=%7B%7D&variables=nope"} {
+		if w := do(t, ts.web, "GET", target, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("GET %s: %d, want 400", target, w.Code)
+		}
+	}
+}
+
+func TestGraphQLAuth(t *testing.T) {
+	ts := newTestServer(t, Config{AuthToken: "secret"})
+	bound := ts.createToken(t, `{"scopes":["read"],"project":"team-a"}`)
+	do(t, ts.api, "POST", "/send", `{"to":"+15551230001","body":"Hi"}`, "Authorization", "Bearer secret")
+	do(t, ts.api, "POST", "/send", `{"to":"+15551230001","body":"Hi"}`, "Authorization", "Bearer secret", projectHeader, "team-a")
+
+	body := `{"query": "{ messages { totalCount } }"}`
+	if w := do(t, ts.web, "POST", "/api/graphql", body); w.Code != http.StatusUnauthorized {
+		t.Errorf("without a token: %d, want 401", w.Code)
+	}
+	// A project-bound token only sees its project, whatever it asks for
+	resp := ts.query(t, `{ messages { totalCount nodes { project } } }`, nil, "Authorization", "Bearer "+bound, projectHeader, "default")
+	if !jsonEqual(t, resp.Data, []byte(`{"messages": {"totalCount": 1, "nodes": [{"project": "team-a"}]}}`)) {
+		t.Errorf("project-bound token: %s", resp.Data)
+	}
+}
+
+func TestGraphQLSubscription(t *testing.T) {
+	ts := newTestServer(t, Config{})
+	srv := httptest.NewServer(ts.web)
+	defer srv.Close()
+
+	dialer := websocket.Dialer{Subprotocols: []string{graphqlWSProtocol}}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/api/graphql", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	read := func() graphqlWSMessage {
+		t.Helper()
+		var msg graphqlWSMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatal(err)
+		}
+		return msg
+	}
+
+	conn.WriteJSON(graphqlWSMessage{Type: "connection_init"})
+	if msg := read(); msg.Type != "connection_ack" {
+		t.Fatalf("got %+v, want connection_ack", msg)
+	}
+	payload, _ := json.Marshal(graphqlRequest{Query: `subscription { messageAdded(to: "+15551230001") { to body } }`})
+	conn.WriteJSON(graphqlWSMessage{ID: "1", Type: "subscribe", Payload: payload})
+	time.Sleep(50 * time.Millisecond)
+
+	ts.send(t, "+15551230002", "Not for this subscription")
+	ts.send(t, "+15551230001", "Hello")
+	msg := read()
+	var result graphqlResponse
+	json.Unmarshal(msg.Payload, &result)
+	if msg.Type != "next" || msg.ID != "1" || !jsonEqual(t, result.Data, []byte(`{"messageAdded": {"to": "+15551230001", "body": "Hello"}}`)) {
+		t.Fatalf("got %+v, want the message to +15551230001", msg)
+	}
+
+	conn.WriteJSON(graphqlWSMessage{Type: "ping"})
+	if msg := read(); msg.Type != "pong" {
+		t.Errorf("got %+v, want pong", msg)
+	}
+
+	// Completing ends the subscription without a complete message back
+	conn.WriteJSON(graphqlWSMessage{ID: "1", Type: "complete"})
+	time.Sleep(50 * time.Millisecond)
+	ts.send(t, "+15551230001", "After complete")
+	conn.WriteJSON(graphqlWSMessage{Type: "ping"})
+	if msg := read(); msg.Type != "pong" {
+		t.Errorf("got %+v after complete, want only the pong", msg)
+	}
+}
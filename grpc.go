@@ -0,0 +1,287 @@
+package smspit
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/substrate-app/smspit/smspitpb"
+)
+
+// grpcProjectMetadata selects the project for RPCs that don't set one
+const grpcProjectMetadata = "x-smspit-project"
+
+// grpcService implements the SMSpit gRPC API (smspitpb/smspit.proto)
+type grpcService struct {
+	smspitpb.UnimplementedSMSpitServer
+	s *Server
+}
+
+// grpcTokenKey holds the authenticated token in an RPC's context
+type grpcTokenKey struct{}
+
+// newGRPCServer returns a gRPC server with the SMSpit service registered
+func (s *Server) newGRPCServer(opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts,
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+			ctx, span := s.grpcSpan(ctx, info.FullMethod)
+			defer func() { endSpan(span, err) }()
+
+			if ctx, err = s.grpcAuth(ctx, info.FullMethod); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+			ctx, span := s.grpcSpan(ss.Context(), info.FullMethod)
+			defer func() { endSpan(span, err) }()
+
+			if ctx, err = s.grpcAuth(ctx, info.FullMethod); err != nil {
+				return err
+			}
+			return handler(srv, &grpcAuthStream{ServerStream: ss, ctx: ctx})
+		}),
+	)
+	server := grpc.NewServer(opts...)
+	smspitpb.RegisterSMSpitServer(server, &grpcService{s: s})
+	return server
+}
+
+// grpcAuthStream carries the authenticated context into a streaming RPC
+type grpcAuthStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (a *grpcAuthStream) Context() context.Context { return a.ctx }
+
+// grpcAuth enforces API tokens like authMiddleware when SMSPIT_AUTH_TOKEN or
+// SSO is set: SendMessage needs the send scope and the other RPCs read
+func (s *Server) grpcAuth(ctx context.Context, method string) (context.Context, error) {
+	if !s.authEnabled() {
+		return ctx, nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	var secret string
+	if values := md.Get("authorization"); len(values) > 0 {
+		secret = strings.TrimPrefix(values[0], "Bearer ")
+	}
+	var token *APIToken
+	ok := false
+	if secret != "" && s.isRootToken(secret) {
+		token, ok = rootToken, true
+	} else if secret != "" {
+		token, ok = s.tokens.lookup(secret)
+	}
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "Unauthorized")
+	}
+
+	scope := scopeRead
+	if method == smspitpb.SMSpit_SendMessage_FullMethodName {
+		scope = scopeSend
+	}
+	if !token.hasScope(scope) {
+		return nil, status.Errorf(codes.PermissionDenied, "token lacks '%s' scope", scope)
+	}
+	return context.WithValue(ctx, grpcTokenKey{}, token), nil
+}
+
+// grpcProject resolves an RPC's project: the request field, then the
+// x-smspit-project metadata, then the default. Project-bound tokens are
+// limited to their project.
+func grpcProject(ctx context.Context, requested string) (string, error) {
+	project := requested
+	if project == "" {
+		if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get(grpcProjectMetadata)) > 0 {
+			project = md.Get(grpcProjectMetadata)[0]
+		}
+	}
+	if project != "" && !validProjectName.MatchString(project) {
+		return "", status.Error(codes.InvalidArgument, "Invalid project name")
+	}
+
+	if token, ok := ctx.Value(grpcTokenKey{}).(*APIToken); ok && token.Project != "" {
+		if project != "" && project != defaultProject && project != token.Project {
+			return "", status.Errorf(codes.PermissionDenied, "token is limited to project '%s'", token.Project)
+		}
+		return token.Project, nil
+	}
+	if project == "" {
+		project = defaultProject
+	}
+	return project, nil
+}
+
+// grpcMessageMetadata returns the message metadata set by an RPC's
+// x-smspit-meta-* metadata, like the X-SMSpit-Meta-* HTTP headers
+func grpcMessageMetadata(ctx context.Context) map[string]string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var meta map[string]string
+	for name, values := range md {
+		key := strings.TrimPrefix(name, strings.ToLower(metaHeaderPrefix))
+		if key == name || !validMetadataKey.MatchString(key) || len(values) == 0 {
+			continue
+		}
+		if meta == nil {
+			meta = make(map[string]string)
+		}
+		meta[key] = values[0]
+	}
+	return meta
+}
+
+// grpcMessage converts a message to its protobuf form
+func grpcMessage(msg Message) *smspitpb.Message {
+	return &smspitpb.Message{
+		Id:         msg.ID,
+		To:         msg.To,
+		From:       msg.From,
+		Body:       msg.Body,
+		Tags:       msg.Tags,
+		Status:     msg.Status,
+		Direction:  msg.Direction,
+		Project:    msg.Project,
+		Unread:     msg.Unread,
+		CreatedAt:  timestamppb.New(msg.CreatedAt),
+		Encoding:   msg.Encoding,
+		Characters: int32(msg.Characters),
+		Segments:   int32(msg.Segments),
+		AccountSid: msg.AccountSID,
+	}
+}
+
+// SendMessage captures a message
+func (g *grpcService) SendMessage(ctx context.Context, req *smspitpb.SendMessageRequest) (*smspitpb.Message, error) {
+	project, err := grpcProject(ctx, req.GetProject())
+	if err != nil {
+		return nil, err
+	}
+	if req.GetTo() == "" {
+		return nil, status.Error(codes.InvalidArgument, "to is required")
+	}
+	if req.GetBody() == "" {
+		return nil, status.Error(codes.InvalidArgument, "body is required")
+	}
+
+	msg := Message{
+		ID:        "msg_" + uuid.New().String()[:8],
+		To:        req.GetTo(),
+		From:      req.GetFrom(),
+		Body:      req.GetBody(),
+		Tags:      req.GetTags(),
+		Status:    "captured",
+		CreatedAt: time.Now(),
+		Project:   project,
+		Metadata:  grpcMessageMetadata(ctx),
+
+		Correlation: grpcCorrelation(ctx),
+	}
+	var tooLong *MessageTooLongError
+	var badSender *SenderError
+	if err := g.s.captureMessage(&msg); errors.Is(err, errShuttingDown) {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	} else if errors.As(err, &tooLong) || errors.As(err, &badSender) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	} else if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+
+	log.Printf("📱 SMS captured (gRPC): To=%s Body=%s", msg.To, truncate(msg.Body, 50))
+	return grpcMessage(msg), nil
+}
+
+// ListMessages returns a page of the project's messages matching the filters
+func (g *grpcService) ListMessages(ctx context.Context, req *smspitpb.ListMessagesRequest) (*smspitpb.ListMessagesResponse, error) {
+	project, err := grpcProject(ctx, req.GetProject())
+	if err != nil {
+		return nil, err
+	}
+
+	q := url.Values{}
+	for key, value := range map[string]string{"q": req.GetQuery(), "to": req.GetTo(), "from": req.GetFrom(), "status": req.GetStatus(), "tag": req.GetTag()} {
+		if value != "" {
+			q.Set(key, value)
+		}
+	}
+	filter, err := parseSearchValues(q)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid filter: %v", err)
+	}
+	msgs := g.s.filterMessages(project, filter)
+
+	limit, offset, end := pageBounds(int(req.GetLimit()), int(req.GetOffset()), len(msgs))
+
+	resp := &smspitpb.ListMessagesResponse{Total: int32(len(msgs)), Limit: int32(limit), Offset: int32(offset)}
+	for _, msg := range msgs[offset:end] {
+		resp.Messages = append(resp.Messages, grpcMessage(msg))
+	}
+	return resp, nil
+}
+
+// StreamMessages streams the project's new messages (and optionally status
+// updates) until the client goes away
+func (g *grpcService) StreamMessages(req *smspitpb.StreamMessagesRequest, stream smspitpb.SMSpit_StreamMessagesServer) error {
+	project, err := grpcProject(stream.Context(), req.GetProject())
+	if err != nil {
+		return err
+	}
+
+	var replay []busEvent
+	var events <-chan busEvent
+	var unsubscribe func()
+	if req.GetAfterEventId() > 0 {
+		replay, events, unsubscribe = g.s.events.subscribeSince(req.GetAfterEventId())
+	} else {
+		events, unsubscribe = g.s.events.subscribe()
+	}
+	defer unsubscribe()
+
+	send := func(event busEvent) error {
+		eventType, _ := event.Data["type"].(string)
+		if !eventVisibleTo(event.Data, project) {
+			return nil
+		}
+		if eventType != "new_message" && (eventType != "status_update" || !req.GetIncludeStatusUpdates()) {
+			return nil
+		}
+		msg, ok := event.Data["message"].(Message)
+		if !ok {
+			return nil
+		}
+		previous, _ := event.Data["previous_status"].(string)
+		return stream.Send(&smspitpb.MessageEvent{
+			EventId:        event.ID,
+			Type:           eventType,
+			Message:        grpcMessage(msg),
+			PreviousStatus: previous,
+		})
+	}
+
+	for _, event := range replay {
+		if err := send(event); err != nil {
+			return err
+		}
+	}
+	for {
+		select {
+		case event := <-events:
+			if err := send(event); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package smspit
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/substrate-app/smspit/smspitpb"
+)
+
+// dialGRPC serves ts's gRPC API in memory and returns a client for it
+func dialGRPC(t *testing.T, ts *testServer) smspitpb.SMSpitClient {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	server := ts.newGRPCServer()
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///smspit",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return smspitpb.NewSMSpitClient(conn)
+}
+
+// grpcContext returns a context carrying metadata name, value pairs
+func grpcContext(t *testing.T, md ...string) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	return metadata.AppendToOutgoingContext(ctx, md...)
+}
+
+// createToken issues an API token with the root token "secret"
+func (ts *testServer) createToken(t *testing.T, body string) string {
+	t.Helper()
+	w := do(t, ts.web, "POST", "/api/v1/admin/tokens", body, "Authorization", "Bearer secret")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create token: %d %s", w.Code, w.Body)
+	}
+	var token APIToken
+	decode(t, w, &token)
+	return token.Token
+}
+
+func TestGRPCAuth(t *testing.T) {
+	ts := newTestServer(t, Config{AuthToken: "secret"})
+	client := dialGRPC(t, ts)
+	read := ts.createToken(t, `{"scopes":["read"]}`)
+	send := ts.createToken(t, `{"scopes":["send"]}`)
+
+	tests := []struct {
+		name       string
+		token      string
+		wantSend   codes.Code
+		wantList   codes.Code
+		wantStream codes.Code
+	}{
+		{"no token", "", codes.Unauthenticated, codes.Unauthenticated, codes.Unauthenticated},
+		{"unknown token", "wrong", codes.Unauthenticated, codes.Unauthenticated, codes.Unauthenticated},
+		{"root token", "secret", codes.OK, codes.OK, codes.OK},
+		{"read scope", read, codes.PermissionDenied, codes.OK, codes.OK},
+		{"send scope", send, codes.OK, codes.PermissionDenied, codes.PermissionDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var md []string
+			if tt.token != "" {
+				md = []string{"authorization", "Bearer " + tt.token}
+			}
+			_, err := client.SendMessage(grpcContext(t, md...), &smspitpb.SendMessageRequest{To: "+15551230001", Body: "Hi"})
+			if got := status.Code(err); got != tt.wantSend {
+				t.Errorf("SendMessage: %v, want %v", err, tt.wantSend)
+			}
+			_, err = client.ListMessages(grpcContext(t, md...), &smspitpb.ListMessagesRequest{})
+			if got := status.Code(err); got != tt.wantList {
+				t.Errorf("ListMessages: %v, want %v", err, tt.wantList)
+			}
+			ctx, cancel := context.WithTimeout(grpcContext(t, md...), 100*time.Millisecond)
+			defer cancel()
+			stream, err := client.StreamMessages(ctx, &smspitpb.StreamMessagesRequest{})
+			if err == nil {
+				_, err = stream.Recv()
+			}
+			if status.Code(err) == codes.DeadlineExceeded {
+				err = nil // An allowed stream waits for events
+			}
+			if got := status.Code(err); got != tt.wantStream {
+				t.Errorf("StreamMessages: %v, want %v", err, tt.wantStream)
+			}
+		})
+	}
+}
+
+func TestGRPCSendMessage(t *testing.T) {
+	ts := newTestServer(t, Config{AuthToken: "secret"})
+	client := dialGRPC(t, ts)
+	bound := ts.createToken(t, `{"scopes":["send","read"],"project":"team-a"}`)
+
+	tests := []struct {
+		name        string
+		token       string
+		req         *smspitpb.SendMessageRequest
+		md          []string
+		want        codes.Code
+		wantProject string
+	}{
+		{"default project", "secret", &smspitpb.SendMessageRequest{To: "+15551230001", Body: "Hi"}, nil, codes.OK, defaultProject},
+		{"request project", "secret", &smspitpb.SendMessageRequest{To: "+15551230001", Body: "Hi", Project: "team-b"}, nil, codes.OK, "team-b"},
+		{"metadata project", "secret", &smspitpb.SendMessageRequest{To: "+15551230001", Body: "Hi"}, []string{grpcProjectMetadata, "team-c"}, codes.OK, "team-c"},
+		{"project-bound token", bound, &smspitpb.SendMessageRequest{To: "+15551230001", Body: "Hi"}, nil, codes.OK, "team-a"},
+		{"project-bound token, other project", bound, &smspitpb.SendMessageRequest{To: "+15551230001", Body: "Hi", Project: "team-b"}, nil, codes.PermissionDenied, ""},
+		{"invalid project", "secret", &smspitpb.SendMessageRequest{To: "+15551230001", Body: "Hi", Project: "Team B"}, nil, codes.InvalidArgument, ""},
+		{"missing to", "secret", &smspitpb.SendMessageRequest{Body: "Hi"}, nil, codes.InvalidArgument, ""},
+		{"missing body", "secret", &smspitpb.SendMessageRequest{To: "+15551230001"}, nil, codes.InvalidArgument, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			md := append([]string{"authorization", "Bearer " + tt.token}, tt.md...)
+			msg, err := client.SendMessage(grpcContext(t, md...), tt.req)
+			if got := status.Code(err); got != tt.want {
+				t.Fatalf("SendMessage: %v, want %v", err, tt.want)
+			}
+			if err != nil {
+				return
+			}
+			if msg.GetProject() != tt.wantProject || msg.GetId() == "" || msg.GetSegments() != 1 {
+				t.Errorf("SendMessage = %v, want a message in %s", msg, tt.wantProject)
+			}
+		})
+	}
+}
+
+func TestGRPCListMessages(t *testing.T) {
+	ts := newTestServer(t, Config{})
+	client := dialGRPC(t, ts)
+	ts.send(t, "+15551230001", "Your code is 123456")
+	ts.send(t, "+15551230002", "Hello there")
+	ts.send(t, "+15551230001", "Hello again")
+
+	ctx := grpcContext(t, "x-smspit-meta-build", "42")
+	if _, err := client.SendMessage(ctx, &smspitpb.SendMessageRequest{To: "+15551230003", Body: "Tagged", Tags: []string{"ci"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		req       *smspitpb.ListMessagesRequest
+		wantTotal int32
+		wantCount int
+		wantCode  codes.Code
+	}{
+		{"all", &smspitpb.ListMessagesRequest{}, 4, 4, codes.OK},
+		{"by recipient", &smspitpb.ListMessagesRequest{To: "+15551230001"}, 2, 2, codes.OK},
+		{"by query", &smspitpb.ListMessagesRequest{Query: "hello"}, 2, 2, codes.OK},
+		{"by tag", &smspitpb.ListMessagesRequest{Tag: "ci"}, 1, 1, codes.OK},
+		{"page", &smspitpb.ListMessagesRequest{Limit: 1, Offset: 1}, 4, 1, codes.OK},
+		{"other project", &smspitpb.ListMessagesRequest{Project: "other"}, 0, 0, codes.OK},
+		{"invalid filter", &smspitpb.ListMessagesRequest{Query: "after:yesterday-ish"}, 0, 0, codes.InvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := client.ListMessages(grpcContext(t), tt.req)
+			if got := status.Code(err); got != tt.wantCode {
+				t.Fatalf("ListMessages: %v, want %v", err, tt.wantCode)
+			}
+			if resp.GetTotal() != tt.wantTotal || len(resp.GetMessages()) != tt.wantCount {
+				t.Errorf("total %d, %d messages; want %d, %d", resp.GetTotal(), len(resp.GetMessages()), tt.wantTotal, tt.wantCount)
+			}
+		})
+	}
+
+	if msgs := ts.messages(t); msgs[0].Metadata["build"] != "42" {
+		t.Errorf("metadata = %v, want build=42 from x-smspit-meta-build", msgs[0].Metadata)
+	}
+}
+
+func TestGRPCStreamMessages(t *testing.T) {
+	ts := newTestServer(t, Config{DeliverySim: true, DeliveryDelay: 10 * time.Millisecond})
+	client := dialGRPC(t, ts)
+
+	stream, err := client.StreamMessages(grpcContext(t), &smspitpb.StreamMessagesRequest{IncludeStatusUpdates: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Let the stream subscribe before sending
+	time.Sleep(50 * time.Millisecond)
+	do(t, ts.api, "POST", "/send", `{"to":"+15551230001","body":"Other project"}`, projectHeader, "other")
+	id := ts.send(t, "+15551230001", "Hello")
+
+	want := []struct{ typ, status string }{
+		{"new_message", "queued"},
+		{"status_update", "sent"},
+		{"status_update", "delivered"},
+	}
+	var lastEvent uint64
+	for _, w := range want {
+		event, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if event.GetType() != w.typ || event.GetMessage().GetId() != id || event.GetMessage().GetStatus() != w.status {
+			t.Fatalf("event %v, want %s of %s as %s", event, w.typ, id, w.status)
+		}
+		lastEvent = event.GetEventId()
+	}
+
+	// Resuming replays the events after the given one
+	id2 := ts.send(t, "+15551230001", "Hello again")
+	replay, err := client.StreamMessages(grpcContext(t), &smspitpb.StreamMessagesRequest{AfterEventId: lastEvent})
+	if err != nil {
+		t.Fatal(err)
+	}
+	event, err := replay.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.GetType() != "new_message" || event.GetMessage().GetId() != id2 {
+		t.Errorf("replayed event %v, want new_message of %s", event, id2)
+	}
+}
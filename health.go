@@ -0,0 +1,178 @@
+package smspit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// readyStoreTimeout is how long readiness waits for the message store
+const readyStoreTimeout = 2 * time.Second
+
+// errDiskFreeUnsupported is returned by diskFree where free space can't be
+// checked; readiness then skips the disk check
+var errDiskFreeUnsupported = errors.New("free disk space can't be checked on this platform")
+
+// listenerStates tracks whether the servers started by Start are serving,
+// for readiness
+type listenerStates struct {
+	mu     sync.Mutex
+	states map[string]string // Listener name → serving, stopped or the error it failed with
+}
+
+// set records a listener's state
+func (l *listenerStates) set(name, state string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.states == nil {
+		l.states = make(map[string]string)
+	}
+	l.states[name] = state
+}
+
+// stopAll marks every listener stopped, as the instance shuts down
+func (l *listenerStates) stopAll() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for name := range l.states {
+		l.states[name] = "stopped"
+	}
+}
+
+// snapshot returns a copy of the states
+func (l *listenerStates) snapshot() map[string]string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	states := make(map[string]string, len(l.states))
+	for name, state := range l.states {
+		states[name] = state
+	}
+	return states
+}
+
+// storeProbe shares one lock probe between concurrent readiness checks, so
+// a stuck message store holds up a single goroutine however often /readyz
+// is polled
+type storeProbe struct {
+	mu   sync.Mutex
+	done chan struct{} // Closed once the running probe gets the lock; nil when none is running
+}
+
+// ReadinessCheck is the outcome of one readiness check
+type ReadinessCheck struct {
+	Status string `json:"status"` // ok, failed or skipped
+	Error  string `json:"error,omitempty"`
+	// Disk check
+	Path      string `json:"path,omitempty"`
+	FreeBytes uint64 `json:"free_bytes,omitempty"`
+	// Listener check
+	Listeners map[string]string `json:"listeners,omitempty"`
+}
+
+// handleLivez reports that the process is up and serving HTTP
+func (s *Server) handleLivez(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "alive"})
+}
+
+// handleReadyz reports whether SMSpit can accept captures: the message store
+// responds, the store's disk has SMSPIT_READY_MIN_FREE_MB free, every
+// listener is serving and, in a cluster, NATS and the shared store are
+// reachable. It answers 503 if any check fails, e.g. while
+// shutting down.
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]ReadinessCheck{
+		"store":     s.checkStore(),
+		"disk":      s.checkDisk(),
+		"listeners": s.checkListeners(),
+		"cluster":   s.checkCluster(),
+	}
+
+	status, code := "ready", http.StatusOK
+	for _, check := range checks {
+		if check.Status == "failed" {
+			status, code = "not ready", http.StatusServiceUnavailable
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": status,
+		"checks": checks,
+	})
+}
+
+// checkStore checks that the message store isn't stuck behind a lock
+func (s *Server) checkStore() ReadinessCheck {
+	if s.mu.TryRLock() {
+		s.mu.RUnlock()
+		return ReadinessCheck{Status: "ok"}
+	}
+
+	// Busy: wait for the lock, joining the probe already waiting if any
+	s.probe.mu.Lock()
+	done := s.probe.done
+	if done == nil {
+		done = make(chan struct{})
+		s.probe.done = done
+		go func() {
+			s.mu.RLock()
+			s.mu.RUnlock()
+			s.probe.mu.Lock()
+			s.probe.done = nil
+			s.probe.mu.Unlock()
+			close(done)
+		}()
+	}
+	s.probe.mu.Unlock()
+
+	select {
+	case <-done:
+		return ReadinessCheck{Status: "ok"}
+	case <-time.After(readyStoreTimeout):
+		return ReadinessCheck{Status: "failed", Error: "message store is not responding"}
+	}
+}
+
+// checkDisk checks the free space where the store's database lives
+func (s *Server) checkDisk() ReadinessCheck {
+	if s.config.ReadyMinFreeMB <= 0 {
+		return ReadinessCheck{Status: "skipped"}
+	}
+	dir := filepath.Dir(s.config.DBPath)
+	free, err := diskFree(dir)
+	if errors.Is(err, errDiskFreeUnsupported) {
+		return ReadinessCheck{Status: "skipped", Path: dir, Error: err.Error()}
+	}
+	if err != nil {
+		return ReadinessCheck{Status: "failed", Path: dir, Error: err.Error()}
+	}
+	check := ReadinessCheck{Status: "ok", Path: dir, FreeBytes: free}
+	if min := uint64(s.config.ReadyMinFreeMB) << 20; free < min {
+		check.Status = "failed"
+		check.Error = fmt.Sprintf("less than %d MB free", s.config.ReadyMinFreeMB)
+	}
+	return check
+}
+
+// checkListeners checks that the servers started by Start are all serving.
+// It is skipped when the handlers are mounted by an embedding program.
+func (s *Server) checkListeners() ReadinessCheck {
+	states := s.listeners.snapshot()
+	if len(states) == 0 {
+		return ReadinessCheck{Status: "skipped"}
+	}
+	check := ReadinessCheck{Status: "ok", Listeners: states}
+	for name, state := range states {
+		if state != "serving" {
+			check.Status = "failed"
+			check.Error = name + " listener is " + state
+		}
+	}
+	return check
+}
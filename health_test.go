@@ -0,0 +1,138 @@
+package smspit
+
+import (
+	"net/http"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestReadyz(t *testing.T) {
+	serving := func(s *Server) { s.listeners.set("api", "serving"); s.listeners.set("web", "serving") }
+
+	tests := []struct {
+		name      string
+		config    Config
+		setup     func(s *Server)
+		want      int
+		checks    map[string]string // Check name → status
+		wantError string            // Part of the failed check's error
+	}{
+		{
+			name:   "ready, embedded",
+			want:   http.StatusOK,
+			checks: map[string]string{"store": "ok", "disk": "skipped", "listeners": "skipped", "cluster": "skipped"},
+		},
+		{
+			name:   "ready, listeners serving",
+			config: Config{DBPath: t.TempDir() + "/smspit.db", ReadyMinFreeMB: 1},
+			setup:  serving,
+			want:   http.StatusOK,
+			checks: map[string]string{"store": "ok", "disk": "ok", "listeners": "ok", "cluster": "skipped"},
+		},
+		{
+			name:      "listener stopped",
+			setup:     func(s *Server) { s.listeners.set("api", "serving"); s.listeners.set("web", "stopped") },
+			want:      http.StatusServiceUnavailable,
+			checks:    map[string]string{"store": "ok", "listeners": "failed"},
+			wantError: "web listener is stopped",
+		},
+		{
+			name:      "listener failed to start",
+			setup:     func(s *Server) { s.listeners.set("smtp", "listen tcp :25: bind: permission denied") },
+			want:      http.StatusServiceUnavailable,
+			checks:    map[string]string{"listeners": "failed"},
+			wantError: "permission denied",
+		},
+		{
+			name:      "shutting down",
+			setup:     func(s *Server) { serving(s); s.listeners.stopAll() },
+			want:      http.StatusServiceUnavailable,
+			checks:    map[string]string{"listeners": "failed"},
+			wantError: "is stopped",
+		},
+		{
+			name:      "disk full",
+			config:    Config{DBPath: t.TempDir() + "/smspit.db", ReadyMinFreeMB: 1 << 40},
+			want:      http.StatusServiceUnavailable,
+			checks:    map[string]string{"store": "ok", "disk": "failed", "listeners": "skipped"},
+			wantError: "MB free",
+		},
+		{
+			name:      "database directory missing",
+			config:    Config{DBPath: t.TempDir() + "/missing/smspit.db", ReadyMinFreeMB: 1},
+			want:      http.StatusServiceUnavailable,
+			checks:    map[string]string{"disk": "failed"},
+			wantError: "no such file",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t, tt.config)
+			if tt.setup != nil {
+				tt.setup(ts.Server)
+			}
+			for _, h := range []http.Handler{ts.api, ts.web} {
+				if w := do(t, h, "GET", "/livez", ""); w.Code != http.StatusOK {
+					t.Errorf("livez: %d", w.Code)
+				}
+				w := do(t, h, "GET", "/readyz", "")
+				if w.Code != tt.want {
+					t.Errorf("readyz: %d %s, want %d", w.Code, w.Body, tt.want)
+				}
+				var resp struct {
+					Status string                    `json:"status"`
+					Checks map[string]ReadinessCheck `json:"checks"`
+				}
+				decode(t, w, &resp)
+				if ready := resp.Status == "ready"; ready != (tt.want == http.StatusOK) {
+					t.Errorf("status %q with code %d", resp.Status, w.Code)
+				}
+				for name, status := range tt.checks {
+					check := resp.Checks[name]
+					if check.Status != status {
+						t.Errorf("%s check = %+v, want %s", name, check, status)
+					}
+					if status == "failed" && !strings.Contains(check.Error, tt.wantError) {
+						t.Errorf("%s check error %q, want it to mention %q", name, check.Error, tt.wantError)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestReadyzStuckStore(t *testing.T) {
+	if testing.Short() {
+		t.Skip("waits for the store timeout")
+	}
+	ts := newTestServer(t, Config{})
+
+	ts.mu.Lock()
+	before := runtime.NumGoroutine()
+	var wg sync.WaitGroup
+	codes := make([]int, 10)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i] = do(t, ts.web, "GET", "/readyz", "").Code
+		}(i)
+	}
+	wg.Wait()
+	// The probes share one goroutine waiting for the lock
+	if n := runtime.NumGoroutine() - before; n > 1 {
+		t.Errorf("%d goroutines left waiting for the store, want 1", n)
+	}
+	ts.mu.Unlock()
+
+	for i, code := range codes {
+		if code != http.StatusServiceUnavailable {
+			t.Errorf("readyz %d with the store stuck: %d, want 503", i, code)
+		}
+	}
+	if w := do(t, ts.web, "GET", "/readyz", ""); w.Code != http.StatusOK {
+		t.Errorf("readyz once the store is free: %d %s", w.Code, w.Body)
+	}
+}
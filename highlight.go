@@ -0,0 +1,218 @@
+package smspit
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Body snippets show up to snippetLength characters, starting
+// snippetContext characters before the first match
+const (
+	snippetLength  = 160
+	snippetContext = 40
+)
+
+// Default markers around matches; ?highlight_pre= and ?highlight_post=
+// replace them. Message text is not HTML-escaped.
+const (
+	defaultHighlightPre  = "<mark>"
+	defaultHighlightPost = "</mark>"
+)
+
+// highlightMarkers holds the markers a search request asked for
+type highlightMarkers struct {
+	pre, post string
+}
+
+// parseHighlight reads the markers from the request, or reports false when
+// highlighting is turned off with ?highlight=false
+func parseHighlight(r *http.Request) (highlightMarkers, bool) {
+	q := r.URL.Query()
+	if q.Get("highlight") == "false" {
+		return highlightMarkers{}, false
+	}
+	markers := highlightMarkers{pre: defaultHighlightPre, post: defaultHighlightPost}
+	if q.Has("highlight_pre") {
+		markers.pre = q.Get("highlight_pre")
+	}
+	if q.Has("highlight_post") {
+		markers.post = q.Get("highlight_post")
+	}
+	return markers, true
+}
+
+// matchRange is the byte range of one match in a field
+type matchRange struct {
+	start, end int
+}
+
+// termFields lists the message fields a term's matches are highlighted in
+var termFields = map[string][]string{
+	"":      {"body", "to", "from", "to_name", "from_name"},
+	"body":  {"body"},
+	"regex": {"body"},
+	"to":    {"to", "to_name"},
+	"from":  {"from", "from_name"},
+}
+
+// highlightField returns the value of a highlightable message field
+func highlightField(msg Message, field string) string {
+	switch field {
+	case "body":
+		return msg.Body
+	case "to":
+		return msg.To
+	case "from":
+		return msg.From
+	case "to_name":
+		return msg.ToName
+	case "from_name":
+		return msg.FromName
+	}
+	return ""
+}
+
+// highlightTerm is a search term's text (or regex:) and the fields it
+// highlights
+type highlightTerm struct {
+	value  string
+	re     *regexp.Regexp
+	fields []string
+}
+
+// highlighter marks the matches of a filter's text terms in messages.
+// Negated terms and terms on other fields (tag:, status:, ...) highlight
+// nothing.
+type highlighter struct {
+	terms   []highlightTerm
+	match   textMatching
+	markers highlightMarkers
+}
+
+func newHighlighter(f searchFilter, markers highlightMarkers) highlighter {
+	h := highlighter{match: f.match, markers: markers}
+	for _, t := range f.terms {
+		if fields, ok := termFields[t.field]; ok && !t.negate {
+			h.terms = append(h.terms, highlightTerm{value: t.value, re: t.re, fields: fields})
+		}
+	}
+	return h
+}
+
+// highlight returns the fields of msg the terms matched, with every match
+// wrapped in the markers. The body is cut down to a snippet around its
+// first match; other fields are returned whole.
+func (h highlighter) highlight(msg Message) map[string]string {
+	matches := make(map[string][]matchRange)
+	for _, t := range h.terms {
+		for _, field := range t.fields {
+			text := highlightField(msg, field)
+			if t.re == nil {
+				matches[field] = append(matches[field], h.match.find(text, t.value)...)
+				continue
+			}
+			for _, loc := range t.re.FindAllStringIndex(text, -1) {
+				if loc[1] > loc[0] {
+					matches[field] = append(matches[field], matchRange{loc[0], loc[1]})
+				}
+			}
+		}
+	}
+	highlights := make(map[string]string, len(matches))
+	for field, ranges := range matches {
+		if len(ranges) == 0 {
+			continue
+		}
+		text := highlightField(msg, field)
+		ranges = mergeRanges(ranges)
+		start, end := 0, len(text)
+		if field == "body" && utf8.RuneCountInString(text) > snippetLength {
+			start = backRunes(text, ranges[0].start, snippetContext)
+			end = max(forwardRunes(text, start, snippetLength), ranges[0].end)
+		}
+		highlights[field] = markRanges(text, ranges, start, end, h.markers)
+	}
+	if len(highlights) == 0 {
+		return nil
+	}
+	return highlights
+}
+
+// mergeRanges sorts ranges and joins those that overlap or touch
+func mergeRanges(ranges []matchRange) []matchRange {
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].start < ranges[j].start })
+	merged := ranges[:1]
+	for _, m := range ranges[1:] {
+		last := &merged[len(merged)-1]
+		if m.start <= last.end {
+			last.end = max(last.end, m.end)
+			continue
+		}
+		merged = append(merged, m)
+	}
+	return merged
+}
+
+// markRanges returns text[start:end] with the matches in it marked, and an
+// ellipsis where text was cut
+func markRanges(text string, ranges []matchRange, start, end int, markers highlightMarkers) string {
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	pos := start
+	for _, m := range ranges {
+		if m.end <= start || m.start >= end {
+			continue
+		}
+		from, to := max(m.start, start), min(m.end, end)
+		b.WriteString(text[pos:from])
+		b.WriteString(markers.pre)
+		b.WriteString(text[from:to])
+		b.WriteString(markers.post)
+		pos = to
+	}
+	b.WriteString(text[pos:end])
+	if end < len(text) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
+
+// backRunes moves i back by up to n runes in s
+func backRunes(s string, i, n int) int {
+	for ; n > 0 && i > 0; n-- {
+		_, size := utf8.DecodeLastRuneInString(s[:i])
+		i -= size
+	}
+	return i
+}
+
+// forwardRunes moves i forward by up to n runes in s
+func forwardRunes(s string, i, n int) int {
+	for ; n > 0 && i < len(s); n-- {
+		_, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+	}
+	return i
+}
+
+// paginateHighlighted is paginate for search results, with the highlights
+// of the messages on the page filled in unless the request turned them off
+func (s *Server) paginateHighlighted(r *http.Request, filter searchFilter, msgs []Message) map[string]interface{} {
+	resp := paginate(r, msgs)
+	markers, ok := parseHighlight(r)
+	if !ok {
+		return resp
+	}
+	filter.match = s.config.SearchMatching
+	h := newHighlighter(filter, markers)
+	page := resp["messages"].([]Message)
+	for i := range page {
+		page[i].Highlight = h.highlight(page[i])
+	}
+	return resp
+}
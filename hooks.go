@@ -0,0 +1,379 @@
+package smspit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/ext"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// hookCostLimit bounds the work one hook may do per message, so a runaway
+// comprehension can't stall captures
+const hookCostLimit = 100000
+
+// Hook is a CEL expression run on every captured message before it is
+// stored. The message is available as msg (id, to, from, body, tags,
+// direction, project, status, encoding, segments, num_media, account_sid
+// and created_at), and the expression evaluates to a map of actions:
+//
+//	msg.body.contains("[test]") ? {"tags": ["test"], "webhook": "http://ci/hook"} : {}
+//
+// "tags" adds tags, "to", "from" and "body" rewrite those fields, "webhook"
+// POSTs the stored message to a URL and "reject" refuses the message with
+// the given reason (and provider error "code", if set). Hooks run in the
+// order they were added, each seeing the previous ones' rewrites.
+type Hook struct {
+	ID         string `json:"id"`
+	Name       string `json:"name,omitempty"`
+	Expression string `json:"expression"`
+	// Project limits the hook to one project; empty means every project
+	Project   string    `json:"project,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	Runs      int       `json:"runs"`
+	Errors    int       `json:"errors"`
+	LastError string    `json:"last_error,omitempty"`
+
+	program cel.Program
+}
+
+// HookRequest is the body for creating a hook
+type HookRequest struct {
+	Name       string `json:"name"`
+	Expression string `json:"expression"`
+	Project    string `json:"project"`
+}
+
+// hookActions is what a hook's expression asks for
+type hookActions struct {
+	Tags    []string `json:"tags"`
+	To      *string  `json:"to"`
+	From    *string  `json:"from"`
+	Body    *string  `json:"body"`
+	Webhook string   `json:"webhook"`
+	Reject  string   `json:"reject"`
+	Code    int      `json:"code"`
+}
+
+// HookRejection is returned when capturing a message a hook rejected
+type HookRejection struct {
+	Hook   string // Name of the hook, or its ID
+	Reason string
+	Code   int // Provider error code to answer with, if the hook set one
+}
+
+func (e *HookRejection) Error() string {
+	return fmt.Sprintf("Message rejected by hook %s: %s", e.Hook, e.Reason)
+}
+
+// MissingFieldError is returned when hooks rewrite a message's recipient or
+// body to nothing
+type MissingFieldError struct {
+	Field string // to or body
+}
+
+func (e *MissingFieldError) Error() string {
+	return fmt.Sprintf("Missing '%s' field", e.Field)
+}
+
+// twilioCode is the Twilio error code for the missing field
+func (e *MissingFieldError) twilioCode() int {
+	if e.Field == "to" {
+		return 21604
+	}
+	return 21602
+}
+
+// hookStore holds the processing hooks
+type hookStore struct {
+	mu    sync.Mutex
+	hooks []*Hook
+}
+
+// hookEnv declares the variables hook expressions can use
+var hookEnv, _ = cel.NewEnv(
+	cel.Variable("msg", cel.MapType(cel.StringType, cel.DynType)),
+	ext.Strings(),
+)
+
+// parseHooks parses "name=expression;name=expression". They are compiled
+// when the server is created; expressions containing ";" can only be added
+// through the API.
+func parseHooks(val string) []HookRequest {
+	var reqs []HookRequest
+	for _, entry := range strings.Split(val, ";") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		name, expr, _ := strings.Cut(entry, "=")
+		reqs = append(reqs, HookRequest{Name: strings.TrimSpace(name), Expression: expr})
+	}
+	return reqs
+}
+
+// newHook compiles req's expression into a hook
+func newHook(req HookRequest) (*Hook, error) {
+	if strings.TrimSpace(req.Expression) == "" {
+		return nil, fmt.Errorf("missing 'expression'")
+	}
+	if req.Project != "" && !validProjectName.MatchString(req.Project) {
+		return nil, fmt.Errorf("invalid project name")
+	}
+
+	ast, issues := hookEnv.Compile(req.Expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, issues.Err()
+	}
+	if kind := ast.OutputType().Kind(); kind != cel.MapType(cel.StringType, cel.DynType).Kind() && kind != cel.DynType.Kind() {
+		return nil, fmt.Errorf("expression must evaluate to a map of actions, not %s", ast.OutputType())
+	}
+	program, err := hookEnv.Program(ast, cel.CostLimit(hookCostLimit))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Hook{
+		ID:         "hook_" + uuid.New().String()[:8],
+		Name:       req.Name,
+		Expression: req.Expression,
+		Project:    req.Project,
+		CreatedAt:  time.Now(),
+		program:    program,
+	}, nil
+}
+
+// hookMessage is msg as the hooks see it
+func hookMessage(msg Message) map[string]interface{} {
+	tags := msg.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	return map[string]interface{}{
+		"id":          msg.ID,
+		"to":          msg.To,
+		"from":        msg.From,
+		"body":        msg.Body,
+		"tags":        tags,
+		"direction":   msg.Direction,
+		"project":     msg.Project,
+		"status":      msg.Status,
+		"encoding":    msg.Encoding,
+		"segments":    msg.Segments,
+		"num_media":   len(msg.Media),
+		"account_sid": msg.AccountSID,
+		"created_at":  msg.CreatedAt,
+	}
+}
+
+// eval runs the hook on msg and returns the actions it asked for
+func (hook *Hook) eval(msg Message) (hookActions, error) {
+	var actions hookActions
+	out, _, err := hook.program.Eval(map[string]interface{}{"msg": hookMessage(msg)})
+	if err != nil {
+		return actions, err
+	}
+	native, err := out.ConvertToNative(reflect.TypeOf(map[string]interface{}{}))
+	if err != nil {
+		return actions, fmt.Errorf("expression must evaluate to a map of actions, not %s", out.Type())
+	}
+
+	// A JSON round trip checks the action names and value types
+	data, err := json.Marshal(native)
+	if err != nil {
+		return actions, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&actions); err != nil {
+		return actions, fmt.Errorf("invalid actions: %v", err)
+	}
+	return actions, nil
+}
+
+// runHooks runs the processing hooks on a message, applying their tags and
+// rewrites, and returns a *HookRejection if one of them rejects it. A hook
+// that fails is skipped.
+func (s *Server) runHooks(msg *Message) error {
+	s.hooks.mu.Lock()
+	hooks := append([]*Hook(nil), s.hooks.hooks...)
+	s.hooks.mu.Unlock()
+
+	for _, hook := range hooks {
+		if hook.Project != "" && hook.Project != msg.Project {
+			continue
+		}
+
+		actions, err := hook.eval(*msg)
+		s.hooks.mu.Lock()
+		hook.Runs++
+		if err != nil {
+			hook.Errors++
+			hook.LastError = err.Error()
+		}
+		s.hooks.mu.Unlock()
+		if err != nil {
+			log.Printf("⚠️ Hook %s failed on message %s: %v", hook.ID, msg.ID, err)
+			continue
+		}
+
+		if actions.Reject != "" {
+			name := hook.Name
+			if name == "" {
+				name = hook.ID
+			}
+			log.Printf("🪝 Hook %s rejected message to %s: %s", name, msg.To, actions.Reject)
+			return &HookRejection{Hook: name, Reason: actions.Reject, Code: actions.Code}
+		}
+		msg.Tags = editTags(msg.Tags, actions.Tags, nil)
+		if actions.To != nil {
+			msg.To = *actions.To
+		}
+		if actions.From != nil {
+			msg.From = *actions.From
+		}
+		if actions.Body != nil && *actions.Body != msg.Body {
+			msg.Body = *actions.Body
+			setEncoding(msg)
+		}
+		if actions.Webhook != "" {
+			msg.hookWebhooks = append(msg.hookWebhooks, actions.Webhook)
+		}
+	}
+	return nil
+}
+
+// sendHookWebhooks POSTs a stored message to the webhooks its hooks asked
+// for, once, without retries
+func (s *Server) sendHookWebhooks(msg Message) {
+	if len(msg.hookWebhooks) == 0 {
+		return
+	}
+	body, _ := json.Marshal(webhookPayload{Event: "message.hook", Message: msg})
+	for _, target := range msg.hookWebhooks {
+		go func(target string) {
+			ctx, span := s.startMessageSpan(msg, "smspit.hook_webhook", trace.SpanKindClient, attribute.String("server.address", targetHost(target)))
+			err := postWebhook(ctx, target, "", body)
+			endSpan(span, err)
+			if err != nil {
+				log.Printf("⚠️ Hook webhook failed: URL=%s Error=%v", maskedWebhookURL(webhookFormatJSON, target), err)
+			}
+		}(target)
+	}
+}
+
+// writeCaptureError answers a capture request whose message a hook
+// rejected or left without a recipient, that is too long, whose sender strict mode refused or that came
+// in during shutdown, in the provider's error format
+func writeCaptureError(w http.ResponseWriter, r *http.Request, err error) {
+	var rejection *HookRejection
+	if errors.As(err, &rejection) {
+		writeProviderError(w, r, http.StatusBadRequest, rejection.Code, rejection.Error(), 0)
+		return
+	}
+	var missing *MissingFieldError
+	if errors.As(err, &missing) {
+		writeProviderError(w, r, http.StatusBadRequest, missing.twilioCode(), missing.Error(), 0)
+		return
+	}
+	var tooLong *MessageTooLongError
+	if errors.As(err, &tooLong) {
+		writeTooLongError(w, r, tooLong)
+		return
+	}
+	var badSender *SenderError
+	if errors.As(err, &badSender) {
+		writeSenderError(w, r, badSender)
+		return
+	}
+	var duplicate *DuplicateError
+	if errors.As(err, &duplicate) {
+		writeDuplicateError(w, r, duplicate)
+		return
+	}
+	var unregistered *UnregisteredSenderError
+	if errors.As(err, &unregistered) {
+		writeUnregisteredSenderError(w, r, unregistered)
+		return
+	}
+	var filtered *ContentFilteredError
+	if errors.As(err, &filtered) {
+		writeContentFilteredError(w, r, filtered)
+		return
+	}
+	if errors.Is(err, errShuttingDown) {
+		writeProviderError(w, r, http.StatusServiceUnavailable, 0, err.Error(), 0)
+		return
+	}
+	writeProviderError(w, r, http.StatusInternalServerError, 0, err.Error(), 0)
+}
+
+// handleListHooks lists the processing hooks
+func (s *Server) handleListHooks(w http.ResponseWriter, r *http.Request) {
+	s.hooks.mu.Lock()
+	defer s.hooks.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"hooks": s.hooks.hooks,
+		"total": len(s.hooks.hooks),
+	})
+}
+
+// handleCreateHook adds a processing hook
+func (s *Server) handleCreateHook(w http.ResponseWriter, r *http.Request) {
+	var req HookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	hook, err := newHook(req)
+	if err != nil {
+		http.Error(w, "Invalid hook: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.hooks.mu.Lock()
+	s.hooks.hooks = append(s.hooks.hooks, hook)
+	s.hooks.mu.Unlock()
+	s.syncRecords(kindHooks)
+
+	log.Printf("🪝 Hook added: ID=%s Expression=%s", hook.ID, truncate(hook.Expression, 50))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(hook)
+}
+
+// handleDeleteHook removes a processing hook
+func (s *Server) handleDeleteHook(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	defer s.syncRecords(kindHooks)
+	s.hooks.mu.Lock()
+	defer s.hooks.mu.Unlock()
+
+	for i, hook := range s.hooks.hooks {
+		if hook.ID == id {
+			s.hooks.hooks = append(s.hooks.hooks[:i], s.hooks.hooks[i+1:]...)
+			log.Printf("🪝 Hook removed: ID=%s", id)
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
+			return
+		}
+	}
+
+	http.Error(w, "Hook not found", http.StatusNotFound)
+}
@@ -0,0 +1,203 @@
+package smspit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHookActions(t *testing.T) {
+	tests := []struct {
+		name       string
+		hooks      []HookRequest
+		want       int
+		wantError  string   // Part of the error response
+		wantTo     string   // Recipient as stored
+		wantBody   string   // Body as stored
+		wantTags   []string // Tags as stored
+		wantErrors int      // Hook failures counted on the first hook
+	}{
+		{
+			name:     "no actions",
+			hooks:    []HookRequest{{Expression: `{}`}},
+			want:     http.StatusOK,
+			wantTo:   "+15551230001",
+			wantBody: "Hello [test]",
+		},
+		{
+			name:     "tag",
+			hooks:    []HookRequest{{Expression: `msg.body.contains("[test]") ? {"tags": ["test"]} : {}`}},
+			want:     http.StatusOK,
+			wantTo:   "+15551230001",
+			wantBody: "Hello [test]",
+			wantTags: []string{"test"},
+		},
+		{
+			name:     "rewrite",
+			hooks:    []HookRequest{{Expression: `{"to": "+15550000000", "body": msg.body.replace("[test]", "").trim()}`}},
+			want:     http.StatusOK,
+			wantTo:   "+15550000000",
+			wantBody: "Hello",
+		},
+		{
+			name: "later hooks see earlier rewrites",
+			hooks: []HookRequest{
+				{Expression: `{"body": "rewritten"}`},
+				{Expression: `msg.body == "rewritten" ? {"tags": ["seen"]} : {}`},
+			},
+			want:     http.StatusOK,
+			wantTo:   "+15551230001",
+			wantBody: "rewritten",
+			wantTags: []string{"seen"},
+		},
+		{
+			name:      "reject",
+			hooks:     []HookRequest{{Name: "no-test", Expression: `{"reject": "test messages are off"}`}},
+			want:      http.StatusBadRequest,
+			wantError: "Message rejected by hook no-test: test messages are off",
+		},
+		{
+			name:      "rewrite to an empty body",
+			hooks:     []HookRequest{{Expression: `{"body": ""}`}},
+			want:      http.StatusBadRequest,
+			wantError: "Missing 'body' field",
+		},
+		{
+			name:     "other project's hook",
+			hooks:    []HookRequest{{Expression: `{"reject": "no"}`, Project: "other"}},
+			want:     http.StatusOK,
+			wantTo:   "+15551230001",
+			wantBody: "Hello [test]",
+		},
+		{
+			name:       "failing hook is skipped",
+			hooks:      []HookRequest{{Expression: `{"tags": [msg.body.size() / 0]}`}},
+			want:       http.StatusOK,
+			wantTo:     "+15551230001",
+			wantBody:   "Hello [test]",
+			wantErrors: 1,
+		},
+		{
+			name:       "unknown action fails the hook",
+			hooks:      []HookRequest{{Expression: `{"drop": true}`}},
+			want:       http.StatusOK,
+			wantTo:     "+15551230001",
+			wantBody:   "Hello [test]",
+			wantErrors: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t, Config{Hooks: tt.hooks})
+
+			w := do(t, ts.api, "POST", "/send", `{"to":"+15551230001","from":"+15550009999","body":"Hello [test]"}`)
+			if w.Code != tt.want {
+				t.Fatalf("send: %d %s, want %d", w.Code, w.Body, tt.want)
+			}
+			if tt.wantError != "" {
+				if !strings.Contains(w.Body.String(), tt.wantError) {
+					t.Errorf("error %q, want %q", w.Body, tt.wantError)
+				}
+				if msgs := ts.messages(t); len(msgs) != 0 {
+					t.Errorf("refused message was stored: %+v", msgs)
+				}
+				return
+			}
+
+			msgs := ts.messages(t)
+			if len(msgs) != 1 {
+				t.Fatalf("got %d messages, want 1", len(msgs))
+			}
+			msg := msgs[0]
+			if msg.To != tt.wantTo || msg.Body != tt.wantBody || !reflect.DeepEqual(msg.Tags, tt.wantTags) {
+				t.Errorf("stored to=%q body=%q tags=%v, want to=%q body=%q tags=%v", msg.To, msg.Body, msg.Tags, tt.wantTo, tt.wantBody, tt.wantTags)
+			}
+
+			var list struct {
+				Hooks []Hook `json:"hooks"`
+			}
+			decode(t, do(t, ts.web, "GET", "/api/v1/hooks", ""), &list)
+			if hook := list.Hooks[0]; hook.Errors != tt.wantErrors {
+				t.Errorf("hook errors = %d (%q), want %d", hook.Errors, hook.LastError, tt.wantErrors)
+			}
+		})
+	}
+}
+
+func TestHookRejectionProviderCode(t *testing.T) {
+	ts := newTestServer(t, Config{
+		TwilioCompat: true,
+		Hooks:        []HookRequest{{Name: "blocked", Expression: `msg.to == "+15551230001" ? {"reject": "blocked", "code": 21610} : {}`}},
+	})
+
+	w := do(t, ts.api, "POST", "/2010-04-01/Accounts/AC1/Messages.json", "To=%2B15551230001&From=%2B15550009999&Body=Hi",
+		"Content-Type", "application/x-www-form-urlencoded")
+	var twilioErr TwilioError
+	decode(t, w, &twilioErr)
+	if w.Code != http.StatusBadRequest || twilioErr.Code != 21610 {
+		t.Errorf("Twilio send: %d %s, want 400 with code 21610", w.Code, w.Body)
+	}
+}
+
+func TestHookWebhook(t *testing.T) {
+	received := make(chan webhookPayload, 1)
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload webhookPayload
+		json.NewDecoder(r.Body).Decode(&payload)
+		received <- payload
+	}))
+	defer target.Close()
+
+	ts := newTestServer(t, Config{Hooks: []HookRequest{{Expression: `{"webhook": "` + target.URL + `", "tags": ["hooked"]}`}}})
+	id := ts.send(t, "+15551230001", "Hello")
+
+	select {
+	case payload := <-received:
+		if payload.Event != "message.hook" || payload.Message.ID != id || len(payload.Message.Tags) != 1 {
+			t.Errorf("webhook got %+v, want the stored message %s", payload, id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("hook webhook not sent")
+	}
+}
+
+func TestHookAPI(t *testing.T) {
+	ts := newTestServer(t, Config{})
+
+	for _, body := range []string{
+		`{"expression": ""}`,
+		`{"expression": "msg.body +"}`,
+		`{"expression": "\"not a map\""}`,
+		`{"expression": "{}", "project": "Not A Project"}`,
+	} {
+		if w := do(t, ts.web, "POST", "/api/v1/hooks", body); w.Code != http.StatusBadRequest {
+			t.Errorf("create %s: %d, want 400", body, w.Code)
+		}
+	}
+
+	w := do(t, ts.web, "POST", "/api/v1/hooks", `{"name": "tagger", "expression": "{\"tags\": [\"a\"]}"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", w.Code, w.Body)
+	}
+	var hook Hook
+	decode(t, w, &hook)
+	ts.send(t, "+15551230001", "Hello")
+	if msgs := ts.messages(t); len(msgs[0].Tags) != 1 {
+		t.Errorf("tags = %v, want the hook's", msgs[0].Tags)
+	}
+
+	if w := do(t, ts.web, "DELETE", "/api/v1/hooks/"+hook.ID, ""); w.Code != http.StatusOK {
+		t.Errorf("delete: %d", w.Code)
+	}
+	if w := do(t, ts.web, "DELETE", "/api/v1/hooks/"+hook.ID, ""); w.Code != http.StatusNotFound {
+		t.Errorf("delete again: %d, want 404", w.Code)
+	}
+	ts.send(t, "+15551230001", "Hello")
+	if msgs := ts.messages(t); len(msgs[0].Tags) != 0 {
+		t.Errorf("tags = %v after the hook was removed", msgs[0].Tags)
+	}
+}
@@ -0,0 +1,251 @@
+package smspit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// maxImportLine bounds a single NDJSON line
+const maxImportLine = 1024 * 1024
+
+// importFormat picks the import format from ?format=, the Content-Type, or
+// by sniffing the first non-space byte of the body
+func importFormat(r *http.Request, body *bufio.Reader) string {
+	if f := r.URL.Query().Get("format"); f != "" {
+		return f
+	}
+
+	ct := r.Header.Get("Content-Type")
+	switch {
+	case strings.Contains(ct, "csv"):
+		return "csv"
+	case strings.Contains(ct, "ndjson"), strings.Contains(ct, "jsonl"):
+		return "ndjson"
+	}
+
+	for {
+		b, err := body.Peek(1)
+		if err != nil {
+			return "ndjson"
+		}
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			body.ReadByte()
+			continue
+		case '[':
+			return "json"
+		case '{':
+			return "ndjson"
+		default:
+			return "csv"
+		}
+	}
+}
+
+// parseImportNDJSON reads one JSON message per line, skipping blank lines
+func parseImportNDJSON(r io.Reader) ([]Message, error) {
+	var msgs []Message
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxImportLine)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		var msg Message
+		if err := json.Unmarshal(text, &msg); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, scanner.Err()
+}
+
+// parseImportCSV reads rows using the header row to locate columns, so the
+// columns written by the CSV export can appear in any order
+func parseImportCSV(r io.Reader) ([]Message, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading header: %v", err)
+	}
+	col := make(map[string]int)
+	for i, name := range header {
+		col[strings.TrimSpace(strings.ToLower(name))] = i
+	}
+	if _, ok := col["to"]; !ok {
+		return nil, fmt.Errorf("missing 'to' column")
+	}
+
+	var msgs []Message
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		field := func(name string) string {
+			if i, ok := col[name]; ok && i < len(record) {
+				return record[i]
+			}
+			return ""
+		}
+
+		msg := Message{
+			ID:         field("id"),
+			Project:    field("project"),
+			Direction:  field("direction"),
+			Status:     field("status"),
+			From:       field("from"),
+			To:         field("to"),
+			Body:       field("body"),
+			AccountSID: field("account_sid"),
+			Channel:    field("channel"),
+		}
+		if tags := field("tags"); tags != "" {
+			msg.Tags = strings.Split(tags, ";")
+		}
+		if v := field("created_at"); v != "" {
+			t, err := time.Parse(time.RFC3339Nano, v)
+			if err != nil {
+				line, _ := cr.FieldPos(0)
+				return nil, fmt.Errorf("line %d: invalid created_at: %v", line, err)
+			}
+			msg.CreatedAt = t
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
+
+// handleImportMessages loads messages from a CSV, JSON or NDJSON export into
+// the request's project. Existing IDs are skipped unless ?replace=true
+// clears the project first. Imported messages are not forwarded or
+// delivery-simulated.
+func (s *Server) handleImportMessages(w http.ResponseWriter, r *http.Request) {
+	body := bufio.NewReader(r.Body)
+
+	var msgs []Message
+	var err error
+	switch format := importFormat(r, body); format {
+	case "csv":
+		msgs, err = parseImportCSV(body)
+	case "json":
+		err = json.NewDecoder(body).Decode(&msgs)
+	case "ndjson":
+		msgs, err = parseImportNDJSON(body)
+	default:
+		http.Error(w, "Invalid format (use csv, json or ndjson)", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Invalid import: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	project := projectFromRequest(r)
+	replace, _ := strconv.ParseBool(r.URL.Query().Get("replace"))
+
+	var removed []Message
+	var keys []messageKey
+
+	s.mu.Lock()
+	if replace {
+		kept := make([]Message, 0, len(s.messages))
+		for _, msg := range s.messages {
+			if msg.Project != project {
+				kept = append(kept, msg)
+			} else {
+				removed = append(removed, msg)
+			}
+		}
+		s.messages = kept
+	}
+
+	existing := make(map[string]bool)
+	for _, msg := range s.messagesFor(project) {
+		existing[msg.ID] = true
+	}
+
+	imported, skipped := 0, 0
+	for _, msg := range msgs {
+		if msg.To == "" {
+			skipped++
+			continue
+		}
+		if msg.ID == "" {
+			msg.ID = "msg_" + uuid.New().String()[:8]
+		}
+		if existing[msg.ID] {
+			skipped++
+			continue
+		}
+		existing[msg.ID] = true
+
+		msg.Project = project
+		msg.ToName, msg.FromName = "", "" // Served from the importing project's contacts
+		msg.Highlight = nil
+		if msg.CreatedAt.IsZero() {
+			msg.CreatedAt = time.Now()
+		}
+		if msg.Direction == "" {
+			msg.Direction = "outbound"
+		}
+		if msg.Status == "" {
+			msg.Status = "captured"
+		}
+		msg.Channel = msg.channel()
+		setEncoding(&msg)
+		s.redactMessage(&msg)
+		s.setLinks(&msg)
+
+		s.seq++
+		msg.seq = s.seq
+		s.messages = append(s.messages, msg)
+		keys = append(keys, msg.key())
+		imported++
+	}
+
+	sort.SliceStable(s.messages, func(i, j int) bool {
+		return s.messages[i].CreatedAt.After(s.messages[j].CreatedAt)
+	})
+	removed = append(removed, s.enforceMaxMessages(project)...)
+	total := len(s.messagesFor(project))
+	s.mu.Unlock()
+	s.syncRemoved(removed...)
+	s.syncSaved(keys...)
+
+	log.Printf("📥 Imported %d messages into project %s (%d skipped)", imported, project, skipped)
+
+	s.broadcastEvent(map[string]interface{}{
+		"type":     "messages_imported",
+		"project":  project,
+		"imported": imported,
+		"replaced": replace,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"imported": imported,
+		"skipped":  skipped,
+		"total":    total,
+	})
+}
@@ -0,0 +1,200 @@
+package smspit
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// defaultAccountSID is used for simulated Twilio traffic when no account is given
+const defaultAccountSID = "AC00000000000000000000000000000000"
+
+// InboundRequest describes a simulated inbound SMS
+type InboundRequest struct {
+	To         string `json:"to"`
+	From       string `json:"from"`
+	Body       string `json:"body"`
+	WebhookURL string `json:"webhook_url,omitempty"`
+	AccountSID string `json:"account_sid,omitempty"`
+}
+
+// twimlResponse is the subset of TwiML SMSpit understands in webhook replies
+type twimlResponse struct {
+	Messages []struct {
+		Text string `xml:",chardata"`
+		Body string `xml:"Body"`
+		To   string `xml:"to,attr"`
+		From string `xml:"from,attr"`
+	} `xml:"Message"`
+}
+
+// handleSimulateInbound records an inbound SMS and delivers it to the
+// application's webhook the way Twilio would. TwiML <Message> replies in the
+// webhook response are captured as outbound messages.
+func (s *Server) handleSimulateInbound(w http.ResponseWriter, r *http.Request) {
+	var req InboundRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.To == "" || req.From == "" {
+		http.Error(w, "Missing 'to' or 'from' field", http.StatusBadRequest)
+		return
+	}
+	if req.Body == "" {
+		http.Error(w, "Missing 'body' field", http.StatusBadRequest)
+		return
+	}
+
+	webhookURL := req.WebhookURL
+	if webhookURL == "" {
+		webhookURL = s.config.InboundWebhookURL
+	}
+	if webhookURL == "" {
+		http.Error(w, "Missing 'webhook_url' and no SMSPIT_INBOUND_WEBHOOK_URL configured", http.StatusBadRequest)
+		return
+	}
+
+	accountSID := req.AccountSID
+	if accountSID == "" {
+		accountSID = defaultAccountSID
+	}
+
+	msg := Message{
+		ID:         "SM" + strings.ReplaceAll(uuid.New().String(), "-", ""),
+		To:         req.To,
+		From:       req.From,
+		Body:       req.Body,
+		Status:     "received",
+		Direction:  "inbound",
+		CreatedAt:  time.Now(),
+		AccountSID: accountSID,
+		Project:    projectFromRequest(r),
+		Metadata:   metadataFromRequest(r),
+
+		Correlation: correlationFromRequest(r),
+	}
+
+	if err := s.captureMessage(&msg); err != nil {
+		writeCaptureError(w, r, err)
+		return
+	}
+
+	log.Printf("📥 Inbound SMS simulated: From=%s To=%s Body=%s", msg.From, msg.To, truncate(msg.Body, 50))
+
+	status, respBody, replies, err := s.postInbound(msg, webhookURL)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadGateway)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": msg,
+			"webhook": map[string]interface{}{
+				"url":   webhookURL,
+				"error": err.Error(),
+			},
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": msg,
+		"webhook": map[string]interface{}{
+			"url":      webhookURL,
+			"status":   status,
+			"response": string(respBody),
+		},
+		"replies": replies,
+	})
+}
+
+// postInbound delivers an inbound message to the application's webhook and
+// captures any TwiML replies, returning the webhook's status and response
+func (s *Server) postInbound(msg Message, webhookURL string) (int, []byte, []Message, error) {
+	resp, err := s.postTwilioWebhook(webhookURL, inboundWebhookParams(msg))
+	if err != nil {
+		log.Printf("⚠️ Inbound webhook failed: URL=%s Error=%v", webhookURL, err)
+		return 0, nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	return resp.StatusCode, respBody, s.captureTwiMLReplies(msg, respBody), nil
+}
+
+// inboundWebhookParams builds the form fields Twilio sends for an incoming SMS
+func inboundWebhookParams(msg Message) url.Values {
+	params := url.Values{}
+	params.Set("MessageSid", msg.ID)
+	params.Set("SmsSid", msg.ID)
+	params.Set("SmsMessageSid", msg.ID)
+	params.Set("AccountSid", msg.AccountSID)
+	params.Set("From", msg.From)
+	params.Set("To", msg.To)
+	params.Set("Body", msg.text())
+	params.Set("NumMedia", "0")
+	params.Set("NumSegments", "1")
+	params.Set("SmsStatus", "received")
+	params.Set("ApiVersion", "2010-04-01")
+	if kind, ok := keywordType(msg.text()); ok {
+		params.Set("OptOutType", kind)
+	}
+	return params
+}
+
+// captureTwiMLReplies captures any <Message> verbs in a TwiML webhook response
+func (s *Server) captureTwiMLReplies(inbound Message, body []byte) []Message {
+	var twiml twimlResponse
+	if err := xml.Unmarshal(body, &twiml); err != nil {
+		return []Message{}
+	}
+
+	replies := make([]Message, 0, len(twiml.Messages))
+	for _, m := range twiml.Messages {
+		text := strings.TrimSpace(m.Body)
+		if text == "" {
+			text = strings.TrimSpace(m.Text)
+		}
+		if text == "" {
+			continue
+		}
+
+		reply := Message{
+			ID:         "SM" + strings.ReplaceAll(uuid.New().String(), "-", ""),
+			To:         inbound.From,
+			From:       inbound.To,
+			Body:       text,
+			Status:     "captured",
+			CreatedAt:  time.Now(),
+			AccountSID: inbound.AccountSID,
+			Project:    inbound.Project,
+
+			autoReplies: inbound.autoReplies,
+		}
+		if m.To != "" {
+			reply.To = m.To
+		}
+		if m.From != "" {
+			reply.From = m.From
+		}
+		if s.optOuts.optedOut(reply.Project, reply.From, reply.To) {
+			log.Printf("🛑 TwiML reply to opted-out recipient dropped: From=%s To=%s", reply.From, reply.To)
+			continue
+		}
+
+		if err := s.captureMessage(&reply); err != nil {
+			continue
+		}
+		log.Printf("📱 SMS captured (TwiML reply): To=%s Body=%s", reply.To, truncate(reply.Body, 50))
+		replies = append(replies, reply)
+	}
+	return replies
+}
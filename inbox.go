@@ -0,0 +1,49 @@
+package smspit
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// handleInbox returns the messages sent to one number, newest first, with
+// the search filters applied and counts by status and sender
+func (s *Server) handleInbox(w http.ResponseWriter, r *http.Request) {
+	number := mux.Vars(r)["number"]
+	filter, err := parseSearchFilter(r)
+	if err != nil {
+		http.Error(w, "Invalid query: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filter.match = s.config.SearchMatching
+	names := s.contactNames(projectFromRequest(r))
+
+	s.mu.RLock()
+	var msgs []Message
+	for _, msg := range s.messagesFor(projectFromRequest(r)) {
+		names.apply(&msg)
+		if msg.To == number && filter.matches(msg) {
+			msgs = append(msgs, msg)
+		}
+	}
+	s.mu.RUnlock()
+
+	byStatus := make(map[string]int)
+	bySender := make(map[string]int)
+	for _, msg := range msgs {
+		byStatus[msg.Status]++
+		bySender[msg.From]++
+	}
+
+	resp := paginate(r, msgs)
+	resp["number"] = number
+	resp["counts"] = map[string]interface{}{
+		"status": byStatus,
+		"from":   bySender,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,117 @@
+package smspit
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// kannelFields are the sendsms parameters SMSpit reads, under Kannel's names
+var kannelFields = []string{"to", "from", "text", "udh", "username", "password", "dlr-url", "dlr-mask"}
+
+// parseKannelParams reads SMSPIT_KANNEL_PARAMS ("to=dest,text=msg") into a
+// map from Kannel field to the parameter name the client uses. Unmapped
+// fields keep their Kannel names.
+func parseKannelParams(val string) map[string]string {
+	params := make(map[string]string, len(kannelFields))
+	for _, field := range kannelFields {
+		params[field] = field
+	}
+	for _, entry := range strings.Split(val, ",") {
+		field, name, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if _, known := params[field]; !ok || !known || name == "" {
+			if entry != "" {
+				log.Printf("⚠️ Ignoring invalid Kannel parameter mapping %q", entry)
+			}
+			continue
+		}
+		params[field] = name
+	}
+	return params
+}
+
+// handleKannelSend handles Kannel-style sendsms requests: GET with query
+// parameters, or a form POST. Recipients are separated by spaces (as Kannel
+// does) or commas. Parts of a concatenated message (a udh with a
+// concatenation header) are captured as one message once all have arrived.
+func (s *Server) handleKannelSend(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+	param := func(field string) string {
+		return r.FormValue(s.config.KannelParams[field])
+	}
+
+	if s.config.KannelUsername != "" {
+		userOK := subtle.ConstantTimeCompare([]byte(param("username")), []byte(s.config.KannelUsername)) == 1
+		passOK := subtle.ConstantTimeCompare([]byte(param("password")), []byte(s.config.KannelPassword)) == 1
+		if !userOK || !passOK {
+			http.Error(w, "Authorization failed for sendsms", http.StatusForbidden)
+			return
+		}
+	}
+
+	recipients := strings.FieldsFunc(param("to"), func(r rune) bool { return r == ' ' || r == ',' })
+	if len(recipients) == 0 {
+		http.Error(w, "Missing receiver number", http.StatusBadRequest)
+		return
+	}
+	text := param("text")
+	if text == "" {
+		http.Error(w, "Missing text parameter", http.StatusBadRequest)
+		return
+	}
+
+	// Kannel only reports when given both; an invalid mask means none
+	dlrMask, _ := strconv.Atoi(param("dlr-mask"))
+	dlrURL := param("dlr-url")
+	if dlrMask <= 0 || dlrURL == "" {
+		dlrMask, dlrURL = 0, ""
+	}
+
+	udh := []byte(param("udh"))
+	concat, concatenated := parseConcatUDH(udh)
+
+	now := time.Now()
+	msgs := make([]Message, 0, len(recipients))
+	for _, to := range recipients {
+		msg := Message{
+			ID:        "msg_" + uuid.New().String()[:8],
+			To:        to,
+			From:      param("from"),
+			Body:      text,
+			Status:    "captured",
+			CreatedAt: now,
+			Project:   projectFromRequest(r),
+			Metadata:  metadataFromRequest(r),
+			DLRURL:    dlrURL,
+			DLRMask:   dlrMask,
+
+			Correlation: correlationFromRequest(r),
+		}
+		if !concatenated {
+			msgs = append(msgs, msg)
+		} else if full, ok := s.addConcatPart(msg, udh, concat); ok {
+			msgs = append(msgs, full)
+		} else {
+			log.Printf("🧩 SMS part %d/%d held for reassembly: To=%s", concat.seq, concat.total, to)
+		}
+	}
+	if err := s.captureMessages(msgs); err != nil {
+		writeCaptureError(w, r, err)
+		return
+	}
+	for _, msg := range msgs {
+		log.Printf("📱 SMS captured (Kannel): To=%s Body=%s", msg.To, truncate(msg.Body, 50))
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusAccepted)
+	w.Write([]byte("0: Accepted for delivery"))
+}
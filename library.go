@@ -0,0 +1,363 @@
+package smspit
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	"github.com/substrate-app/smspit/client"
+)
+
+// shutdownTimeout bounds how long Close waits for in-flight requests
+const shutdownTimeout = 5 * time.Second
+
+// Instance is a running SMSpit server started with Start
+type Instance struct {
+	// WebURL is the web UI and REST API base URL, e.g. http://127.0.0.1:53121
+	// (https when TLS is enabled)
+	WebURL string
+	// APIURL is the capture endpoint base URL (POST {APIURL}/send). It equals
+	// WebURL in single-port mode.
+	APIURL string
+	// SMTPAddr is the SMTP gateway's host:port, empty unless SMTPPort is set
+	SMTPAddr string
+	// GRPCAddr is the gRPC API's host:port, empty unless GRPCPort is set
+	GRPCAddr string
+	// SMPPAddr is the SMPP listener's host:port, empty unless SMPPPort is set
+	SMPPAddr string
+
+	server     *Server
+	tlsConfig  *tls.Config // nil when serving plain HTTP
+	apiServer  *http.Server
+	webServer  *http.Server
+	aux        auxListeners
+	grpcServer *grpc.Server
+	stop       chan struct{}
+	closeOnce  sync.Once
+	closeErr   error
+}
+
+// auxListeners are the optional listeners besides the HTTP ports
+type auxListeners struct {
+	smtp net.Listener
+	grpc net.Listener
+	smpp net.Listener
+}
+
+// listenAux opens the SMTP, gRPC and SMPP listeners that are configured
+func (s *Server) listenAux() (auxListeners, error) {
+	var aux auxListeners
+	var err error
+	if s.config.SMTPPort != "" {
+		if aux.smtp, err = net.Listen("tcp", net.JoinHostPort(s.config.Host, s.config.SMTPPort)); err != nil {
+			return aux, fmt.Errorf("listening on SMTP port: %w", err)
+		}
+	}
+	if s.config.GRPCPort != "" {
+		if aux.grpc, err = net.Listen("tcp", net.JoinHostPort(s.config.Host, s.config.GRPCPort)); err != nil {
+			aux.close()
+			return aux, fmt.Errorf("listening on gRPC port: %w", err)
+		}
+	}
+	if s.config.SMPPPort != "" {
+		if aux.smpp, err = net.Listen("tcp", net.JoinHostPort(s.config.Host, s.config.SMPPPort)); err != nil {
+			aux.close()
+			return aux, fmt.Errorf("listening on SMPP port: %w", err)
+		}
+	}
+	return aux, nil
+}
+
+// close closes the open listeners
+func (a auxListeners) close() {
+	for _, l := range []net.Listener{a.smtp, a.grpc, a.smpp} {
+		if l != nil {
+			l.Close()
+		}
+	}
+}
+
+// Start listens on the configured ports and serves until ctx is cancelled or
+// Close is called. Use port "0" (the default in New) for a random free port:
+//
+//	sms, err := smspit.New(smspit.Config{Host: "127.0.0.1"}).Start(ctx)
+//	defer sms.Close()
+//	os.Setenv("SMS_WEBHOOK_URL", sms.APIURL+"/send")
+func (s *Server) Start(ctx context.Context) (*Instance, error) {
+	if err := s.startTracing(ctx); err != nil {
+		return nil, err
+	}
+	if err := s.joinCluster(); err != nil {
+		s.stopTracing(ctx)
+		return nil, err
+	}
+	inst, err := s.start(ctx)
+	if err != nil {
+		s.leaveCluster()
+		s.stopTracing(ctx)
+	}
+	return inst, err
+}
+
+// start listens on the configured ports and starts serving
+func (s *Server) start(ctx context.Context) (*Instance, error) {
+	var tlsConfig *tls.Config
+	if s.tlsEnabled() {
+		var err error
+		if tlsConfig, err = s.tlsConfig(); err != nil {
+			return nil, err
+		}
+	}
+
+	aux, err := s.listenAux()
+	if err != nil {
+		return nil, err
+	}
+
+	if s.config.SinglePort {
+		return s.startSinglePort(ctx, tlsConfig, aux)
+	}
+
+	apiListener, err := s.listen(s.config.APIPort, tlsConfig)
+	if err != nil {
+		aux.close()
+		return nil, fmt.Errorf("listening on API port: %w", err)
+	}
+	webListener, err := s.listen(s.config.WebPort, tlsConfig)
+	if err != nil {
+		apiListener.Close()
+		aux.close()
+		return nil, fmt.Errorf("listening on web port: %w", err)
+	}
+
+	apiHandler, webHandler := s.Handlers()
+	inst := &Instance{
+		WebURL:    listenerURL(webListener, tlsConfig),
+		APIURL:    listenerURL(apiListener, tlsConfig),
+		server:    s,
+		tlsConfig: tlsConfig,
+		apiServer: &http.Server{Handler: apiHandler},
+		webServer: &http.Server{Handler: webHandler},
+		aux:       aux,
+		stop:      make(chan struct{}),
+	}
+
+	s.listeners.set("api", "serving")
+	go func() {
+		if err := inst.apiServer.Serve(apiListener); err != http.ErrServerClosed {
+			log.Printf("API server error: %v", err)
+			s.listeners.set("api", "failed: "+err.Error())
+		}
+	}()
+	s.serve(ctx, inst, webListener)
+	return inst, nil
+}
+
+// startSinglePort serves everything from the web port
+func (s *Server) startSinglePort(ctx context.Context, tlsConfig *tls.Config, aux auxListeners) (*Instance, error) {
+	listener, err := s.listen(s.config.WebPort, tlsConfig)
+	if err != nil {
+		aux.close()
+		return nil, fmt.Errorf("listening on web port: %w", err)
+	}
+
+	baseURL := listenerURL(listener, tlsConfig)
+	inst := &Instance{
+		WebURL:    baseURL,
+		APIURL:    baseURL,
+		server:    s,
+		tlsConfig: tlsConfig,
+		webServer: &http.Server{Handler: s.Handler()},
+		aux:       aux,
+		stop:      make(chan struct{}),
+	}
+	s.serve(ctx, inst, listener)
+	return inst, nil
+}
+
+// serve starts the web server, the SMTP gateway, the gRPC API, the SMPP
+// listener and background jobs, and closes inst when ctx is done
+func (s *Server) serve(ctx context.Context, inst *Instance, webListener net.Listener) {
+	if inst.aux.smtp != nil {
+		inst.SMTPAddr = listenerAddr(inst.aux.smtp)
+		s.listeners.set("smtp", "serving")
+		go func() {
+			s.serveSMTP(inst.aux.smtp)
+			s.listeners.set("smtp", "stopped")
+		}()
+		log.Printf("📧 SMTP gateway listening on %s (send to +15551234567@%s)", inst.SMTPAddr, s.smtpHostname())
+	}
+	if inst.aux.smpp != nil {
+		inst.SMPPAddr = listenerAddr(inst.aux.smpp)
+		s.listeners.set("smpp", "serving")
+		go func() {
+			s.serveSMPP(inst.aux.smpp)
+			s.listeners.set("smpp", "stopped")
+		}()
+		log.Printf("📶 SMPP listener on %s", inst.SMPPAddr)
+	}
+	if inst.aux.grpc != nil {
+		var opts []grpc.ServerOption
+		if inst.tlsConfig != nil {
+			opts = append(opts, grpc.Creds(credentials.NewTLS(inst.tlsConfig.Clone())))
+		}
+		inst.GRPCAddr = listenerAddr(inst.aux.grpc)
+		inst.grpcServer = s.newGRPCServer(opts...)
+		s.listeners.set("grpc", "serving")
+		go func() {
+			if err := inst.grpcServer.Serve(inst.aux.grpc); err != nil {
+				log.Printf("gRPC server error: %v", err)
+				s.listeners.set("grpc", "failed: "+err.Error())
+			}
+		}()
+		log.Printf("🔌 gRPC API listening on %s", inst.GRPCAddr)
+	}
+	go s.runExpiry(inst.stop)
+	if s.config.Retention > 0 {
+		go s.runRetention(inst.stop)
+		log.Printf("🧹 Retention enabled: messages older than %s are pruned", s.config.Retention)
+	}
+
+	s.listeners.set("web", "serving")
+	go func() {
+		if err := inst.webServer.Serve(webListener); err != http.ErrServerClosed {
+			log.Printf("Web server error: %v", err)
+			s.listeners.set("web", "failed: "+err.Error())
+		}
+	}()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			inst.Close()
+		case <-inst.stop:
+		}
+	}()
+}
+
+// listen opens a TCP listener on port, wrapped in TLS when tlsConfig is set
+func (s *Server) listen(port string, tlsConfig *tls.Config) (net.Listener, error) {
+	l, err := net.Listen("tcp", net.JoinHostPort(s.config.Host, port))
+	if err != nil || tlsConfig == nil {
+		return l, err
+	}
+	return tls.NewListener(l, tlsConfig), nil
+}
+
+// listenerAddr returns a listener's host:port, using the loopback address
+// when listening on all interfaces
+func listenerAddr(l net.Listener) string {
+	return strings.TrimPrefix(listenerURL(l, nil), "http://")
+}
+
+// listenerURL returns an http(s) URL for a listener, using the loopback
+// address when listening on all interfaces
+func listenerURL(l net.Listener, tlsConfig *tls.Config) string {
+	addr := l.Addr().(*net.TCPAddr)
+	host := addr.IP.String()
+	if addr.IP.IsUnspecified() {
+		host = "127.0.0.1"
+	}
+	scheme := "http"
+	if tlsConfig != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + net.JoinHostPort(host, fmt.Sprint(addr.Port))
+}
+
+// Close shuts the servers down, waiting briefly for in-flight requests.
+// It is safe to call more than once.
+func (i *Instance) Close() error {
+	i.closeOnce.Do(func() {
+		close(i.stop)
+		i.server.listeners.stopAll()
+
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+
+		i.server.shutdown(ctx)
+		if i.aux.smtp != nil {
+			i.aux.smtp.Close()
+		}
+		if i.aux.smpp != nil {
+			i.aux.smpp.Close()
+			i.server.closeSMPP()
+		}
+		if i.grpcServer != nil {
+			i.grpcServer.Stop()
+		}
+
+		var apiErr error
+		if i.apiServer != nil {
+			apiErr = i.apiServer.Shutdown(ctx)
+		}
+		webErr := i.webServer.Shutdown(ctx)
+		i.server.leaveCluster()
+		i.server.stopTracing(ctx)
+		i.closeErr = apiErr
+		if i.closeErr == nil {
+			i.closeErr = webErr
+		}
+	})
+	return i.closeErr
+}
+
+// Client returns an HTTP client for this instance. With TLS enabled it
+// trusts the server's certificate, including a self-signed one.
+func (i *Instance) Client() *client.Client {
+	c := client.New(i.WebURL, i.APIURL)
+	c.Token = i.server.config.AuthToken
+	if i.tlsConfig != nil {
+		c.HTTPClient.Transport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: i.certPool()}}
+	}
+	return c
+}
+
+// certPool returns the system roots plus the server's own certificate
+func (i *Instance) certPool() *x509.CertPool {
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	for _, cert := range i.tlsConfig.Certificates {
+		if leaf, err := x509.ParseCertificate(cert.Certificate[0]); err == nil {
+			pool.AddCert(leaf)
+		}
+	}
+	return pool
+}
+
+// Messages returns every captured message across all projects, newest
+// first, as the API lists them
+func (i *Instance) Messages() []Message {
+	i.server.mu.RLock()
+	msgs := make([]Message, len(i.server.messages))
+	copy(msgs, i.server.messages)
+	i.server.mu.RUnlock()
+
+	names := make(map[string]contactNames)
+	for j := range msgs {
+		project := msgs[j].Project
+		if names[project] == nil {
+			names[project] = i.server.contactNames(project)
+		}
+		names[project].apply(&msgs[j])
+	}
+	return msgs
+}
+
+// Reset deletes every captured message in every project, as clearing each
+// project through the API would
+func (i *Instance) Reset() {
+	i.server.clearMessages(func(string) bool { return true })
+}
@@ -0,0 +1,71 @@
+package smspit
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInstance(t *testing.T) {
+	s := New(Config{Host: "127.0.0.1", KannelCompat: true})
+	sms, err := s.Start(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sms.Close()
+	ts := &testServer{Server: s}
+	ts.api, ts.web = s.Handlers()
+
+	for _, project := range []string{"default", "ci-1"} {
+		resp, err := http.Post(sms.APIURL+"/projects/"+project+"/send", "application/json",
+			strings.NewReader(`{"to":"+15551230001","from":"+15550009999","body":"Hi"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("send to %s: %d", project, resp.StatusCode)
+		}
+	}
+	if w := do(t, ts.web, "POST", "/api/v1/contacts", `{"number":"+15551230001","name":"Ada"}`); w.Code != http.StatusCreated {
+		t.Fatalf("add contact: %d %s", w.Code, w.Body)
+	}
+	ts.sendPart(t, "+15551230002", "Part one", 1, 2, 1)
+
+	msgs := sms.Messages()
+	if len(msgs) != 2 {
+		t.Fatalf("Messages() = %d messages, want 2", len(msgs))
+	}
+	for _, msg := range msgs {
+		if want := map[string]string{"default": "Ada"}[msg.Project]; msg.ToName != want {
+			t.Errorf("%s message to_name = %q, want %q", msg.Project, msg.ToName, want)
+		}
+	}
+
+	events, cancel := s.events.subscribe()
+	defer cancel()
+	sms.Reset()
+
+	if msgs := sms.Messages(); len(msgs) != 0 {
+		t.Errorf("Messages() after Reset = %d messages, want none", len(msgs))
+	}
+	s.concat.mu.Lock()
+	pending := len(s.concat.pending)
+	s.concat.mu.Unlock()
+	if pending != 0 {
+		t.Errorf("%d concatenated messages still pending after Reset", pending)
+	}
+	cleared := make(map[string]bool)
+	for len(cleared) < 2 {
+		select {
+		case event := <-events:
+			if event.Data["type"] == "messages_cleared" {
+				cleared[eventProject(event.Data)] = true
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("messages_cleared events for %v, want default and ci-1", cleared)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package smspit
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"unicode/utf8"
+)
+
+// MessageTooLongError is returned when capturing an outbound message whose
+// body is longer than SMSPIT_MAX_MESSAGE_LENGTH
+type MessageTooLongError struct {
+	Length int // Characters in the body
+	Max    int
+}
+
+func (e *MessageTooLongError) Error() string {
+	return fmt.Sprintf(twilioErrorCatalog[21617].Message, e.Max)
+}
+
+// checkMessageLength rejects outbound message bodies over the configured
+// length in characters, like a provider's concatenation limit
+func (s *Server) checkMessageLength(msg Message) error {
+	if s.config.MaxMessageLength <= 0 || msg.Direction != "outbound" {
+		return nil
+	}
+	if n := utf8.RuneCountInString(msg.Body); n > s.config.MaxMessageLength {
+		return &MessageTooLongError{Length: n, Max: s.config.MaxMessageLength}
+	}
+	return nil
+}
+
+// writeTooLongError answers a capture request with a message that's too
+// long, in the provider's error format
+func writeTooLongError(w http.ResponseWriter, r *http.Request, err *MessageTooLongError) {
+	if r.URL.Path == "/messages" {
+		writeMessageBirdError(w, http.StatusUnprocessableEntity, 9, err.Error(), "body")
+		return
+	}
+	writeProviderError(w, r, http.StatusBadRequest, 21617, err.Error(), 0)
+}
+
+// bodyLimitMiddleware caps capture request bodies at SMSPIT_MAX_BODY_BYTES.
+// Requests that declare a larger body are refused up front; others fail
+// when the handler reads past the limit.
+func (s *Server) bodyLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		max := int64(s.config.MaxBodyBytes)
+		if max <= 0 || r.Body == nil || r.Body == http.NoBody {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.ContentLength > max {
+			log.Printf("⚠️ Request body too large: %s %s (%d bytes)", r.Method, r.URL.Path, r.ContentLength)
+			writeProviderError(w, r, http.StatusRequestEntityTooLarge, 0, fmt.Sprintf("Request body exceeds %d bytes", max), 0)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, max)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// errReader fails every read with its error, so a body that failed to
+// buffer fails the same way for the handler
+type errReader struct{ err error }
+
+func (e errReader) Read([]byte) (int, error) { return 0, e.err }
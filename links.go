@@ -0,0 +1,173 @@
+package smspit
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// linkPattern finds URLs with a scheme (https://, or an app's own such as
+// myapp://) or starting with www.
+var linkPattern = regexp.MustCompile(`(?i)\b(?:[a-z][a-z0-9+.-]*://|www\.)[^\s<>"']+`)
+
+// Link is a URL found in a message body, with its parts parsed out
+type Link struct {
+	URL    string `json:"url"`
+	Scheme string `json:"scheme,omitempty"` // Empty for www. links
+	Host   string `json:"host"`
+	Path   string `json:"path,omitempty"`
+	// Query holds the first value of each query parameter, e.g. a reset token
+	Query    map[string]string `json:"query,omitempty"`
+	Fragment string            `json:"fragment,omitempty"`
+	// TrackingURL redirects to the link and records the click, when
+	// SMSPIT_TRACK_LINKS is set
+	TrackingURL string      `json:"tracking_url,omitempty"`
+	Clicks      []LinkClick `json:"clicks,omitempty"`
+}
+
+// LinkClick is one visit to a link's tracking URL
+type LinkClick struct {
+	At        time.Time `json:"at"`
+	UserAgent string    `json:"user_agent"`
+}
+
+// extractLinks returns the links in body in the order they appear.
+// Punctuation ending a sentence after a URL is not part of it.
+func extractLinks(body string) []Link {
+	var links []Link
+	for _, raw := range linkPattern.FindAllString(body, -1) {
+		raw = trimLinkPunctuation(raw)
+		target := raw
+		if strings.HasPrefix(strings.ToLower(raw), "www.") {
+			target = "http://" + raw
+		}
+		u, err := url.Parse(target)
+		if err != nil || u.Host == "" {
+			continue
+		}
+
+		link := Link{URL: raw, Host: u.Host, Path: u.Path, Fragment: u.Fragment}
+		if target == raw {
+			link.Scheme = strings.ToLower(u.Scheme)
+		}
+		for key, values := range u.Query() {
+			if link.Query == nil {
+				link.Query = make(map[string]string)
+			}
+			link.Query[key] = values[0]
+		}
+		links = append(links, link)
+	}
+	return links
+}
+
+// trimLinkPunctuation drops trailing punctuation from a matched URL, keeping
+// a closing bracket that closes one opened inside it
+func trimLinkPunctuation(raw string) string {
+	for raw != "" {
+		last := raw[len(raw)-1]
+		switch {
+		case strings.IndexByte(".,;:!?", last) >= 0:
+		case last == ')' && strings.Count(raw, "(") < strings.Count(raw, ")"):
+		case last == ']' && strings.Count(raw, "[") < strings.Count(raw, "]"):
+		default:
+			return raw
+		}
+		raw = raw[:len(raw)-1]
+	}
+	return raw
+}
+
+// setLinks finds the links in a stored message's body and, when
+// SMSPIT_TRACK_LINKS is set, gives each one a tracking URL
+func (s *Server) setLinks(msg *Message) {
+	msg.Links = extractLinks(msg.Body)
+	if !s.config.TrackLinks {
+		return
+	}
+	for i := range msg.Links {
+		msg.Links[i].TrackingURL = s.config.WebRoot + "/l/" + strings.ReplaceAll(uuid.New().String(), "-", "")[:16]
+	}
+}
+
+// target returns where a link points, adding a scheme to www. links
+func (l Link) target() string {
+	if l.Scheme == "" {
+		return "http://" + l.URL
+	}
+	return l.URL
+}
+
+// handleLinkRedirect records a click on a tracking URL and redirects to the
+// link, emitting a link_clicked event
+func (s *Server) handleLinkRedirect(w http.ResponseWriter, r *http.Request) {
+	trackingURL := s.config.WebRoot + "/l/" + mux.Vars(r)["token"]
+	click := LinkClick{At: time.Now(), UserAgent: r.UserAgent()}
+
+	var msg Message
+	var link Link
+	found := false
+	s.mu.Lock()
+	for i := range s.messages {
+		for j, l := range s.messages[i].Links {
+			if l.TrackingURL != trackingURL {
+				continue
+			}
+			// Copy rather than modify links that served copies may share
+			links := append([]Link(nil), s.messages[i].Links...)
+			links[j].Clicks = append(append([]LinkClick(nil), l.Clicks...), click)
+			s.messages[i].Links = links
+			msg, link, found = s.messages[i], links[j], true
+		}
+	}
+	s.mu.Unlock()
+
+	if !found {
+		http.Error(w, "Link not found", http.StatusNotFound)
+		return
+	}
+	s.syncSaved(msg.key())
+	log.Printf("🔗 Link clicked: %s in %s", link.URL, msg.ID)
+	s.broadcastEvent(map[string]interface{}{
+		"type":         "link_clicked",
+		"project":      msg.Project,
+		"message_id":   msg.ID,
+		"url":          link.URL,
+		"tracking_url": link.TrackingURL,
+		"click":        click,
+	})
+	http.Redirect(w, r, link.target(), http.StatusFound)
+}
+
+// handleGetMessageLinks returns the links found in a message's body
+func (s *Server) handleGetMessageLinks(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, msg := range s.messagesFor(projectFromRequest(r)) {
+		if msg.ID == id {
+			links := msg.Links
+			if links == nil {
+				links = []Link{}
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"message_id": msg.ID,
+				"links":      links,
+				"total":      len(links),
+			})
+			return
+		}
+	}
+
+	http.Error(w, "Message not found", http.StatusNotFound)
+}
@@ -0,0 +1,333 @@
+package smspit
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+)
+
+// Default Lookup carrier data for numbers without a fixture
+const (
+	lookupDefaultCarrier  = "SMSpit Mobile"
+	lookupDefaultLineType = "mobile"
+	lookupDefaultMCC      = "001"
+	lookupDefaultMNC      = "01"
+)
+
+// lookupCountries maps calling codes to ISO country codes. Numbers with
+// other calling codes get "XX".
+var lookupCountries = map[string]string{
+	"1": "US", "7": "RU", "20": "EG", "27": "ZA", "31": "NL", "32": "BE", "33": "FR",
+	"34": "ES", "39": "IT", "41": "CH", "44": "GB", "45": "DK", "46": "SE", "47": "NO",
+	"48": "PL", "49": "DE", "52": "MX", "55": "BR", "61": "AU", "64": "NZ", "65": "SG",
+	"81": "JP", "82": "KR", "86": "CN", "91": "IN", "234": "NG", "351": "PT", "353": "IE",
+	"358": "FI", "971": "AE", "972": "IL",
+}
+
+// LookupFixture overrides the Lookup data returned for one number. Empty
+// fields keep their defaults.
+type LookupFixture struct {
+	Number            string `json:"number"`
+	CountryCode       string `json:"country_code,omitempty"`
+	NationalFormat    string `json:"national_format,omitempty"`
+	CarrierName       string `json:"carrier_name,omitempty"`
+	LineType          string `json:"line_type,omitempty"` // mobile, landline, fixedVoip, nonFixedVoip, tollFree, ...
+	MobileCountryCode string `json:"mobile_country_code,omitempty"`
+	MobileNetworkCode string `json:"mobile_network_code,omitempty"`
+	CallerName        string `json:"caller_name,omitempty"`
+	Valid             *bool  `json:"valid,omitempty"`
+}
+
+// lookupStore holds Lookup fixtures by E.164 number
+type lookupStore struct {
+	mu       sync.RWMutex
+	fixtures map[string]LookupFixture
+}
+
+// lookupResult is the resolved Lookup data for a number
+type lookupResult struct {
+	LookupFixture
+	CallingCode string
+	Errors      []string // v2 validation errors
+}
+
+// splitCallingCode returns the calling code and national number of an E.164
+// number, or ok false if it isn't one
+func splitCallingCode(number string) (code, national string, ok bool) {
+	digits := strings.TrimPrefix(number, "+")
+	if !strings.HasPrefix(number, "+") || digits == "" || strings.Trim(digits, "0123456789") != "" {
+		return "", "", false
+	}
+	for n := 3; n >= 1; n-- {
+		if n < len(digits) && lookupCountries[digits[:n]] != "" {
+			return digits[:n], digits[n:], true
+		}
+	}
+	return digits[:1], digits[1:], true
+}
+
+// nationalFormat formats a national number the way Lookup does for NANP
+// numbers, e.g. (415) 555-0100; other numbers are returned as is
+func nationalFormat(callingCode, national string) string {
+	if callingCode == "1" && len(national) == 10 {
+		return "(" + national[:3] + ") " + national[3:6] + "-" + national[6:]
+	}
+	return national
+}
+
+// normalizeLookupNumber turns a path number into E.164, using the
+// CountryCode query param (default US) for national numbers
+func normalizeLookupNumber(number, country string) string {
+	number = strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' || r == '(' || r == ')' || r == '.' {
+			return -1
+		}
+		return r
+	}, number)
+	if strings.HasPrefix(number, "+") || number == "" || strings.Trim(number, "0123456789") != "" {
+		return number
+	}
+	if country == "" {
+		country = "US"
+	}
+	for code, iso := range lookupCountries {
+		if strings.EqualFold(iso, country) {
+			return "+" + code + strings.TrimLeft(number, "0")
+		}
+	}
+	return number
+}
+
+// lookup resolves the Lookup data for number: defaults derived from the
+// number, overridden by its fixture
+func (s *Server) lookup(number string) lookupResult {
+	result := lookupResult{LookupFixture: LookupFixture{Number: number}}
+
+	code, national, ok := splitCallingCode(number)
+	valid := ok && len(national) >= 4 && len(code)+len(national) <= 15
+	switch {
+	case !ok:
+		result.Errors = []string{"NOT_A_NUMBER"}
+	case len(national) < 4:
+		result.Errors = []string{"TOO_SHORT"}
+	case len(code)+len(national) > 15:
+		result.Errors = []string{"TOO_LONG"}
+	}
+	if ok {
+		result.CallingCode = code
+		result.CountryCode = lookupCountries[code]
+		if result.CountryCode == "" {
+			result.CountryCode = "XX"
+		}
+		result.NationalFormat = nationalFormat(code, national)
+	}
+	result.CarrierName = lookupDefaultCarrier
+	result.LineType = lookupDefaultLineType
+	result.MobileCountryCode = lookupDefaultMCC
+	result.MobileNetworkCode = lookupDefaultMNC
+
+	s.lookups.mu.RLock()
+	fixture, found := s.lookups.fixtures[number]
+	s.lookups.mu.RUnlock()
+	if found {
+		for _, f := range []struct {
+			dst *string
+			val string
+		}{
+			{&result.CountryCode, fixture.CountryCode},
+			{&result.NationalFormat, fixture.NationalFormat},
+			{&result.CarrierName, fixture.CarrierName},
+			{&result.LineType, fixture.LineType},
+			{&result.MobileCountryCode, fixture.MobileCountryCode},
+			{&result.MobileNetworkCode, fixture.MobileNetworkCode},
+			{&result.CallerName, fixture.CallerName},
+		} {
+			if f.val != "" {
+				*f.dst = f.val
+			}
+		}
+		if fixture.Valid != nil {
+			valid = *fixture.Valid
+			if valid {
+				result.Errors = nil
+			} else if len(result.Errors) == 0 {
+				result.Errors = []string{"INVALID_BUT_POSSIBLE"}
+			}
+		}
+	}
+	result.Valid = &valid
+	return result
+}
+
+// nullable returns nil for an empty string so it encodes as JSON null
+func nullable(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// handleLookupV1 serves the Lookup v1 API. Carrier and caller name data are
+// only included when asked for with Type=carrier / Type=caller-name.
+func (s *Server) handleLookupV1(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	number := normalizeLookupNumber(mux.Vars(r)["number"], q.Get("CountryCode"))
+	result := s.lookup(number)
+	if !*result.Valid {
+		writeTwilioError(w, twilioErrorCatalog[20404], r.URL.Path)
+		return
+	}
+
+	types := strings.Join(q["Type"], ",")
+	resource := map[string]interface{}{
+		"phone_number":    number,
+		"country_code":    result.CountryCode,
+		"national_format": result.NationalFormat,
+		"carrier":         nil,
+		"caller_name":     nil,
+		"add_ons":         nil,
+		"url":             "/v1/PhoneNumbers/" + number,
+	}
+	if strings.Contains(types, "carrier") {
+		resource["carrier"] = map[string]interface{}{
+			"name":                result.CarrierName,
+			"type":                result.LineType,
+			"mobile_country_code": result.MobileCountryCode,
+			"mobile_network_code": result.MobileNetworkCode,
+			"error_code":          nil,
+		}
+	}
+	if strings.Contains(types, "caller-name") {
+		resource["caller_name"] = map[string]interface{}{
+			"caller_name": nullable(result.CallerName),
+			"caller_type": nil,
+			"error_code":  nil,
+		}
+	}
+
+	log.Printf("🔎 Lookup v1: %s", number)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resource)
+}
+
+// handleLookupV2 serves the Lookup v2 API. Invalid numbers return 200 with
+// valid false, like Twilio; line type and caller name data are added when
+// requested with Fields=line_type_intelligence,caller_name.
+func (s *Server) handleLookupV2(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	number := normalizeLookupNumber(mux.Vars(r)["number"], q.Get("CountryCode"))
+	result := s.lookup(number)
+	valid := *result.Valid
+
+	resource := map[string]interface{}{
+		"phone_number":               number,
+		"valid":                      valid,
+		"validation_errors":          result.Errors,
+		"calling_country_code":       nullable(result.CallingCode),
+		"country_code":               nullable(result.CountryCode),
+		"national_format":            nullable(result.NationalFormat),
+		"caller_name":                nil,
+		"sim_swap":                   nil,
+		"call_forwarding":            nil,
+		"line_status":                nil,
+		"line_type_intelligence":     nil,
+		"identity_match":             nil,
+		"reassigned_number":          nil,
+		"sms_pumping_risk":           nil,
+		"phone_number_quality_score": nil,
+		"pre_fill":                   nil,
+		"url":                        "/v2/PhoneNumbers/" + number,
+	}
+	if result.Errors == nil {
+		resource["validation_errors"] = []string{}
+	}
+
+	fields := strings.Join(q["Fields"], ",")
+	if valid && strings.Contains(fields, "line_type_intelligence") {
+		resource["line_type_intelligence"] = map[string]interface{}{
+			"carrier_name":        result.CarrierName,
+			"type":                result.LineType,
+			"mobile_country_code": result.MobileCountryCode,
+			"mobile_network_code": result.MobileNetworkCode,
+			"error_code":          nil,
+		}
+	}
+	if valid && strings.Contains(fields, "caller_name") {
+		resource["caller_name"] = map[string]interface{}{
+			"caller_name": nullable(result.CallerName),
+			"caller_type": nil,
+			"error_code":  nil,
+		}
+	}
+
+	log.Printf("🔎 Lookup v2: %s (valid=%t)", number, valid)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resource)
+}
+
+// setLookupFixture adds or replaces the fixture for fixture.Number
+func (s *Server) setLookupFixture(fixture LookupFixture) {
+	s.lookups.mu.Lock()
+	s.lookups.fixtures[fixture.Number] = fixture
+	s.lookups.mu.Unlock()
+	s.syncRecords(kindLookups)
+}
+
+// handleListLookups returns every Lookup fixture, sorted by number
+func (s *Server) handleListLookups(w http.ResponseWriter, r *http.Request) {
+	s.lookups.mu.RLock()
+	fixtures := make([]LookupFixture, 0, len(s.lookups.fixtures))
+	for _, f := range s.lookups.fixtures {
+		fixtures = append(fixtures, f)
+	}
+	s.lookups.mu.RUnlock()
+	sort.Slice(fixtures, func(i, j int) bool { return fixtures[i].Number < fixtures[j].Number })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"lookups": fixtures,
+		"total":   len(fixtures),
+	})
+}
+
+// handleSetLookup adds or replaces the Lookup fixture for a number
+func (s *Server) handleSetLookup(w http.ResponseWriter, r *http.Request) {
+	var fixture LookupFixture
+	if err := json.NewDecoder(r.Body).Decode(&fixture); err != nil {
+		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	fixture.Number = mux.Vars(r)["number"]
+	if _, _, ok := splitCallingCode(fixture.Number); !ok {
+		http.Error(w, "Number must be in E.164 format (e.g. +15551234567)", http.StatusBadRequest)
+		return
+	}
+
+	s.setLookupFixture(fixture)
+	log.Printf("🔎 Lookup fixture set: %s", fixture.Number)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(fixture)
+}
+
+// handleDeleteLookup removes the Lookup fixture for a number
+func (s *Server) handleDeleteLookup(w http.ResponseWriter, r *http.Request) {
+	number := mux.Vars(r)["number"]
+
+	s.lookups.mu.Lock()
+	_, ok := s.lookups.fixtures[number]
+	delete(s.lookups.fixtures, number)
+	s.lookups.mu.Unlock()
+	s.syncRecords(kindLookups)
+
+	if !ok {
+		http.Error(w, "Lookup fixture not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,196 @@
+package smspit
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	maxMediaItems = 10              // Twilio allows up to 10 media items per message
+	maxMediaSize  = 5 * 1024 * 1024 // Twilio's 5MB limit per media item
+)
+
+// MediaItem is an MMS attachment stored alongside a message
+type MediaItem struct {
+	ContentType string `json:"content_type"`
+	Size        int    `json:"size"`
+	Filename    string `json:"filename,omitempty"`
+	SourceURL   string `json:"source_url,omitempty"`
+	URL         string `json:"url"`
+	Data        []byte `json:"-"`
+}
+
+var mediaClient = &http.Client{Timeout: 10 * time.Second}
+
+// fetchMedia downloads a remote media URL so it can be served locally
+func fetchMedia(mediaURL string) (MediaItem, error) {
+	resp, err := mediaClient.Get(mediaURL)
+	if err != nil {
+		return MediaItem{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return MediaItem{}, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	data, err := readMedia(resp.Body)
+	if err != nil {
+		return MediaItem{}, err
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+
+	return MediaItem{
+		ContentType: contentType,
+		Size:        len(data),
+		Filename:    path.Base(resp.Request.URL.Path),
+		SourceURL:   mediaURL,
+		Data:        data,
+	}, nil
+}
+
+// parseMultipartSend reads a multipart /send request: the to, from, body and
+// tags form fields plus any uploaded files as media
+func parseMultipartSend(r *http.Request) (SendRequest, []MediaItem, error) {
+	if err := r.ParseMultipartForm(maxMediaItems * maxMediaSize); err != nil {
+		return SendRequest{}, nil, err
+	}
+
+	req := SendRequest{
+		To:   r.FormValue("to"),
+		From: r.FormValue("from"),
+		Body: r.FormValue("body"),
+		Tags: r.MultipartForm.Value["tags"],
+	}
+	if v := r.FormValue("send_at"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return req, nil, fmt.Errorf("invalid send_at: %w", err)
+		}
+		req.SendAt = &t
+	}
+	req.TTL = r.FormValue("ttl")
+
+	var media []MediaItem
+	for _, files := range r.MultipartForm.File {
+		for _, fh := range files {
+			if len(media) == maxMediaItems {
+				return req, nil, fmt.Errorf("too many media items (max %d)", maxMediaItems)
+			}
+
+			f, err := fh.Open()
+			if err != nil {
+				return req, nil, err
+			}
+			data, err := readMedia(f)
+			f.Close()
+			if err != nil {
+				return req, nil, fmt.Errorf("%s: %w", fh.Filename, err)
+			}
+
+			contentType := fh.Header.Get("Content-Type")
+			if contentType == "" || contentType == "application/octet-stream" {
+				contentType = http.DetectContentType(data)
+			}
+
+			media = append(media, MediaItem{
+				ContentType: contentType,
+				Size:        len(data),
+				Filename:    fh.Filename,
+				Data:        data,
+			})
+		}
+	}
+
+	return req, media, nil
+}
+
+// readMedia reads a media item, enforcing the per-item size limit
+func readMedia(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxMediaSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxMediaSize {
+		return nil, errors.New("media exceeds 5MB limit")
+	}
+	return data, nil
+}
+
+// attachMedia stores media on a message and assigns each item its local URL.
+// Media in a named project is served under that project's path prefix.
+func (s *Server) attachMedia(msg *Message, media []MediaItem) {
+	prefix := s.config.WebRoot
+	if msg.Project != "" && msg.Project != defaultProject {
+		prefix += projectPathPrefix + msg.Project
+	}
+	for i := range media {
+		media[i].URL = fmt.Sprintf("%s/api/v1/messages/%s/media/%d", prefix, msg.ID, i)
+	}
+	msg.Media = media
+}
+
+// mediaDisposition shows images, audio and video inline and downloads
+// everything else, including SVG, which can carry script
+func mediaDisposition(contentType string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "image/svg+xml":
+		return "attachment"
+	case strings.HasPrefix(mediaType, "image/"), strings.HasPrefix(mediaType, "audio/"), strings.HasPrefix(mediaType, "video/"):
+		return "inline"
+	}
+	return "attachment"
+}
+
+// handleGetMedia serves a stored media attachment
+func (s *Server) handleGetMedia(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+	n, err := strconv.Atoi(vars["n"])
+	if err != nil {
+		http.Error(w, "Invalid media index", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, msg := range s.messagesFor(projectFromRequest(r)) {
+		if msg.ID == id {
+			if n < 0 || n >= len(msg.Media) {
+				http.Error(w, "Media not found", http.StatusNotFound)
+				return
+			}
+			item := msg.Media[n]
+			params := map[string]string{}
+			if item.Filename != "" {
+				params["filename"] = item.Filename
+			}
+			// The sender picks the content type, so nothing served here may
+			// run in the dashboard's origin
+			w.Header().Set("Content-Type", item.ContentType)
+			w.Header().Set("Content-Length", strconv.Itoa(len(item.Data)))
+			w.Header().Set("Content-Disposition", mime.FormatMediaType(mediaDisposition(item.ContentType), params))
+			w.Header().Set("X-Content-Type-Options", "nosniff")
+			w.Header().Set("Content-Security-Policy", "sandbox")
+			w.Write(item.Data)
+			return
+		}
+	}
+
+	http.Error(w, "Message not found", http.StatusNotFound)
+}
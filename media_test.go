@@ -0,0 +1,85 @@
+package smspit
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+// sendMedia captures an MMS with one attachment through a multipart /send
+// and returns the message ID
+func (ts *testServer) sendMedia(t *testing.T, filename, contentType string, data []byte) string {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("to", "+15551230001")
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", `form-data; name="file"; filename="`+filename+`"`)
+	header.Set("Content-Type", contentType)
+	part, _ := form.CreatePart(header)
+	part.Write(data)
+	form.Close()
+
+	r := httptest.NewRequest("POST", "/send", &body)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	w := httptest.NewRecorder()
+	ts.api.ServeHTTP(w, r)
+	if w.Code != http.StatusOK && w.Code != http.StatusCreated {
+		t.Fatalf("send: %d %s", w.Code, w.Body)
+	}
+	var resp struct {
+		ID string `json:"id"`
+	}
+	decode(t, w, &resp)
+	return resp.ID
+}
+
+func TestServeMedia(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	html := []byte("<html><script>alert(document.cookie)</script></html>")
+
+	tests := []struct {
+		filename, contentType string
+		data                  []byte
+		wantType, disposition string
+	}{
+		{"receipt.png", "image/png", png, "image/png", "inline"},
+		{"page.html", "text/html", html, "text/html", "attachment"},
+		{"logo.svg", "image/svg+xml", []byte(`<svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`), "image/svg+xml", "attachment"},
+		// Untyped uploads are sniffed, and still not served inline
+		{"blob", "application/octet-stream", html, "text/html; charset=utf-8", "attachment"},
+	}
+	ts := newTestServer(t, Config{})
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			id := ts.sendMedia(t, tt.filename, tt.contentType, tt.data)
+			w := do(t, ts.web, "GET", "/api/v1/messages/"+id+"/media/0", "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("media: %d %s", w.Code, w.Body)
+			}
+			if got := w.Header().Get("Content-Type"); got != tt.wantType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.wantType)
+			}
+			if got := w.Header().Get("Content-Disposition"); !strings.HasPrefix(got, tt.disposition) || !strings.Contains(got, tt.filename) {
+				t.Errorf("Content-Disposition = %q, want %s with the filename", got, tt.disposition)
+			}
+			if got := w.Header().Get("X-Content-Type-Options"); got != "nosniff" {
+				t.Errorf("X-Content-Type-Options = %q, want nosniff", got)
+			}
+			if got := w.Header().Get("Content-Security-Policy"); got != "sandbox" {
+				t.Errorf("Content-Security-Policy = %q, want sandbox", got)
+			}
+			if !bytes.Equal(w.Body.Bytes(), tt.data) {
+				t.Errorf("body = %q, want the upload", w.Body)
+			}
+		})
+	}
+
+	if w := do(t, ts.web, "GET", "/api/v1/messages/"+ts.messages(t)[0].ID+"/media/5", ""); w.Code != http.StatusNotFound {
+		t.Errorf("missing media: %d, want 404", w.Code)
+	}
+}
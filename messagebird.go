@@ -0,0 +1,193 @@
+package smspit
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MessageBirdRequest represents a MessageBird SMS API request.
+// Recipients may be sent as a JSON array of numbers/strings or a
+// comma-separated string.
+type MessageBirdRequest struct {
+	Recipients json.RawMessage `json:"recipients"`
+	Originator string          `json:"originator"`
+	Body       string          `json:"body"`
+	Reference  string          `json:"reference,omitempty"`
+}
+
+// handleMessageBirdSend handles MessageBird-compatible requests (JSON or form encoded)
+func (s *Server) handleMessageBirdSend(w http.ResponseWriter, r *http.Request) {
+	var recipients []string
+	var originator, body, reference string
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		var req MessageBirdRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeMessageBirdError(w, http.StatusBadRequest, 2, "Request not allowed: invalid JSON", "")
+			return
+		}
+		recipients = parseMessageBirdRecipients(req.Recipients)
+		originator, body, reference = req.Originator, req.Body, req.Reference
+	} else {
+		if err := r.ParseForm(); err != nil {
+			writeMessageBirdError(w, http.StatusBadRequest, 2, "Request not allowed: invalid form data", "")
+			return
+		}
+		recipients = splitRecipients(r.FormValue("recipients"))
+		originator, body, reference = r.FormValue("originator"), r.FormValue("body"), r.FormValue("reference")
+	}
+
+	if len(recipients) == 0 {
+		writeMessageBirdError(w, http.StatusUnprocessableEntity, 9, "no (correct) recipients found", "recipients")
+		return
+	}
+	if originator == "" {
+		writeMessageBirdError(w, http.StatusUnprocessableEntity, 9, "originator is required", "originator")
+		return
+	}
+	if body == "" {
+		writeMessageBirdError(w, http.StatusUnprocessableEntity, 9, "body is required", "body")
+		return
+	}
+
+	id := strings.ReplaceAll(uuid.New().String(), "-", "") // MessageBird-style ID
+	now := time.Now()
+
+	msgs := make([]Message, 0, len(recipients))
+	for _, to := range recipients {
+		msgs = append(msgs, Message{
+			ID:        "msg_" + uuid.New().String()[:8],
+			To:        to,
+			From:      originator,
+			Body:      body,
+			Status:    "captured",
+			CreatedAt: now,
+			Project:   projectFromRequest(r),
+			Metadata:  metadataFromRequest(r),
+
+			Correlation: correlationFromRequest(r),
+		})
+	}
+	if err := s.captureMessages(msgs); err != nil {
+		writeCaptureError(w, r, err)
+		return
+	}
+
+	items := make([]map[string]interface{}, 0, len(msgs))
+	for _, msg := range msgs {
+		log.Printf("📱 SMS captured (MessageBird): To=%s Body=%s", msg.To, truncate(msg.Body, 50))
+
+		items = append(items, map[string]interface{}{
+			"recipient":      recipientNumber(msg.To),
+			"status":         "sent",
+			"statusDatetime": now.Format(time.RFC3339),
+		})
+	}
+
+	var ref interface{}
+	if reference != "" {
+		ref = reference
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":                id,
+		"href":              fmt.Sprintf("%s://%s/messages/%s", requestScheme(r), r.Host, id),
+		"direction":         "mt",
+		"type":              "sms",
+		"originator":        originator,
+		"body":              body,
+		"reference":         ref,
+		"validity":          nil,
+		"gateway":           nil,
+		"typeDetails":       map[string]interface{}{},
+		"datacoding":        "plain",
+		"mclass":            1,
+		"scheduledDatetime": nil,
+		"createdDatetime":   now.Format(time.RFC3339),
+		"recipients": map[string]interface{}{
+			"totalCount":               len(items),
+			"totalSentCount":           len(items),
+			"totalDeliveredCount":      0,
+			"totalDeliveryFailedCount": 0,
+			"items":                    items,
+		},
+	})
+}
+
+// parseMessageBirdRecipients accepts an array of numbers/strings or a comma-separated string
+func parseMessageBirdRecipients(raw json.RawMessage) []string {
+	if len(raw) == 0 {
+		return nil
+	}
+
+	var list []interface{}
+	if err := json.Unmarshal(raw, &list); err == nil {
+		var out []string
+		for _, v := range list {
+			switch n := v.(type) {
+			case string:
+				out = append(out, splitRecipients(n)...)
+			case float64:
+				out = append(out, fmt.Sprintf("%.0f", n))
+			}
+		}
+		return out
+	}
+
+	var str string
+	if err := json.Unmarshal(raw, &str); err == nil {
+		return splitRecipients(str)
+	}
+
+	var num float64
+	if err := json.Unmarshal(raw, &num); err == nil {
+		return []string{fmt.Sprintf("%.0f", num)}
+	}
+
+	return nil
+}
+
+func splitRecipients(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+// recipientNumber renders a recipient the way MessageBird does (as a number when possible)
+func recipientNumber(to string) interface{} {
+	if n, err := strconv.ParseInt(strings.TrimPrefix(to, "+"), 10, 64); err == nil {
+		return n
+	}
+	return to
+}
+
+// writeMessageBirdError writes a MessageBird-shaped error response
+func writeMessageBirdError(w http.ResponseWriter, status, code int, description, parameter string) {
+	var param interface{}
+	if parameter != "" {
+		param = parameter
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"errors": []map[string]interface{}{{
+			"code":        code,
+			"description": description,
+			"parameter":   param,
+		}},
+	})
+}
@@ -0,0 +1,81 @@
+package smspit
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// metaHeaderPrefix starts the headers that add metadata to captured
+// messages, e.g. X-SMSpit-Meta-Run-Id: 42 sets run-id
+const metaHeaderPrefix = "X-Smspit-Meta-"
+
+// Limits on the metadata in a send request body
+const (
+	maxMetadataKeys  = 32
+	maxMetadataValue = 1024
+)
+
+// validMetadataKey matches the keys metadata may use. Keys are compared
+// ignoring case.
+var validMetadataKey = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// metadataFromRequest returns the metadata set by a capture request's
+// X-SMSpit-Meta-* headers, keyed by the rest of the header name in lower
+// case, or nil if there are none. Provider endpoints have no other way to
+// take metadata.
+func metadataFromRequest(r *http.Request) map[string]string {
+	var meta map[string]string
+	for name, values := range r.Header {
+		key := strings.ToLower(strings.TrimPrefix(name, metaHeaderPrefix))
+		if key == strings.ToLower(name) || !validMetadataKey.MatchString(key) || len(values) == 0 {
+			continue
+		}
+		if meta == nil {
+			meta = make(map[string]string)
+		}
+		meta[key] = values[0]
+	}
+	return meta
+}
+
+// mergeMetadata adds a request body's metadata to the metadata from its
+// headers, the body winning. Header metadata is bounded by the server's
+// header size limit; body metadata is checked against the limits here.
+func mergeMetadata(headers, body map[string]string) (map[string]string, error) {
+	if len(body) > maxMetadataKeys {
+		return nil, fmt.Errorf("Too many 'metadata' keys (at most %d)", maxMetadataKeys)
+	}
+	if len(body) == 0 {
+		return headers, nil
+	}
+	meta := make(map[string]string, len(headers)+len(body))
+	for key, value := range headers {
+		meta[key] = value
+	}
+	for key, value := range body {
+		if !validMetadataKey.MatchString(key) {
+			return nil, fmt.Errorf("Invalid 'metadata' key %q (letters, digits, '_', '.' and '-', up to 64 characters)", key)
+		}
+		if len(value) > maxMetadataValue {
+			return nil, fmt.Errorf("'metadata' value of %q is longer than %d bytes", key, maxMetadataValue)
+		}
+		meta[key] = value
+	}
+	return meta, nil
+}
+
+// metadataValue returns the message's metadata value for key, ignoring the
+// key's case
+func (m Message) metadataValue(key string) (string, bool) {
+	if value, ok := m.Metadata[key]; ok {
+		return value, true
+	}
+	for k, value := range m.Metadata {
+		if strings.EqualFold(k, key) {
+			return value, true
+		}
+	}
+	return "", false
+}
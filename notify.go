@@ -0,0 +1,215 @@
+package smspit
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// Webhook formats
+const (
+	webhookFormatJSON     = "json"
+	webhookFormatSlack    = "slack"
+	webhookFormatDiscord  = "discord"
+	webhookFormatNtfy     = "ntfy"
+	webhookFormatPushover = "pushover"
+)
+
+// pushoverAPIURL is Pushover's message API. Pushover webhooks carry the
+// application token and user key as its token and user query parameters.
+const pushoverAPIURL = "https://api.pushover.net/1/messages.json"
+
+// pushoverMaxBody is Pushover's message length limit
+const pushoverMaxBody = 1024
+
+// notifyMaxBody keeps notification bodies under Slack's 3000 character
+// section limit (Discord allows 4096)
+const notifyMaxBody = 2900
+
+// webhookRequest returns the URL and JSON body to POST msg to a webhook of
+// the given format
+func (s *Server) webhookRequest(format, target string, msg Message) (string, []byte) {
+	var payload interface{}
+	switch format {
+	case webhookFormatSlack:
+		payload = s.slackPayload(msg)
+	case webhookFormatDiscord:
+		payload = s.discordPayload(msg)
+	case webhookFormatNtfy:
+		target, payload = s.ntfyPayload(target, msg)
+	case webhookFormatPushover:
+		target, payload = s.pushoverPayload(target, msg)
+	default:
+		payload = webhookPayload{Event: "message.captured", Message: msg}
+	}
+	body, _ := json.Marshal(payload)
+	return target, body
+}
+
+// validateNotifyURL checks that a push notification webhook URL names an
+// ntfy topic, or carries Pushover's credentials
+func validateNotifyURL(format string, u *url.URL) error {
+	switch format {
+	case webhookFormatNtfy:
+		if strings.Trim(u.Path, "/") == "" {
+			return fmt.Errorf("Invalid 'url' field (must be an ntfy topic URL, e.g. https://ntfy.sh/mytopic)")
+		}
+	case webhookFormatPushover:
+		if q := u.Query(); q.Get("token") == "" || q.Get("user") == "" {
+			return fmt.Errorf("Invalid 'url' field (must carry Pushover's token and user, e.g. %s?token=APP_TOKEN&user=USER_KEY)", pushoverAPIURL)
+		}
+	}
+	return nil
+}
+
+// pushTitle is the title of a push notification, leading with the
+// verification code, if any, so it shows on a locked screen
+func (s *Server) pushTitle(msg Message) string {
+	if code, _, ok := s.extractOTP(msg.text()); ok {
+		return "🔑 " + code + " · " + notifyTitle(msg)
+	}
+	return notifyTitle(msg)
+}
+
+// ntfyPayload formats a message for ntfy's JSON publishing, which is POSTed
+// to the server root with the topic in the body
+func (s *Server) ntfyPayload(target string, msg Message) (string, map[string]interface{}) {
+	u, _ := url.Parse(target)
+	topicPath := strings.TrimSuffix(u.Path, "/")
+	topic := path.Base(topicPath)
+	u.Path = path.Dir(topicPath)
+
+	return u.String(), map[string]interface{}{
+		"topic":   topic,
+		"title":   s.pushTitle(msg),
+		"message": truncate(msg.Body, notifyMaxBody),
+		"tags":    append([]string{"speech_balloon"}, msg.Tags...),
+	}
+}
+
+// maskedWebhookURL hides the credentials in a webhook URL for the API and
+// logs: a password, Pushover's token and user key, and the path of Slack,
+// Discord and ntfy URLs, which is their secret
+func maskedWebhookURL(format, target string) string {
+	u, err := url.Parse(target)
+	if err != nil {
+		return ""
+	}
+	switch format {
+	case webhookFormatSlack, webhookFormatDiscord, webhookFormatNtfy:
+		if strings.Trim(u.Path, "/") != "" {
+			u.Path, u.RawPath = "/REDACTED", ""
+		}
+	case webhookFormatPushover:
+		q := u.Query()
+		for _, key := range []string{"token", "user"} {
+			if q.Has(key) {
+				q.Set(key, "REDACTED")
+			}
+		}
+		u.RawQuery = q.Encode()
+	}
+	return u.Redacted()
+}
+
+// pushoverPayload formats a message for Pushover's message API, moving the
+// credentials from the webhook URL into the body
+func (s *Server) pushoverPayload(target string, msg Message) (string, map[string]interface{}) {
+	u, _ := url.Parse(target)
+	q := u.Query()
+	u.RawQuery = ""
+
+	payload := map[string]interface{}{
+		"token":     q.Get("token"),
+		"user":      q.Get("user"),
+		"title":     s.pushTitle(msg),
+		"message":   truncate(msg.Body, pushoverMaxBody-3),
+		"timestamp": msg.CreatedAt.Unix(),
+	}
+	if device := q.Get("device"); device != "" {
+		payload["device"] = device
+	}
+	return u.String(), payload
+}
+
+// notifyTitle headlines a message notification
+func notifyTitle(msg Message) string {
+	if msg.Direction == "inbound" {
+		return fmt.Sprintf("📥 SMS from %s to %s", msg.From, msg.To)
+	}
+	title := "📱 SMS to " + msg.To
+	if msg.From != "" {
+		title += " from " + msg.From
+	}
+	return title
+}
+
+// notifyDetails summarizes a message's project, tags and segments
+func notifyDetails(msg Message) string {
+	details := []string{"Project " + msg.Project}
+	if len(msg.Tags) > 0 {
+		details = append(details, "Tags "+strings.Join(msg.Tags, ", "))
+	}
+	details = append(details, fmt.Sprintf("%d segment(s), %s", msg.Segments, msg.Encoding), msg.ID)
+	return strings.Join(details, " · ")
+}
+
+// slackEscape escapes the characters Slack treats as markup
+func slackEscape(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
+
+// slackPayload formats a message as a Slack incoming webhook post, with any
+// verification code called out
+func (s *Server) slackPayload(msg Message) map[string]interface{} {
+	section := func(text string) map[string]interface{} {
+		return map[string]interface{}{
+			"type": "section",
+			"text": map[string]string{"type": "mrkdwn", "text": text},
+		}
+	}
+
+	quoted := "> " + strings.ReplaceAll(slackEscape(truncate(msg.Body, notifyMaxBody)), "\n", "\n> ")
+	blocks := []interface{}{section("*" + slackEscape(notifyTitle(msg)) + "*"), section(quoted)}
+	if code, _, ok := s.extractOTP(msg.text()); ok {
+		blocks = append(blocks, section("Code: `"+slackEscape(code)+"`"))
+	}
+	blocks = append(blocks, map[string]interface{}{
+		"type":     "context",
+		"elements": []interface{}{map[string]string{"type": "mrkdwn", "text": slackEscape(notifyDetails(msg))}},
+	})
+
+	return map[string]interface{}{
+		"text":   slackEscape(notifyTitle(msg) + ": " + truncate(msg.Body, 100)), // Shown in notifications
+		"blocks": blocks,
+	}
+}
+
+// discordPayload formats a message as a Discord webhook embed, with any
+// verification code called out. Mentions in the body don't ping anyone.
+func (s *Server) discordPayload(msg Message) map[string]interface{} {
+	fields := []interface{}{}
+	if code, _, ok := s.extractOTP(msg.text()); ok {
+		fields = append(fields, map[string]interface{}{"name": "Code", "value": "`" + code + "`", "inline": true})
+	}
+
+	color := 0x22c55e // Green for outbound, blue for inbound
+	if msg.Direction == "inbound" {
+		color = 0x3b82f6
+	}
+	return map[string]interface{}{
+		"username": "SMSpit",
+		"embeds": []interface{}{map[string]interface{}{
+			"title":       notifyTitle(msg),
+			"description": truncate(msg.Body, notifyMaxBody),
+			"color":       color,
+			"fields":      fields,
+			"footer":      map[string]string{"text": notifyDetails(msg)},
+			"timestamp":   msg.CreatedAt.Format(time.RFC3339),
+		}},
+		"allowed_mentions": map[string]interface{}{"parse": []string{}},
+	}
+}
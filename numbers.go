@@ -0,0 +1,519 @@
+package smspit
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// Phone number types
+const (
+	numberTypeLocal    = "local"
+	numberTypeMobile   = "mobile"
+	numberTypeTollFree = "toll-free"
+)
+
+// twilioNumberTypes maps AvailablePhoneNumbers list names to number types
+var twilioNumberTypes = map[string]string{
+	"Local":    numberTypeLocal,
+	"Mobile":   numberTypeMobile,
+	"TollFree": numberTypeTollFree,
+}
+
+// tollFreePrefixes are the NANP toll-free area codes
+var tollFreePrefixes = []string{"800", "833", "844", "855", "866", "877", "888"}
+
+// NumberCapabilities is what a provisioned number can be used for
+type NumberCapabilities struct {
+	SMS   bool `json:"sms"`
+	MMS   bool `json:"mms"`
+	Voice bool `json:"voice"`
+}
+
+// PhoneNumber is a fake provisioned number in the project's pool. Numbers
+// without an AccountSID are available to purchase through Twilio's
+// IncomingPhoneNumbers API.
+type PhoneNumber struct {
+	SID          string             `json:"sid"`
+	Number       string             `json:"number"`
+	Country      string             `json:"country"` // ISO code, e.g. US
+	Type         string             `json:"type"`    // local, mobile or toll-free
+	Capabilities NumberCapabilities `json:"capabilities"`
+	FriendlyName string             `json:"friendly_name"`
+	Project      string             `json:"project"`
+	// AccountSID is the Twilio account that purchased the number
+	AccountSID  string     `json:"account_sid,omitempty"`
+	SMSURL      string     `json:"sms_url,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	PurchasedAt *time.Time `json:"purchased_at,omitempty"`
+}
+
+// PhoneNumberRequest is the body for adding a number to the pool or
+// updating one. Omitted capabilities mean SMS, MMS and voice; an empty
+// account_sid on update releases the number.
+type PhoneNumberRequest struct {
+	Number       string              `json:"number"`
+	Country      string              `json:"country"`
+	Type         string              `json:"type"`
+	Capabilities *NumberCapabilities `json:"capabilities"`
+	FriendlyName string              `json:"friendly_name"`
+	AccountSID   *string             `json:"account_sid"`
+	SMSURL       string              `json:"sms_url"`
+}
+
+// numberStore holds the pool of provisioned numbers, in the order added
+type numberStore struct {
+	mu      sync.Mutex
+	numbers []*PhoneNumber
+}
+
+// newPhoneNumber validates req and fills in the country, type and friendly
+// name a provider would derive from the number
+func newPhoneNumber(req PhoneNumberRequest, project string) (*PhoneNumber, error) {
+	code, national, ok := splitCallingCode(req.Number)
+	if !ok || !e164Number.MatchString(req.Number) {
+		return nil, fmt.Errorf("Invalid 'number' field (must be E.164, e.g. +15551234567)")
+	}
+
+	country := strings.ToUpper(req.Country)
+	if country == "" {
+		if country = lookupCountries[code]; country == "" {
+			return nil, fmt.Errorf("Missing 'country' field (no default for +%s numbers)", code)
+		}
+	}
+	numberType := req.Type
+	if numberType == "" {
+		numberType = numberTypeLocal
+		for _, prefix := range tollFreePrefixes {
+			if code == "1" && strings.HasPrefix(national, prefix) {
+				numberType = numberTypeTollFree
+			}
+		}
+	}
+	if numberType != numberTypeLocal && numberType != numberTypeMobile && numberType != numberTypeTollFree {
+		return nil, fmt.Errorf("Invalid 'type' field (local, mobile or toll-free)")
+	}
+	capabilities := NumberCapabilities{SMS: true, MMS: true, Voice: true}
+	if req.Capabilities != nil {
+		capabilities = *req.Capabilities
+	}
+	friendlyName := req.FriendlyName
+	if friendlyName == "" {
+		friendlyName = nationalFormat(code, national)
+	}
+
+	number := &PhoneNumber{
+		SID:          "PN" + strings.ReplaceAll(uuid.New().String(), "-", ""),
+		Number:       req.Number,
+		Country:      country,
+		Type:         numberType,
+		Capabilities: capabilities,
+		FriendlyName: friendlyName,
+		Project:      project,
+		SMSURL:       req.SMSURL,
+		CreatedAt:    time.Now(),
+	}
+	if req.AccountSID != nil && *req.AccountSID != "" {
+		number.purchase(*req.AccountSID)
+	}
+	return number, nil
+}
+
+// purchase assigns the number to a Twilio account
+func (n *PhoneNumber) purchase(accountSID string) {
+	now := time.Now()
+	n.AccountSID = accountSID
+	n.PurchasedAt = &now
+}
+
+// release returns the number to the pool
+func (n *PhoneNumber) release() {
+	n.AccountSID = ""
+	n.PurchasedAt = nil
+	n.SMSURL = ""
+}
+
+// find returns the project's number with the given SID. Callers must hold mu.
+func (st *numberStore) find(project, sid string) *PhoneNumber {
+	for _, number := range st.numbers {
+		if number.Project == project && number.SID == sid {
+			return number
+		}
+	}
+	return nil
+}
+
+// handleListNumbers lists the project's numbers, optionally only those in
+// ?country= or only available (?available=true) or purchased ones
+func (s *Server) handleListNumbers(w http.ResponseWriter, r *http.Request) {
+	project := projectFromRequest(r)
+	q := r.URL.Query()
+	var available *bool
+	if v := q.Get("available"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "Invalid 'available' (true or false)", http.StatusBadRequest)
+			return
+		}
+		available = &b
+	}
+
+	s.numbers.mu.Lock()
+	defer s.numbers.mu.Unlock()
+
+	numbers := []*PhoneNumber{}
+	for _, number := range s.numbers.numbers {
+		if number.Project != project ||
+			(q.Get("country") != "" && !strings.EqualFold(number.Country, q.Get("country"))) ||
+			(available != nil && (number.AccountSID == "") != *available) {
+			continue
+		}
+		numbers = append(numbers, number)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"numbers": numbers,
+		"total":   len(numbers),
+	})
+}
+
+// handleCreateNumber adds a number to the project's pool
+func (s *Server) handleCreateNumber(w http.ResponseWriter, r *http.Request) {
+	var req PhoneNumberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	number, err := newPhoneNumber(req, projectFromRequest(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	defer s.syncRecords(kindNumbers)
+	s.numbers.mu.Lock()
+	defer s.numbers.mu.Unlock()
+	for _, existing := range s.numbers.numbers {
+		if existing.Project == number.Project && existing.Number == number.Number {
+			http.Error(w, "Number already in the pool", http.StatusConflict)
+			return
+		}
+	}
+	s.numbers.numbers = append(s.numbers.numbers, number)
+	log.Printf("☎️ Number added to pool: %s (%s, %s)", number.Number, number.Country, number.Type)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(number)
+}
+
+// handleGetNumber returns one of the project's numbers
+func (s *Server) handleGetNumber(w http.ResponseWriter, r *http.Request) {
+	s.numbers.mu.Lock()
+	defer s.numbers.mu.Unlock()
+
+	number := s.numbers.find(projectFromRequest(r), mux.Vars(r)["sid"])
+	if number == nil {
+		http.Error(w, "Number not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(number)
+}
+
+// handleUpdateNumber replaces a number's details. The number itself can't
+// change; account_sid purchases it for an account, or releases it when empty.
+func (s *Server) handleUpdateNumber(w http.ResponseWriter, r *http.Request) {
+	var req PhoneNumberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	defer s.syncRecords(kindNumbers)
+	s.numbers.mu.Lock()
+	defer s.numbers.mu.Unlock()
+
+	number := s.numbers.find(projectFromRequest(r), mux.Vars(r)["sid"])
+	if number == nil {
+		http.Error(w, "Number not found", http.StatusNotFound)
+		return
+	}
+	if req.Number != "" && req.Number != number.Number {
+		http.Error(w, "The 'number' field can't be changed", http.StatusBadRequest)
+		return
+	}
+	req.Number = number.Number
+	updated, err := newPhoneNumber(req, number.Project)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	updated.SID, updated.CreatedAt = number.SID, number.CreatedAt
+	if req.AccountSID == nil {
+		updated.AccountSID, updated.PurchasedAt = number.AccountSID, number.PurchasedAt
+	} else if *req.AccountSID == number.AccountSID {
+		updated.PurchasedAt = number.PurchasedAt
+	}
+	*number = *updated
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(number)
+}
+
+// handleDeleteNumber removes a number from the pool
+func (s *Server) handleDeleteNumber(w http.ResponseWriter, r *http.Request) {
+	project, sid := projectFromRequest(r), mux.Vars(r)["sid"]
+
+	defer s.syncRecords(kindNumbers)
+	s.numbers.mu.Lock()
+	defer s.numbers.mu.Unlock()
+
+	for i, number := range s.numbers.numbers {
+		if number.Project == project && number.SID == sid {
+			s.numbers.numbers = append(s.numbers.numbers[:i], s.numbers.numbers[i+1:]...)
+			log.Printf("☎️ Number removed from pool: %s", number.Number)
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
+			return
+		}
+	}
+
+	http.Error(w, "Number not found", http.StatusNotFound)
+}
+
+// twilioNumberResource renders a purchased number as a Twilio
+// IncomingPhoneNumber resource
+func twilioNumberResource(n *PhoneNumber) map[string]interface{} {
+	date := n.CreatedAt
+	if n.PurchasedAt != nil {
+		date = *n.PurchasedAt
+	}
+	return map[string]interface{}{
+		"sid":                    n.SID,
+		"account_sid":            n.AccountSID,
+		"friendly_name":          n.FriendlyName,
+		"phone_number":           n.Number,
+		"capabilities":           map[string]bool{"sms": n.Capabilities.SMS, "mms": n.Capabilities.MMS, "voice": n.Capabilities.Voice, "fax": false},
+		"sms_url":                n.SMSURL,
+		"sms_method":             "POST",
+		"status":                 "in-use",
+		"origin":                 "twilio",
+		"api_version":            "2010-04-01",
+		"address_requirements":   "none",
+		"beta":                   false,
+		"date_created":           date.Format(twilioDateFormat),
+		"date_updated":           date.Format(twilioDateFormat),
+		"uri":                    twilioAccountPath(n.Project, n.AccountSID) + "/IncomingPhoneNumbers/" + n.SID + ".json",
+		"emergency_status":       "Inactive",
+		"voice_receive_mode":     "voice",
+		"identity_sid":           nil,
+		"address_sid":            nil,
+		"bundle_sid":             nil,
+		"trunk_sid":              nil,
+		"voice_url":              nil,
+		"status_callback":        "",
+		"status_callback_method": "POST",
+	}
+}
+
+// availableNumberMatches reports whether an available number passes the
+// AvailablePhoneNumbers or purchase filters in q
+func availableNumberMatches(n *PhoneNumber, q map[string][]string) bool {
+	get := func(key string) string {
+		if v := q[key]; len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+	_, national, _ := splitCallingCode(n.Number)
+	for param, capable := range map[string]bool{"SmsEnabled": n.Capabilities.SMS, "MmsEnabled": n.Capabilities.MMS, "VoiceEnabled": n.Capabilities.Voice} {
+		if want, err := strconv.ParseBool(get(param)); err == nil && want && !capable {
+			return false
+		}
+	}
+	if areaCode := get("AreaCode"); areaCode != "" && !strings.HasPrefix(national, areaCode) {
+		return false
+	}
+	if contains := get("Contains"); contains != "" && !strings.Contains(n.Number, strings.ReplaceAll(contains, "*", "")) {
+		return false
+	}
+	return true
+}
+
+// handleTwilioAvailableNumbers lists the pool's available numbers in a
+// country and of a type, like Twilio's AvailablePhoneNumbers
+func (s *Server) handleTwilioAvailableNumbers(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	numberType, ok := twilioNumberTypes[vars["type"]]
+	if !ok {
+		writeTwilioError(w, twilioErrorCatalog[20404], r.URL.Path)
+		return
+	}
+	q := r.URL.Query()
+	limit := 50
+	if v, err := strconv.Atoi(q.Get("PageSize")); err == nil && v > 0 && v < limit {
+		limit = v
+	}
+
+	project := projectFromRequest(r)
+	s.numbers.mu.Lock()
+	available := []map[string]interface{}{}
+	for _, n := range s.numbers.numbers {
+		if len(available) == limit {
+			break
+		}
+		if n.Project != project || n.AccountSID != "" || n.Type != numberType ||
+			!strings.EqualFold(n.Country, vars["country"]) || !availableNumberMatches(n, q) {
+			continue
+		}
+		available = append(available, map[string]interface{}{
+			"friendly_name":        n.FriendlyName,
+			"phone_number":         n.Number,
+			"iso_country":          n.Country,
+			"address_requirements": "none",
+			"beta":                 false,
+			"capabilities":         map[string]bool{"SMS": n.Capabilities.SMS, "MMS": n.Capabilities.MMS, "voice": n.Capabilities.Voice},
+			"lata":                 nil,
+			"locality":             nil,
+			"rate_center":          nil,
+			"region":               nil,
+			"postal_code":          nil,
+			"latitude":             nil,
+			"longitude":            nil,
+		})
+	}
+	s.numbers.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"available_phone_numbers": available,
+		"uri":                     r.URL.RequestURI(),
+	})
+}
+
+// handleTwilioPurchaseNumber purchases a number from the pool for the
+// account: the one given by PhoneNumber, or the first available one in
+// AreaCode
+func (s *Server) handleTwilioPurchaseNumber(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeTwilioFormError(w, err)
+		return
+	}
+	phoneNumber, areaCode := r.FormValue("PhoneNumber"), r.FormValue("AreaCode")
+	if phoneNumber == "" && areaCode == "" {
+		writeTwilioError(w, twilioErrorCatalog[21421])
+		return
+	}
+
+	project := projectFromRequest(r)
+	defer s.syncRecords(kindNumbers)
+	s.numbers.mu.Lock()
+	defer s.numbers.mu.Unlock()
+
+	var number *PhoneNumber
+	for _, n := range s.numbers.numbers {
+		if n.Project != project || n.AccountSID != "" {
+			continue
+		}
+		if phoneNumber != "" && n.Number == phoneNumber ||
+			phoneNumber == "" && availableNumberMatches(n, map[string][]string{"AreaCode": {areaCode}}) {
+			number = n
+			break
+		}
+	}
+	if number == nil {
+		if phoneNumber != "" {
+			writeTwilioError(w, twilioErrorCatalog[21422], phoneNumber)
+		} else {
+			writeTwilioError(w, twilioErrorCatalog[21452], areaCode)
+		}
+		return
+	}
+
+	number.purchase(mux.Vars(r)["accountSid"])
+	if name := r.FormValue("FriendlyName"); name != "" {
+		number.FriendlyName = name
+	}
+	number.SMSURL = r.FormValue("SmsUrl")
+	log.Printf("☎️ Number purchased: %s by %s", number.Number, number.AccountSID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(twilioNumberResource(number))
+}
+
+// accountNumbers returns the project's numbers purchased by the account in
+// the path. Callers must hold s.numbers.mu.
+func (s *Server) accountNumbers(r *http.Request) []*PhoneNumber {
+	project, accountSID := projectFromRequest(r), mux.Vars(r)["accountSid"]
+	var numbers []*PhoneNumber
+	for _, n := range s.numbers.numbers {
+		if n.Project == project && n.AccountSID == accountSID {
+			numbers = append(numbers, n)
+		}
+	}
+	return numbers
+}
+
+// handleTwilioListIncomingNumbers lists the account's numbers, optionally
+// only PhoneNumber or those whose FriendlyName matches
+func (s *Server) handleTwilioListIncomingNumbers(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	s.numbers.mu.Lock()
+	var matched []*PhoneNumber
+	for _, n := range s.accountNumbers(r) {
+		if (q.Get("PhoneNumber") == "" || n.Number == q.Get("PhoneNumber")) &&
+			(q.Get("FriendlyName") == "" || n.FriendlyName == q.Get("FriendlyName")) {
+			matched = append(matched, n)
+		}
+	}
+	s.numbers.mu.Unlock()
+
+	writeTwilioPage(w, r, "incoming_phone_numbers", "/IncomingPhoneNumbers.json", len(matched), func(i int) map[string]interface{} {
+		return twilioNumberResource(matched[i])
+	})
+}
+
+// handleTwilioGetIncomingNumber fetches one of the account's numbers
+func (s *Server) handleTwilioGetIncomingNumber(w http.ResponseWriter, r *http.Request) {
+	s.numbers.mu.Lock()
+	defer s.numbers.mu.Unlock()
+
+	for _, n := range s.accountNumbers(r) {
+		if n.SID == mux.Vars(r)["numberSid"] {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(twilioNumberResource(n))
+			return
+		}
+	}
+	writeTwilioError(w, twilioErrorCatalog[20404], r.URL.Path)
+}
+
+// handleTwilioReleaseNumber releases one of the account's numbers back to
+// the pool
+func (s *Server) handleTwilioReleaseNumber(w http.ResponseWriter, r *http.Request) {
+	defer s.syncRecords(kindNumbers)
+	s.numbers.mu.Lock()
+	defer s.numbers.mu.Unlock()
+
+	for _, n := range s.accountNumbers(r) {
+		if n.SID == mux.Vars(r)["numberSid"] {
+			log.Printf("☎️ Number released: %s by %s", n.Number, n.AccountSID)
+			n.release()
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+	writeTwilioError(w, twilioErrorCatalog[20404], r.URL.Path)
+}
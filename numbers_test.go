@@ -0,0 +1,268 @@
+package smspit
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// addNumber adds a number to the pool, returning it
+func (ts *testServer) addNumber(t *testing.T, body string, header ...string) PhoneNumber {
+	t.Helper()
+	w := do(t, ts.web, "POST", "/api/v1/numbers", body, header...)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("add number: %d %s", w.Code, w.Body)
+	}
+	var number PhoneNumber
+	decode(t, w, &number)
+	return number
+}
+
+func TestNumberDefaults(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		want     PhoneNumber
+		wantCode int
+	}{
+		{
+			name: "US local",
+			body: `{"number":"+15551230001"}`,
+			want: PhoneNumber{Number: "+15551230001", Country: "US", Type: numberTypeLocal, FriendlyName: "(555) 123-0001",
+				Capabilities: NumberCapabilities{SMS: true, MMS: true, Voice: true}},
+		},
+		{
+			name: "US toll-free",
+			body: `{"number":"+18005550100"}`,
+			want: PhoneNumber{Number: "+18005550100", Country: "US", Type: numberTypeTollFree, FriendlyName: "(800) 555-0100",
+				Capabilities: NumberCapabilities{SMS: true, MMS: true, Voice: true}},
+		},
+		{
+			name: "explicit details",
+			body: `{"number":"+447700900123","type":"mobile","friendly_name":"Support","capabilities":{"sms":true},"account_sid":"AC1"}`,
+			want: PhoneNumber{Number: "+447700900123", Country: "GB", Type: numberTypeMobile, FriendlyName: "Support",
+				Capabilities: NumberCapabilities{SMS: true}, AccountSID: "AC1"},
+		},
+		{name: "not E.164", body: `{"number":"5551230001"}`, wantCode: http.StatusBadRequest},
+		{name: "unknown type", body: `{"number":"+15551230001","type":"satellite"}`, wantCode: http.StatusBadRequest},
+		{name: "invalid JSON", body: `{"number":`, wantCode: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t, Config{})
+			w := do(t, ts.web, "POST", "/api/v1/numbers", tt.body)
+			if tt.wantCode != 0 {
+				if w.Code != tt.wantCode {
+					t.Errorf("add: %d %s, want %d", w.Code, w.Body, tt.wantCode)
+				}
+				return
+			}
+			if w.Code != http.StatusCreated {
+				t.Fatalf("add: %d %s", w.Code, w.Body)
+			}
+			var got PhoneNumber
+			decode(t, w, &got)
+			if got.Number != tt.want.Number || got.Country != tt.want.Country || got.Type != tt.want.Type ||
+				got.FriendlyName != tt.want.FriendlyName || got.Capabilities != tt.want.Capabilities || got.AccountSID != tt.want.AccountSID {
+				t.Errorf("number %+v, want %+v", got, tt.want)
+			}
+			if !strings.HasPrefix(got.SID, "PN") || got.Project != defaultProject {
+				t.Errorf("SID %q in project %q", got.SID, got.Project)
+			}
+			if (got.PurchasedAt != nil) != (tt.want.AccountSID != "") {
+				t.Errorf("purchased_at %v with account_sid %q", got.PurchasedAt, got.AccountSID)
+			}
+		})
+	}
+}
+
+func TestNumberAPI(t *testing.T) {
+	ts := newTestServer(t, Config{})
+	local := ts.addNumber(t, `{"number":"+15551230001"}`)
+	ts.addNumber(t, `{"number":"+447700900123","account_sid":"AC1"}`)
+	other := ts.addNumber(t, `{"number":"+15551230001"}`, projectHeader, "other")
+
+	tests := []struct {
+		name, method, path, body string
+		header                   []string
+		want                     int
+		wantBody                 string
+	}{
+		{"duplicate", "POST", "/api/v1/numbers", `{"number":"+15551230001"}`, nil, http.StatusConflict, "already"},
+		{"list", "GET", "/api/v1/numbers", "", nil, http.StatusOK, `"total":2`},
+		{"list by country", "GET", "/api/v1/numbers?country=gb", "", nil, http.StatusOK, `"total":1`},
+		{"list available", "GET", "/api/v1/numbers?available=true", "", nil, http.StatusOK, `"number":"+15551230001"`},
+		{"list purchased", "GET", "/api/v1/numbers?available=false", "", nil, http.StatusOK, `"number":"+447700900123"`},
+		{"list with invalid available", "GET", "/api/v1/numbers?available=maybe", "", nil, http.StatusBadRequest, "available"},
+		{"list another project", "GET", "/api/v1/numbers", "", []string{projectHeader, "other"}, http.StatusOK, `"total":1`},
+		{"get", "GET", "/api/v1/numbers/" + local.SID, "", nil, http.StatusOK, local.SID},
+		{"get another project's number", "GET", "/api/v1/numbers/" + other.SID, "", nil, http.StatusNotFound, ""},
+		{"change the number", "PUT", "/api/v1/numbers/" + local.SID, `{"number":"+15551230002"}`, nil, http.StatusBadRequest, "number"},
+		{"update with an unknown type", "PUT", "/api/v1/numbers/" + local.SID, `{"type":"satellite"}`, nil, http.StatusBadRequest, "type"},
+		{"update another project's number", "PUT", "/api/v1/numbers/" + other.SID, `{}`, nil, http.StatusNotFound, ""},
+		{"delete another project's number", "DELETE", "/api/v1/numbers/" + other.SID, "", nil, http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := do(t, ts.web, tt.method, tt.path, tt.body, tt.header...)
+			if w.Code != tt.want || !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("%s %s: %d %s, want %d mentioning %q", tt.method, tt.path, w.Code, w.Body, tt.want, tt.wantBody)
+			}
+		})
+	}
+
+	// Updating purchases the number and keeps its SID; an empty account
+	// releases it again
+	var updated PhoneNumber
+	decode(t, do(t, ts.web, "PUT", "/api/v1/numbers/"+local.SID, `{"friendly_name":"Alerts","account_sid":"AC2"}`), &updated)
+	if updated.SID != local.SID || updated.FriendlyName != "Alerts" || updated.AccountSID != "AC2" || updated.PurchasedAt == nil {
+		t.Errorf("updated %+v", updated)
+	}
+	var released PhoneNumber
+	decode(t, do(t, ts.web, "PUT", "/api/v1/numbers/"+local.SID, `{"account_sid":""}`), &released)
+	if released.AccountSID != "" || released.PurchasedAt != nil {
+		t.Errorf("released %+v", released)
+	}
+
+	if w := do(t, ts.web, "DELETE", "/api/v1/numbers/"+local.SID, ""); w.Code != http.StatusOK {
+		t.Errorf("delete: %d", w.Code)
+	}
+	if w := do(t, ts.web, "GET", "/api/v1/numbers/"+local.SID, ""); w.Code != http.StatusNotFound {
+		t.Errorf("get after delete: %d, want 404", w.Code)
+	}
+}
+
+func TestTwilioAvailableNumbers(t *testing.T) {
+	ts := newTestServer(t, Config{TwilioCompat: true})
+	ts.addNumber(t, `{"number":"+15551230001"}`)
+	ts.addNumber(t, `{"number":"+15552340001","capabilities":{"sms":true}}`)
+	ts.addNumber(t, `{"number":"+15551239999","account_sid":"AC1"}`)
+	ts.addNumber(t, `{"number":"+18005550100"}`)
+	ts.addNumber(t, `{"number":"+447700900123","type":"mobile"}`)
+	ts.addNumber(t, `{"number":"+15551230002"}`, projectHeader, "other")
+
+	tests := []struct {
+		name      string
+		path      string
+		want      []string // Numbers listed, in order
+		wantError int      // Twilio error code, if any
+	}{
+		{name: "local", path: "US/Local.json", want: []string{"+15551230001", "+15552340001"}},
+		{name: "toll-free", path: "US/TollFree.json", want: []string{"+18005550100"}},
+		{name: "mobile, country in lower case", path: "gb/Mobile.json", want: []string{"+447700900123"}},
+		{name: "area code", path: "US/Local.json?AreaCode=555234", want: []string{"+15552340001"}},
+		{name: "contains", path: "US/Local.json?Contains=*0001", want: []string{"+15551230001", "+15552340001"}},
+		{name: "capability", path: "US/Local.json?VoiceEnabled=true", want: []string{"+15551230001"}},
+		{name: "page size", path: "US/Local.json?PageSize=1", want: []string{"+15551230001"}},
+		{name: "none", path: "CA/Local.json", want: []string{}},
+		{name: "unknown type", path: "US/Satellite.json", wantError: 20404},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := do(t, ts.api, "GET", "/2010-04-01/Accounts/AC1/AvailablePhoneNumbers/"+tt.path, "")
+			if tt.wantError != 0 {
+				var twilioErr TwilioError
+				decode(t, w, &twilioErr)
+				if twilioErr.Code != tt.wantError {
+					t.Errorf("got %d %s, want error %d", w.Code, w.Body, tt.wantError)
+				}
+				return
+			}
+			var resp struct {
+				Numbers []struct {
+					PhoneNumber string `json:"phone_number"`
+				} `json:"available_phone_numbers"`
+			}
+			decode(t, w, &resp)
+			got := []string{}
+			for _, n := range resp.Numbers {
+				got = append(got, n.PhoneNumber)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("available %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTwilioIncomingNumbers(t *testing.T) {
+	ts := newTestServer(t, Config{TwilioCompat: true})
+	ts.addNumber(t, `{"number":"+15551230001"}`)
+	ts.addNumber(t, `{"number":"+15552340001"}`)
+	form := []string{"Content-Type", "application/x-www-form-urlencoded"}
+	const path = "/2010-04-01/Accounts/AC1/IncomingPhoneNumbers"
+
+	tests := []struct {
+		name       string
+		body       string
+		want       int
+		wantNumber string
+		wantError  int
+	}{
+		{name: "no number or area code", body: "FriendlyName=Alerts", want: http.StatusBadRequest, wantError: 21421},
+		{name: "number not in the pool", body: "PhoneNumber=%2B15559990000", want: http.StatusBadRequest, wantError: 21422},
+		{name: "no number in the area code", body: "AreaCode=666", want: http.StatusBadRequest, wantError: 21452},
+		{name: "by number", body: "PhoneNumber=%2B15552340001&FriendlyName=Alerts", want: http.StatusCreated, wantNumber: "+15552340001"},
+		{name: "already purchased", body: "PhoneNumber=%2B15552340001", want: http.StatusBadRequest, wantError: 21422},
+		{name: "by area code", body: "AreaCode=555&SmsUrl=https%3A%2F%2Fexample.com%2Fsms", want: http.StatusCreated, wantNumber: "+15551230001"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := do(t, ts.api, "POST", path+".json", tt.body, form...)
+			if w.Code != tt.want {
+				t.Fatalf("purchase: %d %s, want %d", w.Code, w.Body, tt.want)
+			}
+			if tt.wantError != 0 {
+				var twilioErr TwilioError
+				decode(t, w, &twilioErr)
+				if twilioErr.Code != tt.wantError {
+					t.Errorf("error %d, want %d", twilioErr.Code, tt.wantError)
+				}
+				return
+			}
+			var resource struct {
+				PhoneNumber string `json:"phone_number"`
+				AccountSID  string `json:"account_sid"`
+			}
+			decode(t, w, &resource)
+			if resource.PhoneNumber != tt.wantNumber || resource.AccountSID != "AC1" {
+				t.Errorf("purchased %+v, want %s for AC1", resource, tt.wantNumber)
+			}
+		})
+	}
+
+	var list struct {
+		Numbers []struct {
+			SID          string `json:"sid"`
+			PhoneNumber  string `json:"phone_number"`
+			FriendlyName string `json:"friendly_name"`
+			SMSURL       string `json:"sms_url"`
+		} `json:"incoming_phone_numbers"`
+	}
+	decode(t, do(t, ts.api, "GET", path+".json?FriendlyName=Alerts", ""), &list)
+	if len(list.Numbers) != 1 || list.Numbers[0].PhoneNumber != "+15552340001" {
+		t.Fatalf("numbers named Alerts: %+v", list.Numbers)
+	}
+	sid := list.Numbers[0].SID
+	decode(t, do(t, ts.api, "GET", "/2010-04-01/Accounts/AC2/IncomingPhoneNumbers.json", ""), &list)
+	if len(list.Numbers) != 0 {
+		t.Errorf("another account lists %+v", list.Numbers)
+	}
+
+	if w := do(t, ts.api, "GET", path+"/"+sid+".json", ""); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"friendly_name":"Alerts"`) {
+		t.Errorf("fetch: %d %s", w.Code, w.Body)
+	}
+	if w := do(t, ts.api, "GET", "/2010-04-01/Accounts/AC2/IncomingPhoneNumbers/"+sid+".json", ""); w.Code != http.StatusNotFound {
+		t.Errorf("fetch from another account: %d, want 404", w.Code)
+	}
+	if w := do(t, ts.api, "DELETE", path+"/"+sid+".json", ""); w.Code != http.StatusNoContent {
+		t.Errorf("release: %d", w.Code)
+	}
+	if w := do(t, ts.api, "DELETE", path+"/"+sid+".json", ""); w.Code != http.StatusNotFound {
+		t.Errorf("release again: %d, want 404", w.Code)
+	}
+	// A released number is available to purchase again
+	if w := do(t, ts.api, "POST", path+".json", "PhoneNumber=%2B15552340001", form...); w.Code != http.StatusCreated {
+		t.Errorf("purchase the released number: %d %s", w.Code, w.Body)
+	}
+}
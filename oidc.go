@@ -0,0 +1,344 @@
+package smspit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+const (
+	sessionCookie    = "smspit_session"
+	loginStateCookie = "smspit_login"
+	oidcSessionTTL   = 12 * time.Hour
+	oidcLoginTTL     = 10 * time.Minute
+)
+
+// oidcAuth signs dashboard users in with an OpenID Connect provider and
+// keeps their sessions in memory
+type oidcAuth struct {
+	mu       sync.Mutex
+	provider *oidc.Provider // Discovered on first login
+	logins   map[string]oidcLogin
+	sessions map[string]oidcSession
+}
+
+// oidcLogin is a login waiting for the provider's callback, keyed by state
+type oidcLogin struct {
+	nonce       string
+	verifier    string // PKCE code verifier
+	redirectURL string
+	next        string
+	expires     time.Time
+}
+
+// oidcSession is a signed-in user, keyed by the session cookie
+type oidcSession struct {
+	token   *APIToken
+	expires time.Time
+}
+
+// parseOIDCRoles parses SMSPIT_OIDC_ROLES ("admins=full,qa=read-only") into
+// a map from group to role
+func parseOIDCRoles(val string) map[string]string {
+	roles := make(map[string]string)
+	for _, entry := range strings.Split(val, ",") {
+		group, role, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if _, known := tokenRoles[role]; !ok || !known || group == "" {
+			if entry != "" {
+				log.Printf("⚠️ Ignoring invalid OIDC role mapping %q (use group=read-only or group=full)", entry)
+			}
+			continue
+		}
+		roles[group] = role
+	}
+	return roles
+}
+
+// randomString returns n random bytes, hex encoded
+func randomString(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// oidcConfig returns the OAuth2 client config, discovering the provider
+// the first time. Discovery isn't tied to a request because the provider
+// keeps using its context to refresh signing keys.
+func (s *Server) oidcConfig(redirectURL string) (*oauth2.Config, error) {
+	s.oidc.mu.Lock()
+	defer s.oidc.mu.Unlock()
+	if s.oidc.provider == nil {
+		provider, err := oidc.NewProvider(context.Background(), s.config.OIDCIssuer)
+		if err != nil {
+			return nil, err
+		}
+		s.oidc.provider = provider
+	}
+	return &oauth2.Config{
+		ClientID:     s.config.OIDCClientID,
+		ClientSecret: s.config.OIDCClientSecret,
+		Endpoint:     s.oidc.provider.Endpoint(),
+		RedirectURL:  redirectURL,
+		Scopes:       s.config.OIDCScopes,
+	}, nil
+}
+
+// externalURL returns the browser-facing URL of path under SMSPIT_WEBROOT
+func (s *Server) externalURL(r *http.Request, path string) string {
+	scheme := "http"
+	if r.TLS != nil || (s.fromTrustedProxy(r) && r.Header.Get("X-Forwarded-Proto") == "https") {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + s.config.WebRoot + path
+}
+
+// fromTrustedProxy reports whether the request came through a trusted proxy
+func (s *Server) fromTrustedProxy(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	return err == nil && s.trustedProxy(host)
+}
+
+// safeNext returns a post-login path, refusing anything but local paths
+func safeNext(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
+
+// handleOIDCLogin redirects to the provider's login page. ?next= is where
+// to return afterwards.
+func (s *Server) handleOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	redirectURL := s.config.OIDCRedirectURL
+	if redirectURL == "" {
+		redirectURL = s.externalURL(r, "/auth/callback")
+	}
+	config, err := s.oidcConfig(redirectURL)
+	if err != nil {
+		log.Printf("⚠️ OIDC discovery failed for %s: %v", s.config.OIDCIssuer, err)
+		http.Error(w, "Identity provider unavailable", http.StatusBadGateway)
+		return
+	}
+
+	state := randomString(16)
+	login := oidcLogin{
+		nonce:       randomString(16),
+		verifier:    oauth2.GenerateVerifier(),
+		redirectURL: redirectURL,
+		next:        safeNext(r.URL.Query().Get("next")),
+		expires:     time.Now().Add(oidcLoginTTL),
+	}
+	s.oidc.mu.Lock()
+	for k, l := range s.oidc.logins {
+		if time.Now().After(l.expires) {
+			delete(s.oidc.logins, k)
+		}
+	}
+	s.oidc.logins[state] = login
+	s.oidc.mu.Unlock()
+	s.syncRecords(kindSSOLogins)
+
+	// The cookie ties the callback to this browser
+	http.SetCookie(w, &http.Cookie{
+		Name:     loginStateCookie,
+		Value:    state,
+		Path:     s.config.WebRoot + "/auth/",
+		MaxAge:   int(oidcLoginTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(redirectURL, "https:"),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, config.AuthCodeURL(state, oidc.Nonce(login.nonce), oauth2.S256ChallengeOption(login.verifier)), http.StatusFound)
+}
+
+// handleOIDCCallback completes a login: it exchanges the code, verifies
+// the ID token, maps the user's groups to a role and starts a session
+func (s *Server) handleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		http.Error(w, "Login failed: "+e+" "+q.Get("error_description"), http.StatusUnauthorized)
+		return
+	}
+
+	state := q.Get("state")
+	cookie, err := r.Cookie(loginStateCookie)
+	if err != nil || cookie.Value != state {
+		http.Error(w, "Login state mismatch, please sign in again", http.StatusBadRequest)
+		return
+	}
+	s.oidc.mu.Lock()
+	login, ok := s.oidc.logins[state]
+	delete(s.oidc.logins, state)
+	s.oidc.mu.Unlock()
+	s.syncRecords(kindSSOLogins)
+	if !ok || time.Now().After(login.expires) {
+		http.Error(w, "Login expired, please sign in again", http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: loginStateCookie, Path: s.config.WebRoot + "/auth/", MaxAge: -1})
+
+	config, err := s.oidcConfig(login.redirectURL)
+	if err != nil {
+		http.Error(w, "Identity provider unavailable", http.StatusBadGateway)
+		return
+	}
+	oauthToken, err := config.Exchange(r.Context(), q.Get("code"), oauth2.VerifierOption(login.verifier))
+	if err != nil {
+		log.Printf("⚠️ OIDC code exchange failed: %v", err)
+		http.Error(w, "Login failed: could not exchange the authorization code", http.StatusUnauthorized)
+		return
+	}
+	rawIDToken, _ := oauthToken.Extra("id_token").(string)
+	idToken, err := s.oidc.provider.Verifier(&oidc.Config{ClientID: s.config.OIDCClientID}).Verify(r.Context(), rawIDToken)
+	if err != nil || idToken.Nonce != login.nonce {
+		log.Printf("⚠️ OIDC ID token rejected: %v", err)
+		http.Error(w, "Login failed: invalid ID token", http.StatusUnauthorized)
+		return
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		http.Error(w, "Login failed: invalid ID token claims", http.StatusUnauthorized)
+		return
+	}
+	user := idToken.Subject
+	for _, claim := range []string{"email", "preferred_username", "name"} {
+		if v, ok := claims[claim].(string); ok && v != "" {
+			user = v
+			break
+		}
+	}
+	role := s.oidcRole(claimStrings(claims[s.config.OIDCGroupsClaim]))
+	if role == "" {
+		log.Printf("🔐 SSO login refused for %s: no group maps to a role", user)
+		http.Error(w, "Your account has no SMSpit role", http.StatusForbidden)
+		return
+	}
+
+	id := randomString(32)
+	session := oidcSession{
+		token: &APIToken{
+			ID:        "sso_" + randomString(4),
+			Name:      user,
+			Scopes:    tokenRoles[role],
+			CreatedAt: time.Now(),
+		},
+		expires: time.Now().Add(oidcSessionTTL),
+	}
+	s.oidc.mu.Lock()
+	for k, sess := range s.oidc.sessions {
+		if time.Now().After(sess.expires) {
+			delete(s.oidc.sessions, k)
+		}
+	}
+	s.oidc.sessions[id] = session
+	s.oidc.mu.Unlock()
+	s.syncRecords(kindSSOSessions)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    id,
+		Path:     s.config.WebRoot + "/",
+		MaxAge:   int(oidcSessionTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(login.redirectURL, "https:"),
+		SameSite: http.SameSiteLaxMode,
+	})
+	log.Printf("🔐 SSO login: %s (%s)", user, role)
+	http.Redirect(w, r, s.config.WebRoot+login.next, http.StatusFound)
+}
+
+// oidcRole returns the role for a user's groups: full if any group maps to
+// it, else read-only if any does, else SMSPIT_OIDC_DEFAULT_ROLE ("" to refuse)
+func (s *Server) oidcRole(groups []string) string {
+	role := ""
+	for _, group := range groups {
+		switch s.config.OIDCRoles[group] {
+		case roleFull:
+			return roleFull
+		case roleReadOnly:
+			role = roleReadOnly
+		}
+	}
+	if role == "" {
+		if _, ok := tokenRoles[s.config.OIDCDefaultRole]; ok {
+			role = s.config.OIDCDefaultRole
+		}
+	}
+	return role
+}
+
+// claimStrings reads a claim holding a string or a list of strings
+func claimStrings(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var out []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// handleOIDCLogout ends the session
+func (s *Server) handleOIDCLogout(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		s.oidc.mu.Lock()
+		delete(s.oidc.sessions, cookie.Value)
+		s.oidc.mu.Unlock()
+		s.syncRecords(kindSSOSessions)
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: s.config.WebRoot + "/", MaxAge: -1})
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, `<!DOCTYPE html><title>SMSpit</title><p>Signed out. <a href="%s">Sign in again</a></p>`, html.EscapeString(s.config.WebRoot+"/auth/login"))
+}
+
+// sessionToken returns the token of the request's SSO session, if any
+func (s *Server) sessionToken(r *http.Request) (*APIToken, bool) {
+	if s.oidc == nil {
+		return nil, false
+	}
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return nil, false
+	}
+	s.oidc.mu.Lock()
+	defer s.oidc.mu.Unlock()
+	session, ok := s.oidc.sessions[cookie.Value]
+	if !ok || time.Now().After(session.expires) {
+		return nil, false
+	}
+	return session.token, true
+}
+
+// loginRequired sends browsers without a session or token to the SSO login
+// page when SSO is enabled
+func (s *Server) loginRequired(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.oidc != nil {
+			if _, ok := s.authenticate(r); !ok {
+				http.Redirect(w, r, s.config.WebRoot+"/auth/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
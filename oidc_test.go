@@ -0,0 +1,248 @@
+package smspit
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeOIDC is an OpenID Connect provider that signs in whoever asks, with
+// the groups the test gives them
+type fakeOIDC struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu     sync.Mutex
+	groups []string
+	nonce  string // Overrides the login's nonce when set
+	codes  map[string]string
+}
+
+func newFakeOIDC(t *testing.T) *fakeOIDC {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &fakeOIDC{key: key, codes: make(map[string]string)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                p.URL,
+			"authorization_endpoint":                p.URL + "/authorize",
+			"token_endpoint":                        p.URL + "/token",
+			"jwks_uri":                              p.URL + "/keys",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"alg": "RS256",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		p.mu.Lock()
+		nonce, ok := p.codes[r.Form.Get("code")]
+		if p.nonce != "" {
+			nonce = p.nonce
+		}
+		claims := map[string]interface{}{
+			"iss":    p.URL,
+			"sub":    "u1",
+			"aud":    "smspit",
+			"exp":    time.Now().Add(time.Hour).Unix(),
+			"iat":    time.Now().Unix(),
+			"nonce":  nonce,
+			"email":  "alice@example.com",
+			"groups": p.groups,
+		}
+		p.mu.Unlock()
+		if !ok || r.Form.Get("code_verifier") == "" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "at",
+			"token_type":   "Bearer",
+			"id_token":     p.sign(t, claims),
+		})
+	})
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+// sign returns claims as an RS256 JWT
+func (p *fakeOIDC) sign(t *testing.T, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// login starts a login at SMSpit and returns the state and its cookie,
+// registering a code for the login's nonce with the provider
+func (p *fakeOIDC) login(t *testing.T, ts *testServer, next string) (state, cookie string) {
+	t.Helper()
+	w := do(t, ts.web, "GET", "/auth/login?next="+url.QueryEscape(next), "")
+	if w.Code != http.StatusFound {
+		t.Fatalf("login: %d %s", w.Code, w.Body)
+	}
+	authorize, err := url.Parse(w.Header().Get("Location"))
+	if err != nil || !strings.HasPrefix(authorize.String(), p.URL+"/authorize") {
+		t.Fatalf("login redirects to %q", w.Header().Get("Location"))
+	}
+	q := authorize.Query()
+	if q.Get("client_id") != "smspit" || q.Get("code_challenge_method") != "S256" || q.Get("nonce") == "" {
+		t.Errorf("authorization request %v", q)
+	}
+	p.mu.Lock()
+	p.codes["code-"+q.Get("state")] = q.Get("nonce")
+	p.mu.Unlock()
+	return q.Get("state"), loginStateCookie + "=" + q.Get("state")
+}
+
+func newOIDCServer(t *testing.T, p *fakeOIDC, defaultRole string) *testServer {
+	return newTestServer(t, Config{
+		OIDCIssuer:      p.URL,
+		OIDCClientID:    "smspit",
+		OIDCRoles:       map[string]string{"admins": roleFull, "qa": roleReadOnly},
+		OIDCDefaultRole: defaultRole,
+	})
+}
+
+func TestOIDCLogin(t *testing.T) {
+	tests := []struct {
+		name        string
+		groups      []string
+		defaultRole string
+		want        string // Role, or "" when the login is refused
+	}{
+		{"full group", []string{"qa", "admins"}, "none", roleFull},
+		{"read-only group", []string{"qa"}, "none", roleReadOnly},
+		{"no mapped group", []string{"sales"}, "none", ""},
+		{"no mapped group, default role", []string{"sales"}, roleReadOnly, roleReadOnly},
+		{"no groups claim", nil, "none", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newFakeOIDC(t)
+			p.groups = tt.groups
+			ts := newOIDCServer(t, p, tt.defaultRole)
+
+			state, cookie := p.login(t, ts, "/?tab=inbox")
+			w := do(t, ts.web, "GET", "/auth/callback?state="+state+"&code=code-"+state, "", "Cookie", cookie)
+			if tt.want == "" {
+				if w.Code != http.StatusForbidden {
+					t.Fatalf("callback: %d %s, want 403", w.Code, w.Body)
+				}
+				return
+			}
+			if w.Code != http.StatusFound || w.Header().Get("Location") != "/?tab=inbox" {
+				t.Fatalf("callback: %d to %q, want a redirect to /?tab=inbox", w.Code, w.Header().Get("Location"))
+			}
+			var session string
+			for _, c := range w.Result().Cookies() {
+				if c.Name == sessionCookie {
+					session = sessionCookie + "=" + c.Value
+				}
+			}
+			if session == "" {
+				t.Fatal("callback set no session cookie")
+			}
+
+			if w := do(t, ts.web, "GET", "/api/v1/messages", "", "Cookie", session); w.Code != http.StatusOK {
+				t.Errorf("list messages with the session: %d", w.Code)
+			}
+			wantDelete := http.StatusOK
+			if tt.want == roleReadOnly {
+				wantDelete = http.StatusForbidden
+			}
+			if w := do(t, ts.web, "DELETE", "/api/v1/messages", "", "Cookie", session); w.Code != wantDelete {
+				t.Errorf("delete messages as %s: %d, want %d", tt.want, w.Code, wantDelete)
+			}
+
+			do(t, ts.web, "POST", "/auth/logout", "", "Cookie", session)
+			if w := do(t, ts.web, "GET", "/api/v1/messages", "", "Cookie", session); w.Code != http.StatusUnauthorized {
+				t.Errorf("list messages after logout: %d, want 401", w.Code)
+			}
+		})
+	}
+}
+
+func TestOIDCCallbackRejected(t *testing.T) {
+	p := newFakeOIDC(t)
+	p.groups = []string{"admins"}
+
+	tests := []struct {
+		name  string
+		query func(state string) string
+		nonce string // The ID token's nonce, when not the login's
+		want  int
+	}{
+		{"state mismatch", func(state string) string { return "state=other&code=code-" + state }, "", http.StatusBadRequest},
+		{"provider error", func(string) string { return "error=access_denied" }, "", http.StatusUnauthorized},
+		{"unknown code", func(state string) string { return "state=" + state + "&code=bad" }, "", http.StatusUnauthorized},
+		{"nonce mismatch", func(state string) string { return "state=" + state + "&code=code-" + state }, "replayed", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newOIDCServer(t, p, "none")
+			p.mu.Lock()
+			p.nonce = tt.nonce
+			p.mu.Unlock()
+			state, cookie := p.login(t, ts, "/")
+			w := do(t, ts.web, "GET", "/auth/callback?"+tt.query(state), "", "Cookie", cookie)
+			if w.Code != tt.want {
+				t.Errorf("callback: %d %s, want %d", w.Code, w.Body, tt.want)
+			}
+			for _, c := range w.Result().Cookies() {
+				if c.Name == sessionCookie && c.MaxAge >= 0 {
+					t.Errorf("rejected callback set a session")
+				}
+			}
+		})
+	}
+}
+
+func TestOIDCLoginRequired(t *testing.T) {
+	p := newFakeOIDC(t)
+	ts := newOIDCServer(t, p, "none")
+
+	w := do(t, ts.web, "GET", "/?tab=inbox", "")
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/auth/login?next=%2F%3Ftab%3Dinbox" {
+		t.Errorf("dashboard without a session: %d to %q, want the login page", w.Code, w.Header().Get("Location"))
+	}
+	if w := do(t, ts.web, "GET", "/api/v1/messages", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("API without a session: %d, want 401", w.Code)
+	}
+	// Only local paths are returned to after login
+	for _, next := range []string{"https://evil.example", "//evil.example", "/\\evil.example"} {
+		if got := safeNext(next); got != "/" {
+			t.Errorf("safeNext(%q) = %q, want /", next, got)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package smspit
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+)
+
+// handleOpenAPI serves the embedded OpenAPI document. Capture endpoints are
+// tagged x-smspit-server: api and get a per-path server pointing at the API
+// port on the host the request came in on (unless everything shares one port).
+// The web server URL includes SMSPIT_WEBROOT.
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	raw, err := staticFiles.ReadFile("static/openapi.json")
+	if err != nil {
+		http.Error(w, "OpenAPI document not found", http.StatusInternalServerError)
+		return
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		http.Error(w, "Invalid OpenAPI document: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if s.config.WebRoot != "" {
+		doc["servers"] = []map[string]string{{"url": s.config.WebRoot, "description": "Web UI and REST API"}}
+	}
+
+	host := r.Host
+	if h, _, err := net.SplitHostPort(r.Host); err == nil {
+		host = h
+	}
+	scheme := requestScheme(r)
+	apiServer := []map[string]string{{
+		"url":         scheme + "://" + net.JoinHostPort(host, s.config.APIPort),
+		"description": "Capture API",
+	}}
+
+	if paths, ok := doc["paths"].(map[string]interface{}); ok {
+		for _, item := range paths {
+			item, ok := item.(map[string]interface{})
+			if !ok || item["x-smspit-server"] != "api" {
+				continue
+			}
+			delete(item, "x-smspit-server")
+			if !s.config.SinglePort {
+				item["servers"] = apiServer
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(doc)
+}
+
+// handleAPIDocs serves the Swagger UI page
+func (s *Server) handleAPIDocs(w http.ResponseWriter, r *http.Request) {
+	page, err := staticFiles.ReadFile("static/docs.html")
+	if err != nil {
+		http.Error(w, "Docs not found", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(page)
+}
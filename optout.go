@@ -0,0 +1,280 @@
+package smspit
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Keyword types reported to the inbound webhook as OptOutType
+const (
+	keywordStop  = "STOP"
+	keywordStart = "START"
+	keywordHelp  = "HELP"
+)
+
+// optOutKeywords maps the carrier keywords Twilio handles by default to
+// their type. An inbound message is a keyword only if it is nothing else.
+var optOutKeywords = map[string]string{
+	"STOP":        keywordStop,
+	"STOPALL":     keywordStop,
+	"UNSUBSCRIBE": keywordStop,
+	"CANCEL":      keywordStop,
+	"END":         keywordStop,
+	"QUIT":        keywordStop,
+	"START":       keywordStart,
+	"YES":         keywordStart,
+	"UNSTOP":      keywordStart,
+	"HELP":        keywordHelp,
+	"INFO":        keywordHelp,
+}
+
+// optOutResponses are Twilio's default replies to each keyword type
+var optOutResponses = map[string]string{
+	keywordStop:  "You have successfully been unsubscribed. You will not receive any more messages from this number. Reply START to resubscribe.",
+	keywordStart: "You have successfully been re-subscribed to messages from this number. Reply HELP for help. Reply STOP to unsubscribe. Msg&Data Rates May Apply.",
+	keywordHelp:  "Reply STOP to unsubscribe. Msg&Data Rates May Apply.",
+}
+
+// OptOut is a recipient who no longer accepts messages from a sender
+type OptOut struct {
+	Number    string    `json:"number"` // The recipient who opted out
+	Sender    string    `json:"sender"` // The number they opted out of
+	Project   string    `json:"project"`
+	Keyword   string    `json:"keyword"` // What they texted, e.g. STOP; empty when added through the API
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OptOutRequest is the body for adding an opt-out through the API
+type OptOutRequest struct {
+	Number string `json:"number"`
+	Sender string `json:"sender"`
+}
+
+// optOutStore holds the opt-outs, keyed by project, sender and recipient
+type optOutStore struct {
+	mu      sync.Mutex
+	optOuts map[string]*OptOut
+}
+
+// optOutKey identifies a sender/recipient pair, ignoring number formatting
+func optOutKey(project, sender, number string) string {
+	return project + "|" + numberDigits(sender) + "|" + numberDigits(number)
+}
+
+// keywordType returns the keyword type of an inbound message body, if it is
+// one of the carrier keywords
+func keywordType(body string) (string, bool) {
+	keyword := strings.ToUpper(strings.Trim(body, " \t\r\n.!"))
+	kind, ok := optOutKeywords[keyword]
+	return kind, ok
+}
+
+// add records that number opted out of messages from sender
+func (st *optOutStore) add(optOut *OptOut) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.optOuts == nil {
+		st.optOuts = make(map[string]*OptOut)
+	}
+	st.optOuts[optOutKey(optOut.Project, optOut.Sender, optOut.Number)] = optOut
+}
+
+// remove lifts number's opt-out of sender, reporting whether there was one
+func (st *optOutStore) remove(project, sender, number string) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	key := optOutKey(project, sender, number)
+	_, ok := st.optOuts[key]
+	delete(st.optOuts, key)
+	return ok
+}
+
+// optedOut reports whether number opted out of messages from sender. With no
+// sender (e.g. a Messaging Service send) any opt-out of number counts.
+func (st *optOutStore) optedOut(project, sender, number string) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if sender != "" {
+		_, ok := st.optOuts[optOutKey(project, sender, number)]
+		return ok
+	}
+	digits := numberDigits(number)
+	for _, optOut := range st.optOuts {
+		if optOut.Project == project && numberDigits(optOut.Number) == digits {
+			return true
+		}
+	}
+	return false
+}
+
+// handleKeyword simulates the carrier's handling of an inbound STOP, START
+// or HELP: the opt-out list is updated and the standard response is
+// captured as an outbound message
+func (s *Server) handleKeyword(inbound Message) {
+	if !s.config.OptOutKeywords || inbound.Direction != "inbound" {
+		return
+	}
+	kind, ok := keywordType(inbound.text())
+	if !ok {
+		return
+	}
+
+	switch kind {
+	case keywordStop:
+		s.optOuts.add(&OptOut{
+			Number:    inbound.From,
+			Sender:    inbound.To,
+			Project:   inbound.Project,
+			Keyword:   strings.ToUpper(strings.TrimSpace(inbound.text())),
+			CreatedAt: time.Now(),
+		})
+		log.Printf("🛑 Opt-out recorded: From=%s To=%s", inbound.From, inbound.To)
+	case keywordStart:
+		if s.optOuts.remove(inbound.Project, inbound.To, inbound.From) {
+			log.Printf("✅ Opt-out lifted: From=%s To=%s", inbound.From, inbound.To)
+		}
+	}
+	s.syncRecords(kindOptOuts)
+
+	response := Message{
+		ID:         "SM" + strings.ReplaceAll(uuid.New().String(), "-", ""),
+		To:         inbound.From,
+		From:       inbound.To,
+		Body:       optOutResponses[kind],
+		Tags:       []string{"opt-out"},
+		Status:     "captured",
+		CreatedAt:  time.Now(),
+		AccountSID: inbound.AccountSID,
+		Project:    inbound.Project,
+
+		autoReplies: inbound.autoReplies,
+	}
+	if err := s.captureMessage(&response); err != nil {
+		return
+	}
+	log.Printf("📱 SMS captured (%s response): To=%s Body=%s", kind, response.To, truncate(response.Body, 50))
+}
+
+// optOutMiddleware rejects capture requests to recipients who opted out of
+// the sender, with Twilio's error 21610 in the provider's error format
+func (s *Server) optOutMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		read := r.Method == "GET" && r.URL.Query().Get("Action") == "" && r.URL.Path != s.config.KannelPath
+		if r.Method == "OPTIONS" || read || isPublicPath(r.URL.Path) || strings.HasPrefix(r.URL.Path, "/v2/Services/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		s.optOuts.mu.Lock()
+		active := len(s.optOuts.optOuts) > 0
+		s.optOuts.mu.Unlock()
+		if !active {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		to, from := requestParties(r)
+		sender := ""
+		if len(from) > 0 {
+			sender = strings.TrimSpace(from[0])
+		}
+		project := projectFromRequest(r)
+		for _, number := range to {
+			number = strings.TrimSpace(number)
+			if s.optOuts.optedOut(project, sender, number) {
+				log.Printf("🛑 Send to opted-out recipient rejected: From=%s To=%s", sender, number)
+				entry := twilioErrorCatalog[21610]
+				writeProviderError(w, r, entry.Status, entry.Code, fmt.Sprintf(entry.Message, number), 0)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleListOptOuts lists the project's opt-outs, oldest first
+func (s *Server) handleListOptOuts(w http.ResponseWriter, r *http.Request) {
+	project := projectFromRequest(r)
+
+	s.optOuts.mu.Lock()
+	optOuts := []*OptOut{}
+	for _, optOut := range s.optOuts.optOuts {
+		if optOut.Project == project {
+			optOuts = append(optOuts, optOut)
+		}
+	}
+	s.optOuts.mu.Unlock()
+	sort.Slice(optOuts, func(i, j int) bool { return optOuts[i].CreatedAt.Before(optOuts[j].CreatedAt) })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"opt_outs": optOuts,
+		"total":    len(optOuts),
+	})
+}
+
+// handleCreateOptOut opts a recipient out of a sender without simulating
+// their STOP
+func (s *Server) handleCreateOptOut(w http.ResponseWriter, r *http.Request) {
+	var req OptOutRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if numberDigits(req.Number) == "" || numberDigits(req.Sender) == "" {
+		http.Error(w, "Missing 'number' or 'sender' field", http.StatusBadRequest)
+		return
+	}
+
+	optOut := &OptOut{
+		Number:    req.Number,
+		Sender:    req.Sender,
+		Project:   projectFromRequest(r),
+		CreatedAt: time.Now(),
+	}
+	s.optOuts.add(optOut)
+	s.syncRecords(kindOptOuts)
+	log.Printf("🛑 Opt-out added: Number=%s Sender=%s", optOut.Number, optOut.Sender)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(optOut)
+}
+
+// handleClearOptOuts removes the project's opt-outs, or only those of the
+// recipient given by ?number= (and sender by ?sender=)
+func (s *Server) handleClearOptOuts(w http.ResponseWriter, r *http.Request) {
+	project := projectFromRequest(r)
+	number := numberDigits(r.URL.Query().Get("number"))
+	sender := numberDigits(r.URL.Query().Get("sender"))
+
+	s.optOuts.mu.Lock()
+	removed := 0
+	for key, optOut := range s.optOuts.optOuts {
+		if optOut.Project != project ||
+			(number != "" && numberDigits(optOut.Number) != number) ||
+			(sender != "" && numberDigits(optOut.Sender) != sender) {
+			continue
+		}
+		delete(s.optOuts.optOuts, key)
+		removed++
+	}
+	s.optOuts.mu.Unlock()
+	s.syncRecords(kindOptOuts)
+	log.Printf("🛑 Opt-outs cleared: %d removed", removed)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "cleared",
+		"removed": removed,
+	})
+}
@@ -0,0 +1,127 @@
+package smspit
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// minOTPLength is the shortest code the built-in patterns will accept
+const minOTPLength = 4
+
+// builtinOTPPatterns are tried in order after any configured patterns. The
+// first capture group holds the code.
+var builtinOTPPatterns = []*regexp.Regexp{
+	// "Your code is 123456", "OTP: 1234", "PIN 987654"
+	regexp.MustCompile(`(?i)\b(?:code|otp|pin|passcode|password|token)\b\D{0,20}?\b(\d{4,8})\b`),
+	// "123-456" or "123 456"
+	regexp.MustCompile(`\b(\d{3}[- ]\d{3})\b`),
+	// "Your code is AB12CD" (alphanumeric, must contain a digit)
+	regexp.MustCompile(`(?i)\b(?:code|otp|pin|passcode|password|token)\b(?:\s+is)?[:\s]+([A-Z]*\d[A-Z0-9]*)\b`),
+	// Any standalone 4-8 digit number
+	regexp.MustCompile(`\b(\d{4,8})\b`),
+}
+
+// compileOTPPatterns parses a semicolon-separated list of regexes
+func compileOTPPatterns(val string) []*regexp.Regexp {
+	var patterns []*regexp.Regexp
+	for _, expr := range strings.Split(val, ";") {
+		if expr = strings.TrimSpace(expr); expr == "" {
+			continue
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			log.Printf("⚠️ Ignoring invalid OTP pattern %q: %v", expr, err)
+			continue
+		}
+		patterns = append(patterns, re)
+	}
+	return patterns
+}
+
+// extractOTP finds a verification code in body using the configured patterns
+// first, then the built-in ones. It returns the code and the pattern that matched.
+func (s *Server) extractOTP(body string) (string, string, bool) {
+	for i, patterns := range [][]*regexp.Regexp{s.config.OTPPatterns, builtinOTPPatterns} {
+		builtin := i == 1
+		for _, re := range patterns {
+			m := re.FindStringSubmatch(body)
+			if m == nil {
+				continue
+			}
+			code := m[0]
+			if len(m) > 1 {
+				code = m[1]
+			}
+			// Normalize split codes like "123-456"
+			code = strings.NewReplacer("-", "", " ", "").Replace(code)
+			if builtin && len(code) < minOTPLength {
+				continue
+			}
+			return code, re.String(), true
+		}
+	}
+	return "", "", false
+}
+
+// otpResult is the response body of the OTP endpoints
+func otpResult(msg Message, code, pattern string) map[string]interface{} {
+	return map[string]interface{}{
+		"code":       code,
+		"pattern":    pattern,
+		"message_id": msg.ID,
+		"to":         msg.To,
+		"from":       msg.From,
+		"created_at": msg.CreatedAt.Format(time.RFC3339Nano),
+	}
+}
+
+// handleGetMessageOTP extracts the verification code from a single message
+func (s *Server) handleGetMessageOTP(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, msg := range s.messagesFor(projectFromRequest(r)) {
+		if msg.ID == id {
+			code, pattern, ok := s.extractOTP(msg.text())
+			if !ok {
+				http.Error(w, "No verification code found", http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(otpResult(msg, code, pattern))
+			return
+		}
+	}
+
+	http.Error(w, "Message not found", http.StatusNotFound)
+}
+
+// handleLatestOTP returns the code from the newest message (optionally to a
+// given number) that contains one
+func (s *Server) handleLatestOTP(w http.ResponseWriter, r *http.Request) {
+	to := r.URL.Query().Get("to")
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, msg := range s.messagesFor(projectFromRequest(r)) {
+		if to != "" && !s.config.SearchMatching.contains(msg.To, to) {
+			continue
+		}
+		if code, pattern, ok := s.extractOTP(msg.text()); ok {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(otpResult(msg, code, pattern))
+			return
+		}
+	}
+
+	http.Error(w, "No verification code found", http.StatusNotFound)
+}
@@ -0,0 +1,278 @@
+package smspit
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/google/uuid"
+)
+
+// gsm7Codes is the GSM 03.38 default alphabet indexed by code
+var gsm7Codes = []rune(gsm7Basic)
+
+// gsm7ExtensionCodes maps the code following an escape septet to the
+// extension table character it stands for
+var gsm7ExtensionCodes = map[byte]rune{
+	0x0A: '\f', 0x14: '^', 0x28: '{', 0x29: '}', 0x2F: '\\',
+	0x3C: '[', 0x3D: '~', 0x3E: ']', 0x40: '|', 0x65: '€',
+}
+
+// decodeGSM7 decodes unpacked GSM 03.38 septets, one per byte. An escape
+// before a code with no extension character stands for the basic one.
+func decodeGSM7(septets []byte) string {
+	var b strings.Builder
+	for i := 0; i < len(septets); i++ {
+		code := septets[i] & 0x7F
+		if code == 0x1B && i+1 < len(septets) {
+			i++
+			code = septets[i] & 0x7F
+			if r, ok := gsm7ExtensionCodes[code]; ok {
+				b.WriteRune(r)
+				continue
+			}
+		}
+		b.WriteRune(gsm7Codes[code])
+	}
+	return b.String()
+}
+
+// unpackSeptets unpacks n septets packed into octets as in 3GPP TS 23.038
+// 6.1.2.1, stopping early if data runs out
+func unpackSeptets(data []byte, n int) []byte {
+	septets := make([]byte, 0, n)
+	for i := 0; i < n; i++ {
+		octet, shift := i*7/8, i*7%8
+		if octet >= len(data) {
+			break
+		}
+		v := uint16(data[octet]) >> shift
+		if shift > 1 && octet+1 < len(data) {
+			v |= uint16(data[octet+1]) << (8 - shift)
+		}
+		septets = append(septets, byte(v&0x7F))
+	}
+	return septets
+}
+
+// decodeUCS2 decodes big-endian UTF-16, ignoring a trailing odd byte
+func decodeUCS2(data []byte) string {
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = uint16(data[2*i])<<8 | uint16(data[2*i+1])
+	}
+	return string(utf16.Decode(units))
+}
+
+// decodeLatin1 decodes ISO-8859-1, of which ASCII is a subset
+func decodeLatin1(data []byte) string {
+	runes := make([]rune, len(data))
+	for i, c := range data {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+// Alphabets a TP-DCS (3GPP TS 23.038 4) can select
+const (
+	alphabetGSM7 = iota
+	alphabet8Bit
+	alphabetUCS2
+)
+
+// dcsAlphabet returns the alphabet a TP-DCS selects. Reserved values count
+// as GSM-7, as the spec asks.
+func dcsAlphabet(dcs byte) int {
+	switch {
+	case dcs&0x80 == 0: // General data coding, possibly compressed or marked for deletion
+		switch dcs >> 2 & 0x03 {
+		case 1:
+			return alphabet8Bit
+		case 2:
+			return alphabetUCS2
+		}
+	case dcs&0xF0 == 0xE0: // Message waiting, UCS-2
+		return alphabetUCS2
+	case dcs&0xF0 == 0xF0: // Data coding/message class
+		if dcs&0x04 != 0 {
+			return alphabet8Bit
+		}
+	}
+	return alphabetGSM7
+}
+
+// smsSubmit is a decoded SMS-SUBMIT TPDU (3GPP TS 23.040 9.2.2.2)
+type smsSubmit struct {
+	to   string
+	udh  []byte // User data header with its length byte; nil without TP-UDHI
+	body string
+}
+
+var errPDUTooShort = errors.New("PDU is too short")
+
+// parseSMSSubmit decodes an SMS-SUBMIT TPDU. 8-bit data is read as
+// ISO-8859-1.
+func parseSMSSubmit(pdu []byte) (smsSubmit, error) {
+	var sms smsSubmit
+	if len(pdu) < 4 {
+		return sms, errPDUTooShort
+	}
+	first := pdu[0]
+	if first&0x03 != 0x01 {
+		return sms, errors.New("PDU is not an SMS-SUBMIT")
+	}
+	udhi := first&0x40 != 0
+	vpLen := map[byte]int{0: 0, 1: 7, 2: 1, 3: 7}[first>>3&0x03]
+
+	// TP-MR, then TP-DA: its length in digits, type of address and digits
+	digits, toa := int(pdu[2]), pdu[3]
+	rest := pdu[4:]
+	if len(rest) < (digits+1)/2 {
+		return sms, errPDUTooShort
+	}
+	sms.to = semiOctets(rest[:(digits+1)/2], digits)
+	switch toa & 0x70 {
+	case 0x10: // International
+		sms.to = "+" + sms.to
+	case 0x50: // Alphanumeric, in packed GSM-7
+		sms.to = decodeGSM7(unpackSeptets(rest[:(digits+1)/2], digits*4/7))
+	}
+	rest = rest[(digits+1)/2:]
+
+	// TP-PID, TP-DCS, TP-VP and TP-UDL
+	if len(rest) < 3+vpLen {
+		return sms, errPDUTooShort
+	}
+	alphabet := dcsAlphabet(rest[1])
+	udl := int(rest[2+vpLen])
+	ud := rest[3+vpLen:]
+
+	size := udl
+	if alphabet == alphabetGSM7 {
+		size = (udl*7 + 7) / 8
+	}
+	if len(ud) < size {
+		return sms, errors.New("PDU user data is shorter than TP-UDL")
+	}
+	ud = ud[:size]
+
+	headerLen := 0
+	if udhi {
+		if len(ud) == 0 || int(ud[0])+1 > len(ud) {
+			return sms, errors.New("PDU user data header is longer than the user data")
+		}
+		headerLen = int(ud[0]) + 1
+		sms.udh = ud[:headerLen]
+	}
+	switch alphabet {
+	case alphabetGSM7:
+		// The header is padded to a septet boundary
+		skip := (headerLen*8 + 6) / 7
+		septets := unpackSeptets(ud, udl)
+		if skip > len(septets) {
+			skip = len(septets)
+		}
+		sms.body = decodeGSM7(septets[skip:])
+	case alphabetUCS2:
+		sms.body = decodeUCS2(ud[headerLen:])
+	default:
+		sms.body = decodeLatin1(ud[headerLen:])
+	}
+	return sms, nil
+}
+
+// semiOctets decodes an address's swapped BCD digits, skipping the F filler
+func semiOctets(data []byte, digits int) string {
+	const symbols = "0123456789*#abc"
+	var b strings.Builder
+	for _, octet := range data {
+		for _, nibble := range []byte{octet & 0x0F, octet >> 4} {
+			if b.Len() < digits && nibble < 0x0F {
+				b.WriteByte(symbols[nibble])
+			}
+		}
+	}
+	return b.String()
+}
+
+// PDURequest is a raw SMS-SUBMIT as a modem is sent it in PDU mode
+type PDURequest struct {
+	// PDU is the AT+CMGS hex string: the SMSC information (00 for the
+	// default SMSC) followed by the SMS-SUBMIT TPDU
+	PDU string `json:"pdu"`
+	// From is the sender, which an SMS-SUBMIT doesn't carry
+	From string `json:"from,omitempty"`
+}
+
+// handleSendPDU captures a raw SMS-SUBMIT PDU. Parts of a concatenated
+// message are captured as one message once all have arrived; until then
+// the response has status "held" and the ID the message will have.
+func (s *Server) handleSendPDU(w http.ResponseWriter, r *http.Request) {
+	var req PDURequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	pdu, err := hex.DecodeString(strings.TrimSpace(req.PDU))
+	if err != nil || len(pdu) == 0 {
+		http.Error(w, "Invalid PDU: not hex", http.StatusBadRequest)
+		return
+	}
+	smscLen := int(pdu[0])
+	if 1+smscLen > len(pdu) {
+		http.Error(w, "Invalid PDU: "+errPDUTooShort.Error(), http.StatusBadRequest)
+		return
+	}
+	sms, err := parseSMSSubmit(pdu[1+smscLen:])
+	if err != nil {
+		http.Error(w, "Invalid PDU: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	msg := Message{
+		ID:        "msg_" + uuid.New().String()[:8],
+		To:        sms.to,
+		From:      req.From,
+		Body:      sms.body,
+		Status:    "captured",
+		CreatedAt: time.Now(),
+		Project:   projectFromRequest(r),
+		Metadata:  metadataFromRequest(r),
+
+		Correlation: correlationFromRequest(r),
+	}
+	if concat, ok := parseConcatUDH(sms.udh); ok {
+		full, complete := s.addConcatPart(msg, sms.udh, concat)
+		if !complete {
+			log.Printf("🧩 SMS part %d/%d held for reassembly: To=%s", concat.seq, concat.total, msg.To)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"id":     full.ID,
+				"status": "held",
+				"part":   concat.seq,
+				"total":  concat.total,
+			})
+			return
+		}
+		msg = full
+	}
+
+	if err := s.captureMessage(&msg); err != nil {
+		writeCaptureError(w, r, err)
+		return
+	}
+	log.Printf("📱 SMS captured (PDU): To=%s Body=%s", msg.To, truncate(msg.Body, 50))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":        msg.ID,
+		"status":    msg.Status,
+		"timestamp": msg.CreatedAt,
+	})
+}
@@ -0,0 +1,95 @@
+package smspit
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestSendPDU(t *testing.T) {
+	tests := []struct {
+		name     string
+		pdu      string
+		wantTo   string
+		wantBody string
+	}{
+		{"GSM-7 with relative validity", "0011000B916407281553F80000AA0AE8329BFD4697D9EC37", "+46708251358", "hellohello"},
+		{"GSM-7 extension characters", "0001000B915155214365F700001AD9775D0E1ABFC965507A0E8AC966B49A0DB4E16DCA1B1F", "+15551234567", "Your code is 123456 [€]"},
+		{"UCS-2", "0001000B915155214365F7000814041A043E04340020003100320033003400350036", "+15551234567", "Код 123456"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t, Config{})
+			w := do(t, ts.api, "POST", "/send/pdu", `{"pdu":"`+tt.pdu+`","from":"+15550009999"}`)
+			if w.Code != http.StatusOK {
+				t.Fatalf("send PDU: %d %s", w.Code, w.Body)
+			}
+			msgs := ts.messages(t)
+			if len(msgs) != 1 {
+				t.Fatalf("%d messages captured, want 1", len(msgs))
+			}
+			if msg := msgs[0]; msg.To != tt.wantTo || msg.From != "+15550009999" || msg.Body != tt.wantBody {
+				t.Errorf("captured to %q from %q: %q, want to %q: %q", msg.To, msg.From, msg.Body, tt.wantTo, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestSendPDUInvalid(t *testing.T) {
+	ts := newTestServer(t, Config{})
+	for name, pdu := range map[string]string{
+		"not hex":           "zz",
+		"SMSC only":         "07",
+		"SMS-DELIVER":       "0004000B915155214365F70000",
+		"truncated address": "0001000B9151",
+		"short user data":   "0001000B915155214365F700001AD977",
+	} {
+		if w := do(t, ts.api, "POST", "/send/pdu", `{"pdu":"`+pdu+`"}`); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: %d %s, want 400", name, w.Code, w.Body)
+		}
+	}
+	if msgs := ts.messages(t); len(msgs) != 0 {
+		t.Errorf("%d messages captured from invalid PDUs", len(msgs))
+	}
+}
+
+func TestSendPDUConcat(t *testing.T) {
+	ts := newTestServer(t, Config{})
+	var ids []string
+	for _, pdu := range []string{
+		"0041000B915155214365F70000160500032A0202886FF7890E9AA3C3F232284D7701",
+		"0041000B915155214365F700001C0500032A0201B2EFBA1C347E93CBA0F41C1493CD68359B0B04",
+	} {
+		w := do(t, ts.api, "POST", "/send/pdu", `{"pdu":"`+pdu+`"}`)
+		if w.Code != http.StatusOK && w.Code != http.StatusAccepted {
+			t.Fatalf("send PDU: %d %s", w.Code, w.Body)
+		}
+		var resp struct {
+			ID string `json:"id"`
+		}
+		decode(t, w, &resp)
+		ids = append(ids, resp.ID)
+	}
+
+	msgs := ts.messages(t)
+	if len(msgs) != 1 {
+		t.Fatalf("%d messages captured, want the 2 parts as 1", len(msgs))
+	}
+	msg := msgs[0]
+	if msg.Body != "Your code is 123456. Don't share it." {
+		t.Errorf("body = %q", msg.Body)
+	}
+	if msg.ID != ids[0] || msg.ID != ids[1] {
+		t.Errorf("message ID %s, responses gave %v", msg.ID, ids)
+	}
+	if msg.Concat == nil || msg.Concat.Ref != 0x2A || msg.Concat.Total != 2 || msg.Concat.Received != 2 {
+		t.Errorf("concat = %+v", msg.Concat)
+	}
+
+	var resp struct {
+		Parts []MessagePart `json:"parts"`
+	}
+	decode(t, do(t, ts.web, "GET", "/api/v1/messages/"+msg.ID+"/parts", ""), &resp)
+	if len(resp.Parts) != 2 || resp.Parts[0].UDH != "0500032a0201" || resp.Parts[1].Body != "Don't share it." {
+		t.Errorf("parts = %+v", resp.Parts)
+	}
+}
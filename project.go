@@ -0,0 +1,127 @@
+package smspit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	// defaultProject holds messages captured without a project
+	defaultProject = "default"
+	// projectHeader selects the project for a request
+	projectHeader = "X-SMSpit-Project"
+	// projectPathPrefix selects the project via the URL, e.g. /projects/ci-42/send
+	projectPathPrefix = "/projects/"
+)
+
+var validProjectName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+type projectContextKey struct{}
+
+// projectPrefixHandler strips a /projects/{name} prefix from the request path
+// and records the project so the wrapped router sees the usual routes.
+// It must wrap the router (not be router middleware) because routing
+// happens against the rewritten path.
+func projectPrefixHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, projectPathPrefix) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rest := strings.TrimPrefix(r.URL.Path, projectPathPrefix)
+		name, path, _ := strings.Cut(rest, "/")
+		if !validProjectName.MatchString(name) {
+			http.Error(w, "Invalid project name", http.StatusBadRequest)
+			return
+		}
+
+		r2 := r.Clone(context.WithValue(r.Context(), projectContextKey{}, name))
+		r2.URL.Path = "/" + path
+		r2.URL.RawPath = ""
+		next.ServeHTTP(w, r2)
+	})
+}
+
+// projectFromRequest returns the project a request is scoped to: the path
+// prefix, then the X-SMSpit-Project header, then the ?project= query param
+// (for WebSocket/EventSource clients that can't set headers)
+func projectFromRequest(r *http.Request) string {
+	if name, ok := r.Context().Value(projectContextKey{}).(string); ok {
+		return name
+	}
+	if name := r.Header.Get(projectHeader); validProjectName.MatchString(name) {
+		return name
+	}
+	if name := r.URL.Query().Get("project"); validProjectName.MatchString(name) {
+		return name
+	}
+	return defaultProject
+}
+
+// messagesFor returns the messages in project, newest first.
+// Callers must hold s.mu.
+func (s *Server) messagesFor(project string) []Message {
+	msgs := make([]Message, 0)
+	for _, msg := range s.messages {
+		if msg.Project == project {
+			msgs = append(msgs, msg)
+		}
+	}
+	return msgs
+}
+
+// eventProject returns the project an event belongs to, or "" for events
+// that concern every project
+func eventProject(event map[string]interface{}) string {
+	if project, ok := event["project"].(string); ok {
+		return project
+	}
+	if msg, ok := event["message"].(Message); ok {
+		return msg.Project
+	}
+	return ""
+}
+
+// eventVisibleTo reports whether a subscriber scoped to project should see event
+func eventVisibleTo(event map[string]interface{}, project string) bool {
+	p := eventProject(event)
+	return p == "" || p == project
+}
+
+// handleListProjects lists every project with its message count. A request
+// confined to one project by a project-bound token or a /projects/ prefix
+// only sees that project.
+func (s *Server) handleListProjects(w http.ResponseWriter, r *http.Request) {
+	project, scoped := r.Context().Value(projectContextKey{}).(string)
+
+	s.mu.RLock()
+	counts := make(map[string]int)
+	for _, msg := range s.messages {
+		if !scoped || msg.Project == project {
+			counts[msg.Project]++
+		}
+	}
+	s.mu.RUnlock()
+
+	projects := make([]map[string]interface{}, 0, len(counts))
+	for name, count := range counts {
+		projects = append(projects, map[string]interface{}{
+			"name":          name,
+			"message_count": count,
+		})
+	}
+	sort.Slice(projects, func(i, j int) bool {
+		return projects[i]["name"].(string) < projects[j]["name"].(string)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"projects": projects,
+		"total":    len(projects),
+	})
+}
@@ -0,0 +1,55 @@
+package smspit
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestListProjectsScope(t *testing.T) {
+	ts := newTestServer(t, Config{AuthToken: "secret"})
+	for _, project := range []string{"ci-1", "ci-2"} {
+		w := do(t, ts.api, "POST", "/projects/"+project+"/send", `{"to":"+15551230001","from":"+15550009999","body":"Hi"}`, "Authorization", "Bearer secret")
+		if w.Code != http.StatusOK {
+			t.Fatalf("send to %s: %d %s", project, w.Code, w.Body)
+		}
+	}
+	w := do(t, ts.web, "POST", "/api/v1/admin/tokens", `{"name":"ci","scopes":["read"],"project":"ci-1"}`, "Authorization", "Bearer secret")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create token: %d %s", w.Code, w.Body)
+	}
+	var token APIToken
+	decode(t, w, &token)
+
+	tests := []struct {
+		name   string
+		target string
+		token  string
+		want   []string
+	}{
+		{"root token", "/api/v1/projects", "secret", []string{"ci-1", "ci-2"}},
+		{"project-bound token", "/api/v1/projects", token.Token, []string{"ci-1"}},
+		{"project prefix", "/projects/ci-2/api/v1/projects", "secret", []string{"ci-2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := do(t, ts.web, "GET", tt.target, "", "Authorization", "Bearer "+tt.token)
+			if w.Code != http.StatusOK {
+				t.Fatalf("list projects: %d %s", w.Code, w.Body)
+			}
+			var resp struct {
+				Projects []struct {
+					Name string `json:"name"`
+				} `json:"projects"`
+			}
+			decode(t, w, &resp)
+			got := []string{}
+			for _, p := range resp.Projects {
+				got = append(got, p.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("projects = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,248 @@
+package smspit
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// PurgeReport describes what a purge of a phone number removed
+type PurgeReport struct {
+	Number        string         `json:"number"`
+	Messages      int            `json:"messages"`
+	MessageIDs    []string       `json:"message_ids"`
+	Projects      []string       `json:"projects"`
+	Media         int            `json:"media"`
+	MediaBytes    int            `json:"media_bytes"`
+	Snapshots     map[string]int `json:"snapshots"` // Messages removed per "project/snapshot"
+	Events        int            `json:"events"`    // Buffered stream events dropped
+	Verifications int            `json:"verifications"`
+	SinchBatches  int            `json:"sinch_batches"` // Batches removed, or with the number dropped from their recipients
+	OptOuts       int            `json:"opt_outs"`      // Opt-outs by or of the number
+	Contacts      int            `json:"contacts"`
+	ConcatParts   int            `json:"concat_parts"` // Parts of concatenated messages still being reassembled
+	Lookups       int            `json:"lookups"`      // Lookup fixtures, only removed by a purge of every project
+	Numbers       int            `json:"numbers"`      // Numbers removed from the pool
+	RateLimits    int            `json:"rate_limits"`  // Rate limit slots booked for the number as a sender
+	PurgedAt      time.Time      `json:"purged_at"`
+}
+
+// numberDigits returns the digits of a phone number, so "+1 (555) 123-4567"
+// and "15551234567" compare equal
+func numberDigits(number string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, number)
+}
+
+// involvesNumber reports whether msg was sent to or from the number with
+// the given digits
+func involvesNumber(msg Message, digits string) bool {
+	return numberDigits(msg.To) == digits || numberDigits(msg.From) == digits
+}
+
+// handlePurgeNumber removes every trace of a phone number: messages to or
+// from it with their media, the copies in snapshots, buffered stream events,
+// pending verifications, Sinch batches, opt-outs, its contact, concatenated
+// message parts awaiting reassembly, its Lookup fixture, its place in the
+// number pool and the rate limiter's record of its sends. It covers every
+// project unless the request is confined to one by a project-bound token or
+// a /projects/ prefix.
+func (s *Server) handlePurgeNumber(w http.ResponseWriter, r *http.Request) {
+	number := mux.Vars(r)["number"]
+	digits := numberDigits(number)
+	if digits == "" {
+		http.Error(w, "Invalid phone number", http.StatusBadRequest)
+		return
+	}
+	project, scoped := r.Context().Value(projectContextKey{}).(string)
+	projectInScope := func(p string) bool {
+		return !scoped || p == project
+	}
+	inScope := func(msg Message) bool {
+		return projectInScope(msg.Project) && involvesNumber(msg, digits)
+	}
+
+	report := PurgeReport{
+		Number:     number,
+		MessageIDs: []string{},
+		Projects:   []string{},
+		Snapshots:  make(map[string]int),
+		PurgedAt:   time.Now(),
+	}
+	projects := make(map[string]bool)
+	var removed []Message
+
+	s.mu.Lock()
+	kept := make([]Message, 0, len(s.messages))
+	for _, msg := range s.messages {
+		if !inScope(msg) {
+			kept = append(kept, msg)
+			continue
+		}
+		removed = append(removed, msg)
+		report.Messages++
+		report.MessageIDs = append(report.MessageIDs, msg.ID)
+		projects[msg.Project] = true
+		for _, item := range msg.Media {
+			report.Media++
+			report.MediaBytes += item.Size
+		}
+	}
+	s.messages = kept
+	s.mu.Unlock()
+	s.syncRemoved(removed...)
+
+	s.snapshots.mu.Lock()
+	for p, byName := range s.snapshots.snapshots {
+		for name, snap := range byName {
+			keptSnap := make([]Message, 0, len(snap.messages))
+			for _, msg := range snap.messages {
+				if !inScope(msg) {
+					keptSnap = append(keptSnap, msg)
+				}
+			}
+			if removed := len(snap.messages) - len(keptSnap); removed > 0 {
+				snap.messages = keptSnap
+				snap.MessageCount = len(keptSnap)
+				report.Snapshots[p+"/"+name] = removed
+				projects[p] = true
+			}
+		}
+	}
+	s.snapshots.mu.Unlock()
+
+	s.verify.mu.Lock()
+	for key, ver := range s.verify.verifications {
+		verProject, _, _ := strings.Cut(key, "|")
+		if projectInScope(verProject) && numberDigits(ver.To) == digits {
+			delete(s.verify.verifications, key)
+			report.Verifications++
+		}
+	}
+	s.verify.mu.Unlock()
+
+	report.SinchBatches = s.purgeSinchBatches(digits, projectInScope)
+
+	s.optOuts.mu.Lock()
+	for key, o := range s.optOuts.optOuts {
+		if projectInScope(o.Project) && (numberDigits(o.Number) == digits || numberDigits(o.Sender) == digits) {
+			delete(s.optOuts.optOuts, key)
+			report.OptOuts++
+		}
+	}
+	s.optOuts.mu.Unlock()
+
+	var contactProjects []string
+	s.contacts.mu.Lock()
+	for p, contacts := range s.contacts.projects {
+		if _, ok := contacts[digits]; ok && projectInScope(p) {
+			delete(contacts, digits)
+			contactProjects = append(contactProjects, p)
+		}
+	}
+	s.contacts.mu.Unlock()
+	report.Contacts = len(contactProjects)
+	for _, p := range contactProjects {
+		s.broadcastEvent(map[string]interface{}{"type": "contacts_updated", "project": p})
+	}
+
+	// Lookup fixtures are shared by every project
+	if !scoped {
+		s.lookups.mu.Lock()
+		for number := range s.lookups.fixtures {
+			if numberDigits(number) == digits {
+				delete(s.lookups.fixtures, number)
+				report.Lookups++
+			}
+		}
+		s.lookups.mu.Unlock()
+	}
+
+	s.numbers.mu.Lock()
+	keptNumbers := s.numbers.numbers[:0]
+	for _, n := range s.numbers.numbers {
+		if projectInScope(n.Project) && numberDigits(n.Number) == digits {
+			report.Numbers++
+			continue
+		}
+		keptNumbers = append(keptNumbers, n)
+	}
+	s.numbers.numbers = keptNumbers
+	s.numbers.mu.Unlock()
+
+	report.Events, report.ConcatParts, report.RateLimits = s.purgeReplica(digits, project, scoped)
+	s.syncRecords(kindSnapshots, kindVerifications, kindSinchBatches, kindOptOuts, kindContacts, kindLookups, kindNumbers)
+	s.publishPurge(digits, project, scoped)
+
+	for p := range projects {
+		report.Projects = append(report.Projects, p)
+	}
+	sort.Strings(report.Projects)
+
+	log.Printf("🗑️ Number purged: ...%s (%d messages, %d snapshot copies, %d verifications, %d Sinch batches)", lastDigits(digits, 4), report.Messages, sumCounts(report.Snapshots), report.Verifications, report.SinchBatches)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// purgeReplica removes a number from what each replica keeps to itself:
+// buffered stream events, concatenated message parts awaiting reassembly and
+// the rate limiter's record of its sends. In a cluster the replica handling
+// the purge has the others do the same (see publishPurge).
+func (s *Server) purgeReplica(digits, project string, scoped bool) (events, parts, limits int) {
+	projectInScope := func(p string) bool {
+		return !scoped || p == project
+	}
+	inScope := func(msg Message) bool {
+		return projectInScope(msg.Project) && involvesNumber(msg, digits)
+	}
+
+	events = s.events.purge(func(data map[string]interface{}) bool {
+		msg, ok := data["message"].(Message)
+		return ok && inScope(msg)
+	})
+
+	s.concat.mu.Lock()
+	for key, pending := range s.concat.pending {
+		if inScope(pending.msg) {
+			pending.timer.Stop()
+			delete(s.concat.pending, key)
+			parts += len(pending.parts)
+		}
+	}
+	s.concat.mu.Unlock()
+
+	limits = s.limiter.purge(func(key string) bool {
+		kind, rest, _ := strings.Cut(key, ":")
+		keyProject, sender, _ := strings.Cut(rest, ":")
+		return (kind == "number" || kind == "a2p") && projectInScope(keyProject) && numberDigits(sender) == digits
+	})
+	return events, parts, limits
+}
+
+// lastDigits returns the last n digits, so the log doesn't record the
+// number being purged
+func lastDigits(digits string, n int) string {
+	if len(digits) <= n {
+		return ""
+	}
+	return digits[len(digits)-n:]
+}
+
+// sumCounts adds up the values of a count map
+func sumCounts(counts map[string]int) int {
+	total := 0
+	for _, n := range counts {
+		total += n
+	}
+	return total
+}
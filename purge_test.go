@@ -0,0 +1,106 @@
+package smspit
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestPurgeNumber(t *testing.T) {
+	ts := newTestServer(t, Config{KannelCompat: true, SinchCompat: true, RateLimitPerNumber: 1e6})
+	const number = "+15551230001"
+
+	ts.send(t, number, "Hello")
+	kept := ts.send(t, "+15551230002", "Hello")
+	// A batch to the number alone is removed; one to others loses it
+	for _, body := range []string{
+		`{"from":"+15550009999","to":["` + number + `"],"body":"Hi"}`,
+		`{"from":"+15550009999","to":["` + number + `","+15551230002"],"body":"Hi"}`,
+	} {
+		if w := do(t, ts.api, "POST", "/xms/v1/plan/batches", body); w.Code != http.StatusCreated {
+			t.Fatalf("batch: %d %s", w.Code, w.Body)
+		}
+	}
+	// The first part of a message still being reassembled
+	ts.sendPart(t, number, "Part one", 7, 2, 1)
+	// A send from the number books a rate limit slot for it as a sender
+	if w := do(t, ts.api, "POST", "/send", `{"to":"+15551230002","from":"`+number+`","body":"Hi"}`); w.Code != http.StatusOK {
+		t.Fatalf("send from the number: %d %s", w.Code, w.Body)
+	}
+
+	// Opt-outs refuse sends, so add them last
+	for _, req := range []struct{ method, path, body string }{
+		{"POST", "/api/v1/opt-outs", `{"number":"` + number + `","sender":"+15550009999"}`},
+		{"POST", "/api/v1/contacts", `{"number":"` + number + `","name":"Ada"}`},
+		{"PUT", "/api/v1/lookups/" + number, `{"line_type":"mobile"}`},
+		{"POST", "/api/v1/numbers", `{"number":"` + number + `"}`},
+	} {
+		if w := do(t, ts.web, req.method, req.path, req.body); w.Code >= 300 {
+			t.Fatalf("%s %s: %d %s", req.method, req.path, w.Code, w.Body)
+		}
+	}
+
+	w := do(t, ts.web, "DELETE", "/api/v1/numbers/%2B15551230001", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("purge: %d %s", w.Code, w.Body)
+	}
+	var report PurgeReport
+	decode(t, w, &report)
+
+	want := map[string][2]int{
+		"messages":      {report.Messages, 4},
+		"sinch_batches": {report.SinchBatches, 2},
+		"opt_outs":      {report.OptOuts, 1},
+		"contacts":      {report.Contacts, 1},
+		"concat_parts":  {report.ConcatParts, 1},
+		"lookups":       {report.Lookups, 1},
+		"numbers":       {report.Numbers, 1},
+		"rate_limits":   {report.RateLimits, 1},
+	}
+	for field, n := range want {
+		if n[0] != n[1] {
+			t.Errorf("report %s = %d, want %d", field, n[0], n[1])
+		}
+	}
+
+	msgs := ts.messages(t)
+	if len(msgs) != 2 {
+		t.Fatalf("%d messages left, want the 2 to other numbers", len(msgs))
+	}
+	for _, msg := range msgs {
+		if msg.To == number || msg.From == number {
+			t.Errorf("message %s to the number left", msg.ID)
+		}
+	}
+	found := false
+	for _, msg := range msgs {
+		found = found || msg.ID == kept
+	}
+	if !found {
+		t.Errorf("message %s to another number purged", kept)
+	}
+
+	var batches struct {
+		Batches []map[string]interface{} `json:"batches"`
+	}
+	decode(t, do(t, ts.api, "GET", "/xms/v1/plan/batches", ""), &batches)
+	if len(batches.Batches) != 1 {
+		t.Fatalf("%d batches left, want 1", len(batches.Batches))
+	}
+	if to := batches.Batches[0]["to"].([]interface{}); len(to) != 1 || to[0] != "+15551230002" {
+		t.Errorf("batch recipients = %v, want only +15551230002", to)
+	}
+	for _, path := range []string{"/api/v1/opt-outs", "/api/v1/contacts", "/api/v1/lookups", "/api/v1/numbers"} {
+		if body := do(t, ts.web, "GET", path, "").Body.String(); strings.Contains(body, number) {
+			t.Errorf("GET %s still lists the number: %s", path, body)
+		}
+	}
+
+	ts.limiter.mu.Lock()
+	defer ts.limiter.mu.Unlock()
+	for key := range ts.limiter.next {
+		if strings.Contains(key, number) {
+			t.Errorf("rate limiter still holds %s", key)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package smspit
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// queryFields are the field operators understood by the search query
+// language. Any other "word:..." token is searched as plain text.
+var queryFields = map[string]bool{
+	"to": true, "from": true, "body": true, "tag": true, "status": true,
+	"direction": true, "account": true, "is": true, "after": true, "before": true,
+	"regex": true, "channel": true, "meta": true, "request_id": true, "trace_id": true,
+}
+
+// queryTerm is one condition of a search query, e.g. to:+1555, -tag:spam or
+// meta:run_id=42. Terms without a field match the body, recipient or
+// sender. Recipients and senders also match by contact name (to:alice).
+type queryTerm struct {
+	field  string
+	value  string
+	negate bool
+	at     time.Time      // Parsed value of after: and before:
+	re     *regexp.Regexp // Compiled value of regex:
+}
+
+// parseQuery parses a Mailpit-style query such as
+//
+//	to:+1555 from:ACME body:"reset code" after:2024-01-01 tag:otp -tag:marketing
+//
+// Every term must match. A leading "-" negates a term and double quotes
+// group words.
+func parseQuery(q string) ([]queryTerm, error) {
+	var terms []queryTerm
+	for _, token := range tokenizeQuery(q) {
+		negate := false
+		if strings.HasPrefix(token, "-") && len(token) > 1 {
+			negate = true
+			token = token[1:]
+		}
+
+		field := ""
+		if f, value, ok := strings.Cut(token, ":"); ok && queryFields[strings.ToLower(f)] {
+			field = strings.ToLower(f)
+			token = value
+		}
+		value := strings.Trim(token, `"`)
+		if value == "" {
+			continue
+		}
+
+		t, err := fieldTerm(field, value)
+		if err != nil {
+			return nil, err
+		}
+		t.negate = negate
+		terms = append(terms, t)
+	}
+	return terms, nil
+}
+
+// fieldTerm builds and validates a term for field (empty for free text).
+// Surrounding spaces are dropped, so an unescaped "+1555" in a URL (decoded
+// as " 1555") still matches the number.
+func fieldTerm(field, value string) (queryTerm, error) {
+	value = strings.TrimSpace(value)
+	t := queryTerm{field: field, value: value}
+	switch field {
+	case "after", "before":
+		at, err := parseQueryTime(value)
+		if err != nil {
+			return t, fmt.Errorf("invalid %s: %q", field, value)
+		}
+		t.at = at
+	case "is":
+		if v := strings.ToLower(value); v != "read" && v != "unread" {
+			return t, fmt.Errorf("invalid is: %q (use read or unread)", value)
+		}
+	case "channel":
+		if !validChannel(strings.ToLower(value)) {
+			return t, fmt.Errorf("invalid channel: %q (use %s)", value, strings.Join(channels, ", "))
+		}
+	case "meta":
+		key, _, _ := strings.Cut(value, "=")
+		if !validMetadataKey.MatchString(key) {
+			return t, fmt.Errorf("invalid meta: %q (use key=value or key)", value)
+		}
+	case "regex":
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return t, fmt.Errorf("invalid regex: %v", err)
+		}
+		t.re = re
+	}
+	return t, nil
+}
+
+// tokenizeQuery splits q on whitespace outside double quotes
+func tokenizeQuery(q string) []string {
+	var tokens []string
+	var current strings.Builder
+	quoted := false
+	for _, r := range q {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			current.WriteRune(r)
+		case unicode.IsSpace(r) && !quoted:
+			if current.Len() > 0 {
+				tokens = append(tokens, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		tokens = append(tokens, current.String())
+	}
+	return tokens
+}
+
+// parseQueryTime accepts RFC 3339 timestamps, dates (2024-01-01), Unix
+// seconds, or a duration meaning that long ago (5m, 2h)
+func parseQueryTime(v string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04", "2006-01-02"} {
+		if t, err := time.Parse(layout, v); err == nil {
+			return t, nil
+		}
+	}
+	if secs, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	if d, err := time.ParseDuration(v); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("unrecognized time %q", v)
+}
+
+func (t queryTerm) matches(msg Message, m textMatching) bool {
+	return t.test(msg, m) != t.negate
+}
+
+// test reports whether msg satisfies the term, ignoring negation. Text is
+// compared as m says.
+func (t queryTerm) test(msg Message, m textMatching) bool {
+	switch t.field {
+	case "to":
+		return m.contains(msg.To, t.value) || m.contains(msg.ToName, t.value)
+	case "from":
+		return m.contains(msg.From, t.value) || m.contains(msg.FromName, t.value)
+	case "body":
+		return m.contains(msg.Body, t.value)
+	case "tag":
+		return hasTags(msg, []string{t.value})
+	case "status":
+		return strings.EqualFold(msg.Status, t.value)
+	case "direction":
+		return strings.EqualFold(msg.Direction, t.value)
+	case "account":
+		return strings.EqualFold(msg.AccountSID, t.value)
+	case "channel":
+		return strings.EqualFold(msg.channel(), t.value)
+	case "meta":
+		// key=value matches the value exactly; a bare key matches any value
+		key, value, hasValue := strings.Cut(t.value, "=")
+		got, ok := msg.metadataValue(key)
+		return ok && (!hasValue || got == value)
+	case "request_id":
+		return msg.RequestID != "" && strings.EqualFold(msg.RequestID, t.value)
+	case "trace_id":
+		return msg.TraceID != "" && strings.EqualFold(msg.TraceID, t.value)
+	case "is":
+		return msg.Unread == strings.EqualFold(t.value, "unread")
+	case "after":
+		return msg.CreatedAt.After(t.at)
+	case "before":
+		return msg.CreatedAt.Before(t.at)
+	case "regex":
+		return t.re.MatchString(msg.Body)
+	default:
+		return m.contains(msg.Body, t.value) || m.contains(msg.To, t.value) || m.contains(msg.From, t.value) ||
+			m.contains(msg.ToName, t.value) || m.contains(msg.FromName, t.value)
+	}
+}
@@ -0,0 +1,139 @@
+package smspit
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Rate limit modes
+const (
+	rateLimitReject = "reject"
+	rateLimitQueue  = "queue"
+)
+
+// rateLimit is a send rate applied to one key (a sender or an account)
+type rateLimit struct {
+	key  string
+	rate float64 // Messages per second
+}
+
+// rateLimiter books send slots so each key stays under its rate
+type rateLimiter struct {
+	mu   sync.Mutex
+	next map[string]time.Time // Earliest time each key may send again
+}
+
+// reserve finds the earliest time every limit allows a send and returns how
+// long that is from now. When queue is false the slot is only booked if it
+// is available immediately; otherwise ok is false and the wait is how long
+// until it would be.
+func (l *rateLimiter) reserve(limits []rateLimit, queue bool) (wait time.Duration, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	slot := now
+	for _, limit := range limits {
+		if next := l.next[limit.key]; next.After(slot) {
+			slot = next
+		}
+	}
+
+	wait = slot.Sub(now)
+	if wait > 0 && !queue {
+		return wait, false
+	}
+
+	for _, limit := range limits {
+		l.next[limit.key] = slot.Add(time.Duration(float64(time.Second) / limit.rate))
+	}
+	return wait, true
+}
+
+// purge forgets the slots booked for the keys match accepts and returns how
+// many there were
+func (l *rateLimiter) purge(match func(key string) bool) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := 0
+	for key := range l.next {
+		if match(key) {
+			delete(l.next, key)
+			n++
+		}
+	}
+	return n
+}
+
+// rateLimits returns the limits that apply to a message from sender to
+// recipient in project. account is the provider account (e.g. a Twilio
+// Account SID); without one the project counts as the account. Unregistered
+// 10DLC senders are throttled when SMSPIT_A2P_MODE says so.
+func (s *Server) rateLimits(project, account, sender, recipient string) []rateLimit {
+	if account == "" {
+		account = project
+	}
+
+	var limits []rateLimit
+	if s.config.RateLimitPerNumber > 0 {
+		limits = append(limits, rateLimit{key: "number:" + project + ":" + sender, rate: s.config.RateLimitPerNumber})
+	}
+	if s.config.RateLimitPerAccount > 0 {
+		limits = append(limits, rateLimit{key: "account:" + account, rate: s.config.RateLimitPerAccount})
+	}
+	if s.config.A2PThrottleRate > 0 && s.a2pMode(project, sender, recipient) == a2pThrottle {
+		limits = append(limits, rateLimit{key: "a2p:" + project + ":" + sender, rate: s.config.A2PThrottleRate})
+	}
+	return limits
+}
+
+// queueDelay books a send slot for msg when SMSPIT_RATE_LIMIT_MODE=queue and
+// returns how long it has to stay queued
+func (s *Server) queueDelay(msg Message) time.Duration {
+	if s.config.RateLimitMode != rateLimitQueue || msg.Direction != "outbound" {
+		return 0
+	}
+	limits := s.rateLimits(msg.Project, msg.AccountSID, msg.From, msg.To)
+	if len(limits) == 0 {
+		return 0
+	}
+	wait, _ := s.limiter.reserve(limits, true)
+	return wait
+}
+
+// rateLimitMiddleware rejects capture requests over the configured rates
+// with the provider's 429 response, unless SMSPIT_RATE_LIMIT_MODE=queue.
+// Reads (GETs other than SNS actions) are not limited.
+func (s *Server) rateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limited := s.config.RateLimitPerNumber > 0 || s.config.RateLimitPerAccount > 0 || s.a2pThrottling()
+		read := r.Method == "GET" && r.URL.Query().Get("Action") == "" && r.URL.Path != s.config.KannelPath
+		if !limited || s.config.RateLimitMode == rateLimitQueue || r.Method == "OPTIONS" || read || isPublicPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		sender, recipient := "", ""
+		to, from := requestParties(r)
+		if len(from) > 0 {
+			sender = from[0]
+		}
+		if len(to) > 0 {
+			recipient = to[0]
+		}
+		limits := s.rateLimits(projectFromRequest(r), mux.Vars(r)["accountSid"], sender, recipient)
+		if wait, ok := s.limiter.reserve(limits, false); !ok {
+			log.Printf("🚦 Rate limit exceeded: From=%s Path=%s", sender, r.URL.Path)
+			retryAfter := int(math.Ceil(wait.Seconds()))
+			writeProviderError(w, r, http.StatusTooManyRequests, 0, "Too Many Requests", retryAfter)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
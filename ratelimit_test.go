@@ -0,0 +1,143 @@
+package smspit
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimitReject(t *testing.T) {
+	form := []string{"Content-Type", "application/x-www-form-urlencoded"}
+	twilio := func(account, from string) request {
+		return request{"POST", "/2010-04-01/Accounts/" + account + "/Messages.json", "To=%2B15551230001&From=" + strings.ReplaceAll(from, "+", "%2B") + "&Body=Hi", form}
+	}
+	send := func(from string, header ...string) request {
+		return request{"POST", "/send", `{"to":"+15551230001","from":"` + from + `","body":"Hi"}`, header}
+	}
+
+	tests := []struct {
+		name     string
+		config   Config
+		requests []request
+		want     []int
+	}{
+		{
+			name:     "per number",
+			config:   Config{RateLimitPerNumber: 1},
+			requests: []request{send("+15550000001"), send("+15550000001"), send("+15550000002")},
+			want:     []int{http.StatusOK, http.StatusTooManyRequests, http.StatusOK},
+		},
+		{
+			name:     "per number, by project",
+			config:   Config{RateLimitPerNumber: 1},
+			requests: []request{send("+15550000001"), send("+15550000001", projectHeader, "other")},
+			want:     []int{http.StatusOK, http.StatusOK},
+		},
+		{
+			name:     "per account",
+			config:   Config{RateLimitPerAccount: 1, TwilioCompat: true},
+			requests: []request{twilio("AC1", "+15550000001"), twilio("AC1", "+15550000002"), twilio("AC2", "+15550000001")},
+			want:     []int{http.StatusCreated, http.StatusTooManyRequests, http.StatusCreated},
+		},
+		{
+			name:     "project counts as the account",
+			config:   Config{RateLimitPerAccount: 1},
+			requests: []request{send("+15550000001"), send("+15550000002"), send("+15550000002", projectHeader, "other")},
+			want:     []int{http.StatusOK, http.StatusTooManyRequests, http.StatusOK},
+		},
+		{
+			name:   "reads are not limited",
+			config: Config{RateLimitPerAccount: 1, TwilioCompat: true},
+			requests: []request{
+				{"GET", "/2010-04-01/Accounts/AC1/Messages.json", "", nil},
+				{"GET", "/2010-04-01/Accounts/AC1/Messages.json", "", nil},
+			},
+			want: []int{http.StatusOK, http.StatusOK},
+		},
+		{
+			name:     "no limits",
+			config:   Config{},
+			requests: []request{send("+15550000001"), send("+15550000001")},
+			want:     []int{http.StatusOK, http.StatusOK},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t, tt.config)
+			for i, req := range tt.requests {
+				w := do(t, ts.api, req.method, req.target, req.body, req.header...)
+				if w.Code != tt.want[i] {
+					t.Fatalf("request %d: %d %s, want %d", i, w.Code, w.Body, tt.want[i])
+				}
+				if w.Code == http.StatusTooManyRequests && w.Header().Get("Retry-After") != "1" {
+					t.Errorf("request %d: Retry-After %q, want 1", i, w.Header().Get("Retry-After"))
+				}
+			}
+		})
+	}
+}
+
+// request is one request of a sequence
+type request struct {
+	method, target, body string
+	header               []string
+}
+
+func TestRateLimitErrorShape(t *testing.T) {
+	ts := newTestServer(t, Config{RateLimitPerNumber: 0.5, TwilioCompat: true})
+	body := "To=%2B15551230001&From=%2B15550000001&Body=Hi"
+	form := []string{"Content-Type", "application/x-www-form-urlencoded"}
+
+	do(t, ts.api, "POST", "/2010-04-01/Accounts/AC1/Messages.json", body, form...)
+	w := do(t, ts.api, "POST", "/2010-04-01/Accounts/AC1/Messages.json", body, form...)
+	var twilioErr TwilioError
+	decode(t, w, &twilioErr)
+	if w.Code != http.StatusTooManyRequests || twilioErr.Code != 20429 || w.Header().Get("Retry-After") != "2" {
+		t.Errorf("throttled Twilio send: %d %s, Retry-After %q; want 429 with code 20429 and Retry-After 2", w.Code, w.Body, w.Header().Get("Retry-After"))
+	}
+	if msgs := ts.messages(t); len(msgs) != 1 {
+		t.Errorf("got %d messages, want only the first captured", len(msgs))
+	}
+}
+
+func TestRateLimitQueue(t *testing.T) {
+	ts := newTestServer(t, Config{RateLimitPerNumber: 10, RateLimitMode: rateLimitQueue, DeliveryDelay: time.Millisecond})
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		w := do(t, ts.api, "POST", "/send", `{"to":"+15551230001","from":"+15550000001","body":"Hi"}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("send %d: %d %s, want it queued rather than refused", i, w.Code, w.Body)
+		}
+		var resp struct {
+			ID string `json:"id"`
+		}
+		decode(t, w, &resp)
+		ids = append(ids, resp.ID)
+	}
+
+	status := func(id string) string {
+		for _, msg := range ts.messages(t) {
+			if msg.ID == id {
+				return msg.Status
+			}
+		}
+		return ""
+	}
+	// Slots are 100ms apart, so the last send waits 200ms for its turn
+	time.Sleep(50 * time.Millisecond)
+	if got := status(ids[2]); got != "queued" {
+		t.Errorf("last message is %s, want queued until its slot", got)
+	}
+	time.Sleep(300 * time.Millisecond)
+	// The first send had its slot at once and was never held
+	if got := status(ids[0]); got != "captured" {
+		t.Errorf("first message is %s, want captured", got)
+	}
+	for _, id := range ids[1:] {
+		if got := status(id); got != "delivered" {
+			t.Errorf("message %s is %s, want delivered once its slot came", id, got)
+		}
+	}
+}
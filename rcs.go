@@ -0,0 +1,308 @@
+package smspit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// RCS Business Messaging limits on agent messages
+const (
+	rcsMaxText            = 3072
+	rcsMaxSuggestions     = 11
+	rcsMaxCardSuggestions = 4
+	rcsMaxSuggestionText  = 25
+	rcsMaxPostbackData    = 2048
+	rcsMaxCardTitle       = 200
+	rcsMaxCardDescription = 2000
+	rcsMinCarouselCards   = 2
+	rcsMaxCarouselCards   = 10
+)
+
+// RCSContent is an RCS Business Messaging agent content message: text, a
+// file (contentInfo) or a rich card, with optional suggested replies and
+// actions. Field names follow the RBM API.
+type RCSContent struct {
+	Text        string          `json:"text,omitempty"`
+	ContentInfo *RCSContentInfo `json:"contentInfo,omitempty"`
+	RichCard    *RCSRichCard    `json:"richCard,omitempty"`
+	Suggestions []RCSSuggestion `json:"suggestions,omitempty"`
+}
+
+// RCSContentInfo points at a file sent as media
+type RCSContentInfo struct {
+	FileURL      string `json:"fileUrl"`
+	ThumbnailURL string `json:"thumbnailUrl,omitempty"`
+	ForceRefresh bool   `json:"forceRefresh,omitempty"`
+}
+
+// RCSRichCard is a standalone card or a carousel of cards
+type RCSRichCard struct {
+	StandaloneCard *RCSStandaloneCard `json:"standaloneCard,omitempty"`
+	CarouselCard   *RCSCarouselCard   `json:"carouselCard,omitempty"`
+}
+
+// RCSStandaloneCard is a single rich card
+type RCSStandaloneCard struct {
+	CardOrientation         string         `json:"cardOrientation,omitempty"`
+	ThumbnailImageAlignment string         `json:"thumbnailImageAlignment,omitempty"`
+	CardContent             RCSCardContent `json:"cardContent"`
+}
+
+// RCSCarouselCard is a horizontally scrolling list of cards
+type RCSCarouselCard struct {
+	CardWidth    string           `json:"cardWidth,omitempty"`
+	CardContents []RCSCardContent `json:"cardContents"`
+}
+
+// RCSCardContent is the content of one card
+type RCSCardContent struct {
+	Title       string          `json:"title,omitempty"`
+	Description string          `json:"description,omitempty"`
+	Media       *RCSCardMedia   `json:"media,omitempty"`
+	Suggestions []RCSSuggestion `json:"suggestions,omitempty"`
+}
+
+// RCSCardMedia is a card's image or video
+type RCSCardMedia struct {
+	Height      string          `json:"height,omitempty"`
+	ContentInfo *RCSContentInfo `json:"contentInfo,omitempty"`
+}
+
+// RCSSuggestion is a suggested reply or a suggested action
+type RCSSuggestion struct {
+	Reply  *RCSSuggestedReply  `json:"reply,omitempty"`
+	Action *RCSSuggestedAction `json:"action,omitempty"`
+}
+
+// RCSSuggestedReply is a chip the user taps to send its text back
+type RCSSuggestedReply struct {
+	Text         string `json:"text"`
+	PostbackData string `json:"postbackData,omitempty"`
+}
+
+// RCSSuggestedAction is a chip that opens a URL, dials a number or runs
+// another device action. Actions other than opening a URL and dialing are
+// stored as sent.
+type RCSSuggestedAction struct {
+	Text                      string          `json:"text"`
+	PostbackData              string          `json:"postbackData,omitempty"`
+	FallbackURL               string          `json:"fallbackUrl,omitempty"`
+	OpenURLAction             *RCSOpenURL     `json:"openUrlAction,omitempty"`
+	DialAction                *RCSDial        `json:"dialAction,omitempty"`
+	ViewLocationAction        json.RawMessage `json:"viewLocationAction,omitempty"`
+	CreateCalendarEventAction json.RawMessage `json:"createCalendarEventAction,omitempty"`
+	ShareLocationAction       json.RawMessage `json:"shareLocationAction,omitempty"`
+}
+
+// RCSOpenURL is the target of an open URL action
+type RCSOpenURL struct {
+	URL string `json:"url"`
+}
+
+// RCSDial is the target of a dial action
+type RCSDial struct {
+	PhoneNumber string `json:"phoneNumber"`
+}
+
+// RCSSendRequest represents an /rcs/send request: the recipient and agent
+// plus an RBM contentMessage
+type RCSSendRequest struct {
+	To             string      `json:"to"`
+	From           string      `json:"from,omitempty"` // Agent ID
+	Tags           []string    `json:"tags,omitempty"`
+	ContentMessage *RCSContent `json:"contentMessage"`
+}
+
+// validate checks c against the RBM rules: exactly one of text, file and
+// rich card, and the API's limits on lengths and counts
+func (c RCSContent) validate() error {
+	kinds := 0
+	for _, set := range []bool{c.Text != "", c.ContentInfo != nil, c.RichCard != nil} {
+		if set {
+			kinds++
+		}
+	}
+	if kinds != 1 {
+		return errors.New("contentMessage needs exactly one of text, contentInfo and richCard")
+	}
+
+	if utf8.RuneCountInString(c.Text) > rcsMaxText {
+		return fmt.Errorf("text is longer than %d characters", rcsMaxText)
+	}
+	if c.ContentInfo != nil && c.ContentInfo.FileURL == "" {
+		return errors.New("contentInfo.fileUrl is required")
+	}
+	if card := c.RichCard; card != nil {
+		switch {
+		case (card.StandaloneCard == nil) == (card.CarouselCard == nil):
+			return errors.New("richCard needs exactly one of standaloneCard and carouselCard")
+		case card.StandaloneCard != nil:
+			if err := card.StandaloneCard.CardContent.validate(); err != nil {
+				return err
+			}
+		default:
+			n := len(card.CarouselCard.CardContents)
+			if n < rcsMinCarouselCards || n > rcsMaxCarouselCards {
+				return fmt.Errorf("carouselCard needs %d to %d cardContents", rcsMinCarouselCards, rcsMaxCarouselCards)
+			}
+			for _, content := range card.CarouselCard.CardContents {
+				if err := content.validate(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return validateSuggestions(c.Suggestions, rcsMaxSuggestions)
+}
+
+// validate checks a card's content
+func (c RCSCardContent) validate() error {
+	switch {
+	case c.Title == "" && c.Description == "" && c.Media == nil:
+		return errors.New("cardContent needs a title, description or media")
+	case utf8.RuneCountInString(c.Title) > rcsMaxCardTitle:
+		return fmt.Errorf("cardContent.title is longer than %d characters", rcsMaxCardTitle)
+	case utf8.RuneCountInString(c.Description) > rcsMaxCardDescription:
+		return fmt.Errorf("cardContent.description is longer than %d characters", rcsMaxCardDescription)
+	case c.Media != nil && (c.Media.ContentInfo == nil || c.Media.ContentInfo.FileURL == ""):
+		return errors.New("cardContent.media.contentInfo.fileUrl is required")
+	}
+	return validateSuggestions(c.Suggestions, rcsMaxCardSuggestions)
+}
+
+// validateSuggestions checks a list of at most max suggestions
+func validateSuggestions(suggestions []RCSSuggestion, max int) error {
+	if len(suggestions) > max {
+		return fmt.Errorf("at most %d suggestions are allowed here", max)
+	}
+	for _, s := range suggestions {
+		var text, postback string
+		switch {
+		case (s.Reply == nil) == (s.Action == nil):
+			return errors.New("a suggestion needs exactly one of reply and action")
+		case s.Reply != nil:
+			text, postback = s.Reply.Text, s.Reply.PostbackData
+		default:
+			text, postback = s.Action.Text, s.Action.PostbackData
+		}
+		if text == "" || utf8.RuneCountInString(text) > rcsMaxSuggestionText {
+			return fmt.Errorf("suggestion text must be 1 to %d characters", rcsMaxSuggestionText)
+		}
+		if len(postback) > rcsMaxPostbackData {
+			return fmt.Errorf("suggestion postbackData is longer than %d bytes", rcsMaxPostbackData)
+		}
+	}
+	return nil
+}
+
+// body flattens c into the text a message body is searched and matched
+// by: the text, or each card's title and description
+func (c RCSContent) body() string {
+	switch {
+	case c.Text != "":
+		return c.Text
+	case c.RichCard == nil:
+		return ""
+	}
+
+	var contents []RCSCardContent
+	if card := c.RichCard.StandaloneCard; card != nil {
+		contents = []RCSCardContent{card.CardContent}
+	} else {
+		contents = c.RichCard.CarouselCard.CardContents
+	}
+	parts := make([]string, 0, len(contents))
+	for _, content := range contents {
+		var lines []string
+		for _, line := range []string{content.Title, content.Description} {
+			if line != "" {
+				lines = append(lines, line)
+			}
+		}
+		if len(lines) > 0 {
+			parts = append(parts, strings.Join(lines, "\n"))
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// redactRCS applies the redaction rules to the text and cards of c
+func (s *Server) redactRCS(c *RCSContent) {
+	c.Text = s.redact(c.Text)
+	if c.RichCard == nil {
+		return
+	}
+	contents := []*RCSCardContent{}
+	if card := c.RichCard.StandaloneCard; card != nil {
+		contents = append(contents, &card.CardContent)
+	} else {
+		for i := range c.RichCard.CarouselCard.CardContents {
+			contents = append(contents, &c.RichCard.CarouselCard.CardContents[i])
+		}
+	}
+	for _, content := range contents {
+		content.Title = s.redact(content.Title)
+		content.Description = s.redact(content.Description)
+	}
+}
+
+// handleRCSSend captures an RCS agent message. The structured content is
+// stored as the message's rcs field, with channel "rcs" and a plain-text
+// body for search.
+func (s *Server) handleRCSSend(w http.ResponseWriter, r *http.Request) {
+	var req RCSSendRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.To == "" {
+		http.Error(w, "Missing 'to' field", http.StatusBadRequest)
+		return
+	}
+	if req.ContentMessage == nil {
+		http.Error(w, "Missing 'contentMessage' field", http.StatusBadRequest)
+		return
+	}
+	if err := req.ContentMessage.validate(); err != nil {
+		http.Error(w, "Invalid contentMessage: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	msg := Message{
+		ID:        "msg_" + uuid.New().String()[:8],
+		To:        req.To,
+		From:      req.From,
+		Body:      req.ContentMessage.body(),
+		Tags:      req.Tags,
+		Channel:   channelRCS,
+		RCS:       req.ContentMessage,
+		Status:    "captured",
+		CreatedAt: time.Now(),
+		Project:   projectFromRequest(r),
+		Metadata:  metadataFromRequest(r),
+
+		Correlation: correlationFromRequest(r),
+	}
+
+	if err := s.captureMessage(&msg); err != nil {
+		writeCaptureError(w, r, err)
+		return
+	}
+
+	log.Printf("💬 RCS message captured: To=%s Body=%s", msg.To, truncate(msg.Body, 50))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":        msg.ID,
+		"status":    msg.Status,
+		"timestamp": msg.CreatedAt,
+	})
+}
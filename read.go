@@ -0,0 +1,122 @@
+package smspit
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// setUnread updates the unread flag of a project's messages whose ID is in
+// ids (every message when ids is nil), broadcasts the change and
+// returns the IDs that changed
+func (s *Server) setUnread(project string, ids []string, unread bool) []string {
+	var wanted map[string]bool
+	if ids != nil {
+		wanted = make(map[string]bool, len(ids))
+		for _, id := range ids {
+			wanted[id] = true
+		}
+	}
+
+	s.mu.Lock()
+	changed := []string{}
+	var keys []messageKey
+	remaining := 0
+	for i := range s.messages {
+		msg := &s.messages[i]
+		if msg.Project != project {
+			continue
+		}
+		if (wanted == nil || wanted[msg.ID]) && msg.Unread != unread {
+			msg.Unread = unread
+			changed = append(changed, msg.ID)
+			keys = append(keys, msg.key())
+		}
+		if msg.Unread {
+			remaining++
+		}
+	}
+	s.mu.Unlock()
+	s.syncSaved(keys...)
+
+	if len(changed) > 0 {
+		eventType := "messages_read"
+		if unread {
+			eventType = "messages_unread"
+		}
+		s.broadcastEvent(map[string]interface{}{
+			"type":    eventType,
+			"project": project,
+			"ids":     changed,
+			"unread":  remaining,
+		})
+	}
+	return changed
+}
+
+// markOne handles the single-message read/unread endpoints
+func (s *Server) markOne(w http.ResponseWriter, r *http.Request, unread bool) {
+	id := mux.Vars(r)["id"]
+	project := projectFromRequest(r)
+
+	s.mu.RLock()
+	found := false
+	for _, msg := range s.messagesFor(project) {
+		if msg.ID == id {
+			found = true
+			break
+		}
+	}
+	s.mu.RUnlock()
+
+	if !found {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	}
+
+	s.setUnread(project, []string{id}, unread)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"id": id, "unread": unread})
+}
+
+// handleMarkRead marks a single message as read
+func (s *Server) handleMarkRead(w http.ResponseWriter, r *http.Request) {
+	s.markOne(w, r, false)
+}
+
+// handleMarkUnread marks a single message as unread again
+func (s *Server) handleMarkUnread(w http.ResponseWriter, r *http.Request) {
+	s.markOne(w, r, true)
+}
+
+// handleMarkMessagesRead marks several messages as read: {"ids": [...]} for
+// specific messages or {"all": true} for the whole project
+func (s *Server) handleMarkMessagesRead(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		IDs []string `json:"ids"`
+		All bool     `json:"all"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.IDs) == 0 && !req.All {
+		http.Error(w, "Missing 'ids' field (or set 'all' to true)", http.StatusBadRequest)
+		return
+	}
+
+	ids := req.IDs
+	if req.All {
+		ids = nil
+	}
+	changed := s.setUnread(projectFromRequest(r), ids, false)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"marked": len(changed),
+		"ids":    changed,
+	})
+}
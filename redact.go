@@ -0,0 +1,153 @@
+package smspit
+
+import (
+	"log"
+	"regexp"
+	"strings"
+)
+
+// Redaction modes (SMSPIT_REDACT_MODE)
+const (
+	redactAtCapture = "capture" // Bodies are redacted before they are stored
+	redactAtDisplay = "display" // The original is kept for OTP extraction, waits and relaying
+)
+
+// RedactRule replaces text matching Pattern in message bodies with
+// Replacement, which can refer to the pattern's groups as ${1}
+type RedactRule struct {
+	Pattern     string
+	Replacement string
+
+	re *regexp.Regexp
+}
+
+// redactPresets are rules that can be used by name in SMSPIT_REDACT_RULES
+var redactPresets = map[string]RedactRule{
+	// Card-like runs of 13-19 digits, optionally grouped, keeping the last 4
+	"cards": {Pattern: `\b(?:\d[ -]?){9,15}(\d{4})\b`, Replacement: "****${1}"},
+	// Phone-like numbers of 7 or more digits, keeping the last 4
+	"numbers": {Pattern: `\+?\b\d{3,}(\d{4})\b`, Replacement: "***${1}"},
+}
+
+// parseRedactRules parses "replacement=regex;preset" into redaction rules,
+// applied in order. They are validated when the server is created.
+func parseRedactRules(val string) []RedactRule {
+	var rules []RedactRule
+	for _, entry := range strings.Split(val, ";") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		if preset, ok := redactPresets[entry]; ok {
+			rules = append(rules, preset)
+			continue
+		}
+		replacement, pattern, _ := strings.Cut(entry, "=")
+		rules = append(rules, RedactRule{Pattern: pattern, Replacement: replacement})
+	}
+	return rules
+}
+
+// compileRedactRules compiles the configured rules, skipping invalid ones
+func compileRedactRules(rules []RedactRule) []RedactRule {
+	var compiled []RedactRule
+	for _, rule := range rules {
+		if rule.Pattern == "" {
+			log.Printf("⚠️ Ignoring redaction rule %q: missing pattern", rule.Replacement)
+			continue
+		}
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			log.Printf("⚠️ Ignoring invalid redaction rule %q: %v", rule.Pattern, err)
+			continue
+		}
+		rule.re = re
+		compiled = append(compiled, rule)
+	}
+	return compiled
+}
+
+// redactMessage applies the redaction rules to msg's body, and to template
+// variables and the text and cards of RCS and Viber messages, which are
+// never kept unredacted. When
+// redacting at display time the original body is kept on the message, but
+// never served.
+func (s *Server) redactMessage(msg *Message) {
+	if msg.RCS != nil {
+		s.redactRCS(msg.RCS)
+	}
+	if msg.Viber != nil {
+		msg.Viber.Text = s.redact(msg.Viber.Text)
+	}
+	if len(msg.TemplateVariables) > 0 {
+		variables := make(map[string]string, len(msg.TemplateVariables))
+		for name, value := range msg.TemplateVariables {
+			variables[name] = s.redact(value)
+		}
+		msg.TemplateVariables = variables
+	}
+	body := s.redact(msg.Body)
+	s.redactParts(msg, body)
+	if body == msg.Body {
+		return
+	}
+	if s.config.RedactMode == redactAtDisplay {
+		msg.original = msg.Body
+	}
+	msg.Body = body
+}
+
+// redactParts redacts the parts a concatenated message was reassembled
+// from, given its redacted body. When a redacted value spans two parts the
+// parts can't be redacted on their own, so their bodies are dropped.
+func (s *Server) redactParts(msg *Message, body string) {
+	if len(msg.parts) == 0 {
+		return
+	}
+	parts := make([]MessagePart, len(msg.parts))
+	var joined strings.Builder
+	for i, part := range msg.parts {
+		part.Body = s.redact(part.Body)
+		joined.WriteString(part.Body)
+		parts[i] = part
+	}
+	if joined.String() != body {
+		for i := range parts {
+			parts[i].Body = ""
+		}
+	}
+	msg.parts = parts
+}
+
+// redactSinchBatch redacts the body and parameter values of a Sinch batch
+// before it is stored, as the batch API serves them back. Its messages are
+// redacted like any other.
+func (s *Server) redactSinchBatch(req *SinchBatchRequest) {
+	req.Body = s.redact(req.Body)
+	if len(req.Parameters) == 0 {
+		return
+	}
+	params := make(map[string]map[string]string, len(req.Parameters))
+	for name, values := range req.Parameters {
+		params[name] = make(map[string]string, len(values))
+		for to, value := range values {
+			params[name][to] = s.redact(value)
+		}
+	}
+	req.Parameters = params
+}
+
+// redact returns body with the redaction rules applied
+func (s *Server) redact(body string) string {
+	for _, rule := range s.redactRules {
+		body = rule.re.ReplaceAllString(body, rule.Replacement)
+	}
+	return body
+}
+
+// text returns the message's body as sent, before any display-time redaction
+func (m Message) text() string {
+	if m.original != "" {
+		return m.original
+	}
+	return m.Body
+}
@@ -0,0 +1,102 @@
+package smspit
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+var codeRule = []RedactRule{{Pattern: `\b\d{6}\b`, Replacement: "[code]"}}
+
+func TestRedactModes(t *testing.T) {
+	tests := []struct {
+		mode     string
+		wantText string // What waits, OTP extraction and relaying see
+	}{
+		{"", "Your code is [code]"},
+		{redactAtDisplay, "Your code is 123456"},
+	}
+	for _, tt := range tests {
+		t.Run("mode "+tt.mode, func(t *testing.T) {
+			ts := newTestServer(t, Config{RedactRules: codeRule, RedactMode: tt.mode})
+			id := ts.send(t, "+15551230001", "Your code is 123456")
+
+			for _, path := range []string{"/api/v1/messages", "/api/v1/messages/" + id, "/api/v1/messages/export?format=ndjson"} {
+				if body := do(t, ts.web, "GET", path, "").Body.String(); strings.Contains(body, "123456") {
+					t.Errorf("GET %s shows the code: %s", path, body)
+				}
+			}
+			if msg, _ := ts.findMessage(id); msg.text() != tt.wantText {
+				t.Errorf("text = %q, want %q", msg.text(), tt.wantText)
+			}
+		})
+	}
+}
+
+func TestRedactConcatParts(t *testing.T) {
+	ts := newTestServer(t, Config{KannelCompat: true, RedactRules: codeRule})
+
+	ts.sendPart(t, "+15551230001", "Your code is 123456. ", 1, 2, 1)
+	ts.sendPart(t, "+15551230001", "Don't share it.", 1, 2, 2)
+	// The code spans both parts of this one
+	ts.sendPart(t, "+15551230002", "Your code is 123", 2, 2, 1)
+	ts.sendPart(t, "+15551230002", "456. Don't share it.", 2, 2, 2)
+
+	parts := make(map[string][]MessagePart)
+	for _, msg := range ts.messages(t) {
+		if strings.Contains(msg.Body, "123456") {
+			t.Errorf("message to %s not redacted: %q", msg.To, msg.Body)
+		}
+		w := do(t, ts.web, "GET", "/api/v1/messages/"+msg.ID+"/parts", "")
+		var resp struct {
+			Parts []MessagePart `json:"parts"`
+		}
+		decode(t, w, &resp)
+		parts[msg.To] = resp.Parts
+	}
+
+	got := parts["+15551230001"]
+	if len(got) != 2 || got[0].Body != "Your code is [code]. " || got[1].Body != "Don't share it." {
+		t.Errorf("parts = %+v, want the code redacted in the first", got)
+	}
+	got = parts["+15551230002"]
+	if len(got) != 2 {
+		t.Fatalf("got %d parts, want 2", len(got))
+	}
+	for _, part := range got {
+		if part.Body != "" {
+			t.Errorf("part %d body = %q, want it left out", part.Seq, part.Body)
+		}
+	}
+}
+
+func TestRedactSinchBatch(t *testing.T) {
+	ts := newTestServer(t, Config{SinchCompat: true, RedactRules: codeRule})
+
+	w := do(t, ts.api, "POST", "/xms/v1/plan/batches", `{
+		"from": "+15550009999",
+		"to": ["+15551230001"],
+		"body": "Your code is ${code}, or 654321",
+		"parameters": {"code": {"+15551230001": "123456"}}
+	}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("batch: %d %s", w.Code, w.Body)
+	}
+	var created struct {
+		ID string `json:"id"`
+	}
+	decode(t, w, &created)
+
+	for _, resp := range []string{
+		w.Body.String(),
+		do(t, ts.api, "GET", "/xms/v1/plan/batches/"+created.ID, "").Body.String(),
+		do(t, ts.api, "GET", "/xms/v1/plan/batches", "").Body.String(),
+	} {
+		if strings.Contains(resp, "123456") || strings.Contains(resp, "654321") {
+			t.Errorf("batch not redacted: %s", resp)
+		}
+	}
+	if msgs := ts.messages(t); len(msgs) != 1 || msgs[0].Body != "Your code is [code], or [code]" {
+		t.Errorf("messages = %+v, want one redacted", msgs)
+	}
+}
@@ -0,0 +1,241 @@
+package smspit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Relay providers
+const (
+	relayTwilio = "twilio"
+	relayVonage = "vonage"
+)
+
+// Default provider API base URLs, overridable with SMSPIT_RELAY_URL
+var relayBaseURLs = map[string]string{
+	relayTwilio: "https://api.twilio.com",
+	relayVonage: "https://rest.nexmo.com",
+}
+
+// relayClient sends relayed messages to the real provider
+var relayClient = &http.Client{Timeout: 15 * time.Second}
+
+// RelayResult records the outcome of relaying a message to a real provider
+type RelayResult struct {
+	Provider   string    `json:"provider"`
+	Status     string    `json:"status"` // relayed or failed
+	ProviderID string    `json:"provider_id,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	At         time.Time `json:"at"`
+}
+
+// relayEnabled reports whether a relay provider is configured
+func (s *Server) relayEnabled() bool {
+	return s.config.RelayProvider != "" && s.config.RelayAccount != "" && s.config.RelaySecret != ""
+}
+
+// relayAllowed reports whether to matches the relay allowlist. Entries match
+// exactly, or as a prefix when they end in "*".
+func (s *Server) relayAllowed(to string) bool {
+	for _, allowed := range s.config.RelayAllowlist {
+		if prefix, ok := strings.CutSuffix(allowed, "*"); ok {
+			if strings.HasPrefix(to, prefix) {
+				return true
+			}
+		} else if to == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// maybeRelay relays an outbound message in the background when its
+// recipient is on the allowlist
+func (s *Server) maybeRelay(msg Message) {
+	if !s.relayEnabled() || msg.Direction != "outbound" || !s.relayAllowed(msg.To) {
+		return
+	}
+	go s.relayMessage(msg.traceContext(), msg)
+}
+
+// relayMessage sends msg through the real provider, records the result on
+// the stored message and broadcasts a message_relayed event. The relay's
+// span is a child of ctx's.
+func (s *Server) relayMessage(ctx context.Context, msg Message) RelayResult {
+	from := msg.From
+	if s.config.RelayFrom != "" {
+		from = s.config.RelayFrom
+	}
+
+	result := RelayResult{Provider: s.config.RelayProvider, Status: "relayed", At: time.Now()}
+	ctx, span := s.tracer.Start(ctx, "smspit.relay", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("smspit.message.id", msg.ID),
+		attribute.String("smspit.project", msg.Project),
+		attribute.String("smspit.relay.provider", result.Provider),
+	))
+	var err error
+	switch s.config.RelayProvider {
+	case relayTwilio:
+		result.ProviderID, err = s.relayTwilio(ctx, msg.To, from, msg.text())
+	case relayVonage:
+		result.ProviderID, err = s.relayVonage(ctx, msg.To, from, msg.text())
+	default:
+		err = fmt.Errorf("unknown relay provider %q", s.config.RelayProvider)
+	}
+	endSpan(span, err)
+	if err != nil {
+		result.Status = "failed"
+		result.Error = err.Error()
+		log.Printf("❌ Relay failed: ID=%s To=%s Error=%v", msg.ID, msg.To, err)
+	} else {
+		log.Printf("📡 Relayed via %s: ID=%s To=%s ProviderID=%s", result.Provider, msg.ID, msg.To, result.ProviderID)
+	}
+
+	s.mu.Lock()
+	for i := range s.messages {
+		if s.messages[i].ID == msg.ID {
+			s.messages[i].Relay = &result
+			break
+		}
+	}
+	s.mu.Unlock()
+	s.syncSaved(msg.key())
+
+	s.broadcastEvent(map[string]interface{}{
+		"type":       "message_relayed",
+		"project":    msg.Project,
+		"message_id": msg.ID,
+		"relay":      result,
+	})
+	return result
+}
+
+// relayBaseURL returns the provider API base URL
+func (s *Server) relayBaseURL() string {
+	if s.config.RelayURL != "" {
+		return strings.TrimSuffix(s.config.RelayURL, "/")
+	}
+	return relayBaseURLs[s.config.RelayProvider]
+}
+
+// relayTwilio sends through Twilio's Messages API and returns the message SID
+func (s *Server) relayTwilio(ctx context.Context, to, from, body string) (string, error) {
+	endpoint := fmt.Sprintf("%s/2010-04-01/Accounts/%s/Messages.json", s.relayBaseURL(), url.PathEscape(s.config.RelayAccount))
+	form := url.Values{"To": {to}, "From": {from}, "Body": {body}}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(s.config.RelayAccount, s.config.RelaySecret)
+	injectTrace(ctx, req)
+
+	resp, err := relayClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		SID     string `json:"sid"`
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	if resp.StatusCode >= 300 {
+		return "", fmt.Errorf("twilio error %d (status %d): %s", result.Code, resp.StatusCode, result.Message)
+	}
+	return result.SID, nil
+}
+
+// relayVonage sends through Vonage's SMS API and returns the message ID
+func (s *Server) relayVonage(ctx context.Context, to, from, body string) (string, error) {
+	form := url.Values{
+		"api_key":    {s.config.RelayAccount},
+		"api_secret": {s.config.RelaySecret},
+		"to":         {strings.TrimPrefix(to, "+")},
+		"from":       {strings.TrimPrefix(from, "+")},
+		"text":       {body},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", s.relayBaseURL()+"/sms/json", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	injectTrace(ctx, req)
+
+	resp, err := relayClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Messages []struct {
+			Status    string `json:"status"`
+			MessageID string `json:"message-id"`
+			ErrorText string `json:"error-text"`
+		} `json:"messages"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("vonage response (status %d): %v", resp.StatusCode, err)
+	}
+	if len(result.Messages) == 0 {
+		return "", fmt.Errorf("vonage returned no messages (status %d)", resp.StatusCode)
+	}
+	if m := result.Messages[0]; m.Status != "0" {
+		return "", fmt.Errorf("vonage error %s: %s", m.Status, m.ErrorText)
+	}
+	return result.Messages[0].MessageID, nil
+}
+
+// handleRelayMessage relays a captured message on demand. The recipient must
+// still be on the allowlist.
+func (s *Server) handleRelayMessage(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	if !s.relayEnabled() {
+		http.Error(w, "Relay is not configured (set SMSPIT_RELAY_PROVIDER, SMSPIT_RELAY_ACCOUNT and SMSPIT_RELAY_SECRET)", http.StatusConflict)
+		return
+	}
+
+	s.mu.RLock()
+	var msg *Message
+	for _, m := range s.messagesFor(projectFromRequest(r)) {
+		if m.ID == id {
+			m := m
+			msg = &m
+			break
+		}
+	}
+	s.mu.RUnlock()
+
+	if msg == nil {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	}
+	if !s.relayAllowed(msg.To) {
+		http.Error(w, "Recipient "+msg.To+" is not on the relay allowlist", http.StatusForbidden)
+		return
+	}
+
+	result := s.relayMessage(context.WithoutCancel(r.Context()), *msg)
+
+	w.Header().Set("Content-Type", "application/json")
+	if result.Status == "failed" {
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	json.NewEncoder(w).Encode(result)
+}
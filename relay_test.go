@@ -0,0 +1,219 @@
+package smspit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// relayCall is a request the fake provider received
+type relayCall struct {
+	path string
+	form url.Values
+	user string
+	pass string
+}
+
+// fakeRelayProvider answers relayed messages as Twilio or Vonage would,
+// with an error when fail is set, and records them
+func fakeRelayProvider(t *testing.T, fail bool) (*httptest.Server, chan relayCall) {
+	calls := make(chan relayCall, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		user, pass, _ := r.BasicAuth()
+		calls <- relayCall{path: r.URL.Path, form: r.PostForm, user: user, pass: pass}
+
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/sms/json" && fail:
+			w.Write([]byte(`{"messages":[{"status":"2","error-text":"Missing to param"}]}`))
+		case r.URL.Path == "/sms/json":
+			w.Write([]byte(`{"messages":[{"status":"0","message-id":"V1"}]}`))
+		case fail:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"code":21211,"message":"Invalid 'To' Phone Number"}`))
+		default:
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"sid":"SM1"}`))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, calls
+}
+
+// relayedMessage waits for msg id's relay result
+func (ts *testServer) relayedMessage(t *testing.T, id string) *RelayResult {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, msg := range ts.messages(t) {
+			if msg.ID == id && msg.Relay != nil {
+				return msg.Relay
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return nil
+}
+
+func TestRelay(t *testing.T) {
+	tests := []struct {
+		name      string
+		provider  string
+		allowlist []string
+		relayFrom string
+		fail      bool
+		want      *RelayResult // nil when the message isn't relayed
+		wantPath  string
+		wantForm  url.Values
+	}{
+		{
+			name:      "Twilio",
+			provider:  relayTwilio,
+			allowlist: []string{"+15551230001"},
+			want:      &RelayResult{Provider: relayTwilio, Status: "relayed", ProviderID: "SM1"},
+			wantPath:  "/2010-04-01/Accounts/AC123/Messages.json",
+			wantForm:  url.Values{"To": {"+15551230001"}, "From": {"+15550009999"}, "Body": {"Hello"}},
+		},
+		{
+			name:      "Twilio, prefix allowlist and relay sender",
+			provider:  relayTwilio,
+			allowlist: []string{"+1555123*"},
+			relayFrom: "+15557654321",
+			want:      &RelayResult{Provider: relayTwilio, Status: "relayed", ProviderID: "SM1"},
+			wantPath:  "/2010-04-01/Accounts/AC123/Messages.json",
+			wantForm:  url.Values{"To": {"+15551230001"}, "From": {"+15557654321"}, "Body": {"Hello"}},
+		},
+		{
+			name:      "Twilio error",
+			provider:  relayTwilio,
+			allowlist: []string{"+15551230001"},
+			fail:      true,
+			want:      &RelayResult{Provider: relayTwilio, Status: "failed", Error: "twilio error 21211 (status 400): Invalid 'To' Phone Number"},
+			wantPath:  "/2010-04-01/Accounts/AC123/Messages.json",
+		},
+		{
+			name:      "Vonage",
+			provider:  relayVonage,
+			allowlist: []string{"+15551230001"},
+			want:      &RelayResult{Provider: relayVonage, Status: "relayed", ProviderID: "V1"},
+			wantPath:  "/sms/json",
+			wantForm: url.Values{
+				"api_key": {"AC123"}, "api_secret": {"s3cret"},
+				"to": {"15551230001"}, "from": {"15550009999"}, "text": {"Hello"},
+			},
+		},
+		{
+			name:      "Vonage error",
+			provider:  relayVonage,
+			allowlist: []string{"+15551230001"},
+			fail:      true,
+			want:      &RelayResult{Provider: relayVonage, Status: "failed", Error: "vonage error 2: Missing to param"},
+			wantPath:  "/sms/json",
+		},
+		{
+			name:      "not on the allowlist",
+			provider:  relayTwilio,
+			allowlist: []string{"+15551230002", "+1666*"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, calls := fakeRelayProvider(t, tt.fail)
+			ts := newTestServer(t, Config{
+				RelayProvider:  tt.provider,
+				RelayAccount:   "AC123",
+				RelaySecret:    "s3cret",
+				RelayFrom:      tt.relayFrom,
+				RelayAllowlist: tt.allowlist,
+				RelayURL:       srv.URL,
+			})
+			id := ts.send(t, "+15551230001", "Hello")
+
+			if tt.want == nil {
+				time.Sleep(50 * time.Millisecond)
+				select {
+				case call := <-calls:
+					t.Errorf("relayed to %s, want no relay", call.path)
+				default:
+				}
+				return
+			}
+
+			result := ts.relayedMessage(t, id)
+			if result == nil {
+				t.Fatal("message not relayed")
+			}
+			if result.Provider != tt.want.Provider || result.Status != tt.want.Status || result.ProviderID != tt.want.ProviderID || result.Error != tt.want.Error {
+				t.Errorf("relay %+v, want %+v", result, tt.want)
+			}
+			call := <-calls
+			if call.path != tt.wantPath {
+				t.Errorf("relayed to %s, want %s", call.path, tt.wantPath)
+			}
+			if tt.provider == relayTwilio && (call.user != "AC123" || call.pass != "s3cret") {
+				t.Errorf("Twilio credentials %q:%q", call.user, call.pass)
+			}
+			for key, want := range tt.wantForm {
+				if got := call.form.Get(key); got != want[0] {
+					t.Errorf("relayed %s = %q, want %q", key, got, want[0])
+				}
+			}
+		})
+	}
+}
+
+func TestRelayOnDemand(t *testing.T) {
+	srv, calls := fakeRelayProvider(t, false)
+
+	unconfigured := newTestServer(t, Config{})
+	id := unconfigured.send(t, "+15551230001", "Hello")
+	if w := do(t, unconfigured.web, "POST", "/api/v1/messages/"+id+"/relay", ""); w.Code != http.StatusConflict {
+		t.Errorf("relay without a provider: %d, want 409", w.Code)
+	}
+
+	ts := newTestServer(t, Config{
+		RelayProvider:  relayTwilio,
+		RelayAccount:   "AC123",
+		RelaySecret:    "s3cret",
+		RelayAllowlist: []string{"+15551230001"},
+		RelayURL:       srv.URL,
+	})
+	allowed := ts.send(t, "+15551230001", "Hello")
+	ts.relayedMessage(t, allowed)
+	<-calls
+	other := ts.send(t, "+15551230002", "Hello")
+
+	tests := []struct {
+		name, id string
+		project  string
+		want     int
+	}{
+		{"allowlisted recipient", allowed, "", http.StatusOK},
+		{"recipient not on the allowlist", other, "", http.StatusForbidden},
+		{"unknown message", "msg_missing", "", http.StatusNotFound},
+		{"another project's message", allowed, "other", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var header []string
+			if tt.project != "" {
+				header = []string{projectHeader, tt.project}
+			}
+			w := do(t, ts.web, "POST", "/api/v1/messages/"+tt.id+"/relay", "", header...)
+			if w.Code != tt.want {
+				t.Fatalf("relay: %d %s, want %d", w.Code, w.Body, tt.want)
+			}
+			if tt.want == http.StatusOK {
+				var result RelayResult
+				decode(t, w, &result)
+				if result.Status != "relayed" || result.ProviderID != "SM1" {
+					t.Errorf("relay result %+v", result)
+				}
+				<-calls
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package smspit
+
+import (
+	"log"
+	"time"
+)
+
+// retentionInterval returns how often to prune for a retention window: often
+// enough that messages don't outlive it by much, but at most once a minute
+func retentionInterval(retention time.Duration) time.Duration {
+	interval := retention / 10
+	if interval > time.Minute {
+		interval = time.Minute
+	}
+	if interval < time.Second {
+		interval = time.Second
+	}
+	return interval
+}
+
+// expiryInterval is how often messages sent with a ttl are checked for
+// expiry
+const expiryInterval = time.Second
+
+// runExpiry deletes messages whose ttl has run out until stop is closed
+func (s *Server) runExpiry(stop <-chan struct{}) {
+	ticker := time.NewTicker(expiryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			s.expireMessages(now)
+		case <-stop:
+			return
+		}
+	}
+}
+
+// expireMessages removes messages whose DeleteAt has passed and emits a
+// message_expired event for each
+func (s *Server) expireMessages(now time.Time) int {
+	var expired []Message
+
+	s.mu.Lock()
+	kept := s.messages[:0]
+	for _, msg := range s.messages {
+		if msg.DeleteAt != nil && !now.Before(*msg.DeleteAt) {
+			expired = append(expired, msg)
+			continue
+		}
+		kept = append(kept, msg)
+	}
+	s.messages = kept
+	s.mu.Unlock()
+	s.syncRemoved(expired...)
+
+	for _, msg := range expired {
+		s.broadcastEvent(map[string]interface{}{
+			"type":       "message_expired",
+			"project":    msg.Project,
+			"message_id": msg.ID,
+		})
+	}
+	if len(expired) > 0 {
+		log.Printf("⌛ Deleted %d messages whose ttl ran out", len(expired))
+	}
+	return len(expired)
+}
+
+// runRetention prunes messages older than SMSPIT_RETENTION until stop is closed
+func (s *Server) runRetention(stop <-chan struct{}) {
+	ticker := time.NewTicker(retentionInterval(s.config.Retention))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.pruneMessages(time.Now().Add(-s.config.Retention))
+		case <-stop:
+			return
+		}
+	}
+}
+
+// pruneMessages removes messages created before cutoff and emits one
+// messages_pruned event per affected project
+func (s *Server) pruneMessages(cutoff time.Time) int {
+	pruned := make(map[string][]string)
+	var removed []Message
+
+	s.mu.Lock()
+	kept := s.messages[:0]
+	for _, msg := range s.messages {
+		if msg.CreatedAt.Before(cutoff) {
+			pruned[msg.Project] = append(pruned[msg.Project], msg.ID)
+			removed = append(removed, msg)
+			continue
+		}
+		kept = append(kept, msg)
+	}
+	s.messages = kept
+	s.mu.Unlock()
+	s.syncRemoved(removed...)
+
+	total := 0
+	for project, ids := range pruned {
+		total += len(ids)
+		s.broadcastEvent(map[string]interface{}{
+			"type":    "messages_pruned",
+			"project": project,
+			"count":   len(ids),
+			"ids":     ids,
+			"before":  cutoff,
+		})
+	}
+
+	if total > 0 {
+		log.Printf("🧹 Pruned %d messages older than %s", total, cutoff.Format(time.RFC3339))
+	}
+	return total
+}
@@ -0,0 +1,129 @@
+package smspit
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+var (
+	errMessageNotFound = errors.New("message not found")
+	// errNotScheduled is returned when canceling a message that isn't (or is
+	// no longer) scheduled
+	errNotScheduled = errors.New("message is not scheduled")
+)
+
+// sendScheduled sends a scheduled message at its send time, unless it was
+// canceled: it moves to captured (or queued, then through the delivery
+// lifecycle, when simulating) with a status_update event, and is relayed.
+// Messages content screening flagged become filtered instead.
+func (s *Server) sendScheduled(id string) {
+	msg, ok := s.findMessage(id)
+	if !ok || msg.Status != "scheduled" {
+		return
+	}
+
+	if len(msg.FilteredBy) > 0 {
+		if updated, ok := s.updateMessageStatus(id, filteredStatus); ok {
+			log.Printf("🚫 Scheduled SMS filtered: ID=%s To=%s", id, msg.To)
+			s.sendStatusReports(updated)
+		}
+		return
+	}
+
+	wait := s.queueDelay(msg)
+	simulate := s.config.DeliverySim || msg.wantsStatusReports() || wait > 0
+	status := "captured"
+	if simulate {
+		status = "queued"
+	}
+	updated, ok := s.updateMessageStatus(id, status)
+	if !ok {
+		return // Canceled or deleted meanwhile
+	}
+	log.Printf("⏰ Scheduled SMS sent: ID=%s To=%s", id, msg.To)
+
+	s.maybeRelay(updated)
+	s.maybeAutoReply(updated)
+	if simulate {
+		go s.simulateDelivery(updated, wait)
+	}
+}
+
+// findMessage returns the stored message with the given ID
+func (s *Server) findMessage(id string) (Message, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, msg := range s.messages {
+		if msg.ID == id {
+			return msg, true
+		}
+	}
+	return Message{}, false
+}
+
+// cancelScheduled cancels one of project's scheduled messages, sending its
+// status callback
+func (s *Server) cancelScheduled(project, id string) (Message, error) {
+	msg, ok := s.findMessage(id)
+	if !ok || msg.Project != project {
+		return Message{}, errMessageNotFound
+	}
+	updated, ok := s.updateMessageStatus(id, "canceled")
+	if !ok {
+		return msg, errNotScheduled
+	}
+	log.Printf("🚫 Scheduled SMS canceled: ID=%s To=%s", id, msg.To)
+	go s.sendStatusReports(updated)
+	return updated, nil
+}
+
+// handleCancelMessage cancels a scheduled message
+func (s *Server) handleCancelMessage(w http.ResponseWriter, r *http.Request) {
+	msg, err := s.cancelScheduled(projectFromRequest(r), mux.Vars(r)["id"])
+	switch {
+	case errors.Is(err, errMessageNotFound):
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, "Message is not scheduled (status: "+msg.Status+")", http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(msg)
+}
+
+// handleTwilioUpdateMessage handles Twilio's message update, which cancels
+// a scheduled message with Status=canceled
+func (s *Server) handleTwilioUpdateMessage(w http.ResponseWriter, r *http.Request) {
+	sid := mux.Vars(r)["messageSid"]
+	if status := r.FormValue("Status"); status != "canceled" {
+		writeTwilioError(w, twilioErrorCatalog[20001], "Status", status)
+		return
+	}
+
+	var msg Message
+	found := false
+	for _, m := range s.twilioMessages(r) {
+		if m.ID == sid {
+			msg, found = m, true
+			break
+		}
+	}
+	if !found {
+		writeTwilioError(w, twilioErrorCatalog[20404], r.URL.Path)
+		return
+	}
+
+	msg, err := s.cancelScheduled(msg.Project, sid)
+	if err != nil {
+		writeTwilioError(w, twilioErrorCatalog[20001], "Status", "message "+sid+" is not scheduled")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(twilioResource(msg))
+}
@@ -0,0 +1,194 @@
+package smspit
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Content screening modes
+const (
+	screenFlag   = "flag"
+	screenReject = "reject"
+)
+
+// filteredStatus is the status of an outbound message content screening
+// flagged; Twilio reports it as undelivered with error 30007
+const filteredStatus = "filtered"
+
+// Kinds of content screening rule
+const (
+	ruleBannedWord   = "banned_word"
+	ruleURLShortener = "url_shortener"
+	ruleSHAFT        = "shaft"
+)
+
+// urlShorteners are public URL shortener hosts, which US carriers filter in
+// A2P traffic because they hide where a link goes
+var urlShorteners = []string{
+	"adf.ly", "bit.do", "bit.ly", "bl.ink", "buff.ly", "cutt.ly", "goo.gl", "is.gd", "ow.ly",
+	"rb.gy", "rebrand.ly", "s.id", "shorturl.at", "t.co", "t.ly", "tiny.cc", "tinyurl.com", "v.gd",
+}
+
+// shaftKeywords are sample words for each SHAFT category (sex, hate,
+// alcohol, firearms, tobacco, plus cannabis), enough to exercise a filter
+// rather than match a carrier's lists
+var shaftKeywords = map[string][]string{
+	"sex":      {"sex", "sexy", "xxx", "nude", "nudes", "porn", "escort", "hookup"},
+	"hate":     {"white power", "kkk", "neo-nazi", "racial purity"},
+	"alcohol":  {"beer", "wine", "vodka", "whiskey", "tequila", "liquor", "happy hour"},
+	"firearms": {"gun", "guns", "firearm", "firearms", "rifle", "pistol", "ammo", "ammunition"},
+	"tobacco":  {"tobacco", "cigarette", "cigarettes", "cigar", "cigars", "vape", "nicotine"},
+	"cannabis": {"cannabis", "marijuana", "weed", "thc", "cbd", "dispensary"},
+}
+
+// ContentMatch is one content rule an outbound message broke
+type ContentMatch struct {
+	Rule     string `json:"rule"`               // banned_word, url_shortener or shaft
+	Category string `json:"category,omitempty"` // SHAFT category
+	Match    string `json:"match"`              // The word or host found
+}
+
+func (m ContentMatch) String() string {
+	switch m.Rule {
+	case ruleURLShortener:
+		return "URL shortener " + m.Match
+	case ruleSHAFT:
+		return fmt.Sprintf("%s content (%q)", m.Category, m.Match)
+	}
+	return fmt.Sprintf("banned word %q", m.Match)
+}
+
+// ContentFilteredError is returned in reject mode when capturing an
+// outbound message that content screening flagged
+type ContentFilteredError struct {
+	Matches []ContentMatch
+}
+
+func (e *ContentFilteredError) Error() string {
+	reasons := make([]string, len(e.Matches))
+	for i, m := range e.Matches {
+		reasons[i] = m.String()
+	}
+	return fmt.Sprintf(twilioErrorCatalog[30007].Message, strings.Join(reasons, ", "))
+}
+
+// contentRule is a compiled word rule
+type contentRule struct {
+	rule, category, word string
+	re                   *regexp.Regexp
+}
+
+// contentScreen holds the compiled content screening rules
+type contentScreen struct {
+	words      []contentRule
+	shorteners map[string]bool
+}
+
+// newContentScreen compiles the banned words, URL shortener check and SHAFT
+// categories from the config. It returns nil when nothing is screened.
+func newContentScreen(config Config) *contentScreen {
+	screen := &contentScreen{}
+	for _, word := range config.ScreenBannedWords {
+		screen.words = append(screen.words, newContentRule(ruleBannedWord, "", word))
+	}
+	for _, category := range config.ScreenSHAFT {
+		category = strings.ToLower(category)
+		keywords, ok := shaftKeywords[category]
+		if !ok {
+			log.Printf("⚠️ Unknown SMSPIT_SCREEN_SHAFT category %q, ignoring it (use %s)", category, strings.Join(shaftCategories(), ", "))
+			continue
+		}
+		for _, word := range keywords {
+			screen.words = append(screen.words, newContentRule(ruleSHAFT, category, word))
+		}
+	}
+	if config.ScreenShorteners {
+		screen.shorteners = make(map[string]bool, len(urlShorteners))
+		for _, host := range urlShorteners {
+			screen.shorteners[host] = true
+		}
+	}
+	if len(screen.words) == 0 && screen.shorteners == nil {
+		return nil
+	}
+	return screen
+}
+
+// newContentRule matches word as a whole word or phrase, ignoring case
+func newContentRule(rule, category, word string) contentRule {
+	pattern := `(?i)(?:^|[^\pL\pN])(` + regexp.QuoteMeta(strings.TrimSpace(word)) + `)(?:$|[^\pL\pN])`
+	return contentRule{rule: rule, category: category, word: word, re: regexp.MustCompile(pattern)}
+}
+
+// screen returns the rules body breaks, each banned word, category and
+// shortener once
+func (c *contentScreen) screen(body string) []ContentMatch {
+	var matches []ContentMatch
+	seen := make(map[string]bool)
+	for _, rule := range c.words {
+		key := rule.rule + ":" + rule.category
+		if rule.rule == ruleBannedWord {
+			key += ":" + strings.ToLower(rule.word)
+		}
+		if seen[key] {
+			continue
+		}
+		if m := rule.re.FindStringSubmatch(body); m != nil {
+			seen[key] = true
+			matches = append(matches, ContentMatch{Rule: rule.rule, Category: rule.category, Match: m[1]})
+		}
+	}
+	for _, link := range extractLinks(body) {
+		host := strings.ToLower(link.Host)
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.TrimPrefix(host, "www.")
+		if c.shorteners[host] && !seen[host] {
+			seen[host] = true
+			matches = append(matches, ContentMatch{Rule: ruleURLShortener, Match: host})
+		}
+	}
+	return matches
+}
+
+// screenContent runs content screening on an outbound message. Flagged
+// messages record the rules they broke in filtered_by and are stored as
+// filtered (see storeMessage), or are refused in reject mode.
+func (s *Server) screenContent(msg *Message) error {
+	if s.screening == nil || msg.Direction != "outbound" {
+		return nil
+	}
+	matches := s.screening.screen(msg.Body)
+	if len(matches) == 0 {
+		return nil
+	}
+	if s.config.ScreenMode == screenReject {
+		err := &ContentFilteredError{Matches: matches}
+		log.Printf("🚫 Message to %s refused by content screening: %v", msg.To, err)
+		return err
+	}
+	msg.FilteredBy = matches
+	return nil
+}
+
+// writeContentFilteredError answers a capture request refused by content
+// screening, in the provider's error format (Twilio code 30007)
+func writeContentFilteredError(w http.ResponseWriter, r *http.Request, err *ContentFilteredError) {
+	writeProviderError(w, r, http.StatusBadRequest, 30007, err.Error(), 0)
+}
+
+// shaftCategories lists the SHAFT categories SMSPIT_SCREEN_SHAFT accepts
+func shaftCategories() []string {
+	categories := make([]string, 0, len(shaftKeywords))
+	for category := range shaftKeywords {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	return categories
+}
@@ -0,0 +1,207 @@
+package smspit
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// SavedSearch is a named search query, e.g. "OTP messages" for tag:otp,
+// that the UI offers as a one-click filter
+type SavedSearch struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Query     string    `json:"query"`
+	Project   string    `json:"project"`
+	CreatedAt time.Time `json:"created_at"`
+	// Messages currently matching the query, filled in when served
+	Count  int `json:"count"`
+	Unread int `json:"unread"`
+}
+
+// SavedSearchRequest is the body for saving a search. Project only applies
+// in the config file; the API saves to the request's project.
+type SavedSearchRequest struct {
+	Name    string `json:"name"`
+	Query   string `json:"query"`
+	Project string `json:"project,omitempty"`
+}
+
+// searchStore holds saved searches in the order they were added
+type searchStore struct {
+	mu       sync.RWMutex
+	searches []SavedSearch
+}
+
+// addSavedSearch validates and saves a search in project. Names are unique
+// within a project, ignoring case.
+func (s *Server) addSavedSearch(req SavedSearchRequest, project string) (SavedSearch, int, error) {
+	name, query := strings.TrimSpace(req.Name), strings.TrimSpace(req.Query)
+	if name == "" {
+		return SavedSearch{}, http.StatusBadRequest, fmt.Errorf("Missing 'name' field")
+	}
+	if query == "" {
+		return SavedSearch{}, http.StatusBadRequest, fmt.Errorf("Missing 'query' field")
+	}
+	if _, err := parseQuery(query); err != nil {
+		return SavedSearch{}, http.StatusBadRequest, fmt.Errorf("Invalid query: %v", err)
+	}
+
+	defer s.syncRecords(kindSearches)
+	s.searches.mu.Lock()
+	defer s.searches.mu.Unlock()
+	for _, existing := range s.searches.searches {
+		if existing.Project == project && strings.EqualFold(existing.Name, name) {
+			return SavedSearch{}, http.StatusConflict, fmt.Errorf("A saved search named %q already exists", existing.Name)
+		}
+	}
+	search := SavedSearch{
+		ID:        "search_" + uuid.New().String()[:8],
+		Name:      name,
+		Query:     query,
+		Project:   project,
+		CreatedAt: time.Now(),
+	}
+	s.searches.searches = append(s.searches.searches, search)
+	return search, http.StatusCreated, nil
+}
+
+// savedSearch returns the project's saved search with the given ID
+func (s *Server) savedSearch(project, id string) (SavedSearch, bool) {
+	s.searches.mu.RLock()
+	defer s.searches.mu.RUnlock()
+
+	for _, search := range s.searches.searches {
+		if search.Project == project && search.ID == id {
+			return search, true
+		}
+	}
+	return SavedSearch{}, false
+}
+
+// filter returns the saved search's query as a filter
+func (search SavedSearch) filter() searchFilter {
+	terms, _ := parseQuery(search.Query) // Validated when saved
+	return searchFilter{terms: terms}
+}
+
+// searchResults returns the messages matching a saved search, newest first
+func (s *Server) searchResults(search SavedSearch) []Message {
+	return s.filterMessages(search.Project, search.filter())
+}
+
+// withCounts fills in how many messages match the search and how many of
+// those are unread
+func (s *Server) withCounts(search SavedSearch) SavedSearch {
+	search.Count, search.Unread = 0, 0
+	for _, msg := range s.searchResults(search) {
+		search.Count++
+		if msg.Unread {
+			search.Unread++
+		}
+	}
+	return search
+}
+
+// handleListSearches lists the project's saved searches with their counts
+func (s *Server) handleListSearches(w http.ResponseWriter, r *http.Request) {
+	project := projectFromRequest(r)
+
+	s.searches.mu.RLock()
+	searches := []SavedSearch{}
+	for _, search := range s.searches.searches {
+		if search.Project == project {
+			searches = append(searches, search)
+		}
+	}
+	s.searches.mu.RUnlock()
+
+	for i := range searches {
+		searches[i] = s.withCounts(searches[i])
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"searches": searches,
+		"total":    len(searches),
+	})
+}
+
+// handleCreateSearch saves a named query
+func (s *Server) handleCreateSearch(w http.ResponseWriter, r *http.Request) {
+	var req SavedSearchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	search, status, err := s.addSavedSearch(req, projectFromRequest(r))
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	log.Printf("🔖 Search saved: %s = %s", search.Name, search.Query)
+	s.broadcastEvent(map[string]interface{}{"type": "searches_updated", "project": search.Project})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(s.withCounts(search))
+}
+
+// handleGetSearch returns a saved search with its counts
+func (s *Server) handleGetSearch(w http.ResponseWriter, r *http.Request) {
+	search, ok := s.savedSearch(projectFromRequest(r), mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Saved search not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.withCounts(search))
+}
+
+// handleSavedSearchMessages returns a page of the messages matching a saved
+// search, highlighted like /api/v1/messages/search with its query
+func (s *Server) handleSavedSearchMessages(w http.ResponseWriter, r *http.Request) {
+	search, ok := s.savedSearch(projectFromRequest(r), mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Saved search not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.paginateHighlighted(r, search.filter(), s.searchResults(search)))
+}
+
+// handleDeleteSearch removes a saved search
+func (s *Server) handleDeleteSearch(w http.ResponseWriter, r *http.Request) {
+	project, id := projectFromRequest(r), mux.Vars(r)["id"]
+
+	s.searches.mu.Lock()
+	found := false
+	for i, search := range s.searches.searches {
+		if search.Project == project && search.ID == id {
+			s.searches.searches = append(s.searches.searches[:i], s.searches.searches[i+1:]...)
+			found = true
+			break
+		}
+	}
+	s.searches.mu.Unlock()
+	s.syncRecords(kindSearches)
+
+	if !found {
+		http.Error(w, "Saved search not found", http.StatusNotFound)
+		return
+	}
+	s.broadcastEvent(map[string]interface{}{"type": "searches_updated", "project": project})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
+}
@@ -0,0 +1,149 @@
+package smspit
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// maxSeedCount is the most messages one POST /api/v1/seed may generate
+const maxSeedCount = 10000
+
+// SeedRequest asks for generated test messages
+type SeedRequest struct {
+	Count int    `json:"count"`
+	To    string `json:"to,omitempty"`   // Send every message to this number instead of random ones
+	Seed  int64  `json:"seed,omitempty"` // Makes the output repeatable
+}
+
+// seedSenders are the senders of generated messages: long codes, short
+// codes and alphanumeric sender IDs
+var seedSenders = []string{"+15550100", "+15550101", "+447700900123", "72345", "ACME", "MyBank", "ShopCo", "Verify"}
+
+// seedKinds weights the kinds of generated message towards the common ones
+var seedKinds = []string{"otp", "otp", "link", "unicode", "long", "plain", "plain"}
+
+// seedBodies generate message bodies of each kind. The long one needs
+// several segments.
+var seedBodies = map[string]func(r *rand.Rand) string{
+	"otp": func(r *rand.Rand) string {
+		code := fmt.Sprintf("%06d", r.Intn(1000000))
+		return seedText(r, []string{
+			"Your verification code is " + code,
+			code + " is your ACME login code. Don't share it with anyone.",
+			"MyBank: use code " + code[:3] + "-" + code[3:] + " to approve your payment. It expires in 10 minutes.",
+			"Your one-time passcode: " + code,
+		})
+	},
+	"link": func(r *rand.Rand) string {
+		return seedText(r, []string{
+			"Your order #%d has shipped! Track it: https://shop.example.com/t/%x",
+			"Reset your password: https://example.com/reset?token=%d%x",
+			"Your appointment on Friday is confirmed. Reschedule: https://book.example.com/a/%d/%x",
+		})
+	},
+	"unicode": func(r *rand.Rand) string {
+		return seedText(r, []string{
+			"Votre code de vérification est %d ✅",
+			"Ihre Bestellung ist unterwegs 🚚 Lieferung morgen zwischen 9–12 Uhr (#%d)",
+			"ご予約ありがとうございます。確認番号: %d",
+			"Привет! Ваш код: %d 🔐",
+			"¡Hola! Tu pedido %d está listo para recoger 🎉",
+		})
+	},
+	"long": func(r *rand.Rand) string {
+		return seedText(r, []string{"Reminder from ACME Health: your appointment with Dr. Smith is scheduled for tomorrow at 10:30 AM at our Main Street clinic. " +
+			"Please arrive 15 minutes early and bring your insurance card and a photo ID. If you need to cancel or reschedule, reply C or call us " +
+			"at least 24 hours in advance to avoid a missed appointment fee. Reply STOP to opt out of reminders. Ref %d"})
+	},
+	"plain": func(r *rand.Rand) string {
+		return seedText(r, []string{
+			"Hi! Just a reminder that your table for 2 is booked for 7pm tonight.",
+			"Your package was delivered to the front door.",
+			"Thanks for your payment of $%d.00. Your balance is now $0.00.",
+			"Your ride is arriving in 3 minutes. Look for a grey Toyota Prius.",
+			"Flash sale! 20%% off everything today only. Reply STOP to unsubscribe.",
+		})
+	},
+}
+
+// seedText returns a random entry of options, filling in any placeholders
+// with random numbers
+func seedText(r *rand.Rand, options []string) string {
+	s := options[r.Intn(len(options))]
+	args := make([]interface{}, strings.Count(s, "%")-2*strings.Count(s, "%%"))
+	for i := range args {
+		args[i] = 10000 + r.Intn(90000)
+	}
+	if len(args) == 0 {
+		return strings.ReplaceAll(s, "%%", "%")
+	}
+	return fmt.Sprintf(s, args...)
+}
+
+// seedMessage generates one realistic message
+func seedMessage(r *rand.Rand, req SeedRequest, project string) Message {
+	kind := seedKinds[r.Intn(len(seedKinds))]
+	body := seedBodies[kind](r)
+
+	to := req.To
+	if to == "" {
+		to = fmt.Sprintf("+1555%07d", r.Intn(10000000))
+	}
+	return Message{
+		ID:        "msg_" + uuid.New().String()[:8],
+		To:        to,
+		From:      seedSenders[r.Intn(len(seedSenders))],
+		Body:      body,
+		Tags:      []string{"seed", kind},
+		Status:    "captured",
+		Project:   project,
+		CreatedAt: time.Now(),
+	}
+}
+
+// handleSeed captures generated messages for UI development and load
+// testing. They are tagged "seed" and with their kind (otp, link, unicode,
+// long or plain), and go through the usual capture pipeline, so webhooks and
+// streams see them too.
+func (s *Server) handleSeed(w http.ResponseWriter, r *http.Request) {
+	req := SeedRequest{Count: 50}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Count <= 0 || req.Count > maxSeedCount {
+		http.Error(w, fmt.Sprintf("count must be between 1 and %d", maxSeedCount), http.StatusBadRequest)
+		return
+	}
+	if req.Seed == 0 {
+		req.Seed = time.Now().UnixNano()
+	}
+
+	rng := rand.New(rand.NewSource(req.Seed))
+	project := projectFromRequest(r)
+	ids := make([]string, 0, req.Count)
+	for i := 0; i < req.Count; i++ {
+		msg := seedMessage(rng, req, project)
+		if err := s.captureMessage(&msg); err != nil {
+			continue // Rejected by a hook
+		}
+		ids = append(ids, msg.ID)
+	}
+	log.Printf("🌱 Seeded %d messages (project %s)", len(ids), project)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"seeded": len(ids),
+		"seed":   req.Seed,
+		"ids":    ids,
+	})
+}
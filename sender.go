@@ -0,0 +1,63 @@
+package smspit
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+var (
+	// alphanumericSender is a sender ID as Twilio allows them: up to 11
+	// letters, digits and spaces, with at least one letter
+	alphanumericSender = regexp.MustCompile(`^[A-Za-z0-9 ]{1,11}$`)
+	senderLetter       = regexp.MustCompile(`[A-Za-z]`)
+	e164Number         = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+	shortCode          = regexp.MustCompile(`^[0-9]{3,8}$`)
+)
+
+// SenderError is returned in strict sender ID mode when capturing an
+// outbound message whose sender a carrier would refuse
+type SenderError struct {
+	Code    int // Twilio error code: 21212 for an invalid sender, 21612 for an unreachable recipient
+	Message string
+}
+
+func (e *SenderError) Error() string {
+	return e.Message
+}
+
+// validateSender checks an outbound message's sender when
+// SMSPIT_STRICT_SENDER_ID is set: a numeric sender is an E.164 number or a
+// short code, and an alphanumeric sender ID has at most 11 letters, digits
+// and spaces and can't be used for US and Canadian (+1) recipients
+func (s *Server) validateSender(msg Message) error {
+	if !s.config.StrictSenderID || msg.Direction != "outbound" || msg.From == "" {
+		return nil
+	}
+
+	from := msg.From
+	switch {
+	case strings.TrimLeft(from, "+0123456789") == "":
+		if !e164Number.MatchString(from) && !shortCode.MatchString(from) {
+			return &SenderError{Code: 21212, Message: fmt.Sprintf(twilioErrorCatalog[21212].Message, from)}
+		}
+	case !alphanumericSender.MatchString(from) || !senderLetter.MatchString(from) || strings.TrimSpace(from) != from:
+		return &SenderError{Code: 21212, Message: fmt.Sprintf(twilioErrorCatalog[21212].Message, from)}
+	default:
+		if code, _, ok := splitCallingCode(msg.To); ok && code == "1" {
+			return &SenderError{Code: 21612, Message: fmt.Sprintf("The 'To' phone number %s is not currently reachable using the 'From' sender ID %s via SMS: alphanumeric sender IDs aren't supported in the US and Canada.", msg.To, from)}
+		}
+	}
+	return nil
+}
+
+// writeSenderError answers a capture request whose sender strict mode
+// refused, in the provider's error format
+func writeSenderError(w http.ResponseWriter, r *http.Request, err *SenderError) {
+	if r.URL.Path == "/messages" {
+		writeMessageBirdError(w, http.StatusUnprocessableEntity, 9, err.Error(), "originator")
+		return
+	}
+	writeProviderError(w, r, http.StatusBadRequest, err.Code, err.Error(), 0)
+}
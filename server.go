@@ -0,0 +1,1778 @@
+// Package smspit is SMSpit - The Mailpit of SMS Testing.
+// A modern, self-hosted SMS testing server for development that can also be
+// embedded in Go integration tests (see New and Server.Start).
+package smspit
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	graphql "github.com/graph-gophers/graphql-go"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	_ "modernc.org/sqlite"
+)
+
+//go:embed static/*
+var staticFiles embed.FS
+
+// Config holds application configuration. Zero values get defaults in New;
+// empty ports pick a random free port.
+type Config struct {
+	DBPath              string
+	ReadyMinFreeMB      int    // /readyz fails with less free space for the store; 0 disables the check
+	Host                string // Interface to listen on (empty for all)
+	WebPort             string
+	APIPort             string
+	MaxMessages         int
+	MaxBodyBytes        int // Capture request body limit; 0 for none
+	MaxMessageLength    int // Outbound body limit in characters; 0 for none
+	Retention           time.Duration
+	TwilioCompat        bool
+	VonageCompat        bool
+	MessageBirdCompat   bool
+	SNSCompat           bool
+	SinchCompat         bool
+	KannelCompat        bool
+	WhatsAppCompat      bool
+	ViberCompat         bool
+	ViberAuthToken      string            // Required X-Viber-Auth-Token, when set
+	ViberUnreachable    []string          // Viber receivers that aren't subscribed
+	KannelPath          string            // sendsms endpoint path
+	KannelParams        map[string]string // Kannel field → client parameter name
+	KannelUsername      string            // Required sendsms credentials, when set
+	KannelPassword      string
+	KannelDLRFormat     string // Delivery receipt text given to dlr-url as %A
+	SMTPPort            string // SMTP-to-SMS gateway port, disabled when empty
+	SMTPDomain          string // Recipient domain, e.g. sms.local; * for any
+	GRPCPort            string // gRPC API port, disabled when empty
+	SMPPPort            string // SMPP listener port, disabled when empty
+	SMPPSystemID        string // Required bind credentials, when set
+	SMPPPassword        string
+	SMPPCharset         string // Alphabet of data_coding 0: gsm or latin1
+	SMPPDLRFormat       string // Delivery receipt text of deliver_sm receipts
+	DeliverySim         bool
+	DeliveryDelay       time.Duration
+	DeliveryFailureRate float64
+	TwilioAuthToken     string
+	InboundWebhookURL   string
+	WebhookURL          string
+	WebhookSecret       string
+	SlackWebhookURL     string // Posts captured messages to a Slack channel
+	DiscordWebhookURL   string // Posts captured messages to a Discord channel
+	NtfyURL             string // Pushes captured messages to an ntfy topic, e.g. https://ntfy.sh/mytopic
+	PushoverToken       string // Pushover application token; with PushoverUser, pushes captured messages
+	PushoverUser        string
+	NotifyTags          []string // Only notify about messages with one of these tags
+	NotifyNumbers       []string // Only notify about messages to or from these numbers
+	OTPPatterns         []*regexp.Regexp
+	MagicNumbers        map[string]MagicNumber
+	AuthToken           string
+	ReadTokens          []string // Read-only tokens, e.g. for a shared dashboard
+	// OpenID Connect login for the web UI and its API, enabled by OIDCIssuer
+	OIDCIssuer          string
+	OIDCClientID        string
+	OIDCClientSecret    string
+	OIDCRedirectURL     string // Default: <request host><webroot>/auth/callback
+	OIDCScopes          []string
+	OIDCGroupsClaim     string
+	OIDCRoles           map[string]string // Group → read-only or full
+	OIDCDefaultRole     string            // Role for users in no mapped group; none refuses them
+	TagRules            []TagRule
+	AutoReplyRules      []AutoReplyRequest
+	Hooks               []HookRequest     // Processing hooks run on every captured message
+	OptOutKeywords      bool              // Simulate the carrier's STOP/START/HELP handling of inbound messages
+	StrictSenderID      bool              // Refuse senders a carrier would: malformed numbers, bad or US-bound alphanumeric IDs
+	RedactRules         []RedactRule      // Applied to message bodies, in order
+	RedactMode          string            // capture (default) or display
+	TrackLinks          bool              // Give stored links tracking URLs that record clicks
+	DuplicateWindow     time.Duration     // Identical outbound messages (to and body) within this window are duplicates; 0 disables
+	DuplicateMode       string            // flag (default) or reject
+	SearchMatching      textMatching      // How search, waits and filters compare text: loose (default), ignore-case or exact
+	ScreenBannedWords   []string          // Words and phrases content screening filters
+	ScreenShorteners    bool              // Filter links through public URL shorteners
+	ScreenSHAFT         []string          // SHAFT categories content screening filters
+	ScreenMode          string            // flag (default) or reject screened messages
+	A2PMode             string            // What happens to unregistered US long codes: off (default), throttle or reject
+	A2PNumbers          map[string]string // Per-number A2P modes, including registered
+	A2PThrottleRate     float64           // Messages per second from a throttled number
+	RateLimitPerNumber  float64
+	RateLimitPerAccount float64
+	RateLimitMode       string
+	RelayProvider       string
+	RelayAccount        string
+	RelaySecret         string
+	RelayFrom           string
+	RelayAllowlist      []string
+	RelayURL            string
+	AccessLog           bool
+	Debug               bool   // Serve /debug/pprof and /api/v1/debug/runtime
+	OTLPEndpoint        string // OpenTelemetry collector URL; tracing is off when empty
+	OTLPProtocol        string // http/protobuf or grpc
+	ClusterURL          string // NATS or Redis URL replicas share changes over
+	ClusterSubject      string // NATS subject or Redis channel for those changes
+	ClusterStore        string // Postgres URL of the shared store; empty means the SQLite file at DBPath
+	TrustedProxies      []*net.IPNet
+	SinglePort          bool
+	TLSCert             string               // PEM certificate path
+	TLSKey              string               // PEM private key path
+	TLSAuto             bool                 // Generate a self-signed certificate
+	WebRoot             string               // Path prefix for the UI and REST API, e.g. /smspit
+	TwilioNumberPool    []string             // Senders picked for MessagingServiceSid requests
+	TwilioAccounts      map[string]string    // Test credentials, AccountSid → AuthToken
+	VerifyCode          string               // Code every Twilio Verify check accepts
+	Webhooks            []WebhookRequest     // Registered at startup
+	ChaosRules          []ChaosRequest       // Added at startup
+	LookupFixtures      []LookupFixture      // Twilio Lookup overrides by number
+	SavedSearches       []SavedSearchRequest // Named queries, saved at startup
+	Templates           []TemplateRequest    // Message templates, saved at startup
+	Adapters            []AdapterConfig      // Config-defined provider endpoints
+	CORSOrigins         string
+}
+
+// Message represents a captured SMS message
+type Message struct {
+	ID        string      `json:"id"`
+	To        string      `json:"to"`
+	From      string      `json:"from,omitempty"`
+	Body      string      `json:"body"`
+	Tags      []string    `json:"tags,omitempty"`
+	Media     []MediaItem `json:"media,omitempty"`
+	Channel   string      `json:"channel"` // sms, mms, whatsapp, rcs or viber
+	Status    string      `json:"status"`
+	Direction string      `json:"direction"`
+	Project   string      `json:"project"`
+	Unread    bool        `json:"unread"`
+	CreatedAt time.Time   `json:"created_at"`
+	// Contact names for To and From, filled in when the message is served
+	ToName   string `json:"to_name,omitempty"`
+	FromName string `json:"from_name,omitempty"`
+	// Highlight holds the fields a search matched, with the matches marked;
+	// filled in for search results
+	Highlight map[string]string `json:"highlight,omitempty"`
+	// Encoding and segmentation, computed on capture
+	Encoding   string `json:"encoding"`
+	Characters int    `json:"characters"`
+	Segments   int    `json:"segments"`
+	// Links are the URLs in the body as stored, found on capture
+	Links []Link `json:"links,omitempty"`
+	// Delivery holds per-message delivery simulation overrides
+	Delivery *DeliveryOptions `json:"delivery,omitempty"`
+	// SendAt holds a scheduled message back, in the scheduled status, until then
+	SendAt *time.Time `json:"send_at,omitempty"`
+	// Priority as given by the sender: low, normal or high
+	Priority string `json:"priority,omitempty"`
+	// ValidityPeriod in seconds; the delivery simulation expires the message
+	// if it isn't delivered by ExpiresAt
+	ValidityPeriod int        `json:"validity_period,omitempty"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+	// DeleteAt is when a message sent with a ttl is removed (see expireMessages)
+	DeleteAt *time.Time `json:"delete_at,omitempty"`
+	// Relay is set once the message has been relayed to a real provider
+	Relay *RelayResult `json:"relay,omitempty"`
+	// Concat is set on messages reassembled from concatenated parts, which
+	// are served by /api/v1/messages/{id}/parts
+	Concat *ConcatInfo `json:"concat,omitempty"`
+	// DuplicateOf is the ID of the message this one repeats, when it was
+	// captured within SMSPIT_DUPLICATE_WINDOW of it
+	DuplicateOf string `json:"duplicate_of,omitempty"`
+	// RCS is the structured content of an RCS message (see handleRCSSend)
+	RCS *RCSContent `json:"rcs,omitempty"`
+	// Viber is the content of a Viber message (see handleViberSend)
+	Viber *ViberContent `json:"viber,omitempty"`
+	// Metadata is set by the sender, e.g. a test run or trace ID, from the
+	// request's metadata or X-SMSpit-Meta-* headers (see metadataFromRequest)
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Correlation holds the request and trace IDs of the request that sent
+	// the message (see correlationFromRequest)
+	Correlation
+	// TemplateID is the template the body was rendered from, with the
+	// variables it was given (see renderTemplate)
+	TemplateID        string            `json:"template_id,omitempty"`
+	TemplateVariables map[string]string `json:"template_variables,omitempty"`
+	// FilteredBy lists the content rules an outbound message broke; such
+	// messages are stored as filtered (see screenContent)
+	FilteredBy []ContentMatch `json:"filtered_by,omitempty"`
+	// Twilio compatibility fields
+	AccountSID     string `json:"account_sid,omitempty"`
+	ServiceSID     string `json:"messaging_service_sid,omitempty"`
+	StatusCallback string `json:"status_callback,omitempty"`
+	// Kannel delivery report request: dlr-url is fetched for each status
+	// whose DLR type is in dlr-mask (see sendDLR)
+	DLRURL  string `json:"dlr_url,omitempty"`
+	DLRMask int    `json:"dlr_mask,omitempty"`
+	// SMPP delivery receipt request: deliver_sm receipts go to the binds of
+	// the submitting system_id as registered_delivery asks (see
+	// sendSMPPReceipt)
+	SMPPSystemID       string `json:"smpp_system_id,omitempty"`
+	RegisteredDelivery int    `json:"registered_delivery,omitempty"`
+
+	original    string // Unredacted body, kept when redacting at display time
+	autoReplies int    // Auto-replies earlier in this exchange, to stop reply loops
+	seq         uint64 // Position in capture order, which stream cursors follow
+	parts       []MessagePart
+	replica     string // Cluster replica running the message's delivery and scheduled send
+	// Webhooks the processing hooks asked to be sent the stored message
+	hookWebhooks []string
+}
+
+// SendRequest represents an incoming SMS send request
+type SendRequest struct {
+	To   string   `json:"to"`
+	From string   `json:"from,omitempty"`
+	Body string   `json:"body"`
+	Tags []string `json:"tags,omitempty"`
+	// Delivery overrides the simulated delivery lifecycle for this message
+	Delivery *DeliveryOptions `json:"delivery,omitempty"`
+	// SendAt schedules the message for later
+	SendAt *time.Time `json:"send_at,omitempty"`
+	// Priority is low, normal or high
+	Priority string `json:"priority,omitempty"`
+	// ValidityPeriod is how many seconds the message may wait for delivery
+	ValidityPeriod int `json:"validity_period,omitempty"`
+	// TTL (e.g. "30s") deletes the message that long after capture
+	TTL string `json:"ttl,omitempty"`
+	// TemplateID renders the body from a template (by ID or name) with
+	// Variables instead of sending Body
+	TemplateID string            `json:"template_id,omitempty"`
+	Variables  map[string]string `json:"variables,omitempty"`
+	// Metadata is stored with the message and searchable with meta:
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Twilio compatibility fields
+	Message string `json:"Message,omitempty"` // Twilio uses "Message" not "body"
+}
+
+// WebSocket connection limits
+const (
+	wsSendBuffer   = 256 // Events queued per client before it is dropped
+	wsWriteTimeout = 10 * time.Second
+	wsPongTimeout  = 60 * time.Second
+	wsPingInterval = wsPongTimeout * 9 / 10
+	wsReadLimit    = 4096
+)
+
+// wsClient is a WebSocket connection and its queue of outgoing events
+type wsClient struct {
+	conn    *websocket.Conn
+	project string
+	send    chan []byte
+}
+
+// Server holds the application state
+type Server struct {
+	config    Config
+	messages  []Message
+	seq       uint64 // Capture sequence of the last message stored, guarded by mu
+	mu        sync.RWMutex
+	wsClients map[*wsClient]struct{}
+	wsMu      sync.Mutex
+	wsWriters sync.WaitGroup
+	events    eventBus
+	tokens    tokenStore
+	webhooks  webhookStore
+	snapshots snapshotStore
+	tagRules  tagRuleStore
+	autoReply autoReplyStore
+	optOuts   optOutStore
+	hooks     hookStore
+	listeners listenerStates
+	probe     storeProbe
+	drain     drainState
+	concat    concatStore
+	numbers   numberStore
+	contacts  contactStore
+	searches  searchStore
+	templates templateStore
+	chaos     chaosStore
+	verify    verifyStore
+	a2p       a2pStore
+	lookups   lookupStore
+	sinch     sinchBatchStore
+	adapters  []*adapter
+	limiter   rateLimiter
+	smpp      smppStore
+	upgrader  websocket.Upgrader
+	graphql   *graphql.Schema
+	oidc      *oidcAuth // nil unless SSO is configured
+	tracer    trace.Tracer
+	started   time.Time
+	tracing   *sdktrace.TracerProvider // nil unless tracing is configured
+	cluster   *clusterState            // nil unless SMSPIT_CLUSTER_URL is set
+
+	redactRules []RedactRule
+	screening   *contentScreen // nil unless content screening is configured
+}
+
+// New creates a new SMSpit server
+func New(config Config) *Server {
+	if config.WebPort == "" {
+		config.WebPort = "0"
+	}
+	if config.APIPort == "" {
+		config.APIPort = "0"
+	}
+	if config.MaxMessages <= 0 {
+		config.MaxMessages = 10000
+	}
+	if config.DeliveryDelay <= 0 {
+		config.DeliveryDelay = 2 * time.Second
+	}
+	if config.CORSOrigins == "" {
+		config.CORSOrigins = "*"
+	}
+	if config.DuplicateMode != duplicateReject {
+		config.DuplicateMode = duplicateFlag
+	}
+	if config.A2PMode != a2pThrottle && config.A2PMode != a2pReject {
+		config.A2PMode = a2pOff
+	}
+	if config.ScreenMode != screenReject {
+		config.ScreenMode = screenFlag
+	}
+	if config.RateLimitMode != rateLimitQueue {
+		config.RateLimitMode = rateLimitReject
+	}
+	if config.OTLPProtocol != otlpGRPC {
+		if config.OTLPProtocol != otlpHTTP && config.OTLPProtocol != "" {
+			log.Printf("⚠️ Unknown SMSPIT_OTLP_PROTOCOL %q, using %s", config.OTLPProtocol, otlpHTTP)
+		}
+		config.OTLPProtocol = otlpHTTP
+	}
+	if config.SMTPDomain == "" {
+		config.SMTPDomain = "sms.local"
+	}
+	if config.SMPPCharset != smppCharsetLatin1 {
+		if config.SMPPCharset != smppCharsetGSM && config.SMPPCharset != "" {
+			log.Printf("⚠️ Unknown SMSPIT_SMPP_CHARSET %q, using %s", config.SMPPCharset, smppCharsetGSM)
+		}
+		config.SMPPCharset = smppCharsetGSM
+	}
+	if config.ClusterSubject == "" {
+		config.ClusterSubject = "smspit"
+	}
+	if config.KannelPath == "" {
+		config.KannelPath = "/cgi-bin/sendsms"
+	}
+	if config.KannelDLRFormat == "" {
+		config.KannelDLRFormat = defaultDLRFormat
+	}
+	if config.SMPPDLRFormat == "" {
+		config.SMPPDLRFormat = defaultDLRFormat
+	}
+	kannelParams := parseKannelParams("")
+	for field, name := range config.KannelParams {
+		kannelParams[field] = name
+	}
+	config.KannelParams = kannelParams
+	config.RelayProvider = strings.ToLower(config.RelayProvider)
+	if config.RedactMode != redactAtDisplay {
+		config.RedactMode = redactAtCapture
+	}
+	if !validTextMatching(config.SearchMatching) {
+		if config.SearchMatching != "" {
+			log.Printf("⚠️ Unknown SMSPIT_SEARCH_MATCHING %q, matching loosely", config.SearchMatching)
+		}
+		config.SearchMatching = matchLoose
+	}
+	if len(config.OIDCScopes) == 0 {
+		config.OIDCScopes = []string{"openid", "profile", "email"}
+	}
+	if config.OIDCGroupsClaim == "" {
+		config.OIDCGroupsClaim = "groups"
+	}
+	if _, ok := tokenRoles[config.OIDCDefaultRole]; !ok && config.OIDCDefaultRole != "" && config.OIDCDefaultRole != "none" {
+		log.Printf("⚠️ Unknown SMSPIT_OIDC_DEFAULT_ROLE %q, users in no mapped group will be refused", config.OIDCDefaultRole)
+	}
+	config.WebRoot = normalizeWebRoot(config.WebRoot)
+
+	s := &Server{
+		config:    config,
+		messages:  make([]Message, 0),
+		wsClients: make(map[*wsClient]struct{}),
+		tokens:    tokenStore{tokens: make(map[string]*APIToken)},
+		snapshots: snapshotStore{snapshots: make(map[string]map[string]*Snapshot)},
+		limiter:   rateLimiter{next: make(map[string]time.Time)},
+		verify:    verifyStore{verifications: make(map[string]*verification)},
+		lookups:   lookupStore{fixtures: make(map[string]LookupFixture)},
+		tracer:    noop.NewTracerProvider().Tracer(tracerName),
+		started:   time.Now(),
+		upgrader: websocket.Upgrader{
+			CheckOrigin: func(r *http.Request) bool {
+				return true // Allow all origins for local dev
+			},
+		},
+	}
+
+	for i, secret := range config.ReadTokens {
+		s.tokens.tokens[secret] = &APIToken{ID: "tok_read" + strconv.Itoa(i+1), Name: "SMSPIT_READ_TOKENS", Scopes: []string{scopeRead}, CreatedAt: time.Now()}
+	}
+	if config.OIDCIssuer != "" {
+		if config.OIDCClientID == "" {
+			log.Printf("⚠️ SSO disabled: SMSPIT_OIDC_CLIENT_ID is required with SMSPIT_OIDC_ISSUER")
+		} else {
+			s.oidc = &oidcAuth{logins: make(map[string]oidcLogin), sessions: make(map[string]oidcSession)}
+			log.Printf("🔐 SSO login enabled via %s", config.OIDCIssuer)
+		}
+	}
+	if len(config.ReadTokens) > 0 && !s.authEnabled() {
+		log.Printf("⚠️ SMSPIT_READ_TOKENS has no effect without SMSPIT_AUTH_TOKEN or SSO")
+	}
+	if config.Debug {
+		log.Printf("🐞 Debug endpoints enabled: /debug/pprof/ and /api/v1/debug/runtime")
+		if !s.authEnabled() {
+			log.Printf("⚠️ Anyone who can reach the web port can profile SMSpit; set SMSPIT_AUTH_TOKEN to require an admin token")
+		}
+	}
+
+	if config.WebhookURL != "" {
+		s.addWebhook(WebhookRequest{URL: config.WebhookURL, Secret: config.WebhookSecret})
+		log.Printf("🔗 Forwarding captured messages to %s", config.WebhookURL)
+	}
+	for _, hook := range config.Webhooks {
+		s.addWebhook(hook)
+	}
+	pushoverURL := ""
+	if config.PushoverToken != "" && config.PushoverUser != "" {
+		pushoverURL = pushoverAPIURL + "?" + url.Values{"token": {config.PushoverToken}, "user": {config.PushoverUser}}.Encode()
+	}
+	for _, notifier := range []struct{ format, url string }{
+		{webhookFormatSlack, config.SlackWebhookURL},
+		{webhookFormatDiscord, config.DiscordWebhookURL},
+		{webhookFormatNtfy, config.NtfyURL},
+		{webhookFormatPushover, pushoverURL},
+	} {
+		if notifier.url == "" {
+			continue
+		}
+		s.addWebhook(WebhookRequest{URL: notifier.url, Format: notifier.format, Tags: config.NotifyTags, Numbers: config.NotifyNumbers})
+		log.Printf("🔔 Posting captured messages to %s", notifier.format) // The URL holds the channel's credentials
+	}
+	for _, req := range config.ChaosRules {
+		rule, err := newChaosRule(req)
+		if err != nil {
+			log.Printf("⚠️ Ignoring invalid chaos rule: %v", err)
+			continue
+		}
+		s.chaos.rules = append(s.chaos.rules, rule)
+	}
+	for _, fixture := range config.LookupFixtures {
+		s.setLookupFixture(fixture)
+	}
+	for _, req := range config.SavedSearches {
+		project := req.Project
+		if project == "" {
+			project = defaultProject
+		}
+		if _, _, err := s.addSavedSearch(req, project); err != nil {
+			log.Printf("⚠️ Ignoring saved search %q: %v", req.Name, err)
+		}
+	}
+	for _, req := range config.Templates {
+		project := req.Project
+		if project == "" {
+			project = defaultProject
+		}
+		t, err := newTemplate(req)
+		if err == nil {
+			_, _, err = s.saveTemplate(t, project, "")
+		}
+		if err != nil {
+			log.Printf("⚠️ Ignoring template %q: %v", req.Name, err)
+		}
+	}
+	for _, cfg := range config.Adapters {
+		a, err := newAdapter(cfg)
+		if err != nil {
+			log.Printf("⚠️ Ignoring invalid adapter: %v", err)
+			continue
+		}
+		s.adapters = append(s.adapters, a)
+	}
+	if s.relayEnabled() {
+		log.Printf("📡 Relaying messages to %v via %s", config.RelayAllowlist, config.RelayProvider)
+	}
+	for _, r := range config.TagRules {
+		rule, err := newTagRule(r.Tag, r.Pattern, r.Project)
+		if err != nil {
+			log.Printf("⚠️ Ignoring invalid tag rule %q: %v", r.Tag+"="+r.Pattern, err)
+			continue
+		}
+		s.tagRules.rules = append(s.tagRules.rules, rule)
+	}
+	for _, req := range config.AutoReplyRules {
+		rule, err := newAutoReplyRule(req)
+		if err != nil {
+			log.Printf("⚠️ Ignoring invalid auto-reply rule %q: %v", req.Reply+"="+req.Body, err)
+			continue
+		}
+		s.autoReply.rules = append(s.autoReply.rules, rule)
+	}
+	for _, req := range config.Hooks {
+		hook, err := newHook(req)
+		if err != nil {
+			log.Printf("⚠️ Ignoring invalid hook %q: %v", req.Name, err)
+			continue
+		}
+		s.hooks.hooks = append(s.hooks.hooks, hook)
+	}
+	s.redactRules = compileRedactRules(config.RedactRules)
+	if len(s.redactRules) > 0 {
+		log.Printf("🙈 Redacting message bodies with %d rule(s) at %s time", len(s.redactRules), config.RedactMode)
+	}
+	s.screening = newContentScreen(config)
+	if s.screening != nil {
+		log.Printf("🚫 Screening outbound message content (%s mode)", config.ScreenMode)
+	}
+	s.graphql = s.newGraphQLSchema()
+	return s
+}
+
+// Middleware for CORS
+func (s *Server) corsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", s.config.CORSOrigins)
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, "+projectHeader)
+		w.Header().Set("Access-Control-Expose-Headers", "X-Next-Cursor, X-Has-More")
+
+		if r.Method == "OPTIONS" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// captureMessage runs the processing hooks on a message, then stores it
+// and notifies WebSocket clients. It returns a *HookRejection,
+// *MessageTooLongError, *SenderError or *DuplicateError, storing nothing, if
+// a hook rejected the message, its body is too long, strict mode refused its
+// sender or it repeats a recent message in reject mode, and errShuttingDown
+// while the server drains.
+func (s *Server) captureMessage(msg *Message) error {
+	if err := s.startCapture(); err != nil {
+		return err
+	}
+	defer s.endCapture()
+
+	if err := s.processMessage(msg); err != nil {
+		return err
+	}
+	s.storeMessage(msg)
+	return nil
+}
+
+// captureMessages captures several messages all or nothing: if a hook
+// rejects one of them, none are stored
+func (s *Server) captureMessages(msgs []Message) error {
+	if err := s.startCapture(); err != nil {
+		return err
+	}
+	defer s.endCapture()
+
+	for i := range msgs {
+		if err := s.processMessage(&msgs[i]); err != nil {
+			return err
+		}
+	}
+	for i := range msgs {
+		s.storeMessage(&msgs[i])
+	}
+	return nil
+}
+
+// processMessage fills in a message's defaults, encoding and rule-based
+// tags, runs the processing hooks on it and checks the result: its required
+// fields, length, sender and content, and for duplicates
+func (s *Server) processMessage(msg *Message) error {
+	if msg.Direction == "" {
+		msg.Direction = "outbound"
+	}
+	if msg.Project == "" {
+		msg.Project = defaultProject
+	}
+
+	msg.Channel = msg.channel()
+
+	setEncoding(msg)
+	s.applyTagRules(msg)
+	hadBody := msg.Body != ""
+	if err := s.runHooks(msg); err != nil {
+		return err
+	}
+	// The capture endpoints checked the fields before hooks could rewrite them
+	if strings.TrimSpace(msg.To) == "" {
+		return &MissingFieldError{Field: "to"}
+	}
+	if hadBody && msg.Body == "" {
+		return &MissingFieldError{Field: "body"}
+	}
+
+	// Length, sender ID, 10DLC and carrier screening rules are SMS rules
+	sms := msg.carrierMessaging()
+	if sms {
+		if err := s.checkMessageLength(*msg); err != nil {
+			return err
+		}
+		if err := s.validateSender(*msg); err != nil {
+			return err
+		}
+		if err := s.checkA2P(*msg); err != nil {
+			return err
+		}
+		if err := s.screenContent(msg); err != nil {
+			return err
+		}
+	}
+	return s.checkDuplicate(msg)
+}
+
+// storeMessage stores a processed message and notifies WebSocket clients.
+// When delivery simulation is enabled (or the sender asked for status
+// callbacks) outbound messages start out queued. Messages with a future
+// SendAt stay scheduled until then (see sendScheduled). Messages content
+// screening flagged are filtered and go no further.
+func (s *Server) storeMessage(msg *Message) {
+	_, span := s.startMessageSpan(*msg, "smspit.store", trace.SpanKindInternal, attribute.String("smspit.channel", msg.Channel), attribute.String("smspit.direction", msg.Direction))
+	defer span.End()
+	msg.span = span.SpanContext()
+
+	s.redactMessage(msg)
+	s.setLinks(msg)
+	msg.Unread = true
+
+	scheduled := msg.SendAt != nil && msg.SendAt.After(time.Now())
+	if msg.ValidityPeriod > 0 {
+		// The validity period runs from when the message is sent
+		expires := msg.CreatedAt
+		if scheduled {
+			expires = *msg.SendAt
+		}
+		expires = expires.Add(time.Duration(msg.ValidityPeriod) * time.Second)
+		msg.ExpiresAt = &expires
+	}
+	var wait time.Duration
+	simulate := false
+	filtered := len(msg.FilteredBy) > 0 && !scheduled
+	if scheduled {
+		msg.Status = "scheduled"
+	} else if filtered {
+		msg.Status = filteredStatus
+	} else {
+		// Messages held back by the rate limit stay queued until their slot
+		wait = s.queueDelay(*msg)
+		simulate = msg.Direction == "outbound" && (s.config.DeliverySim || msg.wantsStatusReports() || wait > 0)
+		if simulate {
+			msg.Status = "queued"
+		}
+	}
+	span.SetAttributes(attribute.String("smspit.status", msg.Status))
+
+	if fields := msg.logFields(); fields != "" {
+		log.Printf("🔗 Message %s sent by %s", msg.ID, fields)
+	}
+
+	s.mu.Lock()
+	s.seq++
+	msg.seq = s.seq
+	s.messages = append([]Message{*msg}, s.messages...) // Prepend (newest first)
+
+	dropped := s.enforceMaxMessages(msg.Project)
+	s.mu.Unlock()
+	s.syncRemoved(dropped...)
+	s.syncSaved(msg.key())
+
+	// Broadcast to WebSocket clients
+	s.broadcastMessage(*msg)
+	s.forwardToWebhooks(*msg)
+	s.sendHookWebhooks(*msg)
+	if scheduled {
+		id := msg.ID
+		time.AfterFunc(time.Until(*msg.SendAt), func() { s.sendScheduled(id) })
+		return
+	}
+	if filtered {
+		log.Printf("🚫 Message filtered: ID=%s To=%s", msg.ID, msg.To)
+		go s.sendStatusReports(*msg)
+		return
+	}
+	s.maybeRelay(*msg)
+	s.maybeAutoReply(*msg)
+	s.handleKeyword(*msg)
+
+	if simulate {
+		go s.simulateDelivery(*msg, wait)
+	}
+}
+
+// newSendMessage builds the message for a /send request, checking the
+// required fields. The body may be empty when the message has media.
+func newSendMessage(req SendRequest, project string, hasMedia bool) (Message, error) {
+	// Handle Twilio compatibility
+	body := req.Body
+	if body == "" && req.Message != "" {
+		body = req.Message
+	}
+
+	if req.To == "" {
+		return Message{}, errors.New("Missing 'to' field")
+	}
+	if body == "" && !hasMedia {
+		return Message{}, errors.New("Missing 'body' field")
+	}
+	if req.Priority != "" && !validPriority(req.Priority) {
+		return Message{}, errors.New("Invalid 'priority' field (low, normal or high)")
+	}
+	if req.ValidityPeriod < 0 || req.ValidityPeriod > maxValidityPeriod {
+		return Message{}, fmt.Errorf("Invalid 'validity_period' field (1 to %d seconds)", maxValidityPeriod)
+	}
+	var ttl time.Duration
+	if req.TTL != "" {
+		var err error
+		if ttl, err = time.ParseDuration(req.TTL); err != nil || ttl <= 0 {
+			return Message{}, errors.New("Invalid 'ttl' field (a duration such as 30s or 5m)")
+		}
+	}
+
+	msg := Message{
+		ID:        "msg_" + uuid.New().String()[:8],
+		To:        req.To,
+		From:      req.From,
+		Body:      body,
+		Tags:      req.Tags,
+		Status:    "captured",
+		Delivery:  req.Delivery,
+		SendAt:    req.SendAt,
+		Priority:  req.Priority,
+		Project:   project,
+		CreatedAt: time.Now(),
+
+		ValidityPeriod:    req.ValidityPeriod,
+		TemplateID:        req.TemplateID,
+		TemplateVariables: req.Variables,
+		Metadata:          req.Metadata,
+	}
+	if ttl > 0 {
+		deleteAt := msg.CreatedAt.Add(ttl)
+		msg.DeleteAt = &deleteAt
+	}
+	return msg, nil
+}
+
+// handleSend captures an SMS message
+func (s *Server) handleSend(w http.ResponseWriter, r *http.Request) {
+	var req SendRequest
+	var media []MediaItem
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		var err error
+		if req, media, err = parseMultipartSend(r); err != nil {
+			http.Error(w, "Invalid multipart form: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	project := projectFromRequest(r)
+	if err := s.renderTemplate(&req, project); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var err error
+	if req.Metadata, err = mergeMetadata(metadataFromRequest(r), req.Metadata); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	msg, err := newSendMessage(req, project, len(media) > 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	msg.Correlation = correlationFromRequest(r)
+	s.attachMedia(&msg, media)
+
+	if err := s.captureMessage(&msg); err != nil {
+		writeCaptureError(w, r, err)
+		return
+	}
+
+	log.Printf("📱 SMS captured: To=%s Body=%s", msg.To, truncate(msg.Body, 50))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":        msg.ID,
+		"status":    msg.Status,
+		"timestamp": msg.CreatedAt,
+	})
+}
+
+// handleTwilioSend handles Twilio-compatible requests
+func (s *Server) handleTwilioSend(w http.ResponseWriter, r *http.Request) {
+	// Twilio sends form-encoded data
+	if err := r.ParseForm(); err != nil {
+		writeTwilioFormError(w, err)
+		return
+	}
+
+	to := r.FormValue("To")
+	from := r.FormValue("From")
+	body := r.FormValue("Body")
+	serviceSID := r.FormValue("MessagingServiceSid")
+
+	contentSID := r.FormValue("ContentSid")
+
+	mediaURLs := r.Form["MediaUrl"]
+	switch {
+	case to == "":
+		writeTwilioError(w, twilioErrorCatalog[21604])
+		return
+	case !validTwilioTo(to):
+		writeTwilioError(w, twilioErrorCatalog[21211], to)
+		return
+	case body == "" && len(mediaURLs) == 0 && contentSID == "":
+		writeTwilioError(w, twilioErrorCatalog[21602])
+		return
+	}
+
+	// Content templates (ContentSid with ContentVariables) replace Body
+	var variables map[string]string
+	if contentSID != "" {
+		t, ok := s.template(projectFromRequest(r), contentSID)
+		if !ok {
+			writeTwilioError(w, twilioErrorCatalog[21655], contentSID)
+			return
+		}
+		if v := r.FormValue("ContentVariables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &variables); err != nil {
+				writeTwilioError(w, twilioErrorCatalog[21656], "not a JSON object of strings")
+				return
+			}
+		}
+		rendered, err := t.render(variables)
+		if err != nil {
+			writeTwilioError(w, twilioErrorCatalog[21656], err.Error())
+			return
+		}
+		body, contentSID = rendered, t.ID
+	}
+
+	// Scheduled messages (SendAt with ScheduleType=fixed)
+	var sendAt *time.Time
+	if v := r.FormValue("SendAt"); v != "" {
+		if scheduleType := r.FormValue("ScheduleType"); scheduleType != "fixed" {
+			writeTwilioError(w, twilioErrorCatalog[20001], "ScheduleType", scheduleType)
+			return
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeTwilioError(w, twilioErrorCatalog[20001], "SendAt", v)
+			return
+		}
+		sendAt = &t
+	}
+	validity := 0
+	if v := r.FormValue("ValidityPeriod"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxValidityPeriod {
+			writeTwilioError(w, twilioErrorCatalog[20001], "ValidityPeriod", v)
+			return
+		}
+		validity = n
+	}
+
+	// Without From, a Messaging Service picks the sender from its pool
+	status := "queued"
+	if from == "" {
+		if serviceSID == "" {
+			writeTwilioError(w, twilioErrorCatalog[21603])
+			return
+		}
+		if !strings.HasPrefix(serviceSID, "MG") {
+			writeTwilioError(w, twilioErrorCatalog[21701], serviceSID)
+			return
+		}
+		from = s.pickPoolNumber(to)
+		status = "accepted"
+	}
+
+	if e, number, ok := s.checkMagicNumbers(to, from); ok {
+		log.Printf("🪄 Magic number %s triggered Twilio error %d", number, e.Code)
+		writeTwilioError(w, e, number)
+		return
+	}
+
+	if len(mediaURLs) > maxMediaItems {
+		writeTwilioError(w, twilioErrorCatalog[21623], maxMediaItems)
+		return
+	}
+	media := make([]MediaItem, 0, len(mediaURLs))
+	for _, u := range mediaURLs {
+		item, err := fetchMedia(u)
+		if err != nil {
+			log.Printf("⚠️ Failed to fetch media %s: %v", u, err)
+			writeTwilioError(w, twilioErrorCatalog[21620], u)
+			return
+		}
+		media = append(media, item)
+	}
+
+	msg := Message{
+		ID:             "SM" + uuid.New().String()[:32], // Twilio-style ID
+		To:             to,
+		From:           from,
+		Body:           body,
+		Status:         "captured",
+		CreatedAt:      time.Now(),
+		AccountSID:     mux.Vars(r)["accountSid"],
+		Project:        projectFromRequest(r),
+		Metadata:       metadataFromRequest(r),
+		StatusCallback: r.FormValue("StatusCallback"),
+		ServiceSID:     serviceSID,
+		SendAt:         sendAt,
+		ValidityPeriod: validity,
+
+		TemplateID:        contentSID,
+		TemplateVariables: variables,
+		Correlation:       correlationFromRequest(r),
+	}
+	s.attachMedia(&msg, media)
+
+	if err := s.captureMessage(&msg); err != nil {
+		writeCaptureError(w, r, err)
+		return
+	}
+
+	log.Printf("📱 SMS captured (Twilio): To=%s Body=%s", msg.To, truncate(msg.Body, 50))
+
+	// Return Twilio-compatible response
+	resource := twilioResource(msg)
+	if msg.Status != "scheduled" {
+		resource["status"] = status
+	}
+	if msg.Status == filteredStatus {
+		resource["error_code"] = nil // Twilio reports the filtering later
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resource)
+}
+
+// handleListMessages returns a page of captured messages, narrowed by the
+// same filter params as search. Pollers can revalidate it with If-None-Match.
+func (s *Server) handleListMessages(w http.ResponseWriter, r *http.Request) {
+	msgs, err := s.searchMessages(r)
+	if err != nil {
+		http.Error(w, "Invalid filter: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeConditionalJSON(w, r, paginate(r, msgs), msgs)
+}
+
+// searchFilter holds the query terms shared by search, inbox and export
+type searchFilter struct {
+	terms []queryTerm
+	match textMatching // Set from the config by the server before matching
+}
+
+// filterParams are query params that add a term of the same name
+var filterParams = []string{"to", "from", "status", "tag", "account", "channel", "meta", "request_id", "trace_id", "after", "before"}
+
+// parseSearchFilter reads the ?q= query (see parseQuery), or with
+// ?q_regex=true a regular expression for the body. The ?to=, ?from=,
+// ?status=, ?tag=, ?account=, ?channel=, ?meta=, ?request_id=, ?trace_id=,
+// ?after= and ?before= params add the matching terms.
+func parseSearchFilter(r *http.Request) (searchFilter, error) {
+	return parseSearchValues(r.URL.Query())
+}
+
+// parseSearchValues is parseSearchFilter for query values
+func parseSearchValues(q url.Values) (searchFilter, error) {
+	var terms []queryTerm
+	if q.Get("q_regex") == "true" && q.Get("q") != "" {
+		term, err := fieldTerm("regex", q.Get("q"))
+		if err != nil {
+			return searchFilter{}, err
+		}
+		terms = append(terms, term)
+	} else {
+		var err error
+		if terms, err = parseQuery(q.Get("q")); err != nil {
+			return searchFilter{}, err
+		}
+	}
+	for _, param := range filterParams {
+		for _, value := range q[param] {
+			term, err := fieldTerm(param, value)
+			if err != nil {
+				return searchFilter{}, err
+			}
+			terms = append(terms, term)
+		}
+	}
+	return searchFilter{terms: terms}, nil
+}
+
+func (f searchFilter) matches(msg Message) bool {
+	for _, t := range f.terms {
+		if !t.matches(msg, f.match) {
+			return false
+		}
+	}
+	return true
+}
+
+// searchMessages returns the request project's messages matching the search
+// filters, newest first
+func (s *Server) searchMessages(r *http.Request) ([]Message, error) {
+	filter, err := parseSearchFilter(r)
+	if err != nil {
+		return nil, err
+	}
+	return s.filterMessages(projectFromRequest(r), filter), nil
+}
+
+// filterMessages returns a project's messages matching filter, newest first
+func (s *Server) filterMessages(project string, filter searchFilter) []Message {
+	filter.match = s.config.SearchMatching
+	names := s.contactNames(project)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var results []Message
+	for _, msg := range s.messagesFor(project) {
+		names.apply(&msg)
+		if filter.matches(msg) {
+			results = append(results, msg)
+		}
+	}
+	return results
+}
+
+// handleSearchMessages searches messages, highlighting what matched (see
+// paginateHighlighted)
+func (s *Server) handleSearchMessages(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseSearchFilter(r)
+	if err != nil {
+		http.Error(w, "Invalid query: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	results := s.filterMessages(projectFromRequest(r), filter)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.paginateHighlighted(r, filter, results))
+}
+
+// handleGetMessage returns a single message by ID
+func (s *Server) handleGetMessage(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+	names := s.contactNames(projectFromRequest(r))
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, msg := range s.messagesFor(projectFromRequest(r)) {
+		if msg.ID == id {
+			names.apply(&msg)
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(msg)
+			return
+		}
+	}
+
+	http.Error(w, "Message not found", http.StatusNotFound)
+}
+
+// handleDeleteMessages clears all messages in the request's project
+func (s *Server) handleDeleteMessages(w http.ResponseWriter, r *http.Request) {
+	project := projectFromRequest(r)
+	s.clearMessages(func(p string) bool { return p == project })
+
+	log.Printf("🗑️ All messages cleared (project %s)", project)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "cleared"})
+}
+
+// clearMessages deletes the messages of every project match accepts, along
+// with their buffered stream events and any parts still being reassembled,
+// and emits a messages_cleared event per project it emptied
+func (s *Server) clearMessages(match func(project string) bool) {
+	counts := make(map[string]int)
+
+	s.mu.Lock()
+	kept := make([]Message, 0, len(s.messages))
+	var cleared []Message
+	for _, msg := range s.messages {
+		if match(msg.Project) {
+			cleared = append(cleared, msg)
+			counts[msg.Project]++
+		} else {
+			kept = append(kept, msg)
+		}
+	}
+	s.messages = kept
+	s.mu.Unlock()
+	s.syncRemoved(cleared...)
+
+	s.events.purge(func(data map[string]interface{}) bool {
+		msg, ok := data["message"].(Message)
+		return ok && match(msg.Project)
+	})
+
+	s.concat.mu.Lock()
+	for key, pending := range s.concat.pending {
+		if match(pending.msg.Project) {
+			pending.timer.Stop()
+			delete(s.concat.pending, key)
+		}
+	}
+	s.concat.mu.Unlock()
+
+	for project, count := range counts {
+		s.broadcastEvent(map[string]interface{}{
+			"type":    "messages_cleared",
+			"project": project,
+			"count":   count,
+		})
+	}
+}
+
+// handleDeleteMessage deletes a single message
+func (s *Server) handleDeleteMessage(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	project := projectFromRequest(r)
+
+	s.mu.Lock()
+	var deleted []Message
+	for i, msg := range s.messages {
+		if msg.ID == id && msg.Project == project {
+			s.messages = append(s.messages[:i], s.messages[i+1:]...)
+			deleted = append(deleted, msg)
+			break
+		}
+	}
+	s.mu.Unlock()
+
+	if len(deleted) == 0 {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	}
+	s.syncRemoved(deleted...)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
+}
+
+// handleWebSocket handles WebSocket connections for real-time updates.
+// ?replay=N first sends the project's last N messages and ?since= (a time
+// as in search's after:) those captured since then, oldest first, as
+// new_message events marked "replayed".
+func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	replay := 0
+	if v := q.Get("replay"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid replay count", http.StatusBadRequest)
+			return
+		}
+		replay = n
+	}
+	var since time.Time
+	if v := q.Get("since"); v != "" {
+		t, err := parseQueryTime(v)
+		if err != nil {
+			http.Error(w, "Invalid since: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		since = t
+	}
+
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("WebSocket upgrade error: %v", err)
+		return
+	}
+
+	project := projectFromRequest(r)
+	backlog := s.backlog(project, replay, since)
+	client := &wsClient{conn: conn, project: project, send: make(chan []byte, wsSendBuffer+len(backlog))}
+
+	// Queue the replay under wsMu so no broadcast gets ahead of it
+	s.wsMu.Lock()
+	for _, msg := range backlog {
+		data, _ := json.Marshal(map[string]interface{}{
+			"type":     "new_message",
+			"project":  msg.Project,
+			"message":  msg,
+			"replayed": true,
+		})
+		client.send <- data
+	}
+	if s.shuttingDown() {
+		close(client.send) // The writer sends the backlog, then a close frame
+	} else {
+		s.wsClients[client] = struct{}{}
+	}
+	// Counted before unlocking, so closeWebSockets waits for this writer
+	s.wsWriters.Add(1)
+	s.wsMu.Unlock()
+
+	log.Printf("🔌 WebSocket client connected (project %s)", project)
+	go s.writeWebSocket(client)
+
+	// Read until the client goes away; pongs keep the deadline moving
+	conn.SetReadLimit(wsReadLimit)
+	conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	})
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			break
+		}
+	}
+
+	s.wsMu.Lock()
+	if _, ok := s.wsClients[client]; ok {
+		delete(s.wsClients, client)
+		close(client.send)
+	}
+	s.wsMu.Unlock()
+	conn.Close()
+	log.Printf("🔌 WebSocket client disconnected")
+}
+
+// writeWebSocket sends a client's queued events and periodic pings until
+// its queue is closed or a write fails
+func (s *Server) writeWebSocket(client *wsClient) {
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+	defer s.wsWriters.Done()
+	defer client.conn.Close()
+
+	for {
+		select {
+		case data, ok := <-client.send:
+			client.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if !ok {
+				client.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""))
+				return
+			}
+			if err := client.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				return
+			}
+		case <-ping.C:
+			client.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := client.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// backlog returns the project's messages to replay to a new WebSocket
+// client, oldest first: those after since (when set), at most the last
+// limit of them (when set)
+func (s *Server) backlog(project string, limit int, since time.Time) []Message {
+	if limit == 0 && since.IsZero() {
+		return nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var msgs []Message
+	for _, msg := range s.messagesFor(project) {
+		if limit > 0 && len(msgs) == limit {
+			break
+		}
+		if since.IsZero() || msg.CreatedAt.After(since) {
+			msgs = append(msgs, msg)
+		}
+	}
+	for i, j := 0, len(msgs)-1; i < j; i, j = i+1, j-1 {
+		msgs[i], msgs[j] = msgs[j], msgs[i]
+	}
+	return msgs
+}
+
+// enforceMaxMessages drops a project's oldest messages until it is within
+// MaxMessages and returns them. Callers must hold s.mu.
+func (s *Server) enforceMaxMessages(project string) []Message {
+	var dropped []Message
+	excess := len(s.messagesFor(project)) - s.config.MaxMessages
+	for i := len(s.messages) - 1; i >= 0 && excess > 0; i-- {
+		if s.messages[i].Project == project {
+			dropped = append(dropped, s.messages[i])
+			s.messages = append(s.messages[:i], s.messages[i+1:]...)
+			excess--
+		}
+	}
+	return dropped
+}
+
+// broadcastMessage sends a message to all WebSocket clients
+func (s *Server) broadcastMessage(msg Message) {
+	s.contactNames(msg.Project).apply(&msg)
+	s.broadcastEvent(map[string]interface{}{
+		"type":    "new_message",
+		"project": msg.Project,
+		"message": msg,
+	})
+}
+
+// broadcastEvent sends an event to all WebSocket clients and in-process
+// subscribers, on every replica of a cluster
+func (s *Server) broadcastEvent(event map[string]interface{}) {
+	s.deliverEvent(event)
+	s.publishEvent(event)
+}
+
+// deliverEvent sends an event to this replica's WebSocket clients and
+// in-process subscribers. Clients only receive events for their own
+// project. Events are queued for each client's writer, so a slow client
+// never blocks.
+func (s *Server) deliverEvent(event map[string]interface{}) {
+	s.wsMu.Lock()
+	defer s.wsMu.Unlock()
+
+	s.events.publish(event)
+
+	data, _ := json.Marshal(event)
+
+	for client := range s.wsClients {
+		if !eventVisibleTo(event, client.project) {
+			continue
+		}
+		select {
+		case client.send <- data:
+		default:
+			// Drop clients too slow to keep up rather than stall capture
+			log.Printf("⚠️ Dropping WebSocket client that fell %d events behind", cap(client.send))
+			delete(s.wsClients, client)
+			close(client.send)
+		}
+	}
+}
+
+// handleHealth returns server health status
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	count := len(s.messages)
+	s.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":        "healthy",
+		"message_count": count,
+		"version":       "1.0.0",
+	})
+}
+
+// handleStats returns server statistics, with message counts per channel.
+// ?channel= counts one channel only.
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	channel, err := channelParam(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// Calculate stats
+	phoneNumbers := make(map[string]int)
+	byChannel := make(map[string]int, len(channels))
+	for _, c := range channels {
+		byChannel[c] = 0
+	}
+	var total, last24h, lastHour, unread int
+	now := time.Now()
+
+	for _, msg := range s.messagesFor(projectFromRequest(r)) {
+		if channel != "" && msg.channel() != channel {
+			continue
+		}
+		total++
+		byChannel[msg.channel()]++
+		phoneNumbers[msg.To]++
+		if msg.Unread {
+			unread++
+		}
+		if now.Sub(msg.CreatedAt) < 24*time.Hour {
+			last24h++
+		}
+		if now.Sub(msg.CreatedAt) < time.Hour {
+			lastHour++
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"total_messages":     total,
+		"unique_recipients":  len(phoneNumbers),
+		"unread_messages":    unread,
+		"messages_last_24h":  last24h,
+		"messages_last_hour": lastHour,
+		"channels":           byChannel,
+		"websocket_clients":  len(s.wsClients),
+	})
+}
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 1000
+)
+
+// paginate slices msgs according to the limit/offset query params and
+// returns the response envelope with total, count and a link to the next page
+func paginate(r *http.Request, msgs []Message) map[string]interface{} {
+	return paginateItems(r, "messages", msgs)
+}
+
+// paginateItems is paginate for any list, returned under key
+func paginateItems[T any](r *http.Request, key string, items []T) map[string]interface{} {
+	q := r.URL.Query()
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	offset, _ := strconv.Atoi(q.Get("offset"))
+	limit, offset, end := pageBounds(limit, offset, len(items))
+
+	page := items[offset:end]
+	if page == nil {
+		page = []T{}
+	}
+
+	var next interface{}
+	if end < len(items) {
+		q.Set("limit", strconv.Itoa(limit))
+		q.Set("offset", strconv.Itoa(end))
+		next = r.URL.Path + "?" + q.Encode()
+	}
+
+	return map[string]interface{}{
+		key:      page,
+		"total":  len(items),
+		"count":  len(page),
+		"limit":  limit,
+		"offset": offset,
+		"next":   next,
+	}
+}
+
+// pageBounds applies the default and maximum page size to limit and clamps
+// offset to n items, returning the page's limit, offset and end
+func pageBounds(limit, offset, n int) (int, int, int) {
+	if limit <= 0 {
+		limit = defaultPageLimit
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > n {
+		offset = n
+	}
+	end := offset + limit
+	if end > n {
+		end = n
+	}
+	return limit, offset, end
+}
+
+func truncate(s string, maxLen int) string {
+	if len(s) <= maxLen {
+		return s
+	}
+	return s[:maxLen] + "..."
+}
+
+// Handlers builds the capture API and web UI/REST handlers. Both accept the
+// /projects/{name} path prefix.
+func (s *Server) Handlers() (apiHandler, webHandler http.Handler) {
+	apiRouter, webRouter := s.routers()
+	return s.tracingHandler(s.accessLogHandler(projectPrefixHandler(apiRouter))), s.tracingHandler(s.accessLogHandler(s.webRootHandler(projectPrefixHandler(webRouter))))
+}
+
+// Handler serves the capture API, REST API, WebSocket and UI from a single
+// handler, as used by SMSPIT_SINGLE_PORT. Capture routes take precedence,
+// except that GET / without an SNS Action serves the UI. Everything is
+// served under SMSPIT_WEBROOT.
+func (s *Server) Handler() http.Handler {
+	apiRouter, webRouter := s.routers()
+	combined := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var match mux.RouteMatch
+		uiRoot := r.URL.Path == "/" && r.Method == "GET" && r.URL.Query().Get("Action") == ""
+		if !uiRoot && apiRouter.Match(r, &match) {
+			apiRouter.ServeHTTP(w, r)
+			return
+		}
+		webRouter.ServeHTTP(w, r)
+	})
+	return s.tracingHandler(s.accessLogHandler(s.webRootHandler(projectPrefixHandler(combined))))
+}
+
+// routers builds the capture API and web routers
+func (s *Server) routers() (apiRouter, webRouter *mux.Router) {
+	// API Router (webhook endpoint)
+	apiRouter = mux.NewRouter()
+	apiRouter.Use(traceRouteMiddleware)
+	apiRouter.Use(s.corsMiddleware)
+	apiRouter.Use(s.bodyLimitMiddleware)
+	apiRouter.Use(s.authMiddleware)
+	apiRouter.Use(s.chaosMiddleware)
+	apiRouter.Use(s.optOutMiddleware)
+	apiRouter.Use(s.rateLimitMiddleware)
+
+	// Main send endpoint
+	apiRouter.HandleFunc("/send", s.handleSend).Methods("POST", "OPTIONS")
+	apiRouter.HandleFunc("/send/batch", s.handleSendBatch).Methods("POST", "OPTIONS")
+	apiRouter.HandleFunc("/rcs/send", s.handleRCSSend).Methods("POST", "OPTIONS")
+	apiRouter.HandleFunc("/send/pdu", s.handleSendPDU).Methods("POST", "OPTIONS")
+	apiRouter.HandleFunc("/health", s.handleHealth).Methods("GET")
+	apiRouter.HandleFunc("/livez", s.handleLivez).Methods("GET")
+	apiRouter.HandleFunc("/readyz", s.handleReadyz).Methods("GET")
+
+	// Twilio-compatible endpoint
+	if s.config.TwilioCompat {
+		apiRouter.HandleFunc("/2010-04-01/Accounts/{accountSid}/Messages.json", s.twilioAuth(s.handleTwilioSend)).Methods("POST")
+		apiRouter.HandleFunc("/2010-04-01/Accounts/{accountSid}/Messages.json", s.twilioAuth(s.handleTwilioListMessages)).Methods("GET")
+		apiRouter.HandleFunc("/2010-04-01/Accounts/{accountSid}/Messages/{messageSid}.json", s.twilioAuth(s.handleTwilioGetMessage)).Methods("GET")
+		apiRouter.HandleFunc("/2010-04-01/Accounts/{accountSid}/Messages/{messageSid}.json", s.twilioAuth(s.handleTwilioUpdateMessage)).Methods("POST")
+		apiRouter.HandleFunc("/2010-04-01/Accounts/{accountSid}/AvailablePhoneNumbers/{country}/{type}.json", s.twilioAuth(s.handleTwilioAvailableNumbers)).Methods("GET")
+		apiRouter.HandleFunc("/2010-04-01/Accounts/{accountSid}/IncomingPhoneNumbers.json", s.twilioAuth(s.handleTwilioListIncomingNumbers)).Methods("GET")
+		apiRouter.HandleFunc("/2010-04-01/Accounts/{accountSid}/IncomingPhoneNumbers.json", s.twilioAuth(s.handleTwilioPurchaseNumber)).Methods("POST")
+		apiRouter.HandleFunc("/2010-04-01/Accounts/{accountSid}/IncomingPhoneNumbers/{numberSid}.json", s.twilioAuth(s.handleTwilioGetIncomingNumber)).Methods("GET")
+		apiRouter.HandleFunc("/2010-04-01/Accounts/{accountSid}/IncomingPhoneNumbers/{numberSid}.json", s.twilioAuth(s.handleTwilioReleaseNumber)).Methods("DELETE")
+		apiRouter.HandleFunc("/v2/Services/{serviceSid}/Verifications", s.twilioAuth(s.handleVerifyStart)).Methods("POST")
+		apiRouter.HandleFunc("/v2/Services/{serviceSid}/VerificationCheck", s.twilioAuth(s.handleVerifyCheck)).Methods("POST")
+		apiRouter.HandleFunc("/v1/PhoneNumbers/{number}", s.twilioAuth(s.handleLookupV1)).Methods("GET")
+		apiRouter.HandleFunc("/v2/PhoneNumbers/{number}", s.twilioAuth(s.handleLookupV2)).Methods("GET")
+		apiRouter.NotFoundHandler = twilioRouteFallback(20404, http.NotFoundHandler())
+		apiRouter.MethodNotAllowedHandler = twilioRouteFallback(20004, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}))
+		log.Printf("📱 Twilio compatibility mode enabled")
+	}
+
+	// Vonage/Nexmo-compatible endpoints
+	if s.config.VonageCompat {
+		apiRouter.HandleFunc("/nexmo/sms/json", s.handleVonageSMS).Methods("POST")
+		apiRouter.HandleFunc("/v1/messages", s.handleVonageMessages).Methods("POST")
+		log.Printf("📱 Vonage compatibility mode enabled")
+	}
+
+	// MessageBird-compatible endpoint
+	if s.config.MessageBirdCompat {
+		apiRouter.HandleFunc("/messages", s.handleMessageBirdSend).Methods("POST")
+		log.Printf("📱 MessageBird compatibility mode enabled")
+	}
+
+	// Sinch-compatible endpoints (XMS REST API)
+	if s.config.SinchCompat {
+		apiRouter.HandleFunc("/xms/v1/{servicePlanId}/batches", s.handleSinchSend).Methods("POST")
+		apiRouter.HandleFunc("/xms/v1/{servicePlanId}/batches", s.handleSinchListBatches).Methods("GET")
+		apiRouter.HandleFunc("/xms/v1/{servicePlanId}/batches/{batchId}", s.handleSinchGetBatch).Methods("GET")
+		apiRouter.HandleFunc("/xms/v1/{servicePlanId}/batches/{batchId}/delivery_report", s.handleSinchDeliveryReport).Methods("GET")
+		log.Printf("📱 Sinch compatibility mode enabled")
+	}
+
+	// Kannel-style sendsms endpoint (GET or form POST)
+	if s.config.KannelCompat {
+		apiRouter.HandleFunc(s.config.KannelPath, s.handleKannelSend).Methods("GET", "POST")
+		log.Printf("📱 Kannel compatibility mode enabled at %s", s.config.KannelPath)
+	}
+
+	// WhatsApp Cloud API-compatible endpoint (Graph API)
+	if s.config.WhatsAppCompat {
+		apiRouter.HandleFunc("/{version:v[0-9]+\\.[0-9]+}/{phoneNumberId}/messages", s.handleWhatsAppSend).Methods("POST")
+		log.Printf("📱 WhatsApp Cloud API compatibility mode enabled")
+	}
+
+	// Viber REST API-compatible endpoint
+	if s.config.ViberCompat {
+		apiRouter.HandleFunc("/pa/send_message", s.handleViberSend).Methods("POST")
+		log.Printf("📱 Viber compatibility mode enabled")
+	}
+
+	// AWS SNS-compatible endpoint (query protocol)
+	if s.config.SNSCompat {
+		apiRouter.HandleFunc("/", s.handleSNS).Methods("GET", "POST")
+		log.Printf("📱 AWS SNS compatibility mode enabled")
+	}
+
+	// Config-defined provider adapters
+	for _, a := range s.adapters {
+		apiRouter.HandleFunc(a.Path, s.adapterHandler(a)).Methods(a.Method)
+		log.Printf("📱 Adapter %s enabled: %s %s", a.Name, a.Method, a.Path)
+	}
+
+	// Web Router (UI + API)
+	webRouter = mux.NewRouter()
+	webRouter.Use(traceRouteMiddleware)
+	webRouter.Use(s.corsMiddleware)
+
+	// API endpoints
+	api := webRouter.PathPrefix("/api/v1").Subrouter()
+	api.Use(s.authMiddleware)
+	api.HandleFunc("/messages", s.handleListMessages).Methods("GET")
+	api.HandleFunc("/messages/search", s.handleSearchMessages).Methods("GET")
+	api.HandleFunc("/messages/wait", s.handleWaitForMessage).Methods("GET")
+	api.HandleFunc("/messages/export", s.handleExportMessages).Methods("GET")
+	api.HandleFunc("/messages/stream", s.handleStreamMessages).Methods("GET")
+	api.HandleFunc("/messages/import", s.handleImportMessages).Methods("POST")
+	api.HandleFunc("/messages/{id}", s.handleGetMessage).Methods("GET")
+	api.HandleFunc("/messages/{id}/media/{n}", s.handleGetMedia).Methods("GET")
+	api.HandleFunc("/messages/{id}/otp", s.handleGetMessageOTP).Methods("GET")
+	api.HandleFunc("/messages/{id}/links", s.handleGetMessageLinks).Methods("GET")
+	api.HandleFunc("/messages/{id}/links/{n}/qr.png", s.handleGetLinkQR).Methods("GET")
+	api.HandleFunc("/messages/{id}/parts", s.handleGetMessageParts).Methods("GET")
+	api.HandleFunc("/messages/read", s.handleMarkMessagesRead).Methods("POST")
+	api.HandleFunc("/messages/{id}/read", s.handleMarkRead).Methods("POST")
+	api.HandleFunc("/messages/{id}/unread", s.handleMarkUnread).Methods("POST")
+	api.HandleFunc("/messages/{id}/tags", s.handleUpdateTags).Methods("PUT")
+	api.HandleFunc("/messages/{id}/relay", s.handleRelayMessage).Methods("POST")
+	api.HandleFunc("/messages/{id}/cancel", s.handleCancelMessage).Methods("POST")
+	api.HandleFunc("/tags", s.handleListTags).Methods("GET")
+	api.HandleFunc("/tags/rules", s.handleListTagRules).Methods("GET")
+	api.HandleFunc("/tags/rules", s.handleCreateTagRule).Methods("POST")
+	api.HandleFunc("/tags/rules/{id}", s.handleDeleteTagRule).Methods("DELETE")
+	api.HandleFunc("/auto-replies", s.handleListAutoReplies).Methods("GET")
+	api.HandleFunc("/auto-replies", s.handleCreateAutoReply).Methods("POST")
+	api.HandleFunc("/auto-replies/{id}", s.handleDeleteAutoReply).Methods("DELETE")
+	api.HandleFunc("/hooks", s.handleListHooks).Methods("GET")
+	api.HandleFunc("/hooks", s.handleCreateHook).Methods("POST")
+	api.HandleFunc("/hooks/{id}", s.handleDeleteHook).Methods("DELETE")
+	api.HandleFunc("/opt-outs", s.handleListOptOuts).Methods("GET")
+	api.HandleFunc("/opt-outs", s.handleCreateOptOut).Methods("POST")
+	api.HandleFunc("/opt-outs", s.handleClearOptOuts).Methods("DELETE")
+	api.HandleFunc("/otp/latest", s.handleLatestOTP).Methods("GET")
+	api.HandleFunc("/inbox/{number}", s.handleInbox).Methods("GET")
+	// Number pool; SIDs are matched first so DELETE on a phone number purges it
+	api.HandleFunc("/numbers", s.handleListNumbers).Methods("GET")
+	api.HandleFunc("/numbers", s.handleCreateNumber).Methods("POST")
+	api.HandleFunc("/numbers/{sid:PN[0-9a-f]{32}}", s.handleGetNumber).Methods("GET")
+	api.HandleFunc("/numbers/{sid:PN[0-9a-f]{32}}", s.handleUpdateNumber).Methods("PUT")
+	api.HandleFunc("/numbers/{sid:PN[0-9a-f]{32}}", s.handleDeleteNumber).Methods("DELETE")
+	api.HandleFunc("/numbers/{number}", s.handlePurgeNumber).Methods("DELETE")
+	api.HandleFunc("/a2p/brands", s.handleListBrands).Methods("GET")
+	api.HandleFunc("/a2p/brands", s.handleCreateBrand).Methods("POST")
+	api.HandleFunc("/a2p/brands/{sid}", s.handleGetBrand).Methods("GET")
+	api.HandleFunc("/a2p/brands/{sid}", s.handleUpdateBrand).Methods("PUT")
+	api.HandleFunc("/a2p/brands/{sid}", s.handleDeleteBrand).Methods("DELETE")
+	api.HandleFunc("/a2p/campaigns", s.handleListCampaigns).Methods("GET")
+	api.HandleFunc("/a2p/campaigns", s.handleCreateCampaign).Methods("POST")
+	api.HandleFunc("/a2p/campaigns/{sid}", s.handleGetCampaign).Methods("GET")
+	api.HandleFunc("/a2p/campaigns/{sid}", s.handleUpdateCampaign).Methods("PUT")
+	api.HandleFunc("/a2p/campaigns/{sid}", s.handleDeleteCampaign).Methods("DELETE")
+	api.HandleFunc("/a2p/numbers/{number}", s.handleA2PNumber).Methods("GET")
+	api.HandleFunc("/conversations", s.handleListConversations).Methods("GET")
+	api.HandleFunc("/conversations/{to}/{from}", s.handleGetConversation).Methods("GET")
+	api.HandleFunc("/messages", s.handleDeleteMessages).Methods("DELETE")
+	api.HandleFunc("/messages/{id}", s.handleDeleteMessage).Methods("DELETE")
+	api.HandleFunc("/simulate/inbound", s.handleSimulateInbound).Methods("POST")
+	api.HandleFunc("/seed", s.handleSeed).Methods("POST")
+	api.HandleFunc("/analyze", s.handleAnalyze).Methods("POST")
+	api.HandleFunc("/events", s.handleEvents).Methods("GET")
+	api.HandleFunc("/projects", s.handleListProjects).Methods("GET")
+	api.HandleFunc("/stats", s.handleStats).Methods("GET")
+	api.HandleFunc("/stats/timeseries", s.handleStatsTimeseries).Methods("GET")
+	api.HandleFunc("/stats/numbers", s.handleNumberStats).Methods("GET")
+	api.HandleFunc("/snapshots", s.handleListSnapshots).Methods("GET")
+	api.HandleFunc("/snapshots/{name}", s.handleSaveSnapshot).Methods("POST")
+	api.HandleFunc("/snapshots/{name}", s.handleDeleteSnapshot).Methods("DELETE")
+	api.HandleFunc("/snapshots/{name}/restore", s.handleRestoreSnapshot).Methods("POST")
+	api.HandleFunc("/chaos", s.handleListChaos).Methods("GET")
+	api.HandleFunc("/chaos", s.handleCreateChaos).Methods("POST")
+	api.HandleFunc("/chaos", s.handleClearChaos).Methods("DELETE")
+	api.HandleFunc("/chaos/{id}", s.handleDeleteChaos).Methods("DELETE")
+	api.HandleFunc("/searches", s.handleListSearches).Methods("GET")
+	api.HandleFunc("/searches", s.handleCreateSearch).Methods("POST")
+	api.HandleFunc("/searches/{id}", s.handleGetSearch).Methods("GET")
+	api.HandleFunc("/searches/{id}", s.handleDeleteSearch).Methods("DELETE")
+	api.HandleFunc("/searches/{id}/messages", s.handleSavedSearchMessages).Methods("GET")
+	api.HandleFunc("/templates", s.handleListTemplates).Methods("GET")
+	api.HandleFunc("/templates", s.handleSaveTemplate).Methods("POST")
+	api.HandleFunc("/templates/{id}", s.handleGetTemplate).Methods("GET")
+	api.HandleFunc("/templates/{id}", s.handleSaveTemplate).Methods("PUT")
+	api.HandleFunc("/templates/{id}", s.handleDeleteTemplate).Methods("DELETE")
+	api.HandleFunc("/contacts", s.handleListContacts).Methods("GET")
+	api.HandleFunc("/contacts", s.handleCreateContact).Methods("POST")
+	api.HandleFunc("/contacts/{number}", s.handleSetContact).Methods("PUT")
+	api.HandleFunc("/contacts/{number}", s.handleDeleteContact).Methods("DELETE")
+	api.HandleFunc("/lookups", s.handleListLookups).Methods("GET")
+	api.HandleFunc("/lookups/{number}", s.handleSetLookup).Methods("PUT")
+	api.HandleFunc("/lookups/{number}", s.handleDeleteLookup).Methods("DELETE")
+	api.HandleFunc("/webhooks", s.handleListWebhooks).Methods("GET")
+	api.HandleFunc("/webhooks", s.handleCreateWebhook).Methods("POST")
+	api.HandleFunc("/webhooks/{id}", s.handleGetWebhook).Methods("GET")
+	api.HandleFunc("/webhooks/{id}", s.handleUpdateWebhook).Methods("PUT")
+	api.HandleFunc("/webhooks/{id}", s.handleDeleteWebhook).Methods("DELETE")
+	api.HandleFunc("/health", s.handleHealth).Methods("GET")
+	api.HandleFunc("/openapi.json", s.handleOpenAPI).Methods("GET")
+
+	// Admin API (token management)
+	api.HandleFunc("/admin/tokens", s.handleCreateToken).Methods("POST")
+	api.HandleFunc("/admin/tokens", s.handleListTokens).Methods("GET")
+	api.HandleFunc("/admin/tokens/{id}", s.handleRevokeToken).Methods("DELETE")
+	api.HandleFunc("/whoami", s.handleWhoAmI).Methods("GET")
+
+	// Profiling and runtime stats
+	if s.config.Debug {
+		s.debugRoutes(webRouter, api)
+	}
+
+	// Kubernetes probes
+	webRouter.HandleFunc("/livez", s.handleLivez).Methods("GET")
+	webRouter.HandleFunc("/readyz", s.handleReadyz).Methods("GET")
+
+	// SSO login
+	if s.oidc != nil {
+		webRouter.HandleFunc("/auth/login", s.handleOIDCLogin).Methods("GET")
+		webRouter.HandleFunc("/auth/callback", s.handleOIDCCallback).Methods("GET")
+		webRouter.HandleFunc("/auth/logout", s.handleOIDCLogout).Methods("GET", "POST")
+	}
+
+	// GraphQL (queries, and subscriptions over WebSocket)
+	webRouter.Handle("/api/graphql", s.authMiddleware(http.HandlerFunc(s.handleGraphQL))).Methods("GET", "POST")
+
+	// WebSocket
+	webRouter.Handle("/ws", s.authMiddleware(http.HandlerFunc(s.handleWebSocket)))
+
+	// API docs (Swagger UI)
+	webRouter.Handle("/api/docs", s.loginRequired(http.HandlerFunc(s.handleAPIDocs))).Methods("GET")
+
+	// Link click tracking
+	webRouter.HandleFunc("/l/{token}", s.handleLinkRedirect).Methods("GET")
+
+	// Static files (UI)
+	staticFS, _ := fs.Sub(staticFiles, "static")
+	webRouter.PathPrefix("/").Handler(s.loginRequired(http.FileServer(http.FS(staticFS))))
+
+	return apiRouter, webRouter
+}
@@ -0,0 +1,89 @@
+package smspit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// testServer serves a server's capture API and web handlers in-process
+type testServer struct {
+	*Server
+	api, web http.Handler
+}
+
+func newTestServer(t *testing.T, config Config) *testServer {
+	t.Helper()
+	s := New(config)
+	api, web := s.Handlers()
+	return &testServer{Server: s, api: api, web: web}
+}
+
+// do sends a request to h, with a JSON body when body is set. header holds
+// name, value pairs.
+func do(t *testing.T, h http.Handler, method, target, body string, header ...string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+// decode decodes a JSON response into v, failing the test if it isn't
+func decode(t *testing.T, w *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("decoding %q: %v", w.Body.String(), err)
+	}
+}
+
+// send captures a message through /send and returns its ID
+func (ts *testServer) send(t *testing.T, to, body string) string {
+	t.Helper()
+	w := do(t, ts.api, "POST", "/send", `{"to":"`+to+`","from":"+15550009999","body":"`+body+`"}`)
+	if w.Code != http.StatusOK && w.Code != http.StatusCreated {
+		t.Fatalf("send: %d %s", w.Code, w.Body)
+	}
+	var resp struct {
+		ID string `json:"id"`
+	}
+	decode(t, w, &resp)
+	return resp.ID
+}
+
+// sendPart sends one part of a concatenated message through Kannel sendsms,
+// with an 8-bit reference concatenation header
+func (ts *testServer) sendPart(t *testing.T, to, text string, ref, total, seq byte) {
+	t.Helper()
+	q := url.Values{
+		"to":   {to},
+		"text": {text},
+		"udh":  {string([]byte{5, ieConcat8, 3, ref, total, seq})},
+	}
+	if w := do(t, ts.api, "GET", "/cgi-bin/sendsms?"+q.Encode(), ""); w.Code != http.StatusAccepted {
+		t.Fatalf("sendsms: %d %s", w.Code, w.Body)
+	}
+}
+
+// messages lists the default project's messages
+func (ts *testServer) messages(t *testing.T) []Message {
+	t.Helper()
+	w := do(t, ts.web, "GET", "/api/v1/messages", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("list messages: %d %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Messages []Message `json:"messages"`
+	}
+	decode(t, w, &resp)
+	return resp.Messages
+}
@@ -0,0 +1,93 @@
+package smspit
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+)
+
+// errShuttingDown is returned when capturing a message while the server
+// drains for shutdown
+var errShuttingDown = errors.New("SMSpit is shutting down")
+
+// drainState tracks the captures in flight so shutdown can wait for them
+type drainState struct {
+	mu       sync.Mutex
+	draining bool
+	captures sync.WaitGroup
+}
+
+// startCapture registers an in-flight capture, or returns errShuttingDown
+// once the server is draining. Each successful call must be matched by
+// endCapture.
+func (s *Server) startCapture() error {
+	s.drain.mu.Lock()
+	defer s.drain.mu.Unlock()
+	if s.drain.draining {
+		return errShuttingDown
+	}
+	s.drain.captures.Add(1)
+	return nil
+}
+
+// shuttingDown reports whether the server is draining
+func (s *Server) shuttingDown() bool {
+	s.drain.mu.Lock()
+	defer s.drain.mu.Unlock()
+	return s.drain.draining
+}
+
+// endCapture marks an in-flight capture stored (or abandoned)
+func (s *Server) endCapture() {
+	s.drain.captures.Done()
+}
+
+// shutdown drains the server before its listeners close: new captures are
+// refused, those in flight are waited for so they reach the store, and
+// WebSocket clients get a close frame. It gives up when ctx is done.
+func (s *Server) shutdown(ctx context.Context) {
+	s.drain.mu.Lock()
+	s.drain.draining = true
+	s.drain.mu.Unlock()
+
+	stored := make(chan struct{})
+	go func() {
+		s.drain.captures.Wait()
+		close(stored)
+	}()
+	select {
+	case <-stored:
+	case <-ctx.Done():
+		log.Printf("⚠️ Shutting down with captures still in flight")
+	}
+
+	s.closeWebSockets(ctx)
+}
+
+// closeWebSockets sends every WebSocket client a going-away close frame,
+// after any events still queued for it, and waits for the writers to finish
+func (s *Server) closeWebSockets(ctx context.Context) {
+	s.wsMu.Lock()
+	n := len(s.wsClients)
+	for client := range s.wsClients {
+		delete(s.wsClients, client)
+		close(client.send)
+	}
+	s.wsMu.Unlock()
+	if n == 0 {
+		return
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		s.wsWriters.Wait()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		log.Printf("🔌 Closed %d WebSocket client(s)", n)
+	case <-ctx.Done():
+		log.Printf("⚠️ Shutting down before %d WebSocket client(s) were closed", n)
+	}
+}
@@ -0,0 +1,129 @@
+package smspit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestShutdownRefusesCaptures(t *testing.T) {
+	form := []string{"Content-Type", "application/x-www-form-urlencoded"}
+	tests := []struct {
+		name, target, body string
+		header             []string
+	}{
+		{name: "send", target: "/send", body: `{"to":"+15551230001","body":"Hi"}`},
+		{name: "batch", target: "/send/batch", body: `[{"to":"+15551230001","body":"Hi"}]`},
+		{name: "Twilio", target: "/2010-04-01/Accounts/AC1/Messages.json", body: "To=%2B15551230001&From=%2B15550009999&Body=Hi", header: form},
+	}
+	ts := newTestServer(t, Config{TwilioCompat: true})
+	ts.shutdown(context.Background())
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := do(t, ts.api, "POST", tt.target, tt.body, tt.header...)
+			if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "shutting down") {
+				t.Errorf("POST %s while draining: %d %s, want 503", tt.target, w.Code, w.Body)
+			}
+		})
+	}
+	if msgs := ts.messages(t); len(msgs) != 0 {
+		t.Errorf("captured %d messages while draining, want none", len(msgs))
+	}
+	// Reads still work
+	if w := do(t, ts.web, "GET", "/api/v1/messages", ""); w.Code != http.StatusOK {
+		t.Errorf("list while draining: %d", w.Code)
+	}
+}
+
+func TestShutdownWaitsForCaptures(t *testing.T) {
+	tests := []struct {
+		name     string
+		timeout  time.Duration
+		wantWait bool // Whether shutdown waits for the capture in flight
+	}{
+		{name: "capture finishes", timeout: time.Second, wantWait: true},
+		{name: "timeout", timeout: 20 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t, Config{})
+			if err := ts.startCapture(); err != nil {
+				t.Fatal(err)
+			}
+			release := time.AfterFunc(200*time.Millisecond, ts.endCapture)
+			defer release.Stop()
+
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+			start := time.Now()
+			ts.shutdown(ctx)
+			elapsed := time.Since(start)
+
+			if waited := elapsed >= 200*time.Millisecond; waited != tt.wantWait {
+				t.Errorf("shutdown returned after %v, want waiting = %v", elapsed, tt.wantWait)
+			}
+			if err := ts.startCapture(); err != errShuttingDown {
+				t.Errorf("capture after shutdown: %v, want errShuttingDown", err)
+			}
+			if !tt.wantWait {
+				time.Sleep(250 * time.Millisecond) // Let the capture end before the next case
+			}
+		})
+	}
+}
+
+func TestShutdownClosesWebSockets(t *testing.T) {
+	ts := newTestServer(t, Config{})
+	srv := httptest.NewServer(ts.web)
+	defer srv.Close()
+	dial := func(query string) *websocket.Conn {
+		t.Helper()
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		return conn
+	}
+	// readUntilClose reads events until the close frame, returning their
+	// count and the close code
+	readUntilClose := func(conn *websocket.Conn) (int, int) {
+		t.Helper()
+		events := 0
+		for {
+			_, _, err := conn.ReadMessage()
+			var closeErr *websocket.CloseError
+			if errors.As(err, &closeErr) {
+				return events, closeErr.Code
+			}
+			if err != nil {
+				t.Fatalf("read: %v", err)
+			}
+			events++
+		}
+	}
+
+	connected := dial("")
+	defer connected.Close()
+	time.Sleep(50 * time.Millisecond)
+	ts.send(t, "+15551230001", "Before shutdown")
+
+	ts.shutdown(context.Background())
+	if events, code := readUntilClose(connected); events != 1 || code != websocket.CloseGoingAway {
+		t.Errorf("connected client got %d event(s) and close %d, want the queued event then 1001", events, code)
+	}
+
+	// A client connecting while draining gets its replay, then the close
+	late := dial("?replay=5")
+	defer late.Close()
+	if events, code := readUntilClose(late); events != 1 || code != websocket.CloseGoingAway {
+		t.Errorf("late client got %d event(s) and close %d, want the replay then 1001", events, code)
+	}
+}
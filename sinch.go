@@ -0,0 +1,421 @@
+package smspit
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// sinchBatchExpiry is how long after sending Sinch gives up on a batch
+const sinchBatchExpiry = 3 * 24 * time.Hour
+
+// SinchBatchRequest represents a Sinch XMS batch send request
+type SinchBatchRequest struct {
+	From            string                       `json:"from"`
+	To              []string                     `json:"to"`
+	Body            string                       `json:"body"`
+	Type            string                       `json:"type,omitempty"` // mt_text or mt_binary
+	DeliveryReport  string                       `json:"delivery_report,omitempty"`
+	CallbackURL     string                       `json:"callback_url,omitempty"`
+	ClientReference string                       `json:"client_reference,omitempty"`
+	FlashMessage    bool                         `json:"flash_message,omitempty"`
+	SendAt          *time.Time                   `json:"send_at,omitempty"`
+	ExpireAt        *time.Time                   `json:"expire_at,omitempty"`
+	Parameters      map[string]map[string]string `json:"parameters,omitempty"`
+}
+
+// sinchBatch is a captured Sinch batch and the messages it produced
+type sinchBatch struct {
+	SinchBatchRequest
+	ID            string
+	ServicePlanID string
+	Project       string
+	MessageIDs    map[string]string // Recipient → message ID
+	CreatedAt     time.Time
+}
+
+// sinchBatchStore holds captured batches, newest first
+type sinchBatchStore struct {
+	mu      sync.Mutex
+	batches []*sinchBatch
+}
+
+// sinchBatchID returns a Sinch-style batch ID: 26 upper-case characters
+func sinchBatchID() string {
+	return "01" + strings.ToUpper(strings.ReplaceAll(uuid.New().String(), "-", ""))[:24]
+}
+
+// sinchBody expands ${name} parameters in body for one recipient, falling back
+// to each parameter's "default" value
+func sinchBody(body, to string, params map[string]map[string]string) string {
+	for name, values := range params {
+		value, ok := values[to]
+		if !ok {
+			value = values["default"]
+		}
+		body = strings.ReplaceAll(body, "${"+name+"}", value)
+	}
+	return body
+}
+
+// resource renders the batch as Sinch does
+func (b *sinchBatch) resource() map[string]interface{} {
+	sendAt := b.CreatedAt
+	if b.SendAt != nil {
+		sendAt = *b.SendAt
+	}
+	expireAt := sendAt.Add(sinchBatchExpiry)
+	if b.ExpireAt != nil {
+		expireAt = *b.ExpireAt
+	}
+	resource := map[string]interface{}{
+		"id":              b.ID,
+		"to":              b.To,
+		"from":            b.From,
+		"body":            b.Body,
+		"type":            b.Type,
+		"canceled":        false,
+		"delivery_report": b.DeliveryReport,
+		"flash_message":   b.FlashMessage,
+		"created_at":      b.CreatedAt.UTC().Format(time.RFC3339Nano),
+		"modified_at":     b.CreatedAt.UTC().Format(time.RFC3339Nano),
+		"send_at":         sendAt.UTC().Format(time.RFC3339Nano),
+		"expire_at":       expireAt.UTC().Format(time.RFC3339Nano),
+	}
+	if b.CallbackURL != "" {
+		resource["callback_url"] = b.CallbackURL
+	}
+	if b.ClientReference != "" {
+		resource["client_reference"] = b.ClientReference
+	}
+	if len(b.Parameters) > 0 {
+		resource["parameters"] = b.Parameters
+	}
+	return resource
+}
+
+// handleSinchSend handles Sinch XMS batch sends, capturing one message per
+// recipient
+func (s *Server) handleSinchSend(w http.ResponseWriter, r *http.Request) {
+	var req SinchBatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeSinchError(w, http.StatusBadRequest, "syntax_invalid_json", "Invalid JSON: "+err.Error())
+		return
+	}
+	if len(req.To) == 0 {
+		writeSinchError(w, http.StatusBadRequest, "syntax_constraint_violation", "to: must contain at least one recipient")
+		return
+	}
+	if req.From == "" {
+		writeSinchError(w, http.StatusBadRequest, "syntax_constraint_violation", "from: may not be empty")
+		return
+	}
+	if req.Body == "" {
+		writeSinchError(w, http.StatusBadRequest, "syntax_constraint_violation", "body: may not be empty")
+		return
+	}
+	if req.Type == "" {
+		req.Type = "mt_text"
+	}
+	if req.DeliveryReport == "" {
+		req.DeliveryReport = "none"
+	}
+
+	batch := &sinchBatch{
+		SinchBatchRequest: req,
+		ID:                sinchBatchID(),
+		ServicePlanID:     mux.Vars(r)["servicePlanId"],
+		Project:           projectFromRequest(r),
+		MessageIDs:        make(map[string]string),
+		CreatedAt:         time.Now(),
+	}
+
+	msgs := make([]Message, 0, len(req.To))
+	for _, to := range req.To {
+		msgs = append(msgs, Message{
+			ID:        "sinch_" + uuid.New().String()[:8],
+			To:        to,
+			From:      req.From,
+			Body:      sinchBody(req.Body, to, req.Parameters),
+			Status:    "captured",
+			CreatedAt: batch.CreatedAt,
+			Project:   batch.Project,
+			Metadata:  metadataFromRequest(r),
+
+			Correlation: correlationFromRequest(r),
+		})
+	}
+	if err := s.captureMessages(msgs); err != nil {
+		writeCaptureError(w, r, err)
+		return
+	}
+	s.redactSinchBatch(&batch.SinchBatchRequest)
+	for i, msg := range msgs {
+		batch.MessageIDs[req.To[i]] = msg.ID
+
+		log.Printf("📱 SMS captured (Sinch): To=%s Body=%s", msg.To, truncate(msg.Body, 50))
+	}
+
+	s.sinch.mu.Lock()
+	s.sinch.batches = append([]*sinchBatch{batch}, s.sinch.batches...)
+	if len(s.sinch.batches) > s.config.MaxMessages {
+		s.sinch.batches = s.sinch.batches[:s.config.MaxMessages]
+	}
+	s.sinch.mu.Unlock()
+	s.syncRecords(kindSinchBatches)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(batch.resource())
+}
+
+// sinchBatches returns the request's service plan batches in its project
+func (s *Server) sinchBatches(r *http.Request) []*sinchBatch {
+	servicePlanID := mux.Vars(r)["servicePlanId"]
+	project := projectFromRequest(r)
+
+	s.sinch.mu.Lock()
+	defer s.sinch.mu.Unlock()
+
+	var batches []*sinchBatch
+	for _, b := range s.sinch.batches {
+		if b.ServicePlanID == servicePlanID && b.Project == project {
+			batches = append(batches, b)
+		}
+	}
+	return batches
+}
+
+// findSinchBatch returns the request's batch, or writes a 404
+func (s *Server) findSinchBatch(w http.ResponseWriter, r *http.Request) (*sinchBatch, bool) {
+	id := mux.Vars(r)["batchId"]
+	for _, b := range s.sinchBatches(r) {
+		if b.ID == id {
+			return b, true
+		}
+	}
+	writeSinchError(w, http.StatusNotFound, "not_found", "Batch "+id+" not found")
+	return nil, false
+}
+
+// purgeSinchBatches removes the number with the given digits from the
+// batches inScope accepts. A batch sent from it, or left without recipients,
+// is removed; otherwise the number is dropped from its recipients and
+// parameters. Batches are replaced rather than changed, as handlers read
+// them outside the lock. It returns how many batches were affected.
+func (s *Server) purgeSinchBatches(digits string, inScope func(project string) bool) int {
+	s.sinch.mu.Lock()
+	defer s.sinch.mu.Unlock()
+
+	affected := 0
+	kept := make([]*sinchBatch, 0, len(s.sinch.batches))
+	for _, b := range s.sinch.batches {
+		if !inScope(b.Project) {
+			kept = append(kept, b)
+			continue
+		}
+		if numberDigits(b.From) == digits {
+			affected++
+			continue
+		}
+		to := make([]string, 0, len(b.To))
+		for _, recipient := range b.To {
+			if numberDigits(recipient) != digits {
+				to = append(to, recipient)
+			}
+		}
+		if len(to) == len(b.To) {
+			kept = append(kept, b)
+			continue
+		}
+		affected++
+		if len(to) == 0 {
+			continue
+		}
+
+		scrubbed := *b
+		scrubbed.To = to
+		scrubbed.MessageIDs = make(map[string]string, len(to))
+		for _, recipient := range to {
+			scrubbed.MessageIDs[recipient] = b.MessageIDs[recipient]
+		}
+		if len(b.Parameters) > 0 {
+			scrubbed.Parameters = make(map[string]map[string]string, len(b.Parameters))
+			for name, values := range b.Parameters {
+				scrubbed.Parameters[name] = make(map[string]string, len(values))
+				for key, value := range values {
+					if numberDigits(key) != digits {
+						scrubbed.Parameters[name][key] = value
+					}
+				}
+			}
+		}
+		kept = append(kept, &scrubbed)
+	}
+	s.sinch.batches = kept
+	return affected
+}
+
+// handleSinchListBatches lists batches as Sinch does, with the from, to and
+// client_reference filters and page/page_size paging
+func (s *Server) handleSinchListBatches(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var batches []map[string]interface{}
+	for _, b := range s.sinchBatches(r) {
+		if from := q.Get("from"); from != "" && !containsString(strings.Split(from, ","), b.From) {
+			continue
+		}
+		if to := q.Get("to"); to != "" && !containsAny(strings.Split(to, ","), b.To) {
+			continue
+		}
+		if ref := q.Get("client_reference"); ref != "" && ref != b.ClientReference {
+			continue
+		}
+		batches = append(batches, b.resource())
+	}
+
+	pageSize := 30
+	if v, err := strconv.Atoi(q.Get("page_size")); err == nil && v > 0 {
+		pageSize = v
+	}
+	if pageSize > maxPageLimit {
+		pageSize = maxPageLimit
+	}
+	page := 0
+	if v, err := strconv.Atoi(q.Get("page")); err == nil && v > 0 {
+		page = v
+	}
+
+	count := len(batches)
+	start := page * pageSize
+	if start > count {
+		start = count
+	}
+	end := start + pageSize
+	if end > count {
+		end = count
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"count":     count,
+		"page":      page,
+		"page_size": end - start,
+		"batches":   append([]map[string]interface{}{}, batches[start:end]...),
+	})
+}
+
+// handleSinchGetBatch returns one batch
+func (s *Server) handleSinchGetBatch(w http.ResponseWriter, r *http.Request) {
+	batch, ok := s.findSinchBatch(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(batch.resource())
+}
+
+// sinchStatus maps a message status to a Sinch delivery report status and code
+func sinchStatus(status string) (string, int) {
+	switch status {
+	case "sent":
+		return "Dispatched", 401
+	case "delivered":
+		return "Delivered", 0
+	case "failed", "undelivered", filteredStatus:
+		return "Failed", 402
+	default:
+		return "Queued", 400
+	}
+}
+
+// handleSinchDeliveryReport reports the current status of a batch's messages,
+// grouped by status; type=full lists the recipients of each status
+func (s *Server) handleSinchDeliveryReport(w http.ResponseWriter, r *http.Request) {
+	batch, ok := s.findSinchBatch(w, r)
+	if !ok {
+		return
+	}
+
+	statuses := make(map[string]string, len(batch.MessageIDs)) // Message ID → status
+	s.mu.RLock()
+	for _, msg := range s.messagesFor(batch.Project) {
+		statuses[msg.ID] = msg.Status
+	}
+	s.mu.RUnlock()
+
+	full := r.URL.Query().Get("type") == "full"
+	var order []string
+	groups := make(map[string]map[string]interface{})
+	for _, to := range batch.To {
+		status, code := sinchStatus(statuses[batch.MessageIDs[to]])
+		group, ok := groups[status]
+		if !ok {
+			group = map[string]interface{}{"code": code, "status": status, "count": 0}
+			if full {
+				group["recipients"] = []string{}
+			}
+			groups[status] = group
+			order = append(order, status)
+		}
+		group["count"] = group["count"].(int) + 1
+		if full {
+			group["recipients"] = append(group["recipients"].([]string), to)
+		}
+	}
+
+	report := make([]map[string]interface{}, len(order))
+	for i, status := range order {
+		report[i] = groups[status]
+	}
+
+	resource := map[string]interface{}{
+		"type":                "delivery_report_sms",
+		"batch_id":            batch.ID,
+		"total_message_count": len(batch.To),
+		"statuses":            report,
+	}
+	if batch.ClientReference != "" {
+		resource["client_reference"] = batch.ClientReference
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resource)
+}
+
+// containsString reports whether list contains v
+func containsString(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
+
+// containsAny reports whether any of values is in list
+func containsAny(values, list []string) bool {
+	for _, v := range values {
+		if containsString(list, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeSinchError writes a Sinch-shaped error response
+func writeSinchError(w http.ResponseWriter, status int, code, text string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"code": code,
+		"text": text,
+	})
+}
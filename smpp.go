@@ -0,0 +1,680 @@
+package smspit
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SMPP 3.4 command IDs. A response's ID is its request's with
+// smppResponse set.
+const (
+	smppBindReceiver    uint32 = 0x00000001
+	smppBindTransmitter uint32 = 0x00000002
+	smppSubmitSM        uint32 = 0x00000004
+	smppDeliverSM       uint32 = 0x00000005
+	smppUnbind          uint32 = 0x00000006
+	smppBindTransceiver uint32 = 0x00000009
+	smppEnquireLink     uint32 = 0x00000015
+	smppGenericNack     uint32 = 0x80000000
+	smppResponse        uint32 = 0x80000000
+)
+
+// SMPP command statuses
+const (
+	smppOK            uint32 = 0x00
+	smppInvMsgLen     uint32 = 0x01 // ESME_RINVMSGLEN
+	smppInvCmdLen     uint32 = 0x02 // ESME_RINVCMDLEN
+	smppInvCmdID      uint32 = 0x03 // ESME_RINVCMDID
+	smppInvBindStatus uint32 = 0x04 // ESME_RINVBNDSTS
+	smppAlreadyBound  uint32 = 0x05 // ESME_RALYBND
+	smppInvSrcAddr    uint32 = 0x0A // ESME_RINVSRCADR
+	smppInvDstAddr    uint32 = 0x0B // ESME_RINVDSTADR
+	smppInvPassword   uint32 = 0x0E // ESME_RINVPASWD
+	smppInvSystemID   uint32 = 0x0F // ESME_RINVSYSID
+	smppSubmitFail    uint32 = 0x45 // ESME_RSUBMITFAIL
+	smppThrottled     uint32 = 0x58 // ESME_RTHROTTLED
+	smppTempAppError  uint32 = 0x64 // ESME_RX_T_APPN
+)
+
+// SMPP optional parameter tags
+const (
+	tlvReceiptedMessageID uint16 = 0x001E
+	tlvSARMsgRefNum       uint16 = 0x020C
+	tlvSARTotalSegments   uint16 = 0x020E
+	tlvSARSegmentSeqnum   uint16 = 0x020F
+	tlvSCInterfaceVersion uint16 = 0x0210
+	tlvMessagePayload     uint16 = 0x0424
+	tlvMessageState       uint16 = 0x0427
+)
+
+// esm_class bits
+const (
+	esmDeliveryReceipt = 0x04 // A deliver_sm is a delivery receipt
+	esmUDHI            = 0x40 // short_message starts with a UDH
+)
+
+// registered_delivery bits (SMPP 3.4 5.2.17)
+const (
+	registeredReceipt      = 0x03 // 1: final outcome, 2: failure only, 3: success only (SMPP 5.0)
+	registeredIntermediate = 0x10 // Intermediate notifications too
+)
+
+// SMPP listener limits
+const (
+	smppMaxPDU      = 64 << 10
+	smppIdleTimeout = 5 * time.Minute // Clients send enquire_link well within this
+	smppSystemID    = "smspit"        // Our system_id in bind responses
+
+	smppMaxQueuedReceipts = 1000 // Receipts held per system_id while none of its receivers is bound
+)
+
+// SMPP default alphabets for data_coding 0
+const (
+	smppCharsetGSM    = "gsm"
+	smppCharsetLatin1 = "latin1"
+)
+
+var errSMPPLength = errors.New("invalid command_length")
+
+// smppPDU is an SMPP protocol data unit
+type smppPDU struct {
+	command uint32
+	status  uint32
+	seq     uint32
+	body    []byte
+}
+
+// readSMPP reads one PDU. A command_length out of bounds is errSMPPLength,
+// after which the stream can't be resynchronised.
+func readSMPP(r io.Reader) (smppPDU, error) {
+	var header [16]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return smppPDU{}, err
+	}
+	length := binary.BigEndian.Uint32(header[0:4])
+	if length < 16 || length > smppMaxPDU {
+		return smppPDU{}, errSMPPLength
+	}
+	pdu := smppPDU{
+		command: binary.BigEndian.Uint32(header[4:8]),
+		status:  binary.BigEndian.Uint32(header[8:12]),
+		seq:     binary.BigEndian.Uint32(header[12:16]),
+		body:    make([]byte, length-16),
+	}
+	_, err := io.ReadFull(r, pdu.body)
+	return pdu, err
+}
+
+// bytes encodes the PDU
+func (p smppPDU) bytes() []byte {
+	b := make([]byte, 16, 16+len(p.body))
+	binary.BigEndian.PutUint32(b[0:4], uint32(16+len(p.body)))
+	binary.BigEndian.PutUint32(b[4:8], p.command)
+	binary.BigEndian.PutUint32(b[8:12], p.status)
+	binary.BigEndian.PutUint32(b[12:16], p.seq)
+	return append(b, p.body...)
+}
+
+// smppReader reads the fields of a PDU body. The first error sticks, so
+// fields can be read in sequence and the error checked once.
+type smppReader struct {
+	data []byte
+	err  error
+}
+
+var errSMPPBody = errors.New("PDU body is shorter than its fields")
+
+// cstring reads a NUL-terminated string of at most max bytes, NUL included
+func (r *smppReader) cstring(max int) string {
+	if r.err != nil {
+		return ""
+	}
+	end := bytes.IndexByte(r.data, 0)
+	if end < 0 || end >= max {
+		r.err = errSMPPBody
+		return ""
+	}
+	s := string(r.data[:end])
+	r.data = r.data[end+1:]
+	return s
+}
+
+// byte reads one octet
+func (r *smppReader) byte() byte {
+	b := r.bytes(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+// bytes reads n octets
+func (r *smppReader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.data) < n {
+		r.err = errSMPPBody
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+// tlvs reads the optional parameters that end a body
+func (r *smppReader) tlvs() map[uint16][]byte {
+	params := make(map[uint16][]byte)
+	for r.err == nil && len(r.data) > 0 {
+		header := r.bytes(4)
+		if header == nil {
+			break
+		}
+		tag, n := binary.BigEndian.Uint16(header[0:2]), int(binary.BigEndian.Uint16(header[2:4]))
+		if value := r.bytes(n); value != nil {
+			params[tag] = value
+		}
+	}
+	return params
+}
+
+// smppWriter builds a PDU body
+type smppWriter struct {
+	bytes.Buffer
+}
+
+func (w *smppWriter) cstring(s string) {
+	w.WriteString(s)
+	w.WriteByte(0)
+}
+
+func (w *smppWriter) tlv(tag uint16, value []byte) {
+	binary.Write(w, binary.BigEndian, tag)
+	binary.Write(w, binary.BigEndian, uint16(len(value)))
+	w.Write(value)
+}
+
+// smppSession is one SMPP connection
+type smppSession struct {
+	conn     net.Conn
+	writeMu  sync.Mutex
+	seq      uint32 // Last sequence number of a request we sent, accessed atomically
+	bind     uint32 // The bind command it is bound with, 0 until bound; set under smppStore.mu
+	systemID string
+}
+
+// send writes a PDU, serialised with any other writer
+func (c *smppSession) send(pdu smppPDU) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(smppIdleTimeout))
+	_, err := c.conn.Write(pdu.bytes())
+	return err
+}
+
+// reply answers a request with a response PDU
+func (c *smppSession) reply(req smppPDU, status uint32, body []byte) error {
+	return c.send(smppPDU{command: req.command | smppResponse, status: status, seq: req.seq, body: body})
+}
+
+// request sends a request PDU with the session's next sequence number
+func (c *smppSession) request(command uint32, body []byte) error {
+	seq := atomic.AddUint32(&c.seq, 1) & 0x7FFFFFFF
+	return c.send(smppPDU{command: command, seq: seq, body: body})
+}
+
+// transmits reports whether the session may submit messages
+func (c *smppSession) transmits() bool {
+	return c.bind == smppBindTransmitter || c.bind == smppBindTransceiver
+}
+
+// receives reports whether the session may be sent deliver_sm
+func (c *smppSession) receives() bool {
+	return c.bind == smppBindReceiver || c.bind == smppBindTransceiver
+}
+
+// smppStore tracks the open SMPP connections, so receipts can find their
+// receivers and shutdown can close them, and the receipts waiting for a
+// receiver to bind
+type smppStore struct {
+	mu       sync.Mutex
+	sessions map[*smppSession]struct{}
+	receipts map[string][][]byte // deliver_sm bodies by system_id
+}
+
+// serveSMPP accepts SMPP connections until the listener is closed
+func (s *Server) serveSMPP(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("SMPP server error: %v", err)
+			}
+			return
+		}
+		go s.handleSMPPConn(conn)
+	}
+}
+
+// closeSMPP closes every SMPP connection
+func (s *Server) closeSMPP() {
+	s.smpp.mu.Lock()
+	defer s.smpp.mu.Unlock()
+	for sess := range s.smpp.sessions {
+		sess.conn.Close()
+	}
+}
+
+// handleSMPPConn speaks the SMSC side of SMPP 3.4: binds, submit_sm,
+// enquire_link and unbind. Anything else is answered with generic_nack.
+func (s *Server) handleSMPPConn(conn net.Conn) {
+	sess := &smppSession{conn: conn}
+	s.smpp.mu.Lock()
+	if s.smpp.sessions == nil {
+		s.smpp.sessions = make(map[*smppSession]struct{})
+	}
+	s.smpp.sessions[sess] = struct{}{}
+	s.smpp.mu.Unlock()
+	defer func() {
+		s.smpp.mu.Lock()
+		delete(s.smpp.sessions, sess)
+		s.smpp.mu.Unlock()
+		conn.Close()
+	}()
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(smppIdleTimeout))
+		pdu, err := readSMPP(conn)
+		if errors.Is(err, errSMPPLength) {
+			sess.send(smppPDU{command: smppGenericNack, status: smppInvCmdLen})
+			return
+		}
+		if err != nil {
+			return
+		}
+
+		switch pdu.command {
+		case smppBindReceiver, smppBindTransmitter, smppBindTransceiver:
+			err = s.smppBind(sess, pdu)
+		case smppSubmitSM:
+			if !sess.transmits() {
+				err = sess.reply(pdu, smppInvBindStatus, nil)
+				break
+			}
+			id, status := s.smppSubmit(sess, pdu)
+			var body smppWriter
+			if status == smppOK {
+				body.cstring(id)
+			}
+			err = sess.reply(pdu, status, body.Bytes())
+		case smppEnquireLink:
+			err = sess.reply(pdu, smppOK, nil)
+		case smppUnbind:
+			sess.reply(pdu, smppOK, nil)
+			log.Printf("🔌 SMPP unbind: SystemID=%s", sess.systemID)
+			return
+		default:
+			if pdu.command&smppResponse != 0 {
+				continue // Responses to what we sent need no answer
+			}
+			err = sess.send(smppPDU{command: smppGenericNack, status: smppInvCmdID, seq: pdu.seq})
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// smppBind binds a session, checking its credentials when
+// SMSPIT_SMPP_SYSTEM_ID is set
+func (s *Server) smppBind(sess *smppSession, pdu smppPDU) error {
+	r := smppReader{data: pdu.body}
+	systemID := r.cstring(16)
+	password := r.cstring(9)
+	r.cstring(13) // system_type
+	version := r.byte()
+
+	status := smppOK
+	switch {
+	case r.err != nil:
+		status = smppInvCmdLen
+	case sess.bind != 0:
+		status = smppAlreadyBound
+	case s.config.SMPPSystemID != "" && subtle.ConstantTimeCompare([]byte(systemID), []byte(s.config.SMPPSystemID)) != 1:
+		status = smppInvSystemID
+	case s.config.SMPPSystemID != "" && subtle.ConstantTimeCompare([]byte(password), []byte(s.config.SMPPPassword)) != 1:
+		status = smppInvPassword
+	}
+	if status != smppOK {
+		log.Printf("⚠️ SMPP bind refused: SystemID=%s Status=0x%02X", systemID, status)
+		return sess.reply(pdu, status, nil)
+	}
+
+	s.smpp.mu.Lock()
+	sess.bind, sess.systemID = pdu.command, systemID
+	s.smpp.mu.Unlock()
+
+	var body smppWriter
+	body.cstring(smppSystemID)
+	if version >= 0x34 {
+		body.tlv(tlvSCInterfaceVersion, []byte{0x34})
+	}
+	log.Printf("🔌 SMPP bind: SystemID=%s Mode=%s", systemID, smppBindMode(pdu.command))
+	if err := sess.reply(pdu, smppOK, body.Bytes()); err != nil {
+		return err
+	}
+	if sess.receives() {
+		s.flushSMPPReceipts(sess)
+	}
+	return nil
+}
+
+// smppBindMode names a bind command
+func smppBindMode(command uint32) string {
+	switch command {
+	case smppBindReceiver:
+		return "receiver"
+	case smppBindTransmitter:
+		return "transmitter"
+	}
+	return "transceiver"
+}
+
+// smppSubmit captures a submit_sm and returns the message ID for the
+// response, or the error status. Parts of a concatenated message, by UDH or
+// sar_* parameters, are held until all have arrived and are answered with
+// the ID the reassembled message will have.
+func (s *Server) smppSubmit(sess *smppSession, pdu smppPDU) (string, uint32) {
+	r := smppReader{data: pdu.body}
+	r.cstring(6) // service_type
+	sourceTON := r.byte()
+	r.byte() // source_addr_npi
+	source := r.cstring(21)
+	destTON := r.byte()
+	r.byte() // dest_addr_npi
+	dest := r.cstring(21)
+	esmClass := r.byte()
+	r.byte()      // protocol_id
+	r.byte()      // priority_flag
+	r.cstring(17) // schedule_delivery_time
+	r.cstring(17) // validity_period
+	registered := r.byte() & (registeredReceipt | registeredIntermediate)
+	r.byte() // replace_if_present_flag
+	dataCoding := r.byte()
+	r.byte() // sm_default_msg_id
+	sm := r.bytes(int(r.byte()))
+	params := r.tlvs()
+	if r.err != nil {
+		return "", smppInvCmdLen
+	}
+	if payload, ok := params[tlvMessagePayload]; ok && len(sm) == 0 {
+		sm = payload
+	}
+	if dest == "" {
+		return "", smppInvDstAddr
+	}
+
+	var udh []byte
+	if esmClass&esmUDHI != 0 {
+		if len(sm) == 0 || int(sm[0])+1 > len(sm) {
+			return "", smppInvMsgLen
+		}
+		udh, sm = sm[:int(sm[0])+1], sm[int(sm[0])+1:]
+	}
+	concat, concatenated := parseConcatUDH(udh)
+	if !concatenated {
+		concat, concatenated = smppSARConcat(params)
+	}
+
+	msg := Message{
+		ID:        "msg_" + uuid.New().String()[:8],
+		To:        smppAddress(destTON, dest),
+		From:      smppAddress(sourceTON, source),
+		Body:      s.smppText(dataCoding, sm),
+		Status:    "captured",
+		CreatedAt: time.Now(),
+		Project:   defaultProject,
+	}
+	if registered != 0 {
+		msg.SMPPSystemID, msg.RegisteredDelivery = sess.systemID, int(registered)
+	}
+
+	if s.config.RateLimitMode != rateLimitQueue {
+		if limits := s.rateLimits(msg.Project, "", msg.From, msg.To); len(limits) > 0 {
+			if _, ok := s.limiter.reserve(limits, false); !ok {
+				log.Printf("🚦 Rate limit exceeded: From=%s SystemID=%s", msg.From, sess.systemID)
+				return "", smppThrottled
+			}
+		}
+	}
+
+	if concatenated {
+		full, complete := s.addConcatPart(msg, udh, concat)
+		if !complete {
+			log.Printf("🧩 SMS part %d/%d held for reassembly: To=%s", concat.seq, concat.total, msg.To)
+			return full.ID, smppOK
+		}
+		msg = full
+	}
+	if err := s.captureMessage(&msg); err != nil {
+		return "", smppCaptureStatus(err)
+	}
+	log.Printf("📱 SMS captured (SMPP): To=%s Body=%s", msg.To, truncate(msg.Body, 50))
+	return msg.ID, smppOK
+}
+
+// smppSARConcat reads the concatenation from the sar_* parameters
+func smppSARConcat(params map[uint16][]byte) (udhConcat, bool) {
+	ref, total, seq := params[tlvSARMsgRefNum], params[tlvSARTotalSegments], params[tlvSARSegmentSeqnum]
+	if len(ref) != 2 || len(total) != 1 || len(seq) != 1 {
+		return udhConcat{}, false
+	}
+	c := udhConcat{ref: int(binary.BigEndian.Uint16(ref)), total: int(total[0]), seq: int(seq[0])}
+	if c.total == 0 || c.seq == 0 || c.seq > c.total {
+		return udhConcat{}, false
+	}
+	return c, true
+}
+
+// smppAddress writes an international number (TON 1) with a leading +
+func smppAddress(ton byte, addr string) string {
+	if ton == 1 && addr != "" && !strings.HasPrefix(addr, "+") {
+		return "+" + addr
+	}
+	return addr
+}
+
+// smppText decodes short_message by its data_coding. The SMSC default
+// alphabet (0) is SMSPIT_SMPP_CHARSET: unpacked GSM 03.38 or Latin-1.
+func (s *Server) smppText(dataCoding byte, data []byte) string {
+	switch {
+	case dataCoding == 0x00 && s.config.SMPPCharset != smppCharsetLatin1:
+		return decodeGSM7(data)
+	case dataCoding == 0x08:
+		return decodeUCS2(data)
+	case dataCoding&0xF0 == 0xF0 && dataCoding&0x04 == 0:
+		return decodeGSM7(data)
+	}
+	return decodeLatin1(data) // IA5 (ASCII), Latin-1 and 8-bit data
+}
+
+// smppCaptureStatus maps a capture error to a submit_sm_resp status
+func smppCaptureStatus(err error) uint32 {
+	var tooLong *MessageTooLongError
+	var badSender *SenderError
+	switch {
+	case errors.Is(err, errShuttingDown):
+		return smppTempAppError
+	case errors.As(err, &tooLong):
+		return smppInvMsgLen
+	case errors.As(err, &badSender):
+		return smppInvSrcAddr
+	}
+	log.Printf("⚠️ SMPP submit refused: %v", err)
+	return smppSubmitFail
+}
+
+// smppMessageStates are the message_state values of receipt stats
+var smppMessageStates = map[string]byte{
+	"ENROUTE": 1,
+	"DELIVRD": 2,
+	"EXPIRED": 3,
+	"DELETED": 4,
+	"UNDELIV": 5,
+	"ACCEPTD": 6,
+	"REJECTD": 8,
+}
+
+// smppReceiptWanted reports whether registered_delivery asks for a receipt
+// of status
+func smppReceiptWanted(registered int, status string) bool {
+	switch status {
+	case "queued", "sent":
+		return registered&registeredIntermediate != 0
+	case "delivered":
+		return registered&registeredReceipt == 1 || registered&registeredReceipt == 3
+	}
+	return registered&registeredReceipt == 1 || registered&registeredReceipt == 2
+}
+
+// sendSMPPReceipt sends the system_id that submitted msg a deliver_sm
+// delivery receipt for its status, if registered_delivery asked for one.
+// Receipts wait for a receiver or transceiver of the system_id to bind.
+func (s *Server) sendSMPPReceipt(msg Message) {
+	typ, stat := dlrType(msg.Status)
+	if msg.SMPPSystemID == "" || typ == 0 || !smppReceiptWanted(msg.RegisteredDelivery, msg.Status) {
+		return
+	}
+
+	text := dlrText(s.config.SMPPDLRFormat, msg, stat, time.Now())
+	var body smppWriter
+	body.cstring("") // service_type
+	sourceTON, sourceNPI, source := smppAddressFields(msg.To)
+	body.Write([]byte{sourceTON, sourceNPI})
+	body.cstring(source)
+	destTON, destNPI, dest := smppAddressFields(msg.From)
+	body.Write([]byte{destTON, destNPI})
+	body.cstring(dest)
+	body.Write([]byte{esmDeliveryReceipt, 0, 0}) // esm_class, protocol_id, priority_flag
+	body.cstring("")                             // schedule_delivery_time
+	body.cstring("")                             // validity_period
+	body.Write([]byte{0, 0, 0, 0})               // registered_delivery, replace_if_present_flag, data_coding, sm_default_msg_id
+	if sm := s.smppEncode(text); len(sm) <= 254 {
+		body.WriteByte(byte(len(sm)))
+		body.Write(sm)
+	} else {
+		body.WriteByte(0) // Too long for short_message
+		body.tlv(tlvMessagePayload, sm)
+	}
+	body.tlv(tlvReceiptedMessageID, append([]byte(msg.ID), 0))
+	body.tlv(tlvMessageState, []byte{smppMessageStates[stat]})
+
+	s.deliverSMPP(msg.SMPPSystemID, body.Bytes())
+	log.Printf("📨 SMPP receipt: ID=%s Stat=%s SystemID=%s", msg.ID, stat, msg.SMPPSystemID)
+}
+
+// deliverSMPP sends a deliver_sm to a receiver bound as systemID, or holds
+// it until one binds
+func (s *Server) deliverSMPP(systemID string, body []byte) {
+	s.smpp.mu.Lock()
+	var receiver *smppSession
+	for sess := range s.smpp.sessions {
+		if sess.systemID == systemID && sess.receives() {
+			receiver = sess
+			break
+		}
+	}
+	s.smpp.mu.Unlock()
+
+	if receiver == nil || receiver.request(smppDeliverSM, body) != nil {
+		s.queueSMPPReceipts(systemID, body)
+	}
+}
+
+// queueSMPPReceipts holds receipts for systemID, dropping the oldest past
+// smppMaxQueuedReceipts
+func (s *Server) queueSMPPReceipts(systemID string, bodies ...[]byte) {
+	s.smpp.mu.Lock()
+	defer s.smpp.mu.Unlock()
+	if s.smpp.receipts == nil {
+		s.smpp.receipts = make(map[string][][]byte)
+	}
+	queued := append(s.smpp.receipts[systemID], bodies...)
+	if drop := len(queued) - smppMaxQueuedReceipts; drop > 0 {
+		log.Printf("⚠️ Dropping %d SMPP receipt(s) for %s: no receiver bound", drop, systemID)
+		queued = queued[drop:]
+	}
+	s.smpp.receipts[systemID] = queued
+}
+
+// flushSMPPReceipts sends a newly bound receiver the receipts held for its
+// system_id
+func (s *Server) flushSMPPReceipts(sess *smppSession) {
+	s.smpp.mu.Lock()
+	queued := s.smpp.receipts[sess.systemID]
+	delete(s.smpp.receipts, sess.systemID)
+	s.smpp.mu.Unlock()
+
+	for i, body := range queued {
+		if sess.request(smppDeliverSM, body) != nil {
+			s.queueSMPPReceipts(sess.systemID, queued[i:]...)
+			return
+		}
+	}
+}
+
+// smppAddressFields returns the TON, NPI and digits to send a number as:
+// international without its +, or alphanumeric
+func smppAddressFields(addr string) (ton, npi byte, value string) {
+	switch {
+	case strings.HasPrefix(addr, "+"):
+		return 1, 1, addr[1:]
+	case strings.Trim(addr, "0123456789") != "":
+		return 5, 0, addr
+	}
+	return 0, 1, addr
+}
+
+// smppEncode encodes text in the SMSC default alphabet for data_coding 0,
+// replacing characters it doesn't have with ?
+func (s *Server) smppEncode(text string) []byte {
+	out := make([]byte, 0, len(text))
+	for _, r := range text {
+		if s.config.SMPPCharset == smppCharsetLatin1 {
+			if r > 0xFF {
+				r = '?'
+			}
+			out = append(out, byte(r))
+			continue
+		}
+		out = append(out, gsm7Encode(r)...)
+	}
+	return out
+}
+
+// gsm7Encode returns the unpacked GSM 03.38 septets for r: one, two with
+// the escape for extension characters, or ? when it has none
+func gsm7Encode(r rune) []byte {
+	for code, c := range gsm7Codes {
+		if c == r && code != 0x1B {
+			return []byte{byte(code)}
+		}
+	}
+	for code, c := range gsm7ExtensionCodes {
+		if c == r {
+			return []byte{0x1B, code}
+		}
+	}
+	return []byte{'?'}
+}
@@ -0,0 +1,361 @@
+package smspit
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smppClient is the ESME side of an SMPP connection
+type smppClient struct {
+	t    *testing.T
+	conn net.Conn
+	seq  uint32
+}
+
+// startSMPP starts a server with an SMPP listener
+func startSMPP(t *testing.T, config Config) (*Server, *Instance) {
+	t.Helper()
+	config.Host, config.SMPPPort = "127.0.0.1", "0"
+	s := New(config)
+	inst, err := s.Start(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { inst.Close() })
+	return s, inst
+}
+
+func dialSMPP(t *testing.T, inst *Instance) *smppClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", inst.SMPPAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &smppClient{t: t, conn: conn}
+}
+
+// call sends a request and returns its response
+func (c *smppClient) call(command uint32, body []byte) smppPDU {
+	c.t.Helper()
+	c.seq++
+	if _, err := c.conn.Write(smppPDU{command: command, seq: c.seq, body: body}.bytes()); err != nil {
+		c.t.Fatal(err)
+	}
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	resp, err := readSMPP(c.conn)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if resp.seq != c.seq {
+		c.t.Fatalf("response sequence %d, want %d", resp.seq, c.seq)
+	}
+	return resp
+}
+
+func (c *smppClient) bind(command uint32, systemID, password string) uint32 {
+	c.t.Helper()
+	var body smppWriter
+	body.cstring(systemID)
+	body.cstring(password)
+	body.cstring("")
+	body.Write([]byte{0x34, 0, 0})
+	body.cstring("")
+	return c.call(command, body.Bytes()).status
+}
+
+// smppSubmitFields are the submit_sm fields the tests vary
+type smppSubmitFields struct {
+	from, to   string
+	esmClass   byte
+	dataCoding byte
+	sm         []byte
+	tlvs       map[uint16][]byte
+}
+
+// submit sends a submit_sm and returns the message ID and status
+func (c *smppClient) submit(f smppSubmitFields) (string, uint32) {
+	c.t.Helper()
+	var body smppWriter
+	body.cstring("")
+	body.Write([]byte{1, 1})
+	body.cstring(f.from)
+	body.Write([]byte{1, 1})
+	body.cstring(f.to)
+	body.Write([]byte{f.esmClass, 0, 0})
+	body.cstring("")
+	body.cstring("")
+	body.Write([]byte{0, 0, f.dataCoding, 0, byte(len(f.sm))})
+	body.Write(f.sm)
+	for tag, value := range f.tlvs {
+		body.tlv(tag, value)
+	}
+	resp := c.call(smppSubmitSM, body.Bytes())
+	r := smppReader{data: resp.body}
+	id := ""
+	if resp.status == smppOK {
+		id = r.cstring(66)
+	}
+	return id, resp.status
+}
+
+func TestSMPPSubmit(t *testing.T) {
+	ucs2 := []byte{0x04, 0x1A, 0x04, 0x3E, 0x04, 0x34}
+	tests := []struct {
+		name     string
+		fields   smppSubmitFields
+		wantBody string
+	}{
+		{"GSM default alphabet", smppSubmitFields{sm: []byte{0x00, 'a', 0x11, 0x1B, 0x65}}, "@a_€"},
+		{"Latin-1", smppSubmitFields{dataCoding: 3, sm: []byte("caf\xe9")}, "café"},
+		{"UCS-2", smppSubmitFields{dataCoding: 8, sm: ucs2}, "Код"},
+		{"message_payload", smppSubmitFields{tlvs: map[uint16][]byte{tlvMessagePayload: []byte("Your code is 123456")}}, "Your code is 123456"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, inst := startSMPP(t, Config{})
+			c := dialSMPP(t, inst)
+			if status := c.bind(smppBindTransmitter, "app", "pw"); status != smppOK {
+				t.Fatalf("bind: status 0x%02X", status)
+			}
+			tt.fields.from, tt.fields.to = "15550009999", "15551230001"
+			id, status := c.submit(tt.fields)
+			if status != smppOK {
+				t.Fatalf("submit_sm: status 0x%02X", status)
+			}
+			msg, ok := s.findMessage(id)
+			if !ok {
+				t.Fatalf("message %s not captured", id)
+			}
+			if msg.From != "+15550009999" || msg.To != "+15551230001" || msg.Body != tt.wantBody {
+				t.Errorf("captured from %q to %q: %q, want %q", msg.From, msg.To, msg.Body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestSMPPConcat(t *testing.T) {
+	tests := []struct {
+		name  string
+		parts []smppSubmitFields
+	}{
+		{"UDH", []smppSubmitFields{
+			{esmClass: esmUDHI, sm: append([]byte{5, ieConcat8, 3, 7, 2, 2}, "Don't share it."...)},
+			{esmClass: esmUDHI, sm: append([]byte{5, ieConcat8, 3, 7, 2, 1}, "Your code is 123456. "...)},
+		}},
+		{"SAR parameters", []smppSubmitFields{
+			{sm: []byte("Your code is 123456. "), tlvs: map[uint16][]byte{tlvSARMsgRefNum: {1, 7}, tlvSARTotalSegments: {2}, tlvSARSegmentSeqnum: {1}}},
+			{sm: []byte("Don't share it."), tlvs: map[uint16][]byte{tlvSARMsgRefNum: {1, 7}, tlvSARTotalSegments: {2}, tlvSARSegmentSeqnum: {2}}},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, inst := startSMPP(t, Config{})
+			c := dialSMPP(t, inst)
+			if status := c.bind(smppBindTransceiver, "app", "pw"); status != smppOK {
+				t.Fatalf("bind: status 0x%02X", status)
+			}
+			var ids []string
+			for _, part := range tt.parts {
+				part.from, part.to = "15550009999", "15551230001"
+				id, status := c.submit(part)
+				if status != smppOK {
+					t.Fatalf("submit_sm: status 0x%02X", status)
+				}
+				ids = append(ids, id)
+			}
+			if ids[0] != ids[1] {
+				t.Errorf("parts answered with IDs %v, want the message's for both", ids)
+			}
+			msg, ok := s.findMessage(ids[0])
+			if !ok {
+				t.Fatalf("message %s not captured", ids[0])
+			}
+			if msg.Body != "Your code is 123456. Don't share it." || len(msg.parts) != 2 {
+				t.Errorf("captured %q from %d parts", msg.Body, len(msg.parts))
+			}
+		})
+	}
+}
+
+func TestSMPPSession(t *testing.T) {
+	_, inst := startSMPP(t, Config{SMPPSystemID: "app", SMPPPassword: "secret"})
+
+	tests := []struct {
+		name     string
+		systemID string
+		password string
+		want     uint32
+	}{
+		{"wrong system ID", "other", "secret", smppInvSystemID},
+		{"wrong password", "app", "secre", smppInvPassword},
+		{"credentials", "app", "secret", smppOK},
+	}
+	for _, tt := range tests {
+		c := dialSMPP(t, inst)
+		if status := c.bind(smppBindTransceiver, tt.systemID, tt.password); status != tt.want {
+			t.Errorf("%s: bind status 0x%02X, want 0x%02X", tt.name, status, tt.want)
+		}
+	}
+
+	c := dialSMPP(t, inst)
+	if _, status := c.submit(smppSubmitFields{to: "15551230001", sm: []byte("Hi")}); status != smppInvBindStatus {
+		t.Errorf("submit_sm before bind: status 0x%02X, want 0x%02X", status, smppInvBindStatus)
+	}
+	c.bind(smppBindReceiver, "app", "secret")
+	if _, status := c.submit(smppSubmitFields{to: "15551230001", sm: []byte("Hi")}); status != smppInvBindStatus {
+		t.Errorf("submit_sm as a receiver: status 0x%02X, want 0x%02X", status, smppInvBindStatus)
+	}
+	if status := c.bind(smppBindTransmitter, "app", "secret"); status != smppAlreadyBound {
+		t.Errorf("second bind: status 0x%02X, want 0x%02X", status, smppAlreadyBound)
+	}
+	if resp := c.call(smppEnquireLink, nil); resp.command != smppEnquireLink|smppResponse || resp.status != smppOK {
+		t.Errorf("enquire_link: command 0x%08X status 0x%02X", resp.command, resp.status)
+	}
+	if resp := c.call(0x00000103, nil); resp.command != smppGenericNack || resp.status != smppInvCmdID {
+		t.Errorf("data_sm: command 0x%08X status 0x%02X, want generic_nack", resp.command, resp.status)
+	}
+	if resp := c.call(smppUnbind, nil); resp.command != smppUnbind|smppResponse {
+		t.Errorf("unbind: command 0x%08X", resp.command)
+	}
+}
+
+// smppReceipt is a deliver_sm receipt as a client sees it
+type smppReceipt struct {
+	esmClass  byte
+	text      string
+	receiptID string
+	state     byte
+	from, to  string
+}
+
+// receipts reads the deliver_sm PDUs that arrive within wait, decoding
+// their text as GSM 03.38
+func (c *smppClient) receipts(wait time.Duration) []smppReceipt {
+	c.t.Helper()
+	var receipts []smppReceipt
+	deadline := time.Now().Add(wait)
+	for {
+		c.conn.SetReadDeadline(deadline)
+		pdu, err := readSMPP(c.conn)
+		if err != nil {
+			return receipts
+		}
+		if pdu.command != smppDeliverSM {
+			c.t.Fatalf("got command 0x%08X, want deliver_sm", pdu.command)
+		}
+		r := smppReader{data: pdu.body}
+		r.cstring(6)
+		r.bytes(2)
+		from := r.cstring(21)
+		r.bytes(2)
+		to := r.cstring(21)
+		receipt := smppReceipt{esmClass: r.byte(), from: from, to: to}
+		r.bytes(2)
+		r.cstring(17)
+		r.cstring(17)
+		r.bytes(4)
+		// The default charset is GSM 03.38, where _ is 0x11
+		receipt.text = decodeGSM7(r.bytes(int(r.byte())))
+		params := r.tlvs()
+		if r.err != nil {
+			c.t.Fatalf("invalid deliver_sm: %v", r.err)
+		}
+		receipt.receiptID = strings.TrimSuffix(string(params[tlvReceiptedMessageID]), "\x00")
+		if state := params[tlvMessageState]; len(state) == 1 {
+			receipt.state = state[0]
+		}
+		receipts = append(receipts, receipt)
+	}
+}
+
+func TestSMPPReceipts(t *testing.T) {
+	tests := []struct {
+		name        string
+		registered  byte
+		failureRate float64
+		want        []string // Receipt stats, in order
+	}{
+		{"none requested", 0x00, 0, nil},
+		{"final outcome, delivered", 0x01, 0, []string{"DELIVRD"}},
+		{"final outcome, failed", 0x01, 1, []string{"REJECTD"}},
+		{"failure only, delivered", 0x02, 0, nil},
+		{"failure only, failed", 0x02, 1, []string{"REJECTD"}},
+		{"success only, delivered", 0x03, 0, []string{"DELIVRD"}},
+		{"intermediate notifications", 0x11, 0, []string{"ENROUTE", "ACCEPTD", "DELIVRD"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, inst := startSMPP(t, Config{DeliveryDelay: 10 * time.Millisecond, DeliveryFailureRate: tt.failureRate})
+			c := dialSMPP(t, inst)
+			if status := c.bind(smppBindTransceiver, "app", "pw"); status != smppOK {
+				t.Fatalf("bind: status 0x%02X", status)
+			}
+			id, status := c.submitRegistered("Hello", tt.registered)
+			if status != smppOK {
+				t.Fatalf("submit_sm: status 0x%02X", status)
+			}
+
+			receipts := c.receipts(300 * time.Millisecond)
+			if len(receipts) != len(tt.want) {
+				t.Fatalf("got %d receipts %+v, want %v", len(receipts), receipts, tt.want)
+			}
+			for i, receipt := range receipts {
+				if receipt.esmClass != esmDeliveryReceipt || receipt.receiptID != id || receipt.state != smppMessageStates[tt.want[i]] {
+					t.Errorf("receipt %d = %+v, want a %s receipt for %s", i, receipt, tt.want[i], id)
+				}
+				if !strings.HasPrefix(receipt.text, "id:"+id+" ") || !strings.Contains(receipt.text, "stat:"+tt.want[i]) {
+					t.Errorf("receipt %d text = %q", i, receipt.text)
+				}
+				// A receipt comes from the recipient to the sender
+				if receipt.from != "15551230001" || receipt.to != "15550009999" {
+					t.Errorf("receipt %d from %q to %q", i, receipt.from, receipt.to)
+				}
+			}
+		})
+	}
+}
+
+func TestSMPPReceiptsHeld(t *testing.T) {
+	_, inst := startSMPP(t, Config{DeliveryDelay: 10 * time.Millisecond, SMPPDLRFormat: "{id} {stat}"})
+	tx := dialSMPP(t, inst)
+	tx.bind(smppBindTransmitter, "app", "pw")
+	id, _ := tx.submitRegistered("Hello", 0x01)
+	time.Sleep(100 * time.Millisecond)
+
+	// Receipts only go to receivers of the system_id that submitted
+	other := dialSMPP(t, inst)
+	other.bind(smppBindReceiver, "other", "pw")
+	if receipts := other.receipts(100 * time.Millisecond); len(receipts) != 0 {
+		t.Errorf("another system_id got %d receipts", len(receipts))
+	}
+
+	rx := dialSMPP(t, inst)
+	rx.bind(smppBindReceiver, "app", "pw")
+	receipts := rx.receipts(100 * time.Millisecond)
+	if len(receipts) != 1 || receipts[0].text != id+" DELIVRD" {
+		t.Errorf("held receipts = %+v, want %q", receipts, id+" DELIVRD")
+	}
+}
+
+// submitRegistered submits text with registered_delivery set
+func (c *smppClient) submitRegistered(text string, registered byte) (string, uint32) {
+	c.t.Helper()
+	var body smppWriter
+	body.cstring("")
+	body.Write([]byte{0, 1})
+	body.cstring("15550009999")
+	body.Write([]byte{0, 1})
+	body.cstring("15551230001")
+	body.Write([]byte{0, 0, 0})
+	body.cstring("")
+	body.cstring("")
+	body.Write([]byte{registered, 0, 0, 0, byte(len(text))})
+	body.WriteString(text)
+	resp := c.call(smppSubmitSM, body.Bytes())
+	r := smppReader{data: resp.body}
+	return r.cstring(66), resp.status
+}
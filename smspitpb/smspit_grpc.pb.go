@@ -0,0 +1,225 @@
+// gRPC API for SMSpit, served on SMSPIT_GRPC_PORT alongside the REST API.
+//
+// Regenerate the Go code after editing (from the repository root):
+//
+//	protoc --go_out=. --go_opt=paths=source_relative \
+//	  --go-grpc_out=. --go-grpc_opt=paths=source_relative \
+//	  smspitpb/smspit.proto
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v4.25.3
+// source: smspitpb/smspit.proto
+
+package smspitpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	SMSpit_SendMessage_FullMethodName    = "/smspit.v1.SMSpit/SendMessage"
+	SMSpit_ListMessages_FullMethodName   = "/smspit.v1.SMSpit/ListMessages"
+	SMSpit_StreamMessages_FullMethodName = "/smspit.v1.SMSpit/StreamMessages"
+)
+
+// SMSpitClient is the client API for SMSpit service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// SMSpit captures messages and serves them back. Every RPC is scoped to a
+// project: the request's project field, else the x-smspit-project metadata,
+// else "default". With SMSPIT_AUTH_TOKEN set, send "authorization: Bearer
+// <token>" metadata; SendMessage needs the send scope, the others read.
+type SMSpitClient interface {
+	// SendMessage captures a message as if it had been POSTed to /send
+	SendMessage(ctx context.Context, in *SendMessageRequest, opts ...grpc.CallOption) (*Message, error)
+	// ListMessages returns captured messages, newest first
+	ListMessages(ctx context.Context, in *ListMessagesRequest, opts ...grpc.CallOption) (*ListMessagesResponse, error)
+	// StreamMessages streams new messages and status changes as they happen
+	StreamMessages(ctx context.Context, in *StreamMessagesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[MessageEvent], error)
+}
+
+type sMSpitClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewSMSpitClient(cc grpc.ClientConnInterface) SMSpitClient {
+	return &sMSpitClient{cc}
+}
+
+func (c *sMSpitClient) SendMessage(ctx context.Context, in *SendMessageRequest, opts ...grpc.CallOption) (*Message, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Message)
+	err := c.cc.Invoke(ctx, SMSpit_SendMessage_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sMSpitClient) ListMessages(ctx context.Context, in *ListMessagesRequest, opts ...grpc.CallOption) (*ListMessagesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListMessagesResponse)
+	err := c.cc.Invoke(ctx, SMSpit_ListMessages_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sMSpitClient) StreamMessages(ctx context.Context, in *StreamMessagesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[MessageEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &SMSpit_ServiceDesc.Streams[0], SMSpit_StreamMessages_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StreamMessagesRequest, MessageEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type SMSpit_StreamMessagesClient = grpc.ServerStreamingClient[MessageEvent]
+
+// SMSpitServer is the server API for SMSpit service.
+// All implementations must embed UnimplementedSMSpitServer
+// for forward compatibility.
+//
+// SMSpit captures messages and serves them back. Every RPC is scoped to a
+// project: the request's project field, else the x-smspit-project metadata,
+// else "default". With SMSPIT_AUTH_TOKEN set, send "authorization: Bearer
+// <token>" metadata; SendMessage needs the send scope, the others read.
+type SMSpitServer interface {
+	// SendMessage captures a message as if it had been POSTed to /send
+	SendMessage(context.Context, *SendMessageRequest) (*Message, error)
+	// ListMessages returns captured messages, newest first
+	ListMessages(context.Context, *ListMessagesRequest) (*ListMessagesResponse, error)
+	// StreamMessages streams new messages and status changes as they happen
+	StreamMessages(*StreamMessagesRequest, grpc.ServerStreamingServer[MessageEvent]) error
+	mustEmbedUnimplementedSMSpitServer()
+}
+
+// UnimplementedSMSpitServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedSMSpitServer struct{}
+
+func (UnimplementedSMSpitServer) SendMessage(context.Context, *SendMessageRequest) (*Message, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SendMessage not implemented")
+}
+func (UnimplementedSMSpitServer) ListMessages(context.Context, *ListMessagesRequest) (*ListMessagesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListMessages not implemented")
+}
+func (UnimplementedSMSpitServer) StreamMessages(*StreamMessagesRequest, grpc.ServerStreamingServer[MessageEvent]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamMessages not implemented")
+}
+func (UnimplementedSMSpitServer) mustEmbedUnimplementedSMSpitServer() {}
+func (UnimplementedSMSpitServer) testEmbeddedByValue()                {}
+
+// UnsafeSMSpitServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to SMSpitServer will
+// result in compilation errors.
+type UnsafeSMSpitServer interface {
+	mustEmbedUnimplementedSMSpitServer()
+}
+
+func RegisterSMSpitServer(s grpc.ServiceRegistrar, srv SMSpitServer) {
+	// If the following call pancis, it indicates UnimplementedSMSpitServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&SMSpit_ServiceDesc, srv)
+}
+
+func _SMSpit_SendMessage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SendMessageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SMSpitServer).SendMessage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SMSpit_SendMessage_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SMSpitServer).SendMessage(ctx, req.(*SendMessageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SMSpit_ListMessages_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListMessagesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SMSpitServer).ListMessages(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SMSpit_ListMessages_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SMSpitServer).ListMessages(ctx, req.(*ListMessagesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SMSpit_StreamMessages_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamMessagesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SMSpitServer).StreamMessages(m, &grpc.GenericServerStream[StreamMessagesRequest, MessageEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type SMSpit_StreamMessagesServer = grpc.ServerStreamingServer[MessageEvent]
+
+// SMSpit_ServiceDesc is the grpc.ServiceDesc for SMSpit service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var SMSpit_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "smspit.v1.SMSpit",
+	HandlerType: (*SMSpitServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "SendMessage",
+			Handler:    _SMSpit_SendMessage_Handler,
+		},
+		{
+			MethodName: "ListMessages",
+			Handler:    _SMSpit_ListMessages_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamMessages",
+			Handler:       _SMSpit_StreamMessages_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "smspitpb/smspit.proto",
+}
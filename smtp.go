@@ -0,0 +1,313 @@
+package smspit
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SMTP gateway limits
+const (
+	smtpMaxSize     = 1 << 20 // Largest accepted email
+	smtpMaxRcpts    = 100
+	smtpIdleTimeout = 5 * time.Minute
+)
+
+// smtpSession is one SMTP connection's transaction state
+type smtpSession struct {
+	from  string
+	rcpts []string
+}
+
+// serveSMTP accepts SMTP connections until the listener is closed
+func (s *Server) serveSMTP(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("SMTP server error: %v", err)
+			}
+			return
+		}
+		go s.handleSMTPConn(conn)
+	}
+}
+
+// handleSMTPConn speaks enough SMTP for applications that email an SMS
+// gateway: any AUTH is accepted and each message becomes an SMS per
+// recipient number
+func (s *Server) handleSMTPConn(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	reply := func(format string, args ...interface{}) error {
+		conn.SetWriteDeadline(time.Now().Add(smtpIdleTimeout))
+		return tp.PrintfLine(format, args...)
+	}
+	readLine := func() (string, error) {
+		conn.SetReadDeadline(time.Now().Add(smtpIdleTimeout))
+		return tp.ReadLine()
+	}
+
+	if reply("220 %s SMSpit SMTP gateway ready", s.smtpHostname()) != nil {
+		return
+	}
+
+	var session smtpSession
+	for {
+		line, err := readLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "HELO":
+			err = reply("250 %s", s.smtpHostname())
+		case "EHLO":
+			err = reply("250-%s\r\n250-8BITMIME\r\n250-SIZE %d\r\n250 AUTH PLAIN LOGIN", s.smtpHostname(), smtpMaxSize)
+		case "AUTH":
+			err = s.smtpAuth(arg, reply, readLine)
+		case "MAIL":
+			addr, ok := smtpPath(arg, "FROM:")
+			if !ok {
+				err = reply("501 5.5.4 Syntax: MAIL FROM:<address>")
+				break
+			}
+			session = smtpSession{from: addr}
+			err = reply("250 2.1.0 OK")
+		case "RCPT":
+			addr, ok := smtpPath(arg, "TO:")
+			switch {
+			case !ok:
+				err = reply("501 5.5.4 Syntax: RCPT TO:<address>")
+			case len(session.rcpts) >= smtpMaxRcpts:
+				err = reply("452 4.5.3 Too many recipients")
+			default:
+				number, valid := s.smtpNumber(addr)
+				if !valid {
+					err = reply("550 5.1.1 <%s>: recipient must look like +15551234567@%s", addr, s.smtpHostname())
+					break
+				}
+				session.rcpts = append(session.rcpts, number)
+				err = reply("250 2.1.5 OK")
+			}
+		case "DATA":
+			if len(session.rcpts) == 0 {
+				err = reply("503 5.5.1 RCPT first")
+				break
+			}
+			if err = reply("354 End data with <CR><LF>.<CR><LF>"); err != nil {
+				return
+			}
+			conn.SetReadDeadline(time.Now().Add(smtpIdleTimeout))
+			dot := tp.DotReader()
+			data, readErr := io.ReadAll(io.LimitReader(dot, smtpMaxSize+1))
+			switch {
+			case readErr != nil:
+				return
+			case len(data) > smtpMaxSize:
+				io.Copy(io.Discard, dot)
+				err = reply("552 5.3.4 Message too big")
+			default:
+				if captureErr := s.captureEmail(session, data); errors.Is(captureErr, errShuttingDown) {
+					reply("421 4.3.2 %v", captureErr)
+					return
+				} else if captureErr != nil {
+					err = reply("554 5.6.0 %v", captureErr)
+				} else {
+					err = reply("250 2.0.0 OK: queued as %d message(s)", len(session.rcpts))
+				}
+			}
+			session = smtpSession{}
+		case "RSET":
+			session = smtpSession{}
+			err = reply("250 2.0.0 OK")
+		case "NOOP":
+			err = reply("250 2.0.0 OK")
+		case "VRFY":
+			err = reply("252 2.1.5 Cannot VRFY user")
+		case "QUIT":
+			reply("221 2.0.0 Bye")
+			return
+		default:
+			err = reply("502 5.5.2 Command not recognized")
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// smtpAuth accepts AUTH PLAIN and AUTH LOGIN with any credentials
+func (s *Server) smtpAuth(arg string, reply func(string, ...interface{}) error, readLine func() (string, error)) error {
+	mechanism, initial, _ := strings.Cut(arg, " ")
+	switch strings.ToUpper(mechanism) {
+	case "PLAIN":
+		if initial == "" {
+			if err := reply("334 "); err != nil {
+				return err
+			}
+			if _, err := readLine(); err != nil {
+				return err
+			}
+		}
+	case "LOGIN":
+		prompts := []string{"Username:", "Password:"}
+		if initial != "" {
+			prompts = prompts[1:]
+		}
+		for _, prompt := range prompts {
+			if err := reply("334 %s", base64.StdEncoding.EncodeToString([]byte(prompt))); err != nil {
+				return err
+			}
+			if _, err := readLine(); err != nil {
+				return err
+			}
+		}
+	default:
+		return reply("504 5.5.4 Unrecognized authentication type")
+	}
+	return reply("235 2.7.0 Authentication successful")
+}
+
+// smtpPath parses the address from a MAIL FROM:<...> or RCPT TO:<...>
+// argument, ignoring any parameters after it
+func smtpPath(arg, prefix string) (string, bool) {
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return "", false
+	}
+	path := strings.TrimSpace(arg[len(prefix):])
+	if strings.HasPrefix(path, "<") {
+		end := strings.Index(path, ">")
+		if end < 0 {
+			return "", false
+		}
+		return path[1:end], true
+	}
+	path, _, _ = strings.Cut(path, " ")
+	return path, path != ""
+}
+
+// smtpNumber returns the phone number of a recipient like
+// +15551234567@sms.local, checking the domain unless SMSPIT_SMTP_DOMAIN is *
+func (s *Server) smtpNumber(addr string) (string, bool) {
+	local, domain, ok := strings.Cut(addr, "@")
+	if !ok || (s.config.SMTPDomain != "*" && !strings.EqualFold(domain, s.config.SMTPDomain)) {
+		return "", false
+	}
+	digits := strings.TrimPrefix(local, "+")
+	if digits == "" || strings.Trim(digits, "0123456789") != "" {
+		return "", false
+	}
+	return local, true
+}
+
+// smtpHostname is the name the gateway greets with
+func (s *Server) smtpHostname() string {
+	if s.config.SMTPDomain == "*" {
+		return "localhost"
+	}
+	return s.config.SMTPDomain
+}
+
+// captureEmail turns an email into an SMS per recipient: the subject and
+// the plain-text body, separated by a newline
+func (s *Server) captureEmail(session smtpSession, data []byte) error {
+	email, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("invalid message: %w", err)
+	}
+
+	body, err := emailText(textproto.MIMEHeader(email.Header), email.Body)
+	if err != nil {
+		return fmt.Errorf("invalid message body: %w", err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(email.Header.Get("Subject"))
+	if err != nil {
+		subject = email.Header.Get("Subject")
+	}
+
+	var parts []string
+	for _, part := range []string{subject, body} {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	text := strings.Join(parts, "\n")
+
+	from := session.from
+	if addr, err := mail.ParseAddress(email.Header.Get("From")); err == nil {
+		from = addr.Address
+	}
+
+	now := time.Now()
+	msgs := make([]Message, 0, len(session.rcpts))
+	for _, to := range session.rcpts {
+		msgs = append(msgs, Message{
+			ID:        "msg_" + uuid.New().String()[:8],
+			To:        to,
+			From:      from,
+			Body:      text,
+			Status:    "captured",
+			CreatedAt: now,
+		})
+	}
+	if err := s.captureMessages(msgs); err != nil {
+		return err
+	}
+
+	for _, msg := range msgs {
+		log.Printf("📧 SMS captured (SMTP): To=%s Body=%s", msg.To, truncate(msg.Body, 50))
+	}
+	return nil
+}
+
+// emailText returns the decoded text of a message or MIME part, using the
+// first text/plain part of multipart content
+func emailText(header textproto.MIMEHeader, body io.Reader) (string, error) {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType = "text/plain"
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextRawPart()
+			if err == io.EOF {
+				return "", nil
+			}
+			if err != nil {
+				return "", err
+			}
+			text, err := emailText(part.Header, part)
+			if err != nil || text != "" {
+				return text, err
+			}
+		}
+	}
+	if mediaType != "text/plain" {
+		return "", nil
+	}
+
+	switch strings.ToLower(header.Get("Content-Transfer-Encoding")) {
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body) // Skips line breaks
+	}
+	text, err := io.ReadAll(body)
+	return string(text), err
+}
@@ -0,0 +1,161 @@
+package smspit
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Snapshot is a saved copy of one project's messages
+type Snapshot struct {
+	Name         string    `json:"name"`
+	Project      string    `json:"project"`
+	MessageCount int       `json:"message_count"`
+	CreatedAt    time.Time `json:"created_at"`
+	messages     []Message
+}
+
+// snapshotStore holds snapshots keyed by project, then name
+type snapshotStore struct {
+	mu        sync.RWMutex
+	snapshots map[string]map[string]*Snapshot
+}
+
+// handleSaveSnapshot saves the request project's messages under a name,
+// overwriting any snapshot with the same name
+func (s *Server) handleSaveSnapshot(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	if !validProjectName.MatchString(name) {
+		http.Error(w, "Invalid snapshot name", http.StatusBadRequest)
+		return
+	}
+	project := projectFromRequest(r)
+
+	s.mu.RLock()
+	msgs := s.messagesFor(project)
+	s.mu.RUnlock()
+
+	snap := &Snapshot{
+		Name:         name,
+		Project:      project,
+		MessageCount: len(msgs),
+		CreatedAt:    time.Now(),
+		messages:     msgs,
+	}
+
+	s.snapshots.mu.Lock()
+	if s.snapshots.snapshots[project] == nil {
+		s.snapshots.snapshots[project] = make(map[string]*Snapshot)
+	}
+	s.snapshots.snapshots[project][name] = snap
+	s.snapshots.mu.Unlock()
+	s.syncRecords(kindSnapshots)
+
+	log.Printf("📸 Snapshot saved: %s (%d messages, project %s)", name, len(msgs), project)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(snap)
+}
+
+// handleRestoreSnapshot replaces the request project's messages with a
+// snapshot's contents
+func (s *Server) handleRestoreSnapshot(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	project := projectFromRequest(r)
+
+	s.snapshots.mu.RLock()
+	snap, ok := s.snapshots.snapshots[project][name]
+	s.snapshots.mu.RUnlock()
+	if !ok {
+		http.Error(w, "Snapshot not found", http.StatusNotFound)
+		return
+	}
+
+	restored := make(map[messageKey]bool, len(snap.messages))
+	keys := make([]messageKey, 0, len(snap.messages))
+	for _, msg := range snap.messages {
+		restored[msg.key()] = true
+		keys = append(keys, msg.key())
+	}
+	var removed []Message
+
+	s.mu.Lock()
+	kept := make([]Message, 0, len(s.messages)+len(snap.messages))
+	for _, msg := range s.messages {
+		if msg.Project != project {
+			kept = append(kept, msg)
+		} else if !restored[msg.key()] {
+			removed = append(removed, msg)
+		}
+	}
+	kept = append(kept, snap.messages...)
+	sort.SliceStable(kept, func(i, j int) bool {
+		return kept[i].CreatedAt.After(kept[j].CreatedAt)
+	})
+	s.messages = kept
+	s.mu.Unlock()
+	s.syncRemoved(removed...)
+	s.syncSaved(keys...)
+
+	log.Printf("📸 Snapshot restored: %s (%d messages, project %s)", name, snap.MessageCount, project)
+
+	s.broadcastEvent(map[string]interface{}{
+		"type":     "snapshot_restored",
+		"project":  project,
+		"snapshot": name,
+		"count":    snap.MessageCount,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":   "restored",
+		"snapshot": snap,
+	})
+}
+
+// handleListSnapshots lists the request project's snapshots
+func (s *Server) handleListSnapshots(w http.ResponseWriter, r *http.Request) {
+	project := projectFromRequest(r)
+
+	s.snapshots.mu.RLock()
+	snaps := make([]*Snapshot, 0, len(s.snapshots.snapshots[project]))
+	for _, snap := range s.snapshots.snapshots[project] {
+		snaps = append(snaps, snap)
+	}
+	s.snapshots.mu.RUnlock()
+
+	sort.Slice(snaps, func(i, j int) bool {
+		return snaps[i].Name < snaps[j].Name
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"snapshots": snaps,
+		"total":     len(snaps),
+	})
+}
+
+// handleDeleteSnapshot removes a snapshot
+func (s *Server) handleDeleteSnapshot(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	project := projectFromRequest(r)
+
+	defer s.syncRecords(kindSnapshots)
+	s.snapshots.mu.Lock()
+	defer s.snapshots.mu.Unlock()
+
+	if _, ok := s.snapshots.snapshots[project][name]; !ok {
+		http.Error(w, "Snapshot not found", http.StatusNotFound)
+		return
+	}
+	delete(s.snapshots.snapshots[project], name)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
+}
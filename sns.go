@@ -0,0 +1,122 @@
+package smspit
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const snsXMLNamespace = "https://sns.amazonaws.com/doc/2010-03-31/"
+
+// snsPublishResponse is the XML body returned by the SNS Publish action
+type snsPublishResponse struct {
+	XMLName   xml.Name `xml:"PublishResponse"`
+	Xmlns     string   `xml:"xmlns,attr"`
+	MessageID string   `xml:"PublishResult>MessageId"`
+	RequestID string   `xml:"ResponseMetadata>RequestId"`
+}
+
+// snsErrorResponse is the XML body returned for failed SNS requests
+type snsErrorResponse struct {
+	XMLName   xml.Name `xml:"ErrorResponse"`
+	Xmlns     string   `xml:"xmlns,attr"`
+	Type      string   `xml:"Error>Type"`
+	Code      string   `xml:"Error>Code"`
+	Message   string   `xml:"Error>Message"`
+	RequestID string   `xml:"RequestId"`
+}
+
+// handleSNS handles AWS SNS query-protocol requests. Only the Publish action
+// with a PhoneNumber is supported. SigV4 Authorization headers are accepted
+// but not verified.
+func (s *Server) handleSNS(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeSNSError(w, http.StatusBadRequest, "MalformedQueryString", "Invalid form data")
+		return
+	}
+
+	action := r.FormValue("Action")
+	if action != "Publish" {
+		writeSNSError(w, http.StatusBadRequest, "InvalidAction",
+			fmt.Sprintf("The action %s is not valid for this endpoint.", action))
+		return
+	}
+
+	to := r.FormValue("PhoneNumber")
+	body := r.FormValue("Message")
+
+	if to == "" {
+		writeSNSError(w, http.StatusBadRequest, "InvalidParameter",
+			"Invalid parameter: PhoneNumber Reason: SMSpit only supports publishing to a phone number")
+		return
+	}
+	if body == "" {
+		writeSNSError(w, http.StatusBadRequest, "InvalidParameter",
+			"Invalid parameter: Message Reason: Empty message")
+		return
+	}
+
+	msg := Message{
+		ID:        uuid.New().String(), // SNS MessageIds are UUIDs
+		To:        to,
+		From:      snsMessageAttribute(r, "AWS.SNS.SMS.SenderID"),
+		Body:      body,
+		Status:    "captured",
+		CreatedAt: time.Now(),
+		Project:   projectFromRequest(r),
+		Metadata:  metadataFromRequest(r),
+
+		Correlation: correlationFromRequest(r),
+	}
+
+	if err := s.captureMessage(&msg); err != nil {
+		writeCaptureError(w, r, err)
+		return
+	}
+
+	log.Printf("📱 SMS captured (SNS): To=%s Body=%s", msg.To, truncate(msg.Body, 50))
+
+	requestID := uuid.New().String()
+	w.Header().Set("Content-Type", "text/xml")
+	w.Header().Set("x-amzn-RequestId", requestID)
+	xml.NewEncoder(w).Encode(snsPublishResponse{
+		Xmlns:     snsXMLNamespace,
+		MessageID: msg.ID,
+		RequestID: requestID,
+	})
+}
+
+// snsMessageAttribute finds a string MessageAttributes entry by name.
+// The query protocol flattens attributes as MessageAttributes.entry.N.Name
+// and MessageAttributes.entry.N.Value.StringValue.
+func snsMessageAttribute(r *http.Request, name string) string {
+	for i := 1; ; i++ {
+		prefix := fmt.Sprintf("MessageAttributes.entry.%d.", i)
+		key := r.FormValue(prefix + "Name")
+		if key == "" {
+			return ""
+		}
+		if key == name {
+			return r.FormValue(prefix + "Value.StringValue")
+		}
+	}
+}
+
+// writeSNSError writes an SNS-shaped XML error response
+func writeSNSError(w http.ResponseWriter, status int, code, message string) {
+	requestID := uuid.New().String()
+	w.Header().Set("Content-Type", "text/xml")
+	w.Header().Set("x-amzn-RequestId", requestID)
+	w.WriteHeader(status)
+	xml.NewEncoder(w).Encode(snsErrorResponse{
+		Xmlns:     snsXMLNamespace,
+		Type:      "Sender",
+		Code:      code,
+		Message:   message,
+		RequestID: requestID,
+	})
+}
@@ -0,0 +1,89 @@
+package smspit
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// sseKeepaliveInterval is how often a comment is sent to keep idle proxies from
+// closing the stream
+const sseKeepaliveInterval = 15 * time.Second
+
+// handleEvents streams the same events as the WebSocket (new_message,
+// status_update, ...) using Server-Sent Events. Clients resuming after a
+// reconnect send Last-Event-ID (or ?last_event_id=) to replay missed events.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("last_event_id")
+	}
+
+	var replay []busEvent
+	var events <-chan busEvent
+	var unsubscribe func()
+	if lastID != "" {
+		id, err := strconv.ParseUint(lastID, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+		replay, events, unsubscribe = s.events.subscribeSince(id)
+	} else {
+		events, unsubscribe = s.events.subscribe()
+	}
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // Disable nginx response buffering
+	w.WriteHeader(http.StatusOK)
+
+	project := projectFromRequest(r)
+
+	fmt.Fprintf(w, "retry: 2000\n\n")
+	for _, event := range replay {
+		if eventVisibleTo(event.Data, project) {
+			writeSSEEvent(w, event)
+		}
+	}
+	flusher.Flush()
+
+	keepalive := time.NewTicker(sseKeepaliveInterval)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case event := <-events:
+			if !eventVisibleTo(event.Data, project) {
+				continue
+			}
+			writeSSEEvent(w, event)
+			flusher.Flush()
+		case <-keepalive.C:
+			fmt.Fprintf(w, ": keepalive\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// writeSSEEvent writes a single event in text/event-stream format
+func writeSSEEvent(w http.ResponseWriter, event busEvent) {
+	data, _ := json.Marshal(event.Data)
+	fmt.Fprintf(w, "id: %d\n", event.ID)
+	if t, ok := event.Data["type"].(string); ok {
+		fmt.Fprintf(w, "event: %s\n", t)
+	}
+	fmt.Fprintf(w, "data: %s\n\n", data)
+}
@@ -0,0 +1,222 @@
+package smspit
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	// maxTimeseriesBuckets bounds window/interval, e.g. a day by the minute
+	maxTimeseriesBuckets = 1440
+	// defaultTimeseriesTop is how many tags and recipients get their own series
+	defaultTimeseriesTop = 10
+	maxTimeseriesTop     = 100
+)
+
+// TimeseriesBucket counts the messages captured in one interval
+type TimeseriesBucket struct {
+	Start time.Time `json:"start"`
+	Count int       `json:"count"`
+}
+
+// TimeseriesSeries is the per-bucket counts of one tag or recipient, in
+// bucket order
+type TimeseriesSeries struct {
+	Key    string `json:"key"`
+	Total  int    `json:"total"`
+	Counts []int  `json:"counts"`
+}
+
+// topSeries returns the n series with the highest totals, ties by key
+func topSeries(series map[string]*TimeseriesSeries, n int) []*TimeseriesSeries {
+	list := make([]*TimeseriesSeries, 0, len(series))
+	for _, s := range series {
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Total != list[j].Total {
+			return list[i].Total > list[j].Total
+		}
+		return list[i].Key < list[j].Key
+	})
+	if len(list) > n {
+		list = list[:n]
+	}
+	return list
+}
+
+// handleStatsTimeseries returns the project's message counts bucketed over
+// time (?interval=5m&window=24h), overall, per channel and for the busiest
+// tags and recipients (?top=10), optionally for one ?channel=. Buckets are
+// aligned to the interval and the last one holds the current time.
+func (s *Server) handleStatsTimeseries(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	interval, window := 5*time.Minute, 24*time.Hour
+	for _, param := range []struct {
+		name string
+		d    *time.Duration
+	}{{"interval", &interval}, {"window", &window}} {
+		if v := q.Get(param.name); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d < time.Second {
+				http.Error(w, fmt.Sprintf("Invalid '%s' duration (e.g. 5m, at least 1s)", param.name), http.StatusBadRequest)
+				return
+			}
+			*param.d = d
+		}
+	}
+	if window < interval {
+		http.Error(w, "'window' must be at least 'interval'", http.StatusBadRequest)
+		return
+	}
+	n := int((window + interval - 1) / interval)
+	if n > maxTimeseriesBuckets {
+		http.Error(w, fmt.Sprintf("Too many buckets (window/interval is at most %d)", maxTimeseriesBuckets), http.StatusBadRequest)
+		return
+	}
+	top := defaultTimeseriesTop
+	if v := q.Get("top"); v != "" {
+		t, err := strconv.Atoi(v)
+		if err != nil || t < 0 || t > maxTimeseriesTop {
+			http.Error(w, fmt.Sprintf("Invalid 'top' (0 to %d)", maxTimeseriesTop), http.StatusBadRequest)
+			return
+		}
+		top = t
+	}
+	channel, err := channelParam(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	end := time.Now().Truncate(interval).Add(interval)
+	start := end.Add(-time.Duration(n) * interval)
+	buckets := make([]TimeseriesBucket, n)
+	for i := range buckets {
+		buckets[i].Start = start.Add(time.Duration(i) * interval)
+	}
+	tags := make(map[string]*TimeseriesSeries)
+	recipients := make(map[string]*TimeseriesSeries)
+	byChannel := make(map[string]*TimeseriesSeries)
+	count := func(series map[string]*TimeseriesSeries, key string, i int) {
+		if series[key] == nil {
+			series[key] = &TimeseriesSeries{Key: key, Counts: make([]int, n)}
+		}
+		series[key].Total++
+		series[key].Counts[i]++
+	}
+
+	total := 0
+	s.mu.RLock()
+	for _, msg := range s.messagesFor(projectFromRequest(r)) {
+		if msg.CreatedAt.Before(start) || !msg.CreatedAt.Before(end) || (channel != "" && msg.channel() != channel) {
+			continue
+		}
+		i := int(msg.CreatedAt.Sub(start) / interval)
+		buckets[i].Count++
+		total++
+		for _, tag := range msg.Tags {
+			count(tags, tag, i)
+		}
+		count(recipients, msg.To, i)
+		count(byChannel, msg.channel(), i)
+	}
+	s.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"interval":   interval.String(),
+		"window":     (time.Duration(n) * interval).String(),
+		"start":      start,
+		"end":        end,
+		"total":      total,
+		"per_second": float64(total) / time.Since(start).Seconds(), // Average rate up to now
+		"buckets":    buckets,
+		"tags":       topSeries(tags, top),
+		"recipients": topSeries(recipients, top),
+		"channels":   topSeries(byChannel, len(channels)),
+	})
+}
+
+// maxNumberStatsSenders is how many top senders each number lists
+const maxNumberStatsSenders = 5
+
+// NumberStats summarizes the messages sent to one recipient
+type NumberStats struct {
+	Number    string         `json:"number"`
+	Messages  int            `json:"messages"`
+	FirstSeen time.Time      `json:"first_seen"`
+	LastSeen  time.Time      `json:"last_seen"`
+	Senders   []SenderCount  `json:"senders"` // The busiest senders, most messages first
+	senders   map[string]int // All senders, for ranking
+}
+
+// SenderCount is how many messages a sender sent to a number
+type SenderCount struct {
+	Sender   string `json:"sender"`
+	Messages int    `json:"messages"`
+}
+
+// handleNumberStats lists the project's recipients with their message
+// counts, first and last message times and top senders, busiest first, in
+// pages of ?limit= and ?offset=, optionally counting one ?channel= only
+func (s *Server) handleNumberStats(w http.ResponseWriter, r *http.Request) {
+	channel, err := channelParam(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	byNumber := make(map[string]*NumberStats)
+	s.mu.RLock()
+	for _, msg := range s.messagesFor(projectFromRequest(r)) {
+		if channel != "" && msg.channel() != channel {
+			continue
+		}
+		stats := byNumber[msg.To]
+		if stats == nil {
+			stats = &NumberStats{Number: msg.To, FirstSeen: msg.CreatedAt, LastSeen: msg.CreatedAt, senders: make(map[string]int)}
+			byNumber[msg.To] = stats
+		}
+		stats.Messages++
+		if msg.CreatedAt.Before(stats.FirstSeen) {
+			stats.FirstSeen = msg.CreatedAt
+		}
+		if msg.CreatedAt.After(stats.LastSeen) {
+			stats.LastSeen = msg.CreatedAt
+		}
+		stats.senders[msg.From]++
+	}
+	s.mu.RUnlock()
+
+	numbers := make([]NumberStats, 0, len(byNumber))
+	for _, stats := range byNumber {
+		stats.Senders = make([]SenderCount, 0, len(stats.senders))
+		for sender, n := range stats.senders {
+			stats.Senders = append(stats.Senders, SenderCount{Sender: sender, Messages: n})
+		}
+		sort.Slice(stats.Senders, func(i, j int) bool {
+			if stats.Senders[i].Messages != stats.Senders[j].Messages {
+				return stats.Senders[i].Messages > stats.Senders[j].Messages
+			}
+			return stats.Senders[i].Sender < stats.Senders[j].Sender
+		})
+		if len(stats.Senders) > maxNumberStatsSenders {
+			stats.Senders = stats.Senders[:maxNumberStatsSenders]
+		}
+		numbers = append(numbers, *stats)
+	}
+	sort.Slice(numbers, func(i, j int) bool {
+		if numbers[i].Messages != numbers[j].Messages {
+			return numbers[i].Messages > numbers[j].Messages
+		}
+		return numbers[i].Number < numbers[j].Number
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(paginateItems(r, "numbers", numbers))
+}
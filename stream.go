@@ -0,0 +1,100 @@
+package smspit
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// streamCursor is a position in the capture order of messages: after the
+// message with this capture sequence number. Unlike creation times, which
+// the sender or an import can set, sequence numbers only grow as messages
+// are stored.
+type streamCursor uint64
+
+// String encodes the cursor as an opaque URL-safe token
+func (c streamCursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatUint(uint64(c), 10)))
+}
+
+// parseStreamCursor decodes a token from streamCursor.String
+func parseStreamCursor(token string) (streamCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, fmt.Errorf("malformed cursor")
+	}
+	seq, err := strconv.ParseUint(string(raw), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("malformed cursor")
+	}
+	return streamCursor(seq), nil
+}
+
+// handleStreamMessages streams the messages matching the search filters as
+// newline-delimited JSON, in the order they were stored. With ?cursor= it resumes after the
+// position a previous response ended at; ?limit= caps how many messages one
+// response carries. The X-Next-Cursor header holds the cursor to continue
+// from, so a script can page through a large store or keep polling for new
+// messages.
+func (s *Server) handleStreamMessages(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if format := q.Get("format"); format != "" && format != "ndjson" {
+		http.Error(w, "Invalid format (use ndjson)", http.StatusBadRequest)
+		return
+	}
+	var cursor *streamCursor
+	if token := q.Get("cursor"); token != "" {
+		c, err := parseStreamCursor(token)
+		if err != nil {
+			http.Error(w, "Invalid cursor: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		cursor = &c
+	}
+	limit := 0
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	msgs, err := s.searchMessages(r)
+	if err != nil {
+		http.Error(w, "Invalid query: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	sort.Slice(msgs, func(i, j int) bool { return msgs[i].seq < msgs[j].seq })
+	if cursor != nil {
+		msgs = msgs[sort.Search(len(msgs), func(i int) bool { return msgs[i].seq > uint64(*cursor) }):]
+	}
+	more := false
+	if limit > 0 && len(msgs) > limit {
+		msgs, more = msgs[:limit], true
+	}
+
+	next := q.Get("cursor")
+	if len(msgs) > 0 {
+		last := msgs[len(msgs)-1]
+		next = streamCursor(last.seq).String()
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("X-Next-Cursor", next)
+	w.Header().Set("X-Has-More", strconv.FormatBool(more))
+
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	for i, msg := range msgs {
+		if err := enc.Encode(msg); err != nil {
+			return // Client went away
+		}
+		if flusher != nil && i%exportFlushEvery == exportFlushEvery-1 {
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package smspit
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// stream reads /api/v1/messages/stream from cursor and returns the IDs it
+// lists and the cursor to continue from
+func (ts *testServer) stream(t *testing.T, cursor string) ([]string, string) {
+	t.Helper()
+	w := do(t, ts.web, "GET", "/api/v1/messages/stream?cursor="+cursor, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("stream: %d %s", w.Code, w.Body)
+	}
+	var ids []string
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var msg Message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			t.Fatalf("decoding %q: %v", scanner.Text(), err)
+		}
+		ids = append(ids, msg.ID)
+	}
+	return ids, w.Header().Get("X-Next-Cursor")
+}
+
+func TestStreamCursor(t *testing.T) {
+	ts := newTestServer(t, Config{})
+
+	first := ts.send(t, "+15551230001", "One")
+	second := ts.send(t, "+15551230002", "Two")
+	ids, cursor := ts.stream(t, "")
+	if strings.Join(ids, ",") != first+","+second {
+		t.Fatalf("stream = %v, want %s,%s in capture order", ids, first, second)
+	}
+	if cursor == "" {
+		t.Fatal("no X-Next-Cursor")
+	}
+
+	if ids, next := ts.stream(t, cursor); len(ids) != 0 || next != cursor {
+		t.Errorf("stream after the end = %v (cursor %q), want nothing new", ids, next)
+	}
+
+	// Imported messages keep their timestamps, which can be older than
+	// messages already streamed, but come after them in capture order
+	w := do(t, ts.web, "POST", "/api/v1/messages/import?format=json",
+		`[{"id":"msg_imported","to":"+15551230003","body":"Old","created_at":"2020-01-01T00:00:00Z"}]`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("import: %d %s", w.Code, w.Body)
+	}
+	third := ts.send(t, "+15551230004", "Three")
+
+	ids, next := ts.stream(t, cursor)
+	if strings.Join(ids, ",") != "msg_imported,"+third {
+		t.Errorf("stream after the cursor = %v, want msg_imported,%s", ids, third)
+	}
+	if ids, _ := ts.stream(t, next); len(ids) != 0 {
+		t.Errorf("stream after the next cursor = %v, want nothing new", ids)
+	}
+
+	if w := do(t, ts.web, "GET", "/api/v1/messages/stream?cursor=!!", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid cursor: %d, want 400", w.Code)
+	}
+}
+
+func TestStreamCursorSameTimestamp(t *testing.T) {
+	ts := newTestServer(t, Config{SinchCompat: true})
+
+	// A Sinch batch captures every recipient's message at the same time
+	w := do(t, ts.api, "POST", "/xms/v1/plan/batches", `{"from":"+15550009999","to":["+15551230001","+15551230002","+15551230003"],"body":"Hi"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("batch: %d %s", w.Code, w.Body)
+	}
+
+	seen := make(map[string]int)
+	cursor := ""
+	for page := 0; page < 5; page++ {
+		r := do(t, ts.web, "GET", "/api/v1/messages/stream?limit=1&cursor="+cursor, "")
+		var msg Message
+		if r.Body.Len() == 0 {
+			break
+		}
+		decode(t, r, &msg)
+		seen[msg.ID]++
+		cursor = r.Header().Get("X-Next-Cursor")
+	}
+	if len(seen) != 3 {
+		t.Errorf("paged through %d messages, want 3: %v", len(seen), seen)
+	}
+	for id, n := range seen {
+		if n != 1 {
+			t.Errorf("message %s streamed %d times", id, n)
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package smspit
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// TagRule tags captured messages whose body matches Pattern. Project limits
+// it to one project's messages; empty means every project.
+type TagRule struct {
+	ID        string    `json:"id"`
+	Tag       string    `json:"tag"`
+	Pattern   string    `json:"pattern"`
+	Project   string    `json:"project,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+
+	re *regexp.Regexp
+}
+
+// tagRuleStore holds the auto-tagging rules
+type tagRuleStore struct {
+	mu    sync.RWMutex
+	rules []*TagRule
+}
+
+// TagCount is a tag and how many messages carry it
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// parseTagRules parses "tag=regex;tag=regex" into auto-tagging rules. They
+// are validated when the server is created.
+func parseTagRules(val string) []TagRule {
+	var rules []TagRule
+	for _, entry := range strings.Split(val, ";") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		tag, pattern, _ := strings.Cut(entry, "=")
+		rules = append(rules, TagRule{Tag: tag, Pattern: pattern})
+	}
+	return rules
+}
+
+// newTagRule validates and compiles a rule
+func newTagRule(tag, pattern, project string) (*TagRule, error) {
+	tag = strings.TrimSpace(tag)
+	if tag == "" {
+		return nil, fmt.Errorf("missing tag")
+	}
+	if pattern == "" {
+		return nil, fmt.Errorf("missing pattern")
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %v", err)
+	}
+	return &TagRule{
+		ID:        "rule_" + uuid.New().String()[:8],
+		Tag:       tag,
+		Pattern:   pattern,
+		Project:   project,
+		CreatedAt: time.Now(),
+		re:        re,
+	}, nil
+}
+
+// applyTagRules adds the tag of every matching rule to msg
+func (s *Server) applyTagRules(msg *Message) {
+	s.tagRules.mu.RLock()
+	defer s.tagRules.mu.RUnlock()
+
+	for _, rule := range s.tagRules.rules {
+		if rule.Project != "" && rule.Project != msg.Project {
+			continue
+		}
+		if rule.re.MatchString(msg.Body) {
+			msg.Tags = editTags(msg.Tags, []string{rule.Tag}, nil)
+		}
+	}
+}
+
+// editTags returns tags with add appended and remove dropped, without
+// duplicates or blanks
+func editTags(tags, add, remove []string) []string {
+	drop := make(map[string]bool, len(remove))
+	for _, t := range remove {
+		drop[strings.TrimSpace(t)] = true
+	}
+
+	seen := make(map[string]bool)
+	result := []string{}
+	for _, t := range append(append([]string{}, tags...), add...) {
+		t = strings.TrimSpace(t)
+		if t == "" || seen[t] || drop[t] {
+			continue
+		}
+		seen[t] = true
+		result = append(result, t)
+	}
+	return result
+}
+
+// hasTags reports whether msg carries every tag in tags
+func hasTags(msg Message, tags []string) bool {
+	for _, want := range tags {
+		found := false
+		for _, t := range msg.Tags {
+			if t == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// handleListTags lists the request project's tags with message counts, most
+// used first
+func (s *Server) handleListTags(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	tags := tagCounts(s.messagesFor(projectFromRequest(r)))
+	s.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"tags":  tags,
+		"total": len(tags),
+	})
+}
+
+// tagCounts counts the tags of msgs, most used first
+func tagCounts(msgs []Message) []TagCount {
+	counts := make(map[string]int)
+	for _, msg := range msgs {
+		for _, t := range msg.Tags {
+			counts[t]++
+		}
+	}
+
+	tags := make([]TagCount, 0, len(counts))
+	for t, n := range counts {
+		tags = append(tags, TagCount{Tag: t, Count: n})
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Count != tags[j].Count {
+			return tags[i].Count > tags[j].Count
+		}
+		return tags[i].Tag < tags[j].Tag
+	})
+	return tags
+}
+
+// handleUpdateTags changes a message's tags: {"tags": [...]} replaces them,
+// {"add": [...], "remove": [...]} edits them
+func (s *Server) handleUpdateTags(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	project := projectFromRequest(r)
+
+	var req struct {
+		Tags   *[]string `json:"tags"`
+		Add    []string  `json:"add"`
+		Remove []string  `json:"remove"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	var updated *Message
+	for i := range s.messages {
+		if s.messages[i].ID == id && s.messages[i].Project == project {
+			msg := &s.messages[i]
+			tags := msg.Tags
+			if req.Tags != nil {
+				tags = *req.Tags
+			}
+			msg.Tags = editTags(tags, req.Add, req.Remove)
+			copied := *msg
+			updated = &copied
+			break
+		}
+	}
+	s.mu.Unlock()
+
+	if updated == nil {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	}
+	s.syncSaved(updated.key())
+
+	s.broadcastEvent(map[string]interface{}{
+		"type":       "tags_updated",
+		"project":    project,
+		"message_id": id,
+		"tags":       updated.Tags,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// handleListTagRules lists the auto-tagging rules
+func (s *Server) handleListTagRules(w http.ResponseWriter, r *http.Request) {
+	s.tagRules.mu.RLock()
+	defer s.tagRules.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"rules": s.tagRules.rules,
+		"total": len(s.tagRules.rules),
+	})
+}
+
+// handleCreateTagRule adds an auto-tagging rule
+func (s *Server) handleCreateTagRule(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Tag     string `json:"tag"`
+		Pattern string `json:"pattern"`
+		Project string `json:"project"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Project != "" && !validProjectName.MatchString(req.Project) {
+		http.Error(w, "Invalid project name", http.StatusBadRequest)
+		return
+	}
+
+	rule, err := newTagRule(req.Tag, req.Pattern, req.Project)
+	if err != nil {
+		http.Error(w, "Invalid rule: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.tagRules.mu.Lock()
+	s.tagRules.rules = append(s.tagRules.rules, rule)
+	s.tagRules.mu.Unlock()
+	s.syncRecords(kindTagRules)
+
+	log.Printf("🏷️ Tag rule added: ID=%s Tag=%s Pattern=%s", rule.ID, rule.Tag, rule.Pattern)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(rule)
+}
+
+// handleDeleteTagRule removes an auto-tagging rule
+func (s *Server) handleDeleteTagRule(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	defer s.syncRecords(kindTagRules)
+	s.tagRules.mu.Lock()
+	defer s.tagRules.mu.Unlock()
+
+	for i, rule := range s.tagRules.rules {
+		if rule.ID == id {
+			s.tagRules.rules = append(s.tagRules.rules[:i], s.tagRules.rules[i+1:]...)
+			log.Printf("🏷️ Tag rule removed: ID=%s", id)
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
+			return
+		}
+	}
+
+	http.Error(w, "Tag rule not found", http.StatusNotFound)
+}
@@ -0,0 +1,260 @@
+package smspit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// templatePlaceholder matches a {{variable}} in a template body. Like
+// Twilio Content and WhatsApp templates, variables may be numbered ({{1}})
+// or named ({{first_name}}).
+var templatePlaceholder = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_.-]+)\s*\}\}`)
+
+// Template is a message body with {{variable}} placeholders, filled in from
+// a send request's variables (see renderTemplate)
+type Template struct {
+	// ID is a Twilio Content-style SID, so Twilio requests can pass it as
+	// ContentSid
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Body      string    `json:"body"`
+	Variables []string  `json:"variables"` // In order of first use
+	Project   string    `json:"project"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TemplateRequest is the body for creating or replacing a template.
+// Project only applies in the config file; the API uses the request's
+// project.
+type TemplateRequest struct {
+	Name    string `json:"name"`
+	Body    string `json:"body"`
+	Project string `json:"project,omitempty"`
+}
+
+// templateStore holds templates in the order they were added
+type templateStore struct {
+	mu        sync.RWMutex
+	templates []Template
+}
+
+// templateVariables returns the variables of a template body in order of
+// first use, or an error for a {{ that doesn't start a valid placeholder
+func templateVariables(body string) ([]string, error) {
+	if rest := templatePlaceholder.ReplaceAllString(body, ""); strings.Contains(rest, "{{") || strings.Contains(rest, "}}") {
+		return nil, errors.New("Invalid placeholder in 'body' (use {{name}} or {{1}})")
+	}
+	variables := []string{}
+	seen := make(map[string]bool)
+	for _, match := range templatePlaceholder.FindAllStringSubmatch(body, -1) {
+		if !seen[match[1]] {
+			seen[match[1]] = true
+			variables = append(variables, match[1])
+		}
+	}
+	return variables, nil
+}
+
+// render fills in the template's placeholders. Every variable must be given
+// a non-empty value; variables the template doesn't use are ignored.
+func (t Template) render(variables map[string]string) (string, error) {
+	var missing []string
+	for _, name := range t.Variables {
+		if variables[name] == "" {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return "", fmt.Errorf("Missing variables for template %q: %s", t.Name, strings.Join(missing, ", "))
+	}
+	return templatePlaceholder.ReplaceAllStringFunc(t.Body, func(placeholder string) string {
+		return variables[templatePlaceholder.FindStringSubmatch(placeholder)[1]]
+	}), nil
+}
+
+// newTemplate validates a template request
+func newTemplate(req TemplateRequest) (Template, error) {
+	t := Template{Name: strings.TrimSpace(req.Name), Body: req.Body}
+	if t.Name == "" {
+		return t, errors.New("Missing 'name' field")
+	}
+	if strings.TrimSpace(t.Body) == "" {
+		return t, errors.New("Missing 'body' field")
+	}
+	var err error
+	t.Variables, err = templateVariables(t.Body)
+	return t, err
+}
+
+// saveTemplate adds t to project, or replaces the template with ID id when
+// id is set. Names are unique within a project, ignoring case.
+func (s *Server) saveTemplate(t Template, project, id string) (Template, int, error) {
+	defer s.syncRecords(kindTemplates)
+	s.templates.mu.Lock()
+	defer s.templates.mu.Unlock()
+
+	index := -1
+	for i, existing := range s.templates.templates {
+		if existing.Project != project {
+			continue
+		}
+		if existing.ID == id {
+			index = i
+		} else if strings.EqualFold(existing.Name, t.Name) {
+			return Template{}, http.StatusConflict, fmt.Errorf("A template named %q already exists", existing.Name)
+		}
+	}
+
+	t.Project, t.UpdatedAt = project, time.Now()
+	if id == "" {
+		t.ID = "HX" + strings.ReplaceAll(uuid.New().String(), "-", "")
+		t.CreatedAt = t.UpdatedAt
+		s.templates.templates = append(s.templates.templates, t)
+		return t, http.StatusCreated, nil
+	}
+	if index < 0 {
+		return Template{}, http.StatusNotFound, errors.New("Template not found")
+	}
+	t.ID, t.CreatedAt = id, s.templates.templates[index].CreatedAt
+	s.templates.templates[index] = t
+	return t, http.StatusOK, nil
+}
+
+// template returns the project's template with the given ID or name
+func (s *Server) template(project, ref string) (Template, bool) {
+	s.templates.mu.RLock()
+	defer s.templates.mu.RUnlock()
+
+	for _, t := range s.templates.templates {
+		if t.Project == project && (t.ID == ref || strings.EqualFold(t.Name, ref)) {
+			return t, true
+		}
+	}
+	return Template{}, false
+}
+
+// renderTemplate sets req's body from its template_id and variables. A
+// request without a template_id is left alone.
+func (s *Server) renderTemplate(req *SendRequest, project string) error {
+	if req.TemplateID == "" {
+		if len(req.Variables) > 0 {
+			return errors.New("'variables' needs a 'template_id'")
+		}
+		return nil
+	}
+	if req.Body != "" || req.Message != "" {
+		return errors.New("Use either 'body' or 'template_id', not both")
+	}
+
+	t, ok := s.template(project, req.TemplateID)
+	if !ok {
+		return fmt.Errorf("Template %q not found", req.TemplateID)
+	}
+	body, err := t.render(req.Variables)
+	if err != nil {
+		return err
+	}
+	req.TemplateID, req.Body = t.ID, body
+	return nil
+}
+
+// handleListTemplates lists the project's templates, sorted by name
+func (s *Server) handleListTemplates(w http.ResponseWriter, r *http.Request) {
+	project := projectFromRequest(r)
+
+	s.templates.mu.RLock()
+	templates := []Template{}
+	for _, t := range s.templates.templates {
+		if t.Project == project {
+			templates = append(templates, t)
+		}
+	}
+	s.templates.mu.RUnlock()
+	sort.Slice(templates, func(i, j int) bool {
+		return strings.ToLower(templates[i].Name) < strings.ToLower(templates[j].Name)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"templates": templates,
+		"total":     len(templates),
+	})
+}
+
+// handleSaveTemplate adds a template (POST) or replaces one by ID (PUT)
+func (s *Server) handleSaveTemplate(w http.ResponseWriter, r *http.Request) {
+	var req TemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	t, err := newTemplate(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	project := projectFromRequest(r)
+	t, status, err := s.saveTemplate(t, project, mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	log.Printf("🧩 Template saved: %s (%s)", t.Name, strings.Join(t.Variables, ", "))
+	s.broadcastEvent(map[string]interface{}{"type": "templates_updated", "project": project})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(t)
+}
+
+// handleGetTemplate returns a template by ID or name
+func (s *Server) handleGetTemplate(w http.ResponseWriter, r *http.Request) {
+	t, ok := s.template(projectFromRequest(r), mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Template not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(t)
+}
+
+// handleDeleteTemplate removes a template. Messages rendered from it keep
+// its ID.
+func (s *Server) handleDeleteTemplate(w http.ResponseWriter, r *http.Request) {
+	project, id := projectFromRequest(r), mux.Vars(r)["id"]
+
+	s.templates.mu.Lock()
+	found := false
+	for i, t := range s.templates.templates {
+		if t.Project == project && t.ID == id {
+			s.templates.templates = append(s.templates.templates[:i], s.templates.templates[i+1:]...)
+			found = true
+			break
+		}
+	}
+	s.templates.mu.Unlock()
+
+	if !found {
+		http.Error(w, "Template not found", http.StatusNotFound)
+		return
+	}
+	s.syncRecords(kindTemplates)
+	s.broadcastEvent(map[string]interface{}{"type": "templates_updated", "project": project})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
+}
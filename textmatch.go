@@ -0,0 +1,131 @@
+package smspit
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// textMatching is how search terms, waits and filters compare text, set
+// with SMSPIT_SEARCH_MATCHING
+type textMatching string
+
+const (
+	// matchLoose ignores case (with full Unicode case folding, so "STRASSE"
+	// finds "straße"), accents and compatibility forms ("cafe" finds "café",
+	// "fi" finds "ﬁ"). The zero value matches loosely too.
+	matchLoose textMatching = "loose"
+	// matchIgnoreCase ignores case only
+	matchIgnoreCase textMatching = "ignore-case"
+	// matchExact compares text as is
+	matchExact textMatching = "exact"
+)
+
+// validTextMatching reports whether m is a known matching mode
+func validTextMatching(m textMatching) bool {
+	return m == matchLoose || m == matchIgnoreCase || m == matchExact
+}
+
+// folder folds text rune by rune, remembering where each folded byte came
+// from so matches can be mapped back to the original
+type folder struct {
+	mode   textMatching
+	caser  cases.Caser
+	folded []byte
+	starts []int // Byte offset in the original of the rune each folded byte came from
+	ends   []int // End of that rune, stretched over marks dropped after it
+}
+
+func (m textMatching) newFolder() *folder {
+	return &folder{mode: m, caser: cases.Fold()}
+}
+
+// fold returns s folded for comparison
+func (m textMatching) fold(s string) string {
+	if m == matchExact {
+		return s
+	}
+	f := m.newFolder()
+	f.run(s, false)
+	return string(f.folded)
+}
+
+// run folds s into f.folded, tracking spans when asked to
+func (f *folder) run(s string, spans bool) {
+	for i, end := 0, 0; i < len(s); i = end {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		end = i + size
+		n := len(f.folded)
+		f.folded = f.appendRune(f.folded, r)
+		if !spans {
+			continue
+		}
+		if len(f.folded) == n && n > 0 {
+			f.ends[n-1] = end // A dropped accent belongs to the letter before it
+		}
+		for j := n; j < len(f.folded); j++ {
+			f.starts = append(f.starts, i)
+			f.ends = append(f.ends, end)
+		}
+	}
+}
+
+// appendRune appends the folded form of r to buf
+func (f *folder) appendRune(buf []byte, r rune) []byte {
+	if r < utf8.RuneSelf {
+		if 'A' <= r && r <= 'Z' {
+			r += 'a' - 'A'
+		}
+		return append(buf, byte(r))
+	}
+	s := string(r)
+	if f.mode != matchIgnoreCase {
+		s = strings.Map(func(r rune) rune {
+			if unicode.Is(unicode.Mn, r) {
+				return -1
+			}
+			return r
+		}, norm.NFKD.String(s))
+	}
+	return append(buf, f.caser.String(s)...)
+}
+
+// contains reports whether substr is in s
+func (m textMatching) contains(s, substr string) bool {
+	return strings.Contains(m.fold(s), m.fold(substr))
+}
+
+// find returns the byte ranges of s where substr matches
+func (m textMatching) find(s, substr string) []matchRange {
+	needle := m.fold(substr)
+	if needle == "" {
+		return nil
+	}
+	var ranges []matchRange
+	if m == matchExact {
+		for i := 0; ; {
+			j := strings.Index(s[i:], needle)
+			if j < 0 {
+				return ranges
+			}
+			ranges = append(ranges, matchRange{i + j, i + j + len(needle)})
+			i += j + len(needle)
+		}
+	}
+
+	f := m.newFolder()
+	f.run(s, true)
+	haystack := string(f.folded)
+	for i := 0; ; {
+		j := strings.Index(haystack[i:], needle)
+		if j < 0 {
+			return ranges
+		}
+		start, end := i+j, i+j+len(needle)
+		ranges = append(ranges, matchRange{f.starts[start], f.ends[end-1]})
+		i = end
+	}
+}
@@ -0,0 +1,132 @@
+package smspit
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// selfSignedValidity is how long a generated certificate is valid for
+const selfSignedValidity = 365 * 24 * time.Hour
+
+// tlsEnabled reports whether the listeners should serve HTTPS
+func (s *Server) tlsEnabled() bool {
+	return s.config.TLSAuto || (s.config.TLSCert != "" && s.config.TLSKey != "")
+}
+
+// tlsConfig loads the configured certificate. With SMSPIT_TLS_AUTO a
+// self-signed certificate is generated instead; when a cert/key path is also
+// set it is saved there on first start and reused afterwards, so clients only
+// have to trust it once.
+func (s *Server) tlsConfig() (*tls.Config, error) {
+	certFile, keyFile := s.config.TLSCert, s.config.TLSKey
+	if s.config.TLSAuto && (certFile == "" || keyFile == "" || !fileExists(certFile)) {
+		certPEM, keyPEM, err := selfSignedCert(s.config.Host)
+		if err != nil {
+			return nil, fmt.Errorf("generating self-signed certificate: %w", err)
+		}
+		if certFile != "" && keyFile != "" {
+			if err := os.WriteFile(certFile, certPEM, 0o644); err != nil {
+				return nil, err
+			}
+			if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+				return nil, err
+			}
+			log.Printf("🔐 Saved self-signed certificate to %s", certFile)
+		}
+		return tlsConfigFromPEM(certPEM, keyPEM)
+	}
+
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading TLS certificate: %w", err)
+	}
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading TLS key: %w", err)
+	}
+	return tlsConfigFromPEM(certPEM, keyPEM)
+}
+
+// tlsConfigFromPEM builds a server TLS config and logs the certificate's
+// SHA-256 fingerprint
+func tlsConfigFromPEM(certPEM, keyPEM []byte) (*tls.Config, error) {
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("loading TLS key pair: %w", err)
+	}
+	log.Printf("🔐 TLS enabled (certificate SHA-256 %X)", sha256.Sum256(cert.Certificate[0]))
+	return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}, nil
+}
+
+// selfSignedCert generates a PEM-encoded ECDSA certificate and key valid for
+// localhost, the loopback addresses, this machine's hostname and host
+func selfSignedCert(host string) (certPEM, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"SMSpit"}, CommonName: "localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	if hostname, err := os.Hostname(); err == nil && hostname != "localhost" {
+		template.DNSNames = append(template.DNSNames, hostname)
+	}
+	if ip := net.ParseIP(host); ip != nil && !ip.IsUnspecified() && !ip.IsLoopback() {
+		template.IPAddresses = append(template.IPAddresses, ip)
+	} else if ip == nil && host != "" && host != "localhost" {
+		template.DNSNames = append(template.DNSNames, host)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
+
+// requestScheme returns "https" for requests received over TLS
+func requestScheme(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// fileExists reports whether path exists
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,197 @@
+package smspit
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/metadata"
+)
+
+// OTLP export protocols
+const (
+	otlpHTTP = "http/protobuf"
+	otlpGRPC = "grpc"
+)
+
+// tracerName is the instrumentation scope of SMSpit's spans
+const tracerName = "github.com/substrate-app/smspit"
+
+// tracePropagator reads and writes traceparent, tracestate and baggage
+// headers. It isn't installed globally, so embedding SMSpit in a test
+// leaves the test's own OpenTelemetry setup alone.
+var tracePropagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// startTracing exports spans to the OTLP collector at SMSPIT_OTLP_ENDPOINT.
+// Without one s.tracer stays a no-op. The standard OTEL_* variables for
+// headers, sampling and resource attributes still apply.
+func (s *Server) startTracing(ctx context.Context) error {
+	if s.config.OTLPEndpoint == "" {
+		return nil
+	}
+	u, err := url.Parse(s.config.OTLPEndpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid SMSPIT_OTLP_ENDPOINT %q (must be an http or https URL)", s.config.OTLPEndpoint)
+	}
+
+	var exporter sdktrace.SpanExporter
+	if s.config.OTLPProtocol == otlpGRPC {
+		exporter, err = otlptracegrpc.New(ctx, otlptracegrpc.WithEndpointURL(u.String()))
+	} else {
+		// Like OTEL_EXPORTER_OTLP_ENDPOINT, a base URL gets the traces path
+		if u.Path == "" || u.Path == "/" {
+			u.Path = "/v1/traces"
+		}
+		exporter, err = otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(u.String()))
+	}
+	if err != nil {
+		return fmt.Errorf("creating OTLP exporter: %w", err)
+	}
+
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES override the defaults
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", "smspit")),
+		resource.WithTelemetrySDK(),
+		resource.WithHost(),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		log.Printf("⚠️ Tracing resource: %v", err)
+	}
+	s.tracing = sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	s.tracer = s.tracing.Tracer(tracerName)
+	log.Printf("🔭 Exporting traces to %s (%s)", u, s.config.OTLPProtocol)
+	return nil
+}
+
+// stopTracing exports any spans still buffered
+func (s *Server) stopTracing(ctx context.Context) {
+	if s.tracing == nil {
+		return
+	}
+	if err := s.tracing.Shutdown(ctx); err != nil {
+		log.Printf("⚠️ Exporting traces: %v", err)
+	}
+}
+
+// tracingHandler starts a server span for every request, continuing the
+// caller's trace when it sends a traceparent header. The router renames it
+// after the matched route (see traceRouteMiddleware).
+func (s *Server) tracingHandler(next http.Handler) http.Handler {
+	if s.tracing == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := tracePropagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := s.tracer.Start(ctx, r.Method, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+			attribute.String("http.request.method", r.Method),
+			attribute.String("url.path", r.URL.Path),
+			attribute.String("client.address", s.clientIP(r)),
+			attribute.String("user_agent.original", r.UserAgent()),
+		))
+		defer span.End()
+
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		span.SetAttributes(attribute.Int("http.response.status_code", rec.status))
+		if rec.status >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(rec.status))
+		}
+	})
+}
+
+// traceRouteMiddleware names the request's span after the route it
+// matched, e.g. "POST /2010-04-01/Accounts/{accountSid}/Messages.json"
+func traceRouteMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if route := mux.CurrentRoute(r); route != nil {
+			if template, err := route.GetPathTemplate(); err == nil {
+				span := trace.SpanFromContext(r.Context())
+				span.SetName(r.Method + " " + template)
+				span.SetAttributes(attribute.String("http.route", template))
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// grpcMetadataCarrier reads trace headers from an RPC's metadata
+type grpcMetadataCarrier metadata.MD
+
+func (c grpcMetadataCarrier) Get(key string) string {
+	if values := metadata.MD(c).Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func (c grpcMetadataCarrier) Set(key, value string) { metadata.MD(c).Set(key, value) }
+
+func (c grpcMetadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// grpcSpan starts a server span for an RPC, continuing the caller's trace
+// from its traceparent metadata
+func (s *Server) grpcSpan(ctx context.Context, method string) (context.Context, trace.Span) {
+	if s.tracing == nil {
+		return ctx, trace.SpanFromContext(ctx)
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	ctx = tracePropagator.Extract(ctx, grpcMetadataCarrier(md))
+	return s.tracer.Start(ctx, strings.TrimPrefix(method, "/"), trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+		attribute.String("rpc.system", "grpc"),
+		attribute.String("rpc.method", method),
+	))
+}
+
+// startMessageSpan starts a span for work on a captured message, as a child
+// of the span that captured it
+func (s *Server) startMessageSpan(msg Message, name string, kind trace.SpanKind, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append(attrs, attribute.String("smspit.message.id", msg.ID), attribute.String("smspit.project", msg.Project))
+	return s.tracer.Start(msg.traceContext(), name, trace.WithSpanKind(kind), trace.WithAttributes(attrs...))
+}
+
+// endSpan ends span, marking it failed when err is set
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// injectTrace adds ctx's traceparent to an outgoing request, so the
+// receiver continues the trace
+func injectTrace(ctx context.Context, req *http.Request) {
+	tracePropagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+}
+
+// targetHost is the host a dispatch span records. The full URL isn't
+// recorded since notification URLs carry credentials.
+func targetHost(target string) string {
+	if u, err := url.Parse(target); err == nil {
+		return u.Host
+	}
+	return ""
+}
@@ -0,0 +1,550 @@
+package smspit
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// twilioCallbackClient is used for all outgoing Twilio-style webhooks
+var twilioCallbackClient = &http.Client{Timeout: 10 * time.Second}
+
+// twilioErrorCodes maps simulated failure statuses to Twilio error codes
+var twilioErrorCodes = map[string]int{
+	"failed":      30008, // Unknown error
+	"undelivered": 30003, // Unreachable destination handset
+	"filtered":    30007, // Message filtered by the carrier
+}
+
+// twilioSignature computes the X-Twilio-Signature for a form-encoded request:
+// base64(HMAC-SHA1(authToken, url + sorted key/value pairs))
+func twilioSignature(authToken, callbackURL string, params url.Values) string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(callbackURL)
+	for _, k := range keys {
+		for _, v := range params[k] {
+			b.WriteString(k)
+			b.WriteString(v)
+		}
+	}
+
+	mac := hmac.New(sha1.New, []byte(authToken))
+	mac.Write([]byte(b.String()))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// postTwilioWebhook sends a signed form-encoded request the way Twilio does
+func (s *Server) postTwilioWebhook(target string, params url.Values) (*http.Response, error) {
+	req, err := http.NewRequest("POST", target, strings.NewReader(params.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", "TwilioProxy/1.1")
+	req.Header.Set("X-Twilio-Signature", twilioSignature(s.config.TwilioAuthToken, target, params))
+
+	return twilioCallbackClient.Do(req)
+}
+
+// sendStatusCallback POSTs a Twilio-shaped status callback for msg if the
+// sender supplied a StatusCallback URL
+func (s *Server) sendStatusCallback(msg Message) {
+	if msg.StatusCallback == "" {
+		return
+	}
+
+	params := url.Values{}
+	params.Set("MessageSid", msg.ID)
+	params.Set("SmsSid", msg.ID)
+	params.Set("AccountSid", msg.AccountSID)
+	if msg.ServiceSID != "" {
+		params.Set("MessagingServiceSid", msg.ServiceSID)
+	}
+	params.Set("From", msg.From)
+	params.Set("To", msg.To)
+	params.Set("MessageStatus", twilioStatus(msg))
+	params.Set("SmsStatus", twilioStatus(msg))
+	params.Set("ApiVersion", "2010-04-01")
+	if code, ok := twilioErrorCodes[msg.Status]; ok {
+		params.Set("ErrorCode", strconv.Itoa(code))
+	}
+
+	resp, err := s.postTwilioWebhook(msg.StatusCallback, params)
+	if err != nil {
+		log.Printf("⚠️ Status callback failed: ID=%s URL=%s Error=%v", msg.ID, msg.StatusCallback, err)
+		return
+	}
+	resp.Body.Close()
+
+	log.Printf("📨 Status callback sent: ID=%s Status=%s Response=%d", msg.ID, msg.Status, resp.StatusCode)
+}
+
+// TwilioError describes an entry in Twilio's error catalog
+type TwilioError struct {
+	Code    int
+	Status  int
+	Message string
+}
+
+// twilioErrorCatalog holds the Twilio REST API errors SMSpit can return
+var twilioErrorCatalog = map[int]TwilioError{
+	20001: {20001, http.StatusBadRequest, "Invalid %s: %s"},
+	20003: {20003, http.StatusUnauthorized, "Authenticate"},
+	20004: {20004, http.StatusMethodNotAllowed, "Method not allowed"},
+	20403: {20403, http.StatusForbidden, "%s"},
+	20404: {20404, http.StatusNotFound, "The requested resource %s was not found"},
+	21211: {21211, http.StatusBadRequest, "The 'To' number %s is not a valid phone number."},
+	21212: {21212, http.StatusBadRequest, "The 'From' number %s is not a valid phone number, shortcode, or alphanumeric sender ID."},
+	21408: {21408, http.StatusBadRequest, "Permission to send an SMS has not been enabled for the region indicated by the 'To' number: %s."},
+	21421: {21421, http.StatusBadRequest, "PhoneNumber or AreaCode is required."},
+	21422: {21422, http.StatusBadRequest, "The phone number %s is not available."},
+	21452: {21452, http.StatusBadRequest, "No phone numbers found in area code %s."},
+	21602: {21602, http.StatusBadRequest, "Message body is required."},
+	21603: {21603, http.StatusBadRequest, "A 'From' or 'MessagingServiceSid' parameter is required to send a message."},
+	21604: {21604, http.StatusBadRequest, "A 'To' phone number is required."},
+	21606: {21606, http.StatusBadRequest, "The 'From' phone number provided (%s) is not a valid, message-capable Twilio phone number for this destination."},
+	21610: {21610, http.StatusBadRequest, "Attempt to send to unsubscribed recipient %s."},
+	21611: {21611, http.StatusBadRequest, "This 'From' number %s has exceeded the maximum number of queued messages."},
+	21612: {21612, http.StatusBadRequest, "The 'To' phone number %s is not currently reachable via SMS."},
+	21614: {21614, http.StatusBadRequest, "'To' number %s is not a valid mobile number."},
+	21617: {21617, http.StatusBadRequest, "The concatenated message body exceeds the %d character limit."},
+	21620: {21620, http.StatusBadRequest, "Invalid media URL(s): %s"},
+	21623: {21623, http.StatusBadRequest, "Number of media files exceeds allowed limit of %d."},
+	21655: {21655, http.StatusBadRequest, "The ContentSid %s is invalid."},
+	21656: {21656, http.StatusBadRequest, "The ContentVariables parameter is invalid: %s"},
+	21701: {21701, http.StatusBadRequest, "The Messaging Service Sid %s is invalid."},
+	30007: {30007, http.StatusBadRequest, "Message filtered: %s"},
+	30034: {30034, http.StatusBadRequest, "Message from an Unregistered Number: %s is not registered with an A2P 10DLC campaign."},
+	60200: {60200, http.StatusBadRequest, "Invalid parameter: %s"},
+	60202: {60202, http.StatusTooManyRequests, "Max check attempts reached"},
+	60203: {60203, http.StatusTooManyRequests, "Max send attempts reached"},
+}
+
+// twilioDefaultSender is Twilio's magic "valid" test number, used as the
+// Messaging Service sender when no number pool is configured
+const twilioDefaultSender = "+15005550006"
+
+// pickPoolNumber simulates a Messaging Service choosing a sender from
+// SMSPIT_TWILIO_NUMBER_POOL. Like Twilio's sticky sender, a recipient always
+// gets the same number.
+func (s *Server) pickPoolNumber(to string) string {
+	pool := s.config.TwilioNumberPool
+	if len(pool) == 0 {
+		return twilioDefaultSender
+	}
+	h := fnv.New32a()
+	h.Write([]byte(to))
+	return pool[h.Sum32()%uint32(len(pool))]
+}
+
+// parseTwilioAccounts parses "AccountSid:AuthToken,..." into test credentials
+func parseTwilioAccounts(val string) map[string]string {
+	accounts := make(map[string]string)
+	for _, entry := range strings.Split(val, ",") {
+		sid, token, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok || sid == "" || token == "" {
+			if entry != "" {
+				log.Printf("⚠️ Ignoring invalid Twilio account entry %q", entry)
+			}
+			continue
+		}
+		accounts[sid] = token
+	}
+	return accounts
+}
+
+// twilioAuth wraps a Twilio endpoint to check Basic auth against
+// SMSPIT_TWILIO_ACCOUNTS: the username must be a configured account SID
+// (the one in the path, if any) and the password its auth token. Without
+// configured accounts any credentials are accepted.
+func (s *Server) twilioAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if len(s.config.TwilioAccounts) == 0 {
+			next(w, r)
+			return
+		}
+
+		if !s.twilioAccountAuth(r) {
+			sid, _, _ := r.BasicAuth()
+			log.Printf("🔒 Twilio authentication failed: AccountSid=%s", sid)
+			w.Header().Set("WWW-Authenticate", `Basic realm="Twilio API"`)
+			writeTwilioError(w, twilioErrorCatalog[20003])
+			return
+		}
+		next(w, r)
+	}
+}
+
+// twilioAccountAuth reports whether the request's Basic auth credentials are
+// a configured account SID (the one in the path, if any) and its auth token
+func (s *Server) twilioAccountAuth(r *http.Request) bool {
+	sid, token, ok := r.BasicAuth()
+	expected, known := s.config.TwilioAccounts[sid]
+	pathSID, hasPathSID := mux.Vars(r)["accountSid"]
+	return ok && known && (!hasPathSID || sid == pathSID) && hmac.Equal([]byte(token), []byte(expected))
+}
+
+// MagicNumber is a phone number that makes the Twilio endpoint fail with a specific error
+type MagicNumber struct {
+	Code   int
+	Status int
+}
+
+// Twilio's documented test-credential magic numbers
+var (
+	twilioMagicTo = map[string]int{
+		"+15005550001": 21211,
+		"+15005550002": 21612,
+		"+15005550003": 21408,
+		"+15005550004": 21610,
+		"+15005550009": 21614,
+	}
+	twilioMagicFrom = map[string]int{
+		"+15005550001": 21212,
+		"+15005550007": 21606,
+		"+15005550008": 21611,
+	}
+)
+
+// parseMagicNumbers parses "number=code[:status],..." into custom magic numbers
+func parseMagicNumbers(val string) map[string]MagicNumber {
+	magic := make(map[string]MagicNumber)
+	for _, entry := range strings.Split(val, ",") {
+		number, spec, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			continue
+		}
+		codeStr, statusStr, _ := strings.Cut(spec, ":")
+		code, err := strconv.Atoi(codeStr)
+		if err != nil {
+			log.Printf("⚠️ Ignoring invalid magic number entry %q", entry)
+			continue
+		}
+		status := http.StatusBadRequest
+		if known, ok := twilioErrorCatalog[code]; ok {
+			status = known.Status
+		}
+		if statusStr != "" {
+			if st, err := strconv.Atoi(statusStr); err == nil {
+				status = st
+			}
+		}
+		magic[strings.TrimSpace(number)] = MagicNumber{Code: code, Status: status}
+	}
+	return magic
+}
+
+// checkMagicNumbers returns the error a Twilio request should fail with if
+// either number is a built-in or configured magic number
+func (s *Server) checkMagicNumbers(to, from string) (TwilioError, string, bool) {
+	if m, ok := s.config.MagicNumbers[to]; ok {
+		return lookupTwilioError(m.Code, m.Status), to, true
+	}
+	if m, ok := s.config.MagicNumbers[from]; ok {
+		return lookupTwilioError(m.Code, m.Status), from, true
+	}
+	if code, ok := twilioMagicTo[to]; ok {
+		return twilioErrorCatalog[code], to, true
+	}
+	if code, ok := twilioMagicFrom[from]; ok {
+		return twilioErrorCatalog[code], from, true
+	}
+	return TwilioError{}, "", false
+}
+
+// lookupTwilioError returns the catalog entry for code, overriding its HTTP status
+func lookupTwilioError(code, status int) TwilioError {
+	e, ok := twilioErrorCatalog[code]
+	if !ok {
+		e = TwilioError{Code: code, Message: "Simulated error for %s."}
+	}
+	e.Status = status
+	return e
+}
+
+// isTwilioPath reports whether path belongs to one of the Twilio-compatible
+// APIs (Messaging, Verify or Lookup), whose errors use Twilio's error body
+func isTwilioPath(path string) bool {
+	return strings.HasPrefix(path, "/2010-04-01/") || strings.HasPrefix(path, "/v2/Services/") ||
+		strings.HasPrefix(path, "/v1/PhoneNumbers/") || strings.HasPrefix(path, "/v2/PhoneNumbers/")
+}
+
+// validTwilioTo reports whether to looks like something Twilio would send to:
+// a phone number, optionally with a channel prefix such as "whatsapp:"
+func validTwilioTo(to string) bool {
+	if _, address, ok := strings.Cut(to, ":"); ok {
+		to = address
+	}
+	for _, r := range strings.TrimPrefix(to, "+") {
+		if (r < '0' || r > '9') && !strings.ContainsRune(" -().", r) {
+			return false
+		}
+	}
+	digits := len(numberDigits(to))
+	return digits >= 7 && digits <= 15
+}
+
+// writeTwilioFormError answers a Twilio request whose form can't be parsed
+func writeTwilioFormError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeTwilioError(w, TwilioError{Code: 20001, Status: http.StatusRequestEntityTooLarge, Message: "Request body exceeds %d bytes"}, tooLarge.Limit)
+		return
+	}
+	writeTwilioError(w, twilioErrorCatalog[20001], "request body", err)
+}
+
+// twilioRouteFallback answers requests to Twilio paths that match no route
+// (code 20404) or no method (20004) with a Twilio error, and passes other
+// requests to next
+func twilioRouteFallback(code int, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isTwilioPath(r.URL.Path) || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if code == 20404 {
+			writeTwilioError(w, twilioErrorCatalog[code], r.URL.Path)
+			return
+		}
+		writeTwilioError(w, twilioErrorCatalog[code])
+	})
+}
+
+// writeTwilioError writes a Twilio REST API error body
+func writeTwilioError(w http.ResponseWriter, e TwilioError, args ...interface{}) {
+	message := e.Message
+	if len(args) > 0 {
+		message = fmt.Sprintf(e.Message, args...)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.Status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"code":      e.Code,
+		"message":   message,
+		"more_info": fmt.Sprintf("https://www.twilio.com/docs/errors/%d", e.Code),
+		"status":    e.Status,
+	})
+}
+
+// twilioDateFormat is the RFC 2822 date format of Twilio resources
+const twilioDateFormat = time.RFC1123Z
+
+// twilioStatus returns the Twilio status of a message. Messages captured
+// without delivery simulation stay queued.
+func twilioStatus(msg Message) string {
+	switch msg.Status {
+	case "captured":
+		return "queued"
+	case filteredStatus:
+		return "undelivered"
+	}
+	return msg.Status
+}
+
+// twilioAccountPath returns the Accounts/{sid} base path for resource URIs,
+// under the project's path prefix for named projects
+func twilioAccountPath(project, accountSID string) string {
+	prefix := ""
+	if project != "" && project != defaultProject {
+		prefix = projectPathPrefix + project
+	}
+	return prefix + "/2010-04-01/Accounts/" + accountSID
+}
+
+// twilioResource renders msg as a Twilio Message resource
+func twilioResource(msg Message) map[string]interface{} {
+	uri := twilioAccountPath(msg.Project, msg.AccountSID) + "/Messages/" + msg.ID
+	direction := "outbound-api"
+	if msg.Direction == "inbound" {
+		direction = "inbound"
+	}
+
+	var serviceSID, errorCode interface{}
+	if msg.ServiceSID != "" {
+		serviceSID = msg.ServiceSID
+	}
+	if code, ok := twilioErrorCodes[msg.Status]; ok {
+		errorCode = code
+	}
+
+	return map[string]interface{}{
+		"sid":                   msg.ID,
+		"account_sid":           msg.AccountSID,
+		"messaging_service_sid": serviceSID,
+		"api_version":           "2010-04-01",
+		"to":                    msg.To,
+		"from":                  msg.From,
+		"body":                  msg.Body,
+		"status":                twilioStatus(msg),
+		"direction":             direction,
+		"num_media":             strconv.Itoa(len(msg.Media)),
+		"num_segments":          strconv.Itoa(msg.Segments),
+		"error_code":            errorCode,
+		"error_message":         nil,
+		"price":                 nil,
+		"price_unit":            "USD",
+		"date_created":          msg.CreatedAt.Format(twilioDateFormat),
+		"date_updated":          msg.CreatedAt.Format(twilioDateFormat),
+		"date_sent":             msg.CreatedAt.Format(twilioDateFormat),
+		"uri":                   uri + ".json",
+	}
+}
+
+// twilioMessages returns the request project's messages sent through the
+// account in the path, newest first
+func (s *Server) twilioMessages(r *http.Request) []Message {
+	accountSID := mux.Vars(r)["accountSid"]
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var msgs []Message
+	for _, msg := range s.messagesFor(projectFromRequest(r)) {
+		if msg.AccountSID == accountSID {
+			msgs = append(msgs, msg)
+		}
+	}
+	return msgs
+}
+
+// parseTwilioDate reads a DateSent filter: a date (2024-01-31) or RFC 3339 time
+func parseTwilioDate(v string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", v); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+// handleTwilioListMessages lists an account's messages as Twilio does, with
+// the To, From, DateSent, DateSent< and DateSent> filters and Page/PageSize
+// paging
+func (s *Server) handleTwilioListMessages(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	var day, before, after time.Time
+	for param, dst := range map[string]*time.Time{"DateSent": &day, "DateSent<": &before, "DateSent>": &after} {
+		if v := q.Get(param); v != "" {
+			t, err := parseTwilioDate(v)
+			if err != nil {
+				writeTwilioError(w, twilioErrorCatalog[20001], param, v)
+				return
+			}
+			*dst = t
+		}
+	}
+
+	var matched []Message
+	for _, msg := range s.twilioMessages(r) {
+		sent := msg.CreatedAt.UTC()
+		switch {
+		case q.Get("To") != "" && msg.To != q.Get("To"),
+			q.Get("From") != "" && msg.From != q.Get("From"),
+			!day.IsZero() && (sent.Before(day) || !sent.Before(day.AddDate(0, 0, 1))),
+			!before.IsZero() && !sent.Before(before.AddDate(0, 0, 1)),
+			!after.IsZero() && sent.Before(after):
+			continue
+		}
+		matched = append(matched, msg)
+	}
+
+	writeTwilioPage(w, r, "messages", "/Messages.json", len(matched), func(i int) map[string]interface{} {
+		return twilioResource(matched[i])
+	})
+}
+
+// writeTwilioPage writes a Twilio list response: the page of n resources
+// picked by Page and PageSize under key, with paging URIs for listPath.
+// resource renders the i-th resource.
+func writeTwilioPage(w http.ResponseWriter, r *http.Request, key, listPath string, n int, resource func(i int) map[string]interface{}) {
+	q := r.URL.Query()
+	pageSize := 50
+	if v, err := strconv.Atoi(q.Get("PageSize")); err == nil && v > 0 {
+		pageSize = v
+	}
+	if pageSize > maxPageLimit {
+		pageSize = maxPageLimit
+	}
+	page := 0
+	if v, err := strconv.Atoi(q.Get("Page")); err == nil && v > 0 {
+		page = v
+	}
+
+	start := page * pageSize
+	if start > n {
+		start = n
+	}
+	end := start + pageSize
+	if end > n {
+		end = n
+	}
+
+	resources := make([]map[string]interface{}, 0, end-start)
+	for i := start; i < end; i++ {
+		resources = append(resources, resource(i))
+	}
+
+	listURI := func(page int) string {
+		q.Set("Page", strconv.Itoa(page))
+		q.Set("PageSize", strconv.Itoa(pageSize))
+		return twilioAccountPath(projectFromRequest(r), mux.Vars(r)["accountSid"]) + listPath + "?" + q.Encode()
+	}
+	var next, previous interface{}
+	if end < n {
+		next = listURI(page + 1)
+	}
+	if page > 0 {
+		previous = listURI(page - 1)
+	}
+
+	lastIndex := end - 1
+	if lastIndex < start {
+		lastIndex = start
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		key:                 resources,
+		"page":              page,
+		"page_size":         pageSize,
+		"start":             start,
+		"end":               lastIndex,
+		"uri":               listURI(page),
+		"first_page_uri":    listURI(0),
+		"next_page_uri":     next,
+		"previous_page_uri": previous,
+	})
+}
+
+// handleTwilioGetMessage fetches one message as a Twilio resource
+func (s *Server) handleTwilioGetMessage(w http.ResponseWriter, r *http.Request) {
+	sid := mux.Vars(r)["messageSid"]
+	for _, msg := range s.twilioMessages(r) {
+		if msg.ID == sid {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(twilioResource(msg))
+			return
+		}
+	}
+	writeTwilioError(w, twilioErrorCatalog[20404], r.URL.Path)
+}
@@ -0,0 +1,239 @@
+package smspit
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// Twilio Verify defaults
+const (
+	verifyCodeLength  = 6
+	verifyExpiry      = 10 * time.Minute
+	verifyMaxChecks   = 5
+	verifyMaxSends    = 5
+	verifyBodyPattern = "Your verification code is: %s"
+)
+
+// verifyChannels are the delivery channels Twilio Verify accepts
+var verifyChannels = map[string]bool{"sms": true, "call": true, "email": true, "whatsapp": true}
+
+// verification is a pending Twilio Verify verification
+type verification struct {
+	SID        string
+	ServiceSID string
+	AccountSID string
+	To         string
+	Channel    string
+	Code       string
+	Status     string // pending, approved or max_attempts_reached
+	Checks     int
+	Sends      []time.Time
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// verifyStore holds pending verifications by project, service and recipient
+type verifyStore struct {
+	mu            sync.Mutex
+	verifications map[string]*verification
+}
+
+func verifyKey(project, serviceSID, to string) string {
+	return project + "|" + serviceSID + "|" + to
+}
+
+// lookup returns the unexpired verification for key. The caller must hold mu.
+func (v *verifyStore) lookup(key string) *verification {
+	ver := v.verifications[key]
+	if ver != nil && time.Since(ver.CreatedAt) > verifyExpiry {
+		delete(v.verifications, key)
+		return nil
+	}
+	return ver
+}
+
+// resource renders the verification as Twilio does
+func (v *verification) resource() map[string]interface{} {
+	attempts := make([]map[string]interface{}, len(v.Sends))
+	for i, t := range v.Sends {
+		attempts[i] = map[string]interface{}{"time": t.UTC().Format(time.RFC3339), "channel": v.Channel}
+	}
+	return map[string]interface{}{
+		"sid":                v.SID,
+		"service_sid":        v.ServiceSID,
+		"account_sid":        v.AccountSID,
+		"to":                 v.To,
+		"channel":            v.Channel,
+		"status":             v.Status,
+		"valid":              v.Status == "approved",
+		"amount":             nil,
+		"payee":              nil,
+		"lookup":             map[string]interface{}{},
+		"send_code_attempts": attempts,
+		"date_created":       v.CreatedAt.UTC().Format(time.RFC3339),
+		"date_updated":       v.UpdatedAt.UTC().Format(time.RFC3339),
+		"url":                "/v2/Services/" + v.ServiceSID + "/Verifications/" + v.SID,
+	}
+}
+
+// verifyCode returns a random numeric code
+func verifyCode() string {
+	digits := make([]byte, verifyCodeLength)
+	for i := range digits {
+		n, _ := rand.Int(rand.Reader, big.NewInt(10))
+		digits[i] = byte('0' + n.Int64())
+	}
+	return string(digits)
+}
+
+// twilioSID returns a Twilio-style SID: a two-letter prefix and 32 hex digits
+func twilioSID(prefix string) string {
+	return prefix + strings.ReplaceAll(uuid.New().String(), "-", "")
+}
+
+// handleVerifyStart starts (or resends) a Twilio Verify verification and
+// captures the code as a message
+func (s *Server) handleVerifyStart(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeTwilioFormError(w, err)
+		return
+	}
+
+	to := r.FormValue("To")
+	channel := strings.ToLower(r.FormValue("Channel"))
+	if to == "" {
+		writeTwilioError(w, twilioErrorCatalog[60200], "To")
+		return
+	}
+	if !verifyChannels[channel] {
+		writeTwilioError(w, twilioErrorCatalog[60200], "Channel")
+		return
+	}
+
+	serviceSID := mux.Vars(r)["serviceSid"]
+	accountSID, _, _ := r.BasicAuth()
+	project := projectFromRequest(r)
+	key := verifyKey(project, serviceSID, to)
+	now := time.Now()
+
+	s.verify.mu.Lock()
+	ver := s.verify.lookup(key)
+	if ver == nil {
+		ver = &verification{
+			SID:        twilioSID("VE"),
+			ServiceSID: serviceSID,
+			AccountSID: accountSID,
+			To:         to,
+			Status:     "pending",
+			Code:       verifyCode(),
+			CreatedAt:  now,
+		}
+		s.verify.verifications[key] = ver
+	}
+	if len(ver.Sends) >= verifyMaxSends {
+		s.verify.mu.Unlock()
+		writeTwilioError(w, twilioErrorCatalog[60203])
+		return
+	}
+	if code := r.FormValue("CustomCode"); code != "" {
+		ver.Code = code
+	}
+	ver.Channel = channel
+	ver.Sends = append(ver.Sends, now)
+	ver.UpdatedAt = now
+	code := ver.Code
+	resource := ver.resource()
+	s.verify.mu.Unlock()
+	// Shared before the code is sent, so any replica can check it
+	s.syncRecords(kindVerifications)
+
+	msg := Message{
+		ID:         "SM" + uuid.New().String()[:32],
+		To:         to,
+		From:       s.pickPoolNumber(to),
+		Body:       fmt.Sprintf(verifyBodyPattern, code),
+		Tags:       []string{"verify"},
+		Status:     "captured",
+		CreatedAt:  now,
+		AccountSID: accountSID,
+		Project:    project,
+		Metadata:   metadataFromRequest(r),
+
+		Correlation: correlationFromRequest(r),
+	}
+	if err := s.captureMessage(&msg); err != nil {
+		writeCaptureError(w, r, err)
+		return
+	}
+
+	log.Printf("🔑 Verification started: Service=%s To=%s Channel=%s", serviceSID, to, channel)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resource)
+}
+
+// handleVerifyCheck checks a code against the pending verification for To
+// (or VerificationSid). SMSPIT_TWILIO_VERIFY_CODE, when set, is always accepted.
+func (s *Server) handleVerifyCheck(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeTwilioFormError(w, err)
+		return
+	}
+
+	code := r.FormValue("Code")
+	if code == "" {
+		writeTwilioError(w, twilioErrorCatalog[60200], "Code")
+		return
+	}
+
+	serviceSID := mux.Vars(r)["serviceSid"]
+	project := projectFromRequest(r)
+
+	defer s.syncRecords(kindVerifications)
+	s.verify.mu.Lock()
+	defer s.verify.mu.Unlock()
+
+	key := verifyKey(project, serviceSID, r.FormValue("To"))
+	if sid := r.FormValue("VerificationSid"); sid != "" {
+		for k, v := range s.verify.verifications {
+			if v.SID == sid && strings.HasPrefix(k, verifyKey(project, serviceSID, "")) {
+				key = k
+				break
+			}
+		}
+	}
+
+	ver := s.verify.lookup(key)
+	if ver == nil {
+		writeTwilioError(w, twilioErrorCatalog[20404], r.URL.Path)
+		return
+	}
+
+	ver.Checks++
+	ver.UpdatedAt = time.Now()
+	switch {
+	case code == ver.Code || (s.config.VerifyCode != "" && code == s.config.VerifyCode):
+		ver.Status = "approved"
+		delete(s.verify.verifications, key)
+		log.Printf("✅ Verification approved: Service=%s To=%s", serviceSID, ver.To)
+	case ver.Checks >= verifyMaxChecks:
+		ver.Status = "max_attempts_reached"
+		delete(s.verify.verifications, key)
+		writeTwilioError(w, twilioErrorCatalog[60202])
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ver.resource())
+}
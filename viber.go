@@ -0,0 +1,254 @@
+package smspit
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Viber REST API status codes (sent with HTTP 200)
+const (
+	viberOK                    = 0
+	viberInvalidAuthToken      = 2
+	viberBadData               = 3
+	viberMissingData           = 4
+	viberReceiverNotSubscribed = 6
+	viberTooManyRequests       = 12
+)
+
+// viberStatusMessages are the status_message of each status code
+var viberStatusMessages = map[int]string{
+	viberOK:                    "ok",
+	viberInvalidAuthToken:      "invalidAuthToken",
+	viberBadData:               "badData",
+	viberMissingData:           "missingData",
+	viberReceiverNotSubscribed: "receiverNotSubscribed",
+	viberTooManyRequests:       "tooManyRequests",
+}
+
+// viberMaxText is the longest text message Viber accepts
+const viberMaxText = 7000
+
+// ViberSender is the name and avatar a message is shown from
+type ViberSender struct {
+	Name   string `json:"name"`
+	Avatar string `json:"avatar,omitempty"`
+}
+
+// ViberContent is the content of a Viber message as sent: its type and
+// that type's fields. Rich media and keyboards are kept as sent.
+type ViberContent struct {
+	Type         string          `json:"type"`
+	Text         string          `json:"text,omitempty"`
+	Media        string          `json:"media,omitempty"`
+	Thumbnail    string          `json:"thumbnail,omitempty"`
+	FileName     string          `json:"file_name,omitempty"`
+	Size         int64           `json:"size,omitempty"`
+	Duration     int             `json:"duration,omitempty"`
+	StickerID    int             `json:"sticker_id,omitempty"`
+	Contact      *ViberContact   `json:"contact,omitempty"`
+	Location     *ViberLocation  `json:"location,omitempty"`
+	RichMedia    json.RawMessage `json:"rich_media,omitempty"`
+	Keyboard     json.RawMessage `json:"keyboard,omitempty"`
+	TrackingData string          `json:"tracking_data,omitempty"`
+}
+
+// ViberContact is the content of a contact message
+type ViberContact struct {
+	Name        string `json:"name"`
+	PhoneNumber string `json:"phone_number"`
+}
+
+// ViberLocation is the content of a location message
+type ViberLocation struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// ViberSendRequest represents a Viber REST API send_message request
+type ViberSendRequest struct {
+	Receiver      string      `json:"receiver"`
+	MinAPIVersion int         `json:"min_api_version,omitempty"`
+	Sender        ViberSender `json:"sender"`
+	ViberContent
+}
+
+// viberButton is the part of a rich media or keyboard button SMSpit reads
+type viberButton struct {
+	ActionType string `json:"ActionType"`
+	ActionBody string `json:"ActionBody"`
+	Text       string `json:"Text"`
+}
+
+// viberButtons reads the buttons of rich media or a keyboard
+func viberButtons(raw json.RawMessage) []viberButton {
+	var group struct {
+		Buttons []viberButton `json:"Buttons"`
+	}
+	json.Unmarshal(raw, &group)
+	return group.Buttons
+}
+
+// check returns the status code and message for content Viber would
+// refuse, or viberOK
+func (c ViberContent) check() (int, string) {
+	missing := func(field string) (int, string) {
+		return viberMissingData, fmt.Sprintf("%s is required for %s messages", field, c.Type)
+	}
+	switch c.Type {
+	case "text":
+		if c.Text == "" {
+			return missing("text")
+		}
+		if utf8.RuneCountInString(c.Text) > viberMaxText {
+			return viberBadData, fmt.Sprintf("text is longer than %d characters", viberMaxText)
+		}
+	case "picture", "video", "file", "url":
+		if c.Media == "" {
+			return missing("media")
+		}
+		if c.Type == "file" && c.FileName == "" {
+			return missing("file_name")
+		}
+	case "sticker":
+		if c.StickerID == 0 {
+			return missing("sticker_id")
+		}
+	case "contact":
+		if c.Contact == nil {
+			return missing("contact")
+		}
+	case "location":
+		if c.Location == nil {
+			return missing("location")
+		}
+	case "rich_media":
+		if len(viberButtons(c.RichMedia)) == 0 {
+			return missing("rich_media.Buttons")
+		}
+	case "":
+		return viberMissingData, "type is required"
+	default:
+		return viberBadData, "unknown message type " + c.Type
+	}
+	return viberOK, ""
+}
+
+// body renders c as the text a message body is searched and matched by:
+// the text (or a picture's caption), a file's name or URL, a contact, a
+// location or the button texts of rich media
+func (c ViberContent) body() string {
+	switch c.Type {
+	case "text", "picture":
+		return c.Text
+	case "video", "url":
+		return c.Media
+	case "file":
+		return c.FileName
+	case "sticker":
+		return "Sticker " + strconv.Itoa(c.StickerID)
+	case "contact":
+		return c.Contact.Name + " " + c.Contact.PhoneNumber
+	case "location":
+		return fmt.Sprintf("%g,%g", c.Location.Lat, c.Location.Lon)
+	case "rich_media":
+		var texts []string
+		for _, button := range viberButtons(c.RichMedia) {
+			if button.Text != "" {
+				texts = append(texts, button.Text)
+			}
+		}
+		return strings.Join(texts, "\n")
+	}
+	return ""
+}
+
+// handleViberSend handles Viber REST API send_message requests. Messages
+// are captured on the viber channel, with the content as sent in the viber
+// field. Receivers in SMSPIT_VIBER_UNREACHABLE get receiverNotSubscribed,
+// so apps can test falling back to SMS.
+func (s *Server) handleViberSend(w http.ResponseWriter, r *http.Request) {
+	if s.config.ViberAuthToken != "" && r.Header.Get("X-Viber-Auth-Token") != s.config.ViberAuthToken {
+		writeViberStatus(w, viberInvalidAuthToken, "")
+		return
+	}
+
+	var req ViberSendRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeViberStatus(w, viberBadData, "Invalid JSON: "+err.Error())
+		return
+	}
+	if req.Receiver == "" {
+		writeViberStatus(w, viberMissingData, "receiver is required")
+		return
+	}
+	if req.Sender.Name == "" {
+		writeViberStatus(w, viberMissingData, "sender.name is required")
+		return
+	}
+	if status, message := req.check(); status != viberOK {
+		writeViberStatus(w, status, message)
+		return
+	}
+	for _, receiver := range s.config.ViberUnreachable {
+		if receiver == req.Receiver {
+			log.Printf("📵 Viber receiver %s is unreachable", req.Receiver)
+			writeViberStatus(w, viberReceiverNotSubscribed, "")
+			return
+		}
+	}
+
+	token := rand.Int63() // Viber message tokens are 64-bit numbers
+	content := req.ViberContent
+	msg := Message{
+		ID:        strconv.FormatInt(token, 10),
+		To:        req.Receiver,
+		From:      req.Sender.Name,
+		Body:      content.body(),
+		Channel:   channelViber,
+		Viber:     &content,
+		Status:    "captured",
+		CreatedAt: time.Now(),
+		Project:   projectFromRequest(r),
+		Metadata:  metadataFromRequest(r),
+
+		Correlation: correlationFromRequest(r),
+	}
+
+	if err := s.captureMessage(&msg); err != nil {
+		writeCaptureError(w, r, err)
+		return
+	}
+
+	log.Printf("💬 Viber message captured: To=%s Type=%s Body=%s", msg.To, content.Type, truncate(msg.Body, 50))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":         viberOK,
+		"status_message": viberStatusMessages[viberOK],
+		"message_token":  token,
+		"chat_hostname":  "SN-CHAT-SMSPIT_",
+	})
+}
+
+// writeViberStatus writes a Viber REST API error, which like success is an
+// HTTP 200 with a non-zero status. details, when given, is added as
+// SMSpit's explanation.
+func writeViberStatus(w http.ResponseWriter, status int, details string) {
+	resp := map[string]interface{}{
+		"status":         status,
+		"status_message": viberStatusMessages[status],
+		"chat_hostname":  "SN-CHAT-SMSPIT_",
+	}
+	if details != "" {
+		resp["details"] = details
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
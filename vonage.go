@@ -0,0 +1,177 @@
+package smspit
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// VonageSMSRequest represents a Vonage (Nexmo) SMS API request
+type VonageSMSRequest struct {
+	APIKey    string `json:"api_key"`
+	APISecret string `json:"api_secret"`
+	To        string `json:"to"`
+	From      string `json:"from"`
+	Text      string `json:"text"`
+	ClientRef string `json:"client-ref,omitempty"`
+}
+
+// VonageMessagesRequest represents a Vonage Messages API (v1) request
+type VonageMessagesRequest struct {
+	MessageType string `json:"message_type"`
+	Channel     string `json:"channel"`
+	To          string `json:"to"`
+	From        string `json:"from"`
+	Text        string `json:"text"`
+	ClientRef   string `json:"client_ref,omitempty"`
+}
+
+// handleVonageSMS handles Vonage SMS API requests (form or JSON encoded)
+func (s *Server) handleVonageSMS(w http.ResponseWriter, r *http.Request) {
+	var req VonageSMSRequest
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeVonageSMSError(w, "2", "Invalid JSON: "+err.Error())
+			return
+		}
+	} else {
+		if err := r.ParseForm(); err != nil {
+			writeVonageSMSError(w, "2", "Invalid form data")
+			return
+		}
+		req = VonageSMSRequest{
+			APIKey:    r.FormValue("api_key"),
+			APISecret: r.FormValue("api_secret"),
+			To:        r.FormValue("to"),
+			From:      r.FormValue("from"),
+			Text:      r.FormValue("text"),
+			ClientRef: r.FormValue("client-ref"),
+		}
+	}
+
+	// Vonage reports validation errors with HTTP 200 and a non-zero status
+	if req.To == "" {
+		writeVonageSMSError(w, "2", "Missing to param")
+		return
+	}
+	if req.Text == "" {
+		writeVonageSMSError(w, "2", "Missing text param")
+		return
+	}
+
+	msg := Message{
+		ID:        strings.ToUpper(strings.ReplaceAll(uuid.New().String(), "-", "")[:18]), // Vonage-style ID
+		To:        req.To,
+		From:      req.From,
+		Body:      req.Text,
+		Status:    "captured",
+		CreatedAt: time.Now(),
+		Project:   projectFromRequest(r),
+		Metadata:  metadataFromRequest(r),
+
+		Correlation: correlationFromRequest(r),
+	}
+
+	if err := s.captureMessage(&msg); err != nil {
+		writeCaptureError(w, r, err)
+		return
+	}
+
+	log.Printf("📱 SMS captured (Vonage): To=%s Body=%s", msg.To, truncate(msg.Body, 50))
+
+	result := map[string]interface{}{
+		"to":                msg.To,
+		"message-id":        msg.ID,
+		"status":            "0",
+		"remaining-balance": "10.00000000",
+		"message-price":     "0.00000000",
+		"network":           "12345",
+	}
+	if req.ClientRef != "" {
+		result["client-ref"] = req.ClientRef
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message-count": "1",
+		"messages":      []interface{}{result},
+	})
+}
+
+// handleVonageMessages handles Vonage Messages API (v1) requests
+func (s *Server) handleVonageMessages(w http.ResponseWriter, r *http.Request) {
+	var req VonageMessagesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeVonageProblem(w, "Invalid JSON: "+err.Error())
+		return
+	}
+
+	if req.To == "" {
+		writeVonageProblem(w, "The value of `to` is required")
+		return
+	}
+	if req.Text == "" {
+		writeVonageProblem(w, "The value of `text` is required")
+		return
+	}
+	channel, ok := vonageChannel(req.Channel)
+	if !ok {
+		writeVonageProblem(w, "The value of `channel` is not supported: "+req.Channel)
+		return
+	}
+
+	msg := Message{
+		ID:        uuid.New().String(),
+		To:        req.To,
+		From:      req.From,
+		Body:      req.Text,
+		Channel:   channel,
+		Status:    "captured",
+		CreatedAt: time.Now(),
+		Project:   projectFromRequest(r),
+		Metadata:  metadataFromRequest(r),
+
+		Correlation: correlationFromRequest(r),
+	}
+
+	if err := s.captureMessage(&msg); err != nil {
+		writeCaptureError(w, r, err)
+		return
+	}
+
+	log.Printf("📱 Message captured (Vonage Messages): Channel=%s To=%s Body=%s", msg.Channel, msg.To, truncate(msg.Body, 50))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message_uuid": msg.ID,
+	})
+}
+
+// writeVonageSMSError writes a Vonage SMS API error response
+func writeVonageSMSError(w http.ResponseWriter, status, text string) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message-count": "1",
+		"messages": []map[string]string{{
+			"status":     status,
+			"error-text": text,
+		}},
+	})
+}
+
+// writeVonageProblem writes a Vonage Messages API RFC 7807 error response
+func writeVonageProblem(w http.ResponseWriter, detail string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(map[string]string{
+		"type":     "https://developer.vonage.com/api-errors/messages#1150",
+		"title":    "Invalid params",
+		"detail":   detail,
+		"instance": uuid.New().String(),
+	})
+}
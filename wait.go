@@ -0,0 +1,161 @@
+package smspit
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultWaitTimeout = 30 * time.Second
+	maxWaitTimeout     = 5 * time.Minute
+)
+
+// waitFilter selects the message a long-poll request is waiting for
+type waitFilter struct {
+	project  string
+	to       string
+	from     string
+	contains string
+	since    time.Time
+	terms    []queryTerm // meta:, request_id: and trace_id: terms
+	match    textMatching
+}
+
+func (f waitFilter) matches(msg Message) bool {
+	if msg.Project != f.project {
+		return false
+	}
+	if f.to != "" && !f.match.contains(msg.To, f.to) {
+		return false
+	}
+	if f.from != "" && !f.match.contains(msg.From, f.from) {
+		return false
+	}
+	if f.contains != "" && !f.match.contains(msg.text(), f.contains) {
+		return false
+	}
+	if !f.since.IsZero() && msg.CreatedAt.Before(f.since) {
+		return false
+	}
+	for _, t := range f.terms {
+		if !t.matches(msg, f.match) {
+			return false
+		}
+	}
+	return true
+}
+
+// handleWaitForMessage blocks until a message matching the to, from,
+// contains, meta, request_id and trace_id filters is captured, or responds
+// 408 once the timeout elapses. Messages already in the store match too
+// unless excluded with since.
+func (s *Server) handleWaitForMessage(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	timeout, err := parseWaitTimeout(q.Get("timeout"))
+	if err != nil {
+		http.Error(w, "Invalid timeout: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filter := waitFilter{
+		project:  projectFromRequest(r),
+		to:       q.Get("to"),
+		from:     q.Get("from"),
+		contains: q.Get("contains"),
+		match:    s.config.SearchMatching,
+	}
+	if v := q.Get("since"); v != "" {
+		since, err := parseSince(v)
+		if err != nil {
+			http.Error(w, "Invalid since: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		filter.since = since
+	}
+	for _, param := range []string{"meta", "request_id", "trace_id"} {
+		for _, v := range q[param] {
+			term, err := fieldTerm(param, v)
+			if err != nil {
+				http.Error(w, "Invalid filter: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			filter.terms = append(filter.terms, term)
+		}
+	}
+
+	// Subscribe before scanning the store so nothing slips through in between
+	events, unsubscribe := s.events.subscribe()
+	defer unsubscribe()
+
+	s.mu.RLock()
+	for _, msg := range s.messages {
+		if filter.matches(msg) {
+			s.mu.RUnlock()
+			writeWaitResult(w, msg)
+			return
+		}
+	}
+	s.mu.RUnlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case event := <-events:
+			if event.Data["type"] != "new_message" {
+				continue
+			}
+			if msg, ok := event.Data["message"].(Message); ok && filter.matches(msg) {
+				writeWaitResult(w, msg)
+				return
+			}
+		case <-timer.C:
+			http.Error(w, "Timed out waiting for message", http.StatusRequestTimeout)
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func writeWaitResult(w http.ResponseWriter, msg Message) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(msg)
+}
+
+// parseWaitTimeout accepts a Go duration ("30s") or a number of seconds ("30")
+func parseWaitTimeout(v string) (time.Duration, error) {
+	if v == "" {
+		return defaultWaitTimeout, nil
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		secs, convErr := strconv.Atoi(v)
+		if convErr != nil {
+			return 0, err
+		}
+		d = time.Duration(secs) * time.Second
+	}
+
+	if d > maxWaitTimeout {
+		d = maxWaitTimeout
+	}
+	return d, nil
+}
+
+// parseSince accepts an RFC 3339 timestamp or a duration meaning "that long ago"
+func parseSince(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Now().Add(-d), nil
+}
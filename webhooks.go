@@ -0,0 +1,364 @@
+package smspit
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// webhookMaxAttempts is how many times a forward is tried before giving up
+	webhookMaxAttempts = 5
+	// webhookBaseBackoff is the delay before the first retry; it doubles each time
+	webhookBaseBackoff = time.Second
+	// webhookSignatureHeader carries the hex HMAC-SHA256 of the body
+	webhookSignatureHeader = "X-SMSpit-Signature"
+)
+
+// webhookClient is used for forwarding captured messages
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// Webhook forwards captured messages to an external URL. Project limits it to
+// one project's messages; empty means every project. Tags and Numbers narrow
+// it further to messages with one of the tags or to or from one of the
+// numbers.
+type Webhook struct {
+	ID            string     `json:"id"`
+	URL           string     `json:"url"`
+	Format        string     `json:"format"` // json, or a notification: slack, discord, ntfy or pushover
+	Secret        string     `json:"-"`
+	Signed        bool       `json:"signed"`
+	Project       string     `json:"project,omitempty"`
+	Tags          []string   `json:"tags,omitempty"`
+	Numbers       []string   `json:"numbers,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	Deliveries    int        `json:"deliveries"`
+	Failures      int        `json:"failures"`
+	LastAttemptAt *time.Time `json:"last_attempt_at,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+}
+
+// WebhookRequest is the body for creating or updating a webhook
+type WebhookRequest struct {
+	URL     string   `json:"url"`
+	Format  string   `json:"format,omitempty"`
+	Secret  string   `json:"secret"`
+	Project string   `json:"project"`
+	Tags    []string `json:"tags,omitempty"`
+	Numbers []string `json:"numbers,omitempty"`
+}
+
+// MarshalJSON masks the credentials in the webhook's URL (see
+// maskedWebhookURL), since read tokens can list webhooks
+func (hook Webhook) MarshalJSON() ([]byte, error) {
+	type plain Webhook
+	masked := plain(hook)
+	masked.URL = maskedWebhookURL(hook.Format, hook.URL)
+	return json.Marshal(masked)
+}
+
+// webhookStore holds the configured webhooks
+type webhookStore struct {
+	mu    sync.RWMutex
+	hooks []*Webhook
+}
+
+// webhookPayload is the JSON body POSTed for each captured message
+type webhookPayload struct {
+	Event   string  `json:"event"`
+	Message Message `json:"message"`
+}
+
+// webhookSignature returns the hex HMAC-SHA256 of body keyed by secret
+func webhookSignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// forwardToWebhooks posts msg to every webhook that covers its project
+func (s *Server) forwardToWebhooks(msg Message) {
+	s.webhooks.mu.RLock()
+	defer s.webhooks.mu.RUnlock()
+
+	for _, hook := range s.webhooks.hooks {
+		if !hook.covers(msg) {
+			continue
+		}
+		go s.deliverWebhook(hook, msg)
+	}
+}
+
+// covers reports whether msg passes the webhook's project, tag and number
+// filters
+func (hook *Webhook) covers(msg Message) bool {
+	if hook.Project != "" && hook.Project != msg.Project {
+		return false
+	}
+	if len(hook.Tags) > 0 && !hasAnyTag(msg.Tags, hook.Tags) {
+		return false
+	}
+	if len(hook.Numbers) == 0 {
+		return true
+	}
+	for _, number := range hook.Numbers {
+		if digits := numberDigits(number); digits != "" && involvesNumber(msg, digits) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasAnyTag reports whether tags include one of want
+func hasAnyTag(tags, want []string) bool {
+	for _, tag := range tags {
+		for _, w := range want {
+			if strings.EqualFold(tag, w) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// deliverWebhook POSTs a message to one webhook, retrying failures and 5xx/429
+// responses with exponential backoff
+func (s *Server) deliverWebhook(hook *Webhook, msg Message) {
+	s.webhooks.mu.RLock()
+	target, secret, format := hook.URL, hook.Secret, hook.Format
+	s.webhooks.mu.RUnlock()
+
+	shown := maskedWebhookURL(format, target)
+	target, body := s.webhookRequest(format, target, msg)
+	ctx, span := s.startMessageSpan(msg, "smspit.webhook", trace.SpanKindClient,
+		attribute.String("smspit.webhook.id", hook.ID), attribute.String("server.address", targetHost(target)))
+
+	backoff := webhookBaseBackoff
+	var err error
+	for attempt := 1; attempt <= webhookMaxAttempts; attempt++ {
+		err = postWebhook(ctx, target, secret, body)
+		if err == nil {
+			break
+		}
+		if attempt < webhookMaxAttempts {
+			log.Printf("⚠️ Webhook failed (attempt %d/%d): URL=%s Error=%v", attempt, webhookMaxAttempts, shown, err)
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+
+	endSpan(span, err)
+
+	now := time.Now()
+	s.webhooks.mu.Lock()
+	hook.LastAttemptAt = &now
+	if err != nil {
+		hook.Failures++
+		hook.LastError = err.Error()
+	} else {
+		hook.Deliveries++
+		hook.LastError = ""
+	}
+	s.webhooks.mu.Unlock()
+
+	if err != nil {
+		log.Printf("❌ Webhook gave up: URL=%s MessageID=%s Error=%v", shown, msg.ID, err)
+		return
+	}
+	log.Printf("🔗 Webhook delivered: URL=%s MessageID=%s", shown, msg.ID)
+}
+
+// postWebhook makes a single delivery attempt, passing on ctx's trace
+func postWebhook(ctx context.Context, target, secret string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "SMSpit-Webhook/1.0")
+	if secret != "" {
+		req.Header.Set(webhookSignatureHeader, webhookSignature(secret, body))
+	}
+	injectTrace(ctx, req)
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	if resp.StatusCode >= 400 {
+		// Client errors won't succeed on retry; report them and stop
+		log.Printf("⚠️ Webhook rejected: Host=%s Status=%d", targetHost(target), resp.StatusCode)
+	}
+	return nil
+}
+
+// addWebhook registers a webhook and returns it
+func (s *Server) addWebhook(req WebhookRequest) *Webhook {
+	hook := &Webhook{
+		ID:        "wh_" + uuid.New().String()[:8],
+		URL:       req.URL,
+		Format:    req.Format,
+		Secret:    req.Secret,
+		Signed:    req.Secret != "",
+		Project:   req.Project,
+		Tags:      req.Tags,
+		Numbers:   req.Numbers,
+		CreatedAt: time.Now(),
+	}
+	if hook.Format == "" {
+		hook.Format = webhookFormatJSON
+	}
+
+	s.webhooks.mu.Lock()
+	s.webhooks.hooks = append(s.webhooks.hooks, hook)
+	s.webhooks.mu.Unlock()
+	s.syncRecords(kindWebhooks)
+	return hook
+}
+
+// decodeWebhookRequest parses and validates a webhook create/update body
+func decodeWebhookRequest(r *http.Request) (WebhookRequest, error) {
+	var req WebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return req, fmt.Errorf("Invalid JSON: %v", err)
+	}
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return req, fmt.Errorf("Invalid 'url' field (must be an http or https URL)")
+	}
+	if req.Project != "" && !validProjectName.MatchString(req.Project) {
+		return req, fmt.Errorf("Invalid project name")
+	}
+	switch req.Format {
+	case "", webhookFormatJSON, webhookFormatSlack, webhookFormatDiscord:
+	case webhookFormatNtfy, webhookFormatPushover:
+		if err := validateNotifyURL(req.Format, u); err != nil {
+			return req, err
+		}
+	default:
+		return req, fmt.Errorf("Invalid 'format' field (must be json, slack, discord, ntfy or pushover)")
+	}
+	return req, nil
+}
+
+// handleCreateWebhook registers a new webhook
+func (s *Server) handleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	req, err := decodeWebhookRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	hook := s.addWebhook(req)
+	log.Printf("🔗 Webhook added: ID=%s URL=%s", hook.ID, maskedWebhookURL(hook.Format, hook.URL))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(hook)
+}
+
+// handleListWebhooks lists all webhooks with their delivery counters
+func (s *Server) handleListWebhooks(w http.ResponseWriter, r *http.Request) {
+	s.webhooks.mu.RLock()
+	defer s.webhooks.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"webhooks": s.webhooks.hooks,
+		"total":    len(s.webhooks.hooks),
+	})
+}
+
+// handleGetWebhook returns a single webhook
+func (s *Server) handleGetWebhook(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	s.webhooks.mu.RLock()
+	defer s.webhooks.mu.RUnlock()
+
+	for _, hook := range s.webhooks.hooks {
+		if hook.ID == id {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(hook)
+			return
+		}
+	}
+
+	http.Error(w, "Webhook not found", http.StatusNotFound)
+}
+
+// handleUpdateWebhook replaces a webhook's URL, format, secret and filters
+func (s *Server) handleUpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	req, err := decodeWebhookRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	defer s.syncRecords(kindWebhooks)
+	s.webhooks.mu.Lock()
+	defer s.webhooks.mu.Unlock()
+
+	for _, hook := range s.webhooks.hooks {
+		if hook.ID == id {
+			hook.URL = req.URL
+			hook.Format = req.Format
+			if hook.Format == "" {
+				hook.Format = webhookFormatJSON
+			}
+			hook.Secret = req.Secret
+			hook.Signed = req.Secret != ""
+			hook.Project = req.Project
+			hook.Tags = req.Tags
+			hook.Numbers = req.Numbers
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(hook)
+			return
+		}
+	}
+
+	http.Error(w, "Webhook not found", http.StatusNotFound)
+}
+
+// handleDeleteWebhook removes a webhook
+func (s *Server) handleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	defer s.syncRecords(kindWebhooks)
+	s.webhooks.mu.Lock()
+	defer s.webhooks.mu.Unlock()
+
+	for i, hook := range s.webhooks.hooks {
+		if hook.ID == id {
+			s.webhooks.hooks = append(s.webhooks.hooks[:i], s.webhooks.hooks[i+1:]...)
+			log.Printf("🔗 Webhook removed: ID=%s", id)
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
+			return
+		}
+	}
+
+	http.Error(w, "Webhook not found", http.StatusNotFound)
+}
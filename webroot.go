@@ -0,0 +1,47 @@
+package smspit
+
+import (
+	"net/http"
+	"strings"
+)
+
+// normalizeWebRoot turns "smspit", "/smspit/" and the like into "/smspit",
+// or "" for the root
+func normalizeWebRoot(root string) string {
+	root = strings.Trim(root, "/")
+	if root == "" {
+		return ""
+	}
+	return "/" + root
+}
+
+// webRootHandler serves next under SMSPIT_WEBROOT, stripping the prefix so
+// the routers see their usual paths. The UI only uses relative URLs, so it
+// works under any prefix.
+func (s *Server) webRootHandler(next http.Handler) http.Handler {
+	root := s.config.WebRoot
+	if root == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == root {
+			target := root + "/"
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
+			return
+		}
+
+		path, ok := strings.CutPrefix(r.URL.Path, root+"/")
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		r2 := r.Clone(r.Context())
+		r2.URL.Path = "/" + path
+		r2.URL.RawPath = ""
+		next.ServeHTTP(w, r2)
+	})
+}
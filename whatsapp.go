@@ -0,0 +1,277 @@
+package smspit
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// whatsAppPath matches the Cloud API's send endpoint, /{version}/{phone
+// number ID}/messages
+var whatsAppPath = regexp.MustCompile(`^/v[0-9]+\.[0-9]+/[^/]+/messages$`)
+
+// whatsAppMediaTypes are the media message types, whose object is named
+// after the type
+var whatsAppMediaTypes = []string{"image", "audio", "video", "document", "sticker"}
+
+// WhatsAppMedia is the object of a media message
+type WhatsAppMedia struct {
+	ID       string `json:"id,omitempty"`
+	Link     string `json:"link,omitempty"`
+	Caption  string `json:"caption,omitempty"`
+	Filename string `json:"filename,omitempty"`
+}
+
+// WhatsAppTemplate is the object of a template message
+type WhatsAppTemplate struct {
+	Name     string `json:"name"`
+	Language struct {
+		Code string `json:"code"`
+	} `json:"language"`
+	Components []struct {
+		Type       string `json:"type"`
+		Parameters []struct {
+			Type          string `json:"type"`
+			ParameterName string `json:"parameter_name,omitempty"`
+			Text          string `json:"text,omitempty"`
+			Currency      *struct {
+				FallbackValue string `json:"fallback_value"`
+			} `json:"currency,omitempty"`
+			DateTime *struct {
+				FallbackValue string `json:"fallback_value"`
+			} `json:"date_time,omitempty"`
+		} `json:"parameters,omitempty"`
+	} `json:"components,omitempty"`
+}
+
+// WhatsAppRequest represents a WhatsApp Cloud API send request. Media
+// messages put a WhatsAppMedia under their type's name (image, document...).
+type WhatsAppRequest struct {
+	MessagingProduct string `json:"messaging_product"`
+	RecipientType    string `json:"recipient_type,omitempty"`
+	To               string `json:"to"`
+	Type             string `json:"type,omitempty"`
+	Text             *struct {
+		Body       string `json:"body"`
+		PreviewURL bool   `json:"preview_url,omitempty"`
+	} `json:"text,omitempty"`
+	Template *WhatsAppTemplate `json:"template,omitempty"`
+	Image    *WhatsAppMedia    `json:"image,omitempty"`
+	Audio    *WhatsAppMedia    `json:"audio,omitempty"`
+	Video    *WhatsAppMedia    `json:"video,omitempty"`
+	Document *WhatsAppMedia    `json:"document,omitempty"`
+	Sticker  *WhatsAppMedia    `json:"sticker,omitempty"`
+}
+
+// media returns the object of a media message of the given type
+func (req WhatsAppRequest) media(typ string) *WhatsAppMedia {
+	switch typ {
+	case "image":
+		return req.Image
+	case "audio":
+		return req.Audio
+	case "video":
+		return req.Video
+	case "document":
+		return req.Document
+	case "sticker":
+		return req.Sticker
+	}
+	return nil
+}
+
+// params returns the text of the template's parameters in order
+func (t WhatsAppTemplate) params() []string {
+	var params []string
+	for _, c := range t.Components {
+		for _, p := range c.Parameters {
+			switch {
+			case p.Text != "":
+				params = append(params, p.Text)
+			case p.Currency != nil:
+				params = append(params, p.Currency.FallbackValue)
+			case p.DateTime != nil:
+				params = append(params, p.DateTime.FallbackValue)
+			}
+		}
+	}
+	return params
+}
+
+// variables returns the template's parameters as variables for a SMSpit
+// template: named parameters by name, others as {{1}}, {{2}}...
+func (t WhatsAppTemplate) variables() map[string]string {
+	variables := make(map[string]string)
+	n := 0
+	for _, c := range t.Components {
+		for _, p := range c.Parameters {
+			value := p.Text
+			if p.Currency != nil {
+				value = p.Currency.FallbackValue
+			} else if p.DateTime != nil {
+				value = p.DateTime.FallbackValue
+			}
+			if p.ParameterName != "" {
+				variables[p.ParameterName] = value
+			} else {
+				n++
+				variables[strconv.Itoa(n)] = value
+			}
+		}
+	}
+	return variables
+}
+
+// body renders a template message as its name, language and parameters,
+// e.g. "verification_code (en_US): 123456", for templates SMSpit doesn't
+// have the text of
+func (t WhatsAppTemplate) body() string {
+	params := t.params()
+
+	body := t.Name
+	if t.Language.Code != "" {
+		body += " (" + t.Language.Code + ")"
+	}
+	if len(params) > 0 {
+		body += ": " + strings.Join(params, ", ")
+	}
+	return body
+}
+
+// handleWhatsAppSend handles WhatsApp Cloud API message sends: text,
+// template and media messages are captured with channel "whatsapp", sent
+// from the phone number ID in the path. Template messages naming a SMSpit
+// template are rendered from it.
+func (s *Server) handleWhatsAppSend(w http.ResponseWriter, r *http.Request) {
+	var req WhatsAppRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeWhatsAppError(w, http.StatusBadRequest, 100, "Invalid parameter", "Invalid JSON: "+err.Error())
+		return
+	}
+	if req.Type == "" {
+		req.Type = "text"
+	}
+
+	switch {
+	case req.MessagingProduct != channelWhatsApp:
+		writeWhatsAppError(w, http.StatusBadRequest, 100, "Invalid parameter", "messaging_product must be whatsapp")
+		return
+	case numberDigits(req.To) == "":
+		writeWhatsAppError(w, http.StatusBadRequest, 100, "Invalid parameter", "Parameter to is required")
+		return
+	}
+
+	var body, templateID string
+	var variables map[string]string
+	var media []MediaItem
+	switch req.Type {
+	case "text":
+		if req.Text == nil || req.Text.Body == "" {
+			writeWhatsAppError(w, http.StatusBadRequest, 100, "Invalid parameter", "Parameter text['body'] is required")
+			return
+		}
+		body = req.Text.Body
+	case "template":
+		if req.Template == nil || req.Template.Name == "" {
+			writeWhatsAppError(w, http.StatusBadRequest, 100, "Invalid parameter", "Parameter template['name'] is required")
+			return
+		}
+		body = req.Template.body()
+		if t, ok := s.template(projectFromRequest(r), req.Template.Name); ok {
+			variables = req.Template.variables()
+			rendered, err := t.render(variables)
+			if err != nil {
+				writeWhatsAppError(w, http.StatusBadRequest, 132000, "Number of parameters does not match the expected number of params", err.Error())
+				return
+			}
+			body, templateID = rendered, t.ID
+		}
+	default:
+		obj := req.media(req.Type)
+		if obj == nil {
+			writeWhatsAppError(w, http.StatusBadRequest, 100, "Invalid parameter",
+				fmt.Sprintf("Parameter type must be text, template or one of %s", strings.Join(whatsAppMediaTypes, ", ")))
+			return
+		}
+		if obj.Link == "" {
+			// Media uploaded with the Media API can't be fetched here
+			writeWhatsAppError(w, http.StatusBadRequest, 131009, "Parameter value is not valid",
+				fmt.Sprintf("Parameter %s['link'] is required; uploaded media IDs are not supported", req.Type))
+			return
+		}
+		item, err := fetchMedia(obj.Link)
+		if err != nil {
+			log.Printf("⚠️ Failed to fetch media %s: %v", obj.Link, err)
+			writeWhatsAppError(w, http.StatusBadRequest, 131053, "Media upload error", "Downloading media from "+obj.Link+" failed")
+			return
+		}
+		if obj.Filename != "" {
+			item.Filename = obj.Filename
+		}
+		media = []MediaItem{item}
+		body = obj.Caption
+	}
+
+	waID := numberDigits(req.To)
+	msg := Message{
+		ID:        "wamid." + base64.RawURLEncoding.EncodeToString([]byte(uuid.New().String()[:24])), // WhatsApp-style ID
+		To:        "+" + waID,
+		From:      mux.Vars(r)["phoneNumberId"],
+		Body:      body,
+		Channel:   channelWhatsApp,
+		Status:    "captured",
+		CreatedAt: time.Now(),
+		Project:   projectFromRequest(r),
+		Metadata:  metadataFromRequest(r),
+
+		Correlation:       correlationFromRequest(r),
+		TemplateID:        templateID,
+		TemplateVariables: variables,
+	}
+	s.attachMedia(&msg, media)
+
+	if err := s.captureMessage(&msg); err != nil {
+		writeCaptureError(w, r, err)
+		return
+	}
+
+	log.Printf("💬 WhatsApp message captured: To=%s Type=%s Body=%s", msg.To, req.Type, truncate(msg.Body, 50))
+
+	sent := map[string]interface{}{"id": msg.ID}
+	if req.Type == "template" {
+		sent["message_status"] = "accepted"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"messaging_product": channelWhatsApp,
+		"contacts":          []map[string]string{{"input": req.To, "wa_id": waID}},
+		"messages":          []interface{}{sent},
+	})
+}
+
+// writeWhatsAppError writes a Graph API error response
+func writeWhatsAppError(w http.ResponseWriter, status, code int, message, details string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{
+			"message": fmt.Sprintf("(#%d) %s", code, message),
+			"type":    "OAuthException",
+			"code":    code,
+			"error_data": map[string]string{
+				"messaging_product": channelWhatsApp,
+				"details":           details,
+			},
+			"fbtrace_id": strings.ReplaceAll(uuid.New().String(), "-", "")[:27],
+		},
+	})
+}